@@ -0,0 +1,174 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package anchor anchors digests (e.g., the hashes of ledger checkpoints) in external systems, and verifies the anchors later.
+
+An external system (a public chain, a timestamping authority, a partner domain, ...) is a Backend.
+Submit anchors a digest and returns a Receipt, Status tells whether the anchor is confirmed, and Verify checks the anchor
+and returns the time at which the digest is proved to have existed.
+
+Two backends are provided:
+
+  - FileBackend is a local stand-in, which records anchors signed with a KeyPair in a directory
+  - RFC3161Backend requests timestamp tokens (RFC 3161) from a TSA, and verifies them with the trusted root certificates
+
+AnchorCheckpoint anchors the hash of a ledger checkpoint, and VerifyExistence proves that a transaction existed at a point in time
+by its inclusion proof in the checkpoint and the anchor of the checkpoint.
+
+TimestampedTransaction keeps a transaction with RFC 3161 timestamp tokens over its TransactionID, which prove the creation time
+of the transaction directly. LocalTSA is an in-process TSA for development and testing.
+*/
+package anchor
+
+import (
+	"bbclib"
+	"bbclib/ledger"
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Status is the status of an anchor
+type Status int
+
+// Statuses of anchor
+const (
+	StatusPending Status = iota
+	StatusConfirmed
+	StatusFailed
+)
+
+var (
+	// ErrNotConfirmed is returned by Verify when the anchor is not confirmed yet
+	ErrNotConfirmed = errors.New("anchor is not confirmed yet")
+	// ErrInvalidAnchor is returned by Verify when the anchor does not prove the digest
+	ErrInvalidAnchor = errors.New("invalid anchor")
+)
+
+type (
+	// Backend is an external system in which digests are anchored
+	Backend interface {
+		// Name returns the name of the backend, which is recorded in receipts
+		Name() string
+		// Submit anchors the digest and returns the receipt
+		Submit(digest []byte) (*Receipt, error)
+		// Status returns the status of the anchor
+		Status(receipt *Receipt) (Status, error)
+		// Verify checks that the anchor proves the digest, and returns the time at which the digest existed
+		Verify(receipt *Receipt, digest []byte) (time.Time, error)
+	}
+
+	// Receipt is the evidence of an anchor, which should be kept with the anchored object
+	Receipt struct {
+		Backend     string `json:"backend"`
+		Digest      []byte `json:"digest"`
+		Reference   string `json:"reference"`       // identifier of the anchor in the backend
+		Token       []byte `json:"token,omitempty"` // proof given by the backend (e.g., RFC 3161 timestamp token)
+		SubmittedAt int64  `json:"submitted_at"`    // in microseconds
+	}
+)
+
+// String returns the name of the status
+func (s Status) String() string {
+	switch s {
+	case StatusPending:
+		return "pending"
+	case StatusConfirmed:
+		return "confirmed"
+	case StatusFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// checkReceipt checks that the receipt is for the backend and the digest
+func checkReceipt(backend Backend, receipt *Receipt, digest []byte) error {
+	if receipt == nil {
+		return errors.New("receipt must be given")
+	}
+	if receipt.Backend != backend.Name() {
+		return fmt.Errorf("%w: receipt of backend %q (not %q)", ErrInvalidAnchor, receipt.Backend, backend.Name())
+	}
+	if digest != nil && !bytes.Equal(receipt.Digest, digest) {
+		return fmt.Errorf("%w: receipt is for digest %x", ErrInvalidAnchor, receipt.Digest)
+	}
+	return nil
+}
+
+// nowMicro returns the current time in microseconds
+func nowMicro() int64 {
+	return time.Now().UnixNano() / int64(time.Microsecond)
+}
+
+// AnchorCheckpoint anchors the hash of the checkpoint in the backend
+func AnchorCheckpoint(backend Backend, checkpoint *ledger.Checkpoint) (*Receipt, error) {
+	if checkpoint == nil {
+		return nil, errors.New("checkpoint must be given")
+	}
+	digest, err := checkpoint.Hash()
+	if err != nil {
+		return nil, err
+	}
+	return backend.Submit(digest)
+}
+
+// VerifyCheckpoint verifies the signature of the checkpoint with the trusted domain public key
+// and its anchor, and returns the time at which the checkpoint existed
+func VerifyCheckpoint(checkpoint *ledger.Checkpoint, domainPublicKey []byte, backend Backend, receipt *Receipt) (time.Time, error) {
+	if checkpoint == nil {
+		return time.Time{}, errors.New("checkpoint must be given")
+	}
+	if err := checkpoint.Verify(domainPublicKey); err != nil {
+		return time.Time{}, err
+	}
+	digest, err := checkpoint.Hash()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return backend.Verify(receipt, digest)
+}
+
+// VerifyExistence proves that the transaction existed at the returned time, by the inclusion proof of the TransactionID
+// in the checkpoint and the anchor of the checkpoint
+func VerifyExistence(transactionID []byte, proof *ledger.Proof, checkpoint *ledger.Checkpoint, domainPublicKey []byte, backend Backend, receipt *Receipt) (time.Time, error) {
+	if proof == nil || !bytes.Equal(proof.TransactionID, transactionID) {
+		return time.Time{}, fmt.Errorf("%w: proof is not for transaction %x", ledger.ErrInvalidProof, transactionID)
+	}
+	if err := ledger.VerifyProof(proof, checkpoint, domainPublicKey); err != nil {
+		return time.Time{}, err
+	}
+	return VerifyCheckpoint(checkpoint, domainPublicKey, backend, receipt)
+}
+
+// VerifyTransactionExistence is VerifyExistence for the transaction object (its TransactionID and signatures are verified)
+// The transaction is not modified: the digest is calculated with a copy, since Digest and VerifyAll update TransactionID.
+func VerifyTransactionExistence(txobj *bbclib.BBcTransaction, proof *ledger.Proof, checkpoint *ledger.Checkpoint, domainPublicKey []byte, backend Backend, receipt *Receipt) (time.Time, error) {
+	if txobj == nil {
+		return time.Time{}, errors.New("transaction must be given")
+	}
+	transactionID := append([]byte{}, txobj.TransactionID...)
+	c := txobj.Clone()
+	digest := c.Digest()
+	if len(transactionID) != txobj.TransactionIdLength || len(digest) < len(transactionID) || !bytes.Equal(digest[:len(transactionID)], transactionID) {
+		return time.Time{}, errors.New("transaction_id does not match the content of the transaction")
+	}
+	if result, idx := c.VerifyAll(); !result {
+		return time.Time{}, fmt.Errorf("signatures[%d]: %w", idx, bbclib.ErrInvalidSignature)
+	}
+	return VerifyExistence(transactionID, proof, checkpoint, domainPublicKey, backend, receipt)
+}
@@ -0,0 +1,183 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package anchor
+
+import (
+	"bbclib"
+	"bbclib/ledger"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileBackend(t *testing.T) {
+	keypair, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	otherKey, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	dir, err := ioutil.TempDir("", "anchor_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	backend, err := NewFileBackend(dir, keypair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Delay = time.Minute
+	backend.now = func() time.Time { return now }
+	digest := sha256.Sum256([]byte("checkpoint"))
+
+	t.Run("pending and confirmed", func(t *testing.T) {
+		receipt, err := backend.Submit(digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, err := backend.Status(receipt); status != StatusPending || err != nil {
+			t.Fatalf("anchor must be pending: %v %v", status, err)
+		}
+		if _, err := backend.Verify(receipt, digest[:]); !errors.Is(err, ErrNotConfirmed) {
+			t.Fatalf("pending anchor must not be verified: %v", err)
+		}
+		anchoredAt := now
+		now = now.Add(time.Minute)
+		if status, err := backend.Status(receipt); status != StatusConfirmed || err != nil {
+			t.Fatalf("anchor must be confirmed: %v %v", status, err)
+		}
+		at, err := backend.Verify(receipt, digest[:])
+		if err != nil || !at.Equal(anchoredAt) {
+			t.Fatalf("anchor must be verified at %v: %v %v", anchoredAt, at, err)
+		}
+
+		again, err := backend.Submit(digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if at, err := backend.Verify(again, digest[:]); err != nil || !at.Equal(anchoredAt) {
+			t.Fatalf("anchor must be kept: %v %v", at, err)
+		}
+	})
+
+	t.Run("invalid receipts", func(t *testing.T) {
+		receipt, _ := backend.Submit(digest[:])
+		other := sha256.Sum256([]byte("other"))
+		if _, err := backend.Verify(receipt, other[:]); !errors.Is(err, ErrInvalidAnchor) {
+			t.Fatalf("receipt for another digest must be rejected: %v", err)
+		}
+		forged := *receipt
+		forged.Reference = "../" + receipt.Reference
+		if _, err := backend.Verify(&forged, digest[:]); !errors.Is(err, ErrInvalidAnchor) {
+			t.Fatalf("reference out of the directory must be rejected: %v", err)
+		}
+		forged = *receipt
+		forged.Backend = RFC3161BackendName
+		if _, err := backend.Verify(&forged, digest[:]); !errors.Is(err, ErrInvalidAnchor) {
+			t.Fatalf("receipt of another backend must be rejected: %v", err)
+		}
+
+		otherBackend, _ := NewFileBackend(dir, otherKey)
+		otherBackend.now = backend.now
+		if _, err := otherBackend.Verify(receipt, digest[:]); !errors.Is(err, ErrInvalidAnchor) {
+			t.Fatalf("record signed by another key must be rejected: %v", err)
+		}
+
+		path := filepath.Join(dir, receipt.Reference)
+		dat, _ := ioutil.ReadFile(path)
+		tampered := append([]byte{}, dat...)
+		tampered[len(tampered)-10] ^= 0x01
+		_ = ioutil.WriteFile(path, tampered, 0644)
+		if _, err := backend.Verify(receipt, digest[:]); !errors.Is(err, ErrInvalidAnchor) {
+			t.Fatalf("modified record must be rejected: %v", err)
+		}
+		var r fileRecord
+		_ = json.Unmarshal(dat, &r)
+		r.Signature = r.Signature[:3]
+		short, _ := json.Marshal(&r)
+		_ = ioutil.WriteFile(path, short, 0644)
+		forged = *receipt
+		forged.Token = short
+		if _, err := backend.Verify(&forged, digest[:]); !errors.Is(err, ErrInvalidAnchor) {
+			t.Fatalf("record with a short signature must be rejected: %v", err)
+		}
+		_ = ioutil.WriteFile(path, dat, 0644)
+	})
+
+	t.Run("transaction existence", func(t *testing.T) {
+		domainKey, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+		l, _ := ledger.New(bbclib.GetIdentifier("anchor_test_domain", 32), domainKey)
+		user := bbclib.GetIdentifier("user", 32)
+		group := bbclib.GetIdentifier("group", 32)
+		txobj, err := bbclib.NewTransactionBuilder(nil).SetTimestamp(now.UnixNano()/1000).
+			AddEvent(&group, func(e *bbclib.EventBuilder) { e.CreateAsset(&user, nil, "asset") }).
+			Sign(&user, keypair, false).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = l.AppendTransaction(txobj)
+		_, _ = l.Append(bbclib.GetIdentifier("other_tx", 32))
+		cp, _ := l.Checkpoint(0)
+		receipt, err := AnchorCheckpoint(backend, cp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, _, _ := l.Prove(txobj.TransactionID)
+		if _, err := VerifyTransactionExistence(txobj, proof, cp, domainKey.Pubkey, backend, receipt); !errors.Is(err, ErrNotConfirmed) {
+			t.Fatalf("existence must not be proved before confirmation: %v", err)
+		}
+		now = now.Add(time.Minute)
+		at, err := VerifyTransactionExistence(txobj, proof, cp, domainKey.Pubkey, backend, receipt)
+		if err != nil || !at.Equal(now.Add(-time.Minute)) {
+			t.Fatalf("existence must be proved at the anchor: %v %v", at, err)
+		}
+
+		if _, err := VerifyTransactionExistence(txobj, proof, cp, otherKey.Pubkey, backend, receipt); !errors.Is(err, bbclib.ErrInvalidSignature) {
+			t.Fatalf("checkpoint must be verified with the domain key: %v", err)
+		}
+		if _, err := VerifyCheckpoint(cp, nil, backend, receipt); err == nil {
+			t.Fatal("domain public key must be required")
+		}
+		otherProof, _, _ := l.Prove(bbclib.GetIdentifier("other_tx", 32))
+		if _, err := VerifyTransactionExistence(txobj, otherProof, cp, domainKey.Pubkey, backend, receipt); !errors.Is(err, ledger.ErrInvalidProof) {
+			t.Fatalf("proof of another transaction must be rejected: %v", err)
+		}
+		truncated := txobj.Clone()
+		truncated.TransactionID = truncated.TransactionID[:1]
+		shortLedger, _ := ledger.New(bbclib.GetIdentifier("anchor_test_domain", 32), domainKey)
+		_, _ = shortLedger.Append(truncated.TransactionID)
+		shortCp, _ := shortLedger.Checkpoint(0)
+		shortReceipt, _ := AnchorCheckpoint(backend, shortCp)
+		now = now.Add(time.Minute)
+		shortProof, _, _ := shortLedger.Prove(truncated.TransactionID)
+		if _, err := VerifyTransactionExistence(truncated, shortProof, shortCp, domainKey.Pubkey, backend, shortReceipt); err == nil || !strings.Contains(err.Error(), "does not match") {
+			t.Fatalf("truncated transaction_id must be rejected: %v", err)
+		}
+
+		txobj.Events[0].Asset.AssetBody = []byte("modified")
+		if _, err := VerifyTransactionExistence(txobj, proof, cp, domainKey.Pubkey, backend, receipt); err == nil || !strings.Contains(err.Error(), "does not match") {
+			t.Fatalf("modified transaction must be rejected: %v", err)
+		}
+		if !bytes.Equal(txobj.TransactionID, proof.TransactionID) {
+			t.Fatal("transaction_id must not be changed by the verification")
+		}
+	})
+}
@@ -0,0 +1,187 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package anchor
+
+import (
+	"bbclib"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileBackendName is the name of FileBackend in receipts
+const FileBackendName = "file"
+
+/*
+FileBackend definition
+
+FileBackend is a local stand-in of an external anchor system for development and testing.
+An anchor is a file "<digest in hex>.json" in the directory, which records the digest and the time of the anchor with the signature
+by the key pair of the backend (the stand-in of the external authority).
+The anchor is pending until "Delay" has passed since the submission, which simulates the confirmation of a public chain.
+The record is also returned in Receipt.Token, and Verify checks that the record in the directory is the same.
+*/
+type (
+	FileBackend struct {
+		mutex   sync.Mutex
+		dir     string
+		keypair *bbclib.KeyPair
+		Delay   time.Duration
+		now     func() time.Time
+	}
+
+	// fileRecord is the content of an anchor file
+	fileRecord struct {
+		Digest     []byte `json:"digest"`
+		AnchoredAt int64  `json:"anchored_at"` // in microseconds
+		PublicKey  []byte `json:"public_key"`
+		Signature  []byte `json:"signature"`
+	}
+)
+
+// NewFileBackend returns the file backend in the directory (created if not exist) with the key pair of the backend
+func NewFileBackend(dir string, keypair *bbclib.KeyPair) (*FileBackend, error) {
+	if keypair == nil || keypair.PrivateKeyStructure == nil {
+		return nil, errors.New("key pair with private key must be given")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileBackend{dir: dir, keypair: keypair, now: time.Now}, nil
+}
+
+// Name returns the name of the backend
+func (b *FileBackend) Name() string {
+	return FileBackendName
+}
+
+// recordDigest returns the digest signed in the record
+func (r *fileRecord) recordDigest() []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(r.AnchoredAt))
+	digest := sha256.Sum256(append(append([]byte{}, r.Digest...), buf...))
+	return digest[:]
+}
+
+// path returns the path of the anchor file of the digest
+func (b *FileBackend) path(digest []byte) string {
+	return filepath.Join(b.dir, hex.EncodeToString(digest)+".json")
+}
+
+// Submit records the anchor of the digest (the existing anchor is kept if the digest has already been anchored)
+func (b *FileBackend) Submit(digest []byte) (*Receipt, error) {
+	if len(digest) == 0 {
+		return nil, errors.New("digest must be given")
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	path := b.path(digest)
+	dat, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		r := fileRecord{
+			Digest:     append([]byte{}, digest...),
+			AnchoredAt: b.now().UnixNano() / int64(time.Microsecond),
+			PublicKey:  b.keypair.Pubkey,
+		}
+		if r.Signature = b.keypair.Sign(r.recordDigest()); r.Signature == nil {
+			return nil, errors.New("fail to sign the anchor")
+		}
+		if dat, err = json.Marshal(&r); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path, dat, 0644); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return &Receipt{
+		Backend:     FileBackendName,
+		Digest:      append([]byte{}, digest...),
+		Reference:   filepath.Base(path),
+		Token:       dat,
+		SubmittedAt: b.now().UnixNano() / int64(time.Microsecond),
+	}, nil
+}
+
+// read returns the record of the receipt in the directory
+func (b *FileBackend) read(receipt *Receipt) (*fileRecord, error) {
+	if filepath.Base(receipt.Reference) != receipt.Reference {
+		return nil, fmt.Errorf("%w: invalid reference %q", ErrInvalidAnchor, receipt.Reference)
+	}
+	dat, err := ioutil.ReadFile(filepath.Join(b.dir, receipt.Reference))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAnchor, err)
+	}
+	if receipt.Token != nil && !bytes.Equal(dat, receipt.Token) {
+		return nil, fmt.Errorf("%w: record differs from the receipt", ErrInvalidAnchor)
+	}
+	var r fileRecord
+	if err := json.Unmarshal(dat, &r); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAnchor, err)
+	}
+	return &r, nil
+}
+
+// Status returns StatusConfirmed if Delay has passed since the anchor, StatusPending if not, and StatusFailed if there is no valid record
+func (b *FileBackend) Status(receipt *Receipt) (Status, error) {
+	if err := checkReceipt(b, receipt, nil); err != nil {
+		return StatusFailed, err
+	}
+	r, err := b.read(receipt)
+	if err != nil {
+		return StatusFailed, err
+	}
+	if b.now().UnixNano()/int64(time.Microsecond) < r.AnchoredAt+int64(b.Delay/time.Microsecond) {
+		return StatusPending, nil
+	}
+	return StatusConfirmed, nil
+}
+
+// Verify checks the signed record of the anchor, and returns the time of the anchor
+func (b *FileBackend) Verify(receipt *Receipt, digest []byte) (time.Time, error) {
+	if err := checkReceipt(b, receipt, digest); err != nil {
+		return time.Time{}, err
+	}
+	status, err := b.Status(receipt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if status != StatusConfirmed {
+		return time.Time{}, ErrNotConfirmed
+	}
+	r, err := b.read(receipt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !bytes.Equal(r.Digest, digest) {
+		return time.Time{}, fmt.Errorf("%w: record is for digest %x", ErrInvalidAnchor, r.Digest)
+	}
+	if len(r.Signature) != 64 || !bytes.Equal(r.PublicKey, b.keypair.Pubkey) || !b.keypair.Verify(r.recordDigest(), r.Signature) {
+		return time.Time{}, fmt.Errorf("%w: signature of the record", ErrInvalidAnchor)
+	}
+	return time.Unix(0, r.AnchoredAt*int64(time.Microsecond)).UTC(), nil
+}
@@ -0,0 +1,584 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package anchor
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+const (
+	// RFC3161BackendName is the name of RFC3161Backend in receipts
+	RFC3161BackendName = "rfc3161"
+	// TimeStampQueryContentType is the content type of timestamp requests over HTTP (RFC 3161 section 3.4)
+	TimeStampQueryContentType = "application/timestamp-query"
+	// TimeStampReplyContentType is the content type of timestamp responses over HTTP (RFC 3161 section 3.4)
+	TimeStampReplyContentType = "application/timestamp-reply"
+
+	maxTimeStampResponseSize = 1 << 20
+)
+
+// ErrInvalidTimeStampToken is returned when a timestamp token is broken or does not prove the digest
+var ErrInvalidTimeStampToken = errors.New("invalid timestamp token")
+
+var (
+	oidContentTypeSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentTypeTSTInfo    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttributeContentType  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeDigest       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	// signing certificate attributes of ESS (RFC 2634 and RFC 5035)
+	oidAttributeSigningCertificate   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	oidAttributeSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidSignatureRSAPSS               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidHashSHA256                    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidHashSHA384                    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidHashSHA512                    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// PKIStatus values in timestamp responses (RFC 3161 section 2.4.2)
+const (
+	pkiStatusGranted         = 0
+	pkiStatusGrantedWithMods = 1
+	pkiStatusRejection       = 2
+)
+
+// ASN.1 structures of RFC 3161 and CMS (RFC 5652)
+type (
+	messageImprint struct {
+		HashAlgorithm pkix.AlgorithmIdentifier
+		HashedMessage []byte
+	}
+
+	timeStampReq struct {
+		Version        int
+		MessageImprint messageImprint
+		ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+		Nonce          *big.Int              `asn1:"optional"`
+		CertReq        bool                  `asn1:"optional"`
+		Extensions     []pkix.Extension      `asn1:"optional,tag:0"`
+	}
+
+	pkiStatusInfo struct {
+		Status       int
+		StatusString []string       `asn1:"optional"`
+		FailInfo     asn1.BitString `asn1:"optional"`
+	}
+
+	timeStampResp struct {
+		Status         pkiStatusInfo
+		TimeStampToken asn1.RawValue `asn1:"optional"`
+	}
+
+	contentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+
+	encapContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     []byte `asn1:"explicit,optional,tag:0"`
+	}
+
+	signedData struct {
+		Version          int
+		DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+		EncapContentInfo encapContentInfo
+		Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+		CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+		SignerInfos      []signerInfo  `asn1:"set"`
+	}
+
+	signerInfo struct {
+		Version            int
+		SID                asn1.RawValue
+		DigestAlgorithm    pkix.AlgorithmIdentifier
+		SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          []byte
+		UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+	}
+
+	issuerAndSerialNumber struct {
+		Issuer       asn1.RawValue
+		SerialNumber *big.Int
+	}
+
+	attribute struct {
+		Type   asn1.ObjectIdentifier
+		Values asn1.RawValue `asn1:"set"`
+	}
+
+	accuracy struct {
+		Seconds int `asn1:"optional"`
+		Millis  int `asn1:"optional,tag:0"`
+		Micros  int `asn1:"optional,tag:1"`
+	}
+
+	essCertID struct {
+		CertHash     []byte
+		IssuerSerial asn1.RawValue `asn1:"optional"`
+	}
+
+	essCertIDv2 struct {
+		HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+		CertHash      []byte
+		IssuerSerial  asn1.RawValue `asn1:"optional"`
+	}
+
+	signingCertificate struct {
+		Certs    []essCertID
+		Policies asn1.RawValue `asn1:"optional"`
+	}
+
+	signingCertificateV2 struct {
+		Certs    []essCertIDv2
+		Policies asn1.RawValue `asn1:"optional"`
+	}
+
+	tstInfo struct {
+		Version        int
+		Policy         asn1.ObjectIdentifier
+		MessageImprint messageImprint
+		SerialNumber   *big.Int
+		GenTime        time.Time        `asn1:"generalized"`
+		Accuracy       accuracy         `asn1:"optional"`
+		Ordering       bool             `asn1:"optional"`
+		Nonce          *big.Int         `asn1:"optional"`
+		TSA            asn1.RawValue    `asn1:"explicit,optional,tag:0"`
+		Extensions     []pkix.Extension `asn1:"optional,tag:1"`
+	}
+)
+
+// checkSigningCertificate checks that the signing certificate attribute (if any) identifies the certificate
+func checkSigningCertificate(attrs []attribute, cert *x509.Certificate) error {
+	for _, attr := range attrs {
+		var expected, actual []byte
+		switch {
+		case attr.Type.Equal(oidAttributeSigningCertificateV2):
+			var sc signingCertificateV2
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &sc); err != nil || len(sc.Certs) == 0 {
+				return fmt.Errorf("signing certificate attribute: %v", err)
+			}
+			hash := crypto.SHA256
+			if len(sc.Certs[0].HashAlgorithm.Algorithm) > 0 {
+				var err error
+				if hash, err = hashFromOID(sc.Certs[0].HashAlgorithm.Algorithm); err != nil {
+					return fmt.Errorf("signing certificate attribute: %v", err)
+				}
+			}
+			h := hash.New()
+			h.Write(cert.Raw)
+			expected, actual = sc.Certs[0].CertHash, h.Sum(nil)
+		case attr.Type.Equal(oidAttributeSigningCertificate):
+			var sc signingCertificate
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &sc); err != nil || len(sc.Certs) == 0 {
+				return fmt.Errorf("signing certificate attribute: %v", err)
+			}
+			digest := sha1.Sum(cert.Raw)
+			expected, actual = sc.Certs[0].CertHash, digest[:]
+		default:
+			continue
+		}
+		if !bytes.Equal(expected, actual) {
+			return errors.New("signing certificate attribute does not identify the certificate of the signer")
+		}
+	}
+	return nil
+}
+
+/*
+TimeStampToken definition
+
+TimeStampToken is a parsed RFC 3161 timestamp token, i.e., a CMS SignedData over TSTInfo.
+"HashedMessage" is the digest timestamped by the TSA at "GenTime" (± "Accuracy"), and "Certificates" are the certificates
+contained in the token. The fields are not trustworthy until VerifyTimeStampToken succeeds.
+*/
+type (
+	TimeStampToken struct {
+		Raw           []byte
+		Policy        asn1.ObjectIdentifier
+		HashAlgorithm crypto.Hash
+		HashedMessage []byte
+		SerialNumber  *big.Int
+		GenTime       time.Time
+		Accuracy      time.Duration
+		Nonce         *big.Int
+		Certificates  []*x509.Certificate
+		signed        signedData
+	}
+)
+
+// hashFromOID returns the hash function of the algorithm identifier
+func hashFromOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidHashSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidHashSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidHashSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported hash algorithm %v", oid)
+}
+
+// NewTimeStampRequest returns the DER encoded timestamp request (with certReq set) for the SHA-256 digest
+func NewTimeStampRequest(digest []byte, nonce *big.Int) ([]byte, error) {
+	if len(digest) != crypto.SHA256.Size() {
+		return nil, fmt.Errorf("digest must be %d bytes of SHA-256 (%d bytes given)", crypto.SHA256.Size(), len(digest))
+	}
+	req := timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidHashSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	}
+	return asn1.Marshal(req)
+}
+
+// ParseTimeStampResponse returns the timestamp token in the DER encoded timestamp response, or the error if the request is not granted
+func ParseTimeStampResponse(der []byte) ([]byte, error) {
+	var resp timeStampResp
+	rest, err := asn1.Unmarshal(der, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp response: %v", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("timestamp response: %d bytes of trailing data", len(rest))
+	}
+	if resp.Status.Status != pkiStatusGranted && resp.Status.Status != pkiStatusGrantedWithMods {
+		return nil, fmt.Errorf("timestamp request is not granted (status %d, failure info %x): %v",
+			resp.Status.Status, resp.Status.FailInfo.Bytes, resp.Status.StatusString)
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("timestamp response has no token")
+	}
+	return resp.TimeStampToken.FullBytes, nil
+}
+
+// ParseTimeStampToken parses the DER encoded timestamp token without verification
+func ParseTimeStampToken(der []byte) (*TimeStampToken, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: content info: %v", ErrInvalidTimeStampToken, err)
+	}
+	if !ci.ContentType.Equal(oidContentTypeSignedData) {
+		return nil, fmt.Errorf("%w: content type %v is not signed data", ErrInvalidTimeStampToken, ci.ContentType)
+	}
+	t := &TimeStampToken{Raw: append([]byte{}, der...)}
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &t.signed); err != nil {
+		return nil, fmt.Errorf("%w: signed data: %v", ErrInvalidTimeStampToken, err)
+	}
+	if !t.signed.EncapContentInfo.EContentType.Equal(oidContentTypeTSTInfo) {
+		return nil, fmt.Errorf("%w: content type %v is not TSTInfo", ErrInvalidTimeStampToken, t.signed.EncapContentInfo.EContentType)
+	}
+	var info tstInfo
+	if rest, err := asn1.Unmarshal(t.signed.EncapContentInfo.EContent, &info); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: TSTInfo: %v", ErrInvalidTimeStampToken, err)
+	}
+	hash, err := hashFromOID(info.MessageImprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("%w: message imprint: %v", ErrInvalidTimeStampToken, err)
+	}
+	if len(t.signed.Certificates.Bytes) > 0 {
+		if t.Certificates, err = x509.ParseCertificates(t.signed.Certificates.Bytes); err != nil {
+			return nil, fmt.Errorf("%w: certificates: %v", ErrInvalidTimeStampToken, err)
+		}
+	}
+	t.Policy = info.Policy
+	t.HashAlgorithm = hash
+	t.HashedMessage = info.MessageImprint.HashedMessage
+	t.SerialNumber = info.SerialNumber
+	t.GenTime = info.GenTime.UTC()
+	t.Accuracy = time.Duration(info.Accuracy.Seconds)*time.Second + time.Duration(info.Accuracy.Millis)*time.Millisecond +
+		time.Duration(info.Accuracy.Micros)*time.Microsecond
+	t.Nonce = info.Nonce
+	return t, nil
+}
+
+// signer returns the certificate of the signer identified by the signer info
+func (t *TimeStampToken) signer(si *signerInfo) (*x509.Certificate, error) {
+	for _, cert := range t.Certificates {
+		if si.SID.Class == asn1.ClassContextSpecific && si.SID.Tag == 0 {
+			if len(cert.SubjectKeyId) > 0 && bytes.Equal(cert.SubjectKeyId, si.SID.Bytes) {
+				return cert, nil
+			}
+			continue
+		}
+		var ias issuerAndSerialNumber
+		if _, err := asn1.Unmarshal(si.SID.FullBytes, &ias); err != nil {
+			return nil, fmt.Errorf("%w: signer identifier: %v", ErrInvalidTimeStampToken, err)
+		}
+		if bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: certificate of the signer is not in the token", ErrInvalidTimeStampToken)
+}
+
+// signatureAlgorithm returns the x509 signature algorithm of the signer info for the certificate
+func signatureAlgorithm(si *signerInfo, cert *x509.Certificate, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	pss := si.SignatureAlgorithm.Algorithm.Equal(oidSignatureRSAPSS)
+	algorithms := map[x509.PublicKeyAlgorithm]map[crypto.Hash]x509.SignatureAlgorithm{
+		x509.RSA:   {crypto.SHA256: x509.SHA256WithRSA, crypto.SHA384: x509.SHA384WithRSA, crypto.SHA512: x509.SHA512WithRSA},
+		x509.ECDSA: {crypto.SHA256: x509.ECDSAWithSHA256, crypto.SHA384: x509.ECDSAWithSHA384, crypto.SHA512: x509.ECDSAWithSHA512},
+	}
+	if pss {
+		algorithms[x509.RSA] = map[crypto.Hash]x509.SignatureAlgorithm{
+			crypto.SHA256: x509.SHA256WithRSAPSS, crypto.SHA384: x509.SHA384WithRSAPSS, crypto.SHA512: x509.SHA512WithRSAPSS,
+		}
+	}
+	if cert.PublicKeyAlgorithm == x509.Ed25519 {
+		return x509.PureEd25519, nil
+	}
+	if algo, ok := algorithms[cert.PublicKeyAlgorithm][hash]; ok {
+		return algo, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signature algorithm %v with %v", si.SignatureAlgorithm.Algorithm, cert.PublicKeyAlgorithm)
+}
+
+// verifySignature verifies the signed attributes and the signature of the token, and returns the certificate of the signer
+func (t *TimeStampToken) verifySignature() (*x509.Certificate, error) {
+	if len(t.signed.SignerInfos) != 1 {
+		return nil, fmt.Errorf("%w: %d signer infos (1 expected)", ErrInvalidTimeStampToken, len(t.signed.SignerInfos))
+	}
+	si := &t.signed.SignerInfos[0]
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return nil, fmt.Errorf("%w: no signed attributes", ErrInvalidTimeStampToken)
+	}
+	hash, err := hashFromOID(si.DigestAlgorithm.Algorithm)
+	if err != nil || !hash.Available() {
+		return nil, fmt.Errorf("%w: digest algorithm: %v", ErrInvalidTimeStampToken, err)
+	}
+
+	// the signature is made over the DER encoding of the signed attributes as SET OF (RFC 5652 section 5.4)
+	signed := append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+		return nil, fmt.Errorf("%w: signed attributes: %v", ErrInvalidTimeStampToken, err)
+	}
+	var contentType asn1.ObjectIdentifier
+	var messageDigest []byte
+	for _, attr := range attrs {
+		switch {
+		case attr.Type.Equal(oidAttributeContentType):
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &contentType); err != nil {
+				return nil, fmt.Errorf("%w: content type attribute: %v", ErrInvalidTimeStampToken, err)
+			}
+		case attr.Type.Equal(oidAttributeDigest):
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &messageDigest); err != nil {
+				return nil, fmt.Errorf("%w: message digest attribute: %v", ErrInvalidTimeStampToken, err)
+			}
+		}
+	}
+	if !contentType.Equal(oidContentTypeTSTInfo) {
+		return nil, fmt.Errorf("%w: content type attribute %v is not TSTInfo", ErrInvalidTimeStampToken, contentType)
+	}
+	h := hash.New()
+	h.Write(t.signed.EncapContentInfo.EContent)
+	if !bytes.Equal(messageDigest, h.Sum(nil)) {
+		return nil, fmt.Errorf("%w: message digest attribute does not match TSTInfo", ErrInvalidTimeStampToken)
+	}
+
+	cert, err := t.signer(si)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSigningCertificate(attrs, cert); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTimeStampToken, err)
+	}
+	algo, err := signatureAlgorithm(si, cert, hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTimeStampToken, err)
+	}
+	if err := cert.CheckSignature(algo, signed, si.Signature); err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidTimeStampToken, err)
+	}
+	return cert, nil
+}
+
+// isTimeStampingCertificate returns true if the certificate has the only extended key usage id-kp-timeStamping in the critical extension
+// (RFC 3161 section 2.3)
+func isTimeStampingCertificate(cert *x509.Certificate) bool {
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageTimeStamping || len(cert.UnknownExtKeyUsage) > 0 {
+		return false
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtensionExtKeyUsage) {
+			return ext.Critical
+		}
+	}
+	return false
+}
+
+// VerifyTimeStampToken verifies that the DER encoded timestamp token is a token over the SHA-256 digest signed by a TSA
+// certified by the roots (through the intermediates and the certificates in the token) at its genTime, and returns the parsed token.
+// The certificate of the TSA must be in the token, i.e., certReq must be set in the request.
+func VerifyTimeStampToken(der []byte, digest []byte, roots *x509.CertPool, intermediates []*x509.Certificate) (*TimeStampToken, error) {
+	if roots == nil {
+		return nil, errors.New("trusted root certificates must be given")
+	}
+	t, err := ParseTimeStampToken(der)
+	if err != nil {
+		return nil, err
+	}
+	if t.HashAlgorithm != crypto.SHA256 || !bytes.Equal(t.HashedMessage, digest) {
+		return nil, fmt.Errorf("%w: message imprint does not match the digest %x", ErrInvalidTimeStampToken, digest)
+	}
+	cert, err := t.verifySignature()
+	if err != nil {
+		return nil, err
+	}
+
+	if !isTimeStampingCertificate(cert) {
+		return nil, fmt.Errorf("%w: certificate of the signer is not for timestamping", ErrInvalidTimeStampToken)
+	}
+	pool := x509.NewCertPool()
+	for _, c := range append(append([]*x509.Certificate(nil), intermediates...), t.Certificates...) {
+		if c != cert {
+			pool.AddCert(c)
+		}
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: pool,
+		CurrentTime:   t.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		return nil, fmt.Errorf("%w: certificate of the signer: %v", ErrInvalidTimeStampToken, err)
+	}
+	return t, nil
+}
+
+/*
+RFC3161Backend definition
+
+RFC3161Backend anchors digests by the timestamp tokens (RFC 3161) issued by a TSA at "URL" over HTTP.
+The anchor is confirmed as soon as the token is issued, and the token in the receipt is verified with "Roots" (and "Intermediates").
+"Client" is http.DefaultClient if nil.
+*/
+type (
+	RFC3161Backend struct {
+		URL           string
+		Client        *http.Client
+		Roots         *x509.CertPool
+		Intermediates []*x509.Certificate
+	}
+)
+
+// NewRFC3161Backend returns the backend for the TSA at the URL, trusted by the roots
+func NewRFC3161Backend(url string, roots *x509.CertPool) *RFC3161Backend {
+	return &RFC3161Backend{URL: url, Roots: roots}
+}
+
+// Name returns the name of the backend
+func (b *RFC3161Backend) Name() string {
+	return RFC3161BackendName
+}
+
+// Request sends the timestamp request for the SHA-256 digest to the TSA, and returns the verified token
+func (b *RFC3161Backend) Request(digest []byte) (*TimeStampToken, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	req, err := NewTimeStampRequest(digest, nonce)
+	if err != nil {
+		return nil, err
+	}
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(b.URL, TimeStampQueryContentType, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("TSA responded %s", resp.Status)
+	}
+	dat, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTimeStampResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	der, err := ParseTimeStampResponse(dat)
+	if err != nil {
+		return nil, err
+	}
+	t, err := VerifyTimeStampToken(der, digest, b.Roots, b.Intermediates)
+	if err != nil {
+		return nil, err
+	}
+	if t.Nonce == nil || t.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("%w: nonce does not match the request", ErrInvalidTimeStampToken)
+	}
+	return t, nil
+}
+
+// Submit requests the timestamp token over the digest, and returns the receipt with the token
+func (b *RFC3161Backend) Submit(digest []byte) (*Receipt, error) {
+	t, err := b.Request(digest)
+	if err != nil {
+		return nil, err
+	}
+	return &Receipt{
+		Backend:     RFC3161BackendName,
+		Digest:      append([]byte{}, digest...),
+		Reference:   t.SerialNumber.Text(16),
+		Token:       t.Raw,
+		SubmittedAt: nowMicro(),
+	}, nil
+}
+
+// Status returns StatusConfirmed if the receipt has a valid token, and StatusFailed if not
+func (b *RFC3161Backend) Status(receipt *Receipt) (Status, error) {
+	if err := checkReceipt(b, receipt, nil); err != nil {
+		return StatusFailed, err
+	}
+	if _, err := VerifyTimeStampToken(receipt.Token, receipt.Digest, b.Roots, b.Intermediates); err != nil {
+		return StatusFailed, fmt.Errorf("%w: %v", ErrInvalidAnchor, err)
+	}
+	return StatusConfirmed, nil
+}
+
+// Verify verifies the token in the receipt over the digest, and returns its genTime
+func (b *RFC3161Backend) Verify(receipt *Receipt, digest []byte) (time.Time, error) {
+	if err := checkReceipt(b, receipt, digest); err != nil {
+		return time.Time{}, err
+	}
+	t, err := VerifyTimeStampToken(receipt.Token, digest, b.Roots, b.Intermediates)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrInvalidAnchor, err)
+	}
+	return t.GenTime, nil
+}
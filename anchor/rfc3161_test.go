@@ -0,0 +1,402 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package anchor
+
+import (
+	"bbclib"
+	"bbclib/ledger"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T, template, parent *x509.Certificate, pub, priv interface{}) *x509.Certificate {
+	cert, err := createCertificate(template, parent, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// newTestTSA returns a local TSA at a fixed time with a self-signed certificate which has the extended key usages
+// (the critical timestamping extension by default)
+func newTestTSA(t *testing.T, extKeyUsage ...x509.ExtKeyUsage) *LocalTSA {
+	notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test tsa"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  extKeyUsage,
+	}
+	if extKeyUsage == nil {
+		template.ExtraExtensions = []pkix.Extension{TimeStampingExtension()}
+	}
+	tsa := NewLocalTSAWithCertificate(newTestCertificate(t, template, template, &key.PublicKey, key), key, nil)
+	tsa.Now = func() time.Time { return time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC) }
+	return tsa
+}
+
+// asn1TSA assembles timestamp tokens by hand (independently of LocalTSA) with a TSA certificate under its own root certificate
+// (through an intermediate certificate if any)
+type asn1TSA struct {
+	t            *testing.T
+	root         *x509.Certificate
+	intermediate *x509.Certificate
+	cert         *x509.Certificate
+	key          *ecdsa.PrivateKey
+	genTime      time.Time
+	serial       int64
+}
+
+func newASN1TSA(t *testing.T, withIntermediate bool) *asn1TSA {
+	notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	a := &asn1TSA{t: t, root: newTestCertificate(t, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)}
+	issuer, issuerKey := a.root, rootKey
+	if withIntermediate {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(2),
+			Subject:               pkix.Name{CommonName: "test intermediate"},
+			NotBefore:             notBefore,
+			NotAfter:              notBefore.AddDate(10, 0, 0),
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		a.intermediate = newTestCertificate(t, template, a.root, &key.PublicKey, rootKey)
+		issuer, issuerKey = a.intermediate, key
+	}
+
+	a.key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(3),
+		Subject:         pkix.Name{CommonName: "test tsa"},
+		NotBefore:       notBefore,
+		NotAfter:        notBefore.AddDate(5, 0, 0),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{TimeStampingExtension()},
+	}
+	a.cert = newTestCertificate(t, template, issuer, &a.key.PublicKey, issuerKey)
+	a.genTime = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	return a
+}
+
+func (a *asn1TSA) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(a.root)
+	return pool
+}
+
+func (a *asn1TSA) marshal(val interface{}) []byte {
+	dat, err := asn1.Marshal(val)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return dat
+}
+
+// token returns the timestamp token over the SHA-256 digest (with the TSA certificate only)
+func (a *asn1TSA) token(digest []byte, nonce *big.Int) []byte {
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidHashSHA256, Parameters: asn1.NullRawValue}
+	a.serial++
+	info := a.marshal(tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: messageImprint{HashAlgorithm: sha256ID, HashedMessage: digest},
+		SerialNumber:   big.NewInt(a.serial),
+		GenTime:        a.genTime,
+		Accuracy:       accuracy{Seconds: 1},
+		Nonce:          nonce,
+	})
+	infoDigest := sha256.Sum256(info)
+
+	var attrs [][]byte
+	for _, attr := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{{oidAttributeContentType, oidContentTypeTSTInfo}, {oidAttributeDigest, infoDigest[:]}} {
+		value := asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: a.marshal(attr.value)}
+		attrs = append(attrs, a.marshal(attribute{Type: attr.oid, Values: value}))
+	}
+	sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+	signedAttrs := bytes.Join(attrs, nil)
+	signedDigest := sha256.Sum256(a.marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: signedAttrs}))
+	sig, err := a.key.Sign(rand.Reader, signedDigest[:], crypto.SHA256)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	sid := a.marshal(issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: a.cert.RawIssuer}, SerialNumber: a.cert.SerialNumber})
+	sd := a.marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+		EncapContentInfo: encapContentInfo{EContentType: oidContentTypeTSTInfo, EContent: info},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: a.cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha256ID,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedAttrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA256},
+			Signature:          sig,
+		}},
+	})
+	return a.marshal(contentInfo{
+		ContentType: oidContentTypeSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
+
+func TestTimeStampTokenFixtures(t *testing.T) {
+	digest := sha256.Sum256([]byte("checkpoint"))
+
+	t.Run("hand-assembled token", func(t *testing.T) {
+		tsa := newASN1TSA(t, false)
+		der := tsa.token(digest[:], big.NewInt(7))
+		token, err := VerifyTimeStampToken(der, digest[:], tsa.roots(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !token.GenTime.Equal(tsa.genTime) || token.Nonce.Int64() != 7 || token.Accuracy != time.Second || len(token.Certificates) != 1 {
+			t.Fatalf("unexpected token: %+v", token)
+		}
+		if _, err := VerifyTimeStampToken(der, digest[:], newASN1TSA(t, false).roots(), nil); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("token must be verified with the trusted roots: %v", err)
+		}
+		for i := len(der) - 40; i < len(der); i += 8 {
+			tampered := append([]byte{}, der...)
+			tampered[i] ^= 0x01
+			if _, err := VerifyTimeStampToken(tampered, digest[:], tsa.roots(), nil); err == nil {
+				t.Fatalf("tampered token (byte %d) must be rejected", i)
+			}
+		}
+		tsa.genTime = tsa.cert.NotAfter.Add(time.Hour)
+		if _, err := VerifyTimeStampToken(tsa.token(digest[:], nil), digest[:], tsa.roots(), nil); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("token out of the validity of the certificate must be rejected: %v", err)
+		}
+	})
+
+	t.Run("intermediate chain", func(t *testing.T) {
+		tsa := newASN1TSA(t, true)
+		der := tsa.token(digest[:], nil)
+		if _, err := VerifyTimeStampToken(der, digest[:], tsa.roots(), []*x509.Certificate{tsa.intermediate}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := VerifyTimeStampToken(der, digest[:], tsa.roots(), nil); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("token must not be verified without the intermediate certificate: %v", err)
+		}
+
+		// the spare capacity of the given slice must not be overwritten
+		intermediates := make([]*x509.Certificate, 1, 4)
+		intermediates[0] = tsa.intermediate
+		if _, err := VerifyTimeStampToken(der, digest[:], tsa.roots(), intermediates); err != nil {
+			t.Fatal(err)
+		}
+		if spare := intermediates[:2][1]; spare != nil {
+			t.Fatal("intermediates of the caller must not be modified")
+		}
+	})
+
+	t.Run("token issued by openssl", func(t *testing.T) {
+		dir := filepath.Join("testdata", "openssl")
+		der, err := ioutil.ReadFile(filepath.Join(dir, "token.der"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dat, err := ioutil.ReadFile(filepath.Join(dir, "root.pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := pem.Decode(dat)
+		if block == nil {
+			t.Fatal("root.pem has no certificate")
+		}
+		root, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots := x509.NewCertPool()
+		roots.AddCert(root)
+
+		token, err := VerifyTimeStampToken(der, digest[:], roots, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !token.GenTime.Equal(time.Date(2026, 10, 18, 17, 3, 32, 0, time.UTC)) || token.Accuracy != time.Second ||
+			!token.Policy.Equal(asn1.ObjectIdentifier{1, 2, 3, 4, 1}) || token.Nonce == nil || len(token.Certificates) != 1 {
+			t.Fatalf("unexpected token: %+v", token)
+		}
+		other := sha256.Sum256([]byte("other"))
+		if _, err := VerifyTimeStampToken(der, other[:], roots, nil); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("token must not prove another digest: %v", err)
+		}
+		if _, err := VerifyTimeStampToken(der, digest[:], newASN1TSA(t, false).roots(), nil); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("token must be verified with the trusted roots: %v", err)
+		}
+	})
+}
+
+func TestRFC3161Backend(t *testing.T) {
+	tsa, err := NewLocalTSA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genTime := time.Now().UTC().Truncate(time.Second)
+	tsa.Now = func() time.Time { return genTime }
+	server := httptest.NewServer(tsa)
+	defer server.Close()
+	backend := NewRFC3161Backend(server.URL, tsa.Roots())
+	digest := sha256.Sum256([]byte("checkpoint"))
+
+	t.Run("submit and verify", func(t *testing.T) {
+		receipt, err := backend.Submit(digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, err := backend.Status(receipt); status != StatusConfirmed || err != nil {
+			t.Fatalf("token must be confirmed: %v %v", status, err)
+		}
+		at, err := backend.Verify(receipt, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !at.Equal(genTime) {
+			t.Fatalf("unexpected time %v", at)
+		}
+		other := sha256.Sum256([]byte("other"))
+		if _, err := backend.Verify(receipt, other[:]); !errors.Is(err, ErrInvalidAnchor) {
+			t.Fatalf("token must not prove another digest: %v", err)
+		}
+		receipt.Digest = other[:]
+		if _, err := backend.Verify(receipt, other[:]); !errors.Is(err, ErrInvalidAnchor) {
+			t.Fatalf("token must not prove another digest: %v", err)
+		}
+	})
+
+	t.Run("token", func(t *testing.T) {
+		der, err := tsa.Issue(digest[:], big.NewInt(7))
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := VerifyTimeStampToken(der, digest[:], tsa.Roots(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Nonce.Int64() != 7 || token.Accuracy != time.Second || token.HashAlgorithm != crypto.SHA256 || len(token.Certificates) != 1 {
+			t.Fatalf("unexpected token: %+v", token)
+		}
+
+		if _, err := VerifyTimeStampToken(der, digest[:], newTestTSA(t).Roots(), nil); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("token must be verified with the trusted roots: %v", err)
+		}
+		for i := len(der) - 40; i < len(der); i += 8 {
+			tampered := append([]byte{}, der...)
+			tampered[i] ^= 0x01
+			if _, err := VerifyTimeStampToken(tampered, digest[:], tsa.Roots(), nil); err == nil {
+				t.Fatalf("tampered token (byte %d) must be rejected", i)
+			}
+		}
+		if _, err := VerifyTimeStampToken(der, digest[:], nil, nil); err == nil {
+			t.Fatal("roots must be required")
+		}
+
+		// the TSA certificate itself can be trusted
+		selfSigned := newTestTSA(t)
+		der, _ = selfSigned.Issue(digest[:], nil)
+		if _, err := VerifyTimeStampToken(der, digest[:], selfSigned.Roots(), nil); err != nil {
+			t.Fatal(err)
+		}
+		selfSigned.Now = func() time.Time { return selfSigned.Certificate.NotAfter.Add(time.Hour) }
+		der, _ = selfSigned.Issue(digest[:], nil)
+		if _, err := VerifyTimeStampToken(der, digest[:], selfSigned.Roots(), nil); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("token out of the validity of the certificate must be rejected: %v", err)
+		}
+		notTSA := newTestTSA(t, x509.ExtKeyUsageServerAuth)
+		der, _ = notTSA.Issue(digest[:], nil)
+		if _, err := VerifyTimeStampToken(der, digest[:], notTSA.Roots(), nil); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("certificate not for timestamping must be rejected: %v", err)
+		}
+		nonCritical := newTestTSA(t, x509.ExtKeyUsageTimeStamping)
+		der, _ = nonCritical.Issue(digest[:], nil)
+		if _, err := VerifyTimeStampToken(der, digest[:], nonCritical.Roots(), nil); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("extended key usage must be critical: %v", err)
+		}
+	})
+
+	t.Run("request", func(t *testing.T) {
+		if _, err := backend.Submit([]byte("short")); err == nil {
+			t.Fatal("digest other than SHA-256 must be rejected")
+		}
+		rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(rejection(failureBadAlg, "rejected"))
+		}))
+		defer rejecting.Close()
+		if _, err := NewRFC3161Backend(rejecting.URL, tsa.Roots()).Submit(digest[:]); err == nil {
+			t.Fatal("rejected request must fail")
+		}
+		untrusted := NewRFC3161Backend(server.URL, newTestTSA(t).Roots())
+		if _, err := untrusted.Submit(digest[:]); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("token from untrusted TSA must be rejected: %v", err)
+		}
+	})
+
+	t.Run("existence", func(t *testing.T) {
+		keypair, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+		l, _ := ledger.New(bbclib.GetIdentifier("anchor_test_domain", 32), keypair)
+		txid := bbclib.GetIdentifier("tx", 32)
+		_, _ = l.Append(txid, bbclib.GetIdentifier("tx2", 32))
+		cp, _ := l.Checkpoint(0)
+		receipt, err := AnchorCheckpoint(backend, cp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, _, _ := l.Prove(txid)
+		at, err := VerifyExistence(txid, proof, cp, keypair.Pubkey, backend, receipt)
+		if err != nil || !at.Equal(genTime) {
+			t.Fatalf("existence must be proved at genTime: %v %v", at, err)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+#!/bin/sh
+# Copyright (c) 2020 Zettant Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Generate the timestamp token issued by the TSA of OpenSSL (openssl ts) over SHA-256("checkpoint").
+# The private keys are made in a temporary directory and discarded, so that only root.pem and token.der remain.
+#
+# Usage: sh generate.sh (in this directory)
+
+set -e
+work=$(mktemp -d)
+trap 'rm -rf "$work"' EXIT
+
+cat > "$work/tsa.cnf" <<CNF
+[ tsa ]
+default_tsa = tsa_config
+
+[ tsa_config ]
+serial = $work/serial
+signer_digest = sha256
+default_policy = 1.2.3.4.1
+digests = sha256
+accuracy = secs:1
+ordering = no
+tsa_name = no
+ess_cert_id_chain = no
+ess_cert_id_alg = sha256
+
+[ tsa_cert ]
+basicConstraints = critical, CA:FALSE
+keyUsage = critical, digitalSignature
+extendedKeyUsage = critical, timeStamping
+
+[ root_cert ]
+basicConstraints = critical, CA:TRUE
+keyUsage = critical, keyCertSign
+CNF
+echo 01 > "$work/serial"
+
+openssl ecparam -name prime256v1 -genkey -noout -out "$work/root.key"
+openssl req -new -x509 -key "$work/root.key" -subj "/CN=bbclib-go test root (openssl)" -days 7300 \
+	-config "$work/tsa.cnf" -extensions root_cert -out root.pem
+openssl ecparam -name prime256v1 -genkey -noout -out "$work/tsa.key"
+openssl req -new -key "$work/tsa.key" -subj "/CN=bbclib-go test TSA (openssl)" -out "$work/tsa.csr"
+openssl x509 -req -in "$work/tsa.csr" -CA root.pem -CAkey "$work/root.key" -set_serial 2 -days 7300 \
+	-extfile "$work/tsa.cnf" -extensions tsa_cert -out "$work/tsa.pem"
+
+printf checkpoint > "$work/data"
+openssl ts -query -data "$work/data" -sha256 -cert -out "$work/request.tsq"
+openssl ts -reply -config "$work/tsa.cnf" -queryfile "$work/request.tsq" -inkey "$work/tsa.key" -signer "$work/tsa.pem" \
+	-token_out -out token.der
+openssl ts -verify -data "$work/data" -in token.der -token_in -CAfile root.pem
@@ -0,0 +1,207 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package anchor
+
+import (
+	"bbclib"
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// ErrNoTimeStamp is returned by TimestampedTransaction.Verify when the transaction has no timestamp token
+var ErrNoTimeStamp = errors.New("no timestamp token")
+
+// TransactionDigest returns the SHA-256 digest of the transaction from which its TransactionID is taken, which is timestamped
+// for the transaction (the digest is the TransactionID itself when TransactionIdLength is 32)
+// The digest is calculated with a copy, so that the TransactionID of the transaction is not updated by Digest.
+func TransactionDigest(txobj *bbclib.BBcTransaction) ([]byte, error) {
+	if txobj == nil {
+		return nil, errors.New("transaction must be given")
+	}
+	transactionID := append([]byte{}, txobj.TransactionID...)
+	digest := txobj.Clone().Digest()
+	if digest == nil {
+		return nil, errors.New("fail to calculate the digest of the transaction")
+	}
+	if len(transactionID) == 0 || len(digest) < len(transactionID) || !bytes.Equal(digest[:len(transactionID)], transactionID) {
+		return nil, errors.New("transaction_id does not match the content of the transaction")
+	}
+	return digest, nil
+}
+
+// NewTransactionTimeStampRequest returns the DER encoded timestamp request over the TransactionID of the transaction
+func NewTransactionTimeStampRequest(txobj *bbclib.BBcTransaction, nonce *big.Int) ([]byte, error) {
+	digest, err := TransactionDigest(txobj)
+	if err != nil {
+		return nil, err
+	}
+	return NewTimeStampRequest(digest, nonce)
+}
+
+/*
+TimestampedTransaction definition
+
+TimestampedTransaction keeps a transaction with the timestamp tokens (RFC 3161) over its TransactionID, which prove the time
+of the creation of the transaction instead of the self-declared BBcTransaction.Timestamp.
+The tokens stay valid when signatures are added to the transaction, because TransactionID does not cover the signatures.
+
+The packed data is in little endian:
+
+	transaction_len (4) | serialized transaction (transaction_len bytes) | token_num (2) | (token_len (4) | token (token_len bytes)) * token_num
+*/
+type (
+	TimestampedTransaction struct {
+		Transaction *bbclib.BBcTransaction
+		Tokens      [][]byte
+	}
+)
+
+// AddToken adds the DER encoded timestamp token after checking that it is over the TransactionID (the token is not verified here)
+func (p *TimestampedTransaction) AddToken(der []byte) error {
+	digest, err := TransactionDigest(p.Transaction)
+	if err != nil {
+		return err
+	}
+	t, err := ParseTimeStampToken(der)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(t.HashedMessage, digest) {
+		return fmt.Errorf("%w: token is not over transaction %x", ErrInvalidTimeStampToken, p.Transaction.TransactionID)
+	}
+	p.Tokens = append(p.Tokens, append([]byte{}, der...))
+	return nil
+}
+
+// Timestamp requests the timestamp token over the TransactionID to the TSA of the backend, and adds the verified token
+func (p *TimestampedTransaction) Timestamp(backend *RFC3161Backend) (*TimeStampToken, error) {
+	digest, err := TransactionDigest(p.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	t, err := backend.Request(digest)
+	if err != nil {
+		return nil, err
+	}
+	p.Tokens = append(p.Tokens, t.Raw)
+	return t, nil
+}
+
+// Verify verifies all tokens over the TransactionID with the trusted roots (and the intermediates), and returns the earliest genTime
+func (p *TimestampedTransaction) Verify(roots *x509.CertPool, intermediates []*x509.Certificate) (time.Time, error) {
+	digest, err := TransactionDigest(p.Transaction)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(p.Tokens) == 0 {
+		return time.Time{}, ErrNoTimeStamp
+	}
+	var earliest time.Time
+	for i, der := range p.Tokens {
+		t, err := VerifyTimeStampToken(der, digest, roots, intermediates)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("tokens[%d]: %w", i, err)
+		}
+		if i == 0 || t.GenTime.Before(earliest) {
+			earliest = t.GenTime
+		}
+	}
+	return earliest, nil
+}
+
+// Pack returns the binary data of the transaction and the tokens
+func (p *TimestampedTransaction) Pack() ([]byte, error) {
+	if p.Transaction == nil {
+		return nil, errors.New("transaction must be given")
+	}
+	dat, err := bbclib.Serialize(p.Transaction, bbclib.FormatPlain)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err := bbclib.Put4byte(buf, uint32(len(dat))); err != nil {
+		return nil, err
+	}
+	buf.Write(dat)
+	if err := bbclib.Put2byte(buf, uint16(len(p.Tokens))); err != nil {
+		return nil, err
+	}
+	for _, token := range p.Tokens {
+		if err := bbclib.Put4byte(buf, uint32(len(token))); err != nil {
+			return nil, err
+		}
+		buf.Write(token)
+	}
+	return buf.Bytes(), nil
+}
+
+// Unpack the binary data to the transaction and the tokens
+func (p *TimestampedTransaction) Unpack(dat []byte) error {
+	buf := bytes.NewBuffer(dat)
+	txLen, err := bbclib.Get4byte(buf)
+	if err != nil {
+		return fmt.Errorf("timestamped transaction: transaction_len: %w", err)
+	}
+	if int(txLen) > buf.Len() {
+		return fmt.Errorf("timestamped transaction: transaction: %d bytes required but %d bytes left", txLen, buf.Len())
+	}
+	txdat, _, err := bbclib.GetBytes(buf, int(txLen))
+	if err != nil {
+		return fmt.Errorf("timestamped transaction: transaction: %w", err)
+	}
+	txobj, err := bbclib.Deserialize(txdat)
+	if err != nil {
+		return fmt.Errorf("timestamped transaction: transaction: %w", err)
+	}
+	num, err := bbclib.Get2byte(buf)
+	if err != nil {
+		return fmt.Errorf("timestamped transaction: token_num: %w", err)
+	}
+	tokens := make([][]byte, 0, num)
+	for i := 0; i < int(num); i++ {
+		tokenLen, err := bbclib.Get4byte(buf)
+		if err != nil {
+			return fmt.Errorf("timestamped transaction: tokens[%d]: %w", i, err)
+		}
+		if int(tokenLen) > buf.Len() {
+			return fmt.Errorf("timestamped transaction: tokens[%d]: %d bytes required but %d bytes left", i, tokenLen, buf.Len())
+		}
+		token, _, err := bbclib.GetBytes(buf, int(tokenLen))
+		if err != nil {
+			return fmt.Errorf("timestamped transaction: tokens[%d]: %w", i, err)
+		}
+		tokens = append(tokens, token)
+	}
+	if buf.Len() > 0 {
+		return fmt.Errorf("timestamped transaction: %d bytes of trailing data", buf.Len())
+	}
+	p.Transaction, p.Tokens = txobj, tokens
+	return nil
+}
+
+// UnpackTimestampedTransaction returns the timestamped transaction in the binary data
+func UnpackTimestampedTransaction(dat []byte) (*TimestampedTransaction, error) {
+	p := &TimestampedTransaction{}
+	if err := p.Unpack(dat); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
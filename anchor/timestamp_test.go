@@ -0,0 +1,171 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package anchor
+
+import (
+	"bbclib"
+	"bytes"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimestampedTransaction(t *testing.T) {
+	tsa, err := NewLocalTSA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(tsa)
+	defer server.Close()
+	backend := NewRFC3161Backend(server.URL, tsa.Roots())
+
+	keypair, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	user := bbclib.GetIdentifier("user", 32)
+	group := bbclib.GetIdentifier("group", 32)
+	makeTransaction := func(idLength int, body string) *bbclib.BBcTransaction {
+		profile, _ := bbclib.NewIdLengthProfile(&bbclib.BBcIdConfig{TransactionIdLength: idLength})
+		txobj, err := bbclib.NewTransactionBuilder(profile).SetTimestamp(1).
+			AddEvent(&group, func(e *bbclib.EventBuilder) { e.CreateAsset(&user, nil, body) }).
+			Sign(&user, keypair, false).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return txobj
+	}
+
+	t.Run("timestamp and verify", func(t *testing.T) {
+		for _, idLength := range []int{32, 8} {
+			txobj := makeTransaction(idLength, "asset")
+			stamped := &TimestampedTransaction{Transaction: txobj}
+			if _, err := stamped.Verify(tsa.Roots(), nil); !errors.Is(err, ErrNoTimeStamp) {
+				t.Fatalf("transaction without token must not be verified: %v", err)
+			}
+			early := time.Now().UTC().Truncate(time.Second).Add(-30 * time.Minute)
+			tsa.Now = func() time.Time { return early.Add(time.Minute) }
+			if _, err := stamped.Timestamp(backend); err != nil {
+				t.Fatal(err)
+			}
+			tsa.Now = func() time.Time { return early }
+			if _, err := stamped.Timestamp(backend); err != nil {
+				t.Fatal(err)
+			}
+			tsa.Now = nil
+
+			dat, err := stamped.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			recovered, err := UnpackTimestampedTransaction(dat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			at, err := recovered.Verify(tsa.Roots(), nil)
+			if err != nil || !at.Equal(early) || len(recovered.Tokens) != 2 {
+				t.Fatalf("the earliest time must be proved (TransactionIdLength %d): %v %v", idLength, at, err)
+			}
+
+			// the tokens are kept valid by adding signatures
+			other := bbclib.GetIdentifier("other_user", 32)
+			recovered.Transaction.Sign(&other, keypair, false)
+			if _, err := recovered.Verify(tsa.Roots(), nil); err != nil {
+				t.Fatal(err)
+			}
+			recovered.Transaction.Events[0].Asset.AssetBody = []byte("modified")
+			if _, err := recovered.Verify(tsa.Roots(), nil); err == nil {
+				t.Fatal("modified transaction must be rejected")
+			}
+		}
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		txobj := makeTransaction(32, "asset")
+		otherTx := makeTransaction(32, "other asset")
+		digest, _ := TransactionDigest(otherTx)
+		otherToken, _ := tsa.Issue(digest, nil)
+		stamped := &TimestampedTransaction{Transaction: txobj}
+		if err := stamped.AddToken(otherToken); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("token over another transaction must be rejected: %v", err)
+		}
+		if err := stamped.AddToken([]byte("broken")); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("broken token must be rejected: %v", err)
+		}
+
+		// the request can be sent to the TSA in another way
+		req, err := NewTransactionTimeStampRequest(txobj, big.NewInt(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := ParseTimeStampResponse(tsa.Respond(req))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := stamped.AddToken(token); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stamped.Verify(tsa.Roots(), nil); err != nil {
+			t.Fatal(err)
+		}
+		untrusted := newTestTSA(t)
+		if _, err := stamped.Verify(untrusted.Roots(), nil); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("token must be verified with the trusted TSA certificate: %v", err)
+		}
+
+		// a token from an untrusted TSA invalidates the set of the tokens
+		digest, _ = TransactionDigest(txobj)
+		untrustedToken, _ := untrusted.Issue(digest, nil)
+		if err := stamped.AddToken(untrustedToken); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stamped.Verify(tsa.Roots(), nil); !errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("token from an untrusted TSA must be rejected: %v", err)
+		}
+	})
+
+	t.Run("tampered transaction", func(t *testing.T) {
+		txobj := makeTransaction(32, "asset")
+		transactionID := append([]byte{}, txobj.TransactionID...)
+		txobj.Events[0].Asset.AssetBody = []byte("modified")
+		if _, err := TransactionDigest(txobj); err == nil {
+			t.Fatal("digest of the modified transaction must be rejected")
+		}
+		if _, err := NewTransactionTimeStampRequest(txobj, nil); err == nil {
+			t.Fatal("timestamp request for the modified transaction must be rejected")
+		}
+		if err := (&TimestampedTransaction{Transaction: txobj}).AddToken([]byte("broken")); errors.Is(err, ErrInvalidTimeStampToken) {
+			t.Fatalf("token must not be checked for the modified transaction: %v", err)
+		}
+		if !bytes.Equal(txobj.TransactionID, transactionID) {
+			t.Fatal("transaction_id must not be changed by TransactionDigest")
+		}
+	})
+
+	t.Run("broken data", func(t *testing.T) {
+		stamped := &TimestampedTransaction{Transaction: makeTransaction(32, "asset")}
+		_, _ = stamped.Timestamp(backend)
+		dat, _ := stamped.Pack()
+		for _, broken := range [][]byte{dat[:len(dat)-1], append(dat, 0), {0xff, 0xff, 0xff, 0xff}} {
+			if _, err := UnpackTimestampedTransaction(broken); err == nil {
+				t.Fatal("broken data must not be unpacked")
+			}
+		}
+		if _, err := (&TimestampedTransaction{}).Pack(); err == nil {
+			t.Fatal("transaction must be required")
+		}
+	})
+}
@@ -0,0 +1,316 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package anchor
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidExtensionExtKeyUsage     = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtKeyUsageTimeStamping  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+	// LocalTSAPolicy is the default policy of LocalTSA (in the arc for examples, 2.999)
+	LocalTSAPolicy = asn1.ObjectIdentifier{2, 999, 1}
+)
+
+// PKIFailureInfo bits in rejected timestamp responses (RFC 3161 section 2.4.2)
+const (
+	failureBadAlg        = 0
+	failureBadRequest    = 2
+	failureBadDataFormat = 5
+)
+
+/*
+LocalTSA definition
+
+LocalTSA is an in-process timestamping authority for development and testing, which issues RFC 3161 timestamp tokens
+signed with the key of "Certificate". "Root" is the certificate to be trusted by verifiers (Roots returns the pool of it).
+The tokens are stamped with "Now" (time.Now if nil) in seconds, and LocalTSA serves timestamp requests over HTTP as http.Handler.
+*/
+type (
+	LocalTSA struct {
+		mutex       sync.Mutex
+		Root        *x509.Certificate
+		Certificate *x509.Certificate
+		Policy      asn1.ObjectIdentifier
+		Accuracy    time.Duration
+		Now         func() time.Time
+		key         crypto.Signer
+		serial      int64
+	}
+
+	// attributeValue is a signed attribute with a single value
+	attributeValue struct {
+		Type  asn1.ObjectIdentifier
+		Value interface{}
+	}
+)
+
+// NewLocalTSA returns a local TSA with a new self-signed root certificate and a TSA certificate issued by it
+func NewLocalTSA() (*LocalTSA, error) {
+	notBefore := time.Now().Add(-time.Hour).UTC()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "bbclib local TSA root"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	root, err := createCertificate(rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		Subject:         pkix.Name{CommonName: "bbclib local TSA"},
+		NotBefore:       notBefore,
+		NotAfter:        notBefore.AddDate(5, 0, 0),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{TimeStampingExtension()},
+	}
+	cert, err := createCertificate(template, root, &key.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalTSAWithCertificate(cert, key, root), nil
+}
+
+// NewLocalTSAWithCertificate returns a local TSA signing with the certificate and its private key (ECDSA or RSA)
+// The certificate itself is the root to be trusted if root is nil.
+func NewLocalTSAWithCertificate(cert *x509.Certificate, key crypto.Signer, root *x509.Certificate) *LocalTSA {
+	if root == nil {
+		root = cert
+	}
+	return &LocalTSA{Root: root, Certificate: cert, Policy: LocalTSAPolicy, Accuracy: time.Second, key: key}
+}
+
+// TimeStampingExtension returns the critical extended key usage extension of id-kp-timeStamping, which is required
+// for the certificates of TSA (x509.Certificate.ExtKeyUsage is encoded as non-critical)
+func TimeStampingExtension() pkix.Extension {
+	return pkix.Extension{Id: oidExtensionExtKeyUsage, Critical: true, Value: mustMarshal([]asn1.ObjectIdentifier{oidExtKeyUsageTimeStamping})}
+}
+
+// createCertificate creates and parses the certificate
+func createCertificate(template, parent *x509.Certificate, pub, priv interface{}) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Roots returns the pool of the root certificate of the TSA
+func (a *LocalTSA) Roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(a.Root)
+	return pool
+}
+
+// signatureAlgorithm returns the identifier of the signature algorithm with SHA-256 for the key
+func (a *LocalTSA) signatureAlgorithm() (asn1.ObjectIdentifier, error) {
+	switch a.key.Public().(type) {
+	case *ecdsa.PublicKey:
+		return oidSignatureECDSAWithSHA256, nil
+	case *rsa.PublicKey:
+		return oidSignatureSHA256WithRSA, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", a.key.Public())
+}
+
+// signedAttributes returns the DER encoding of the attributes as SET OF (without the tag and the length)
+func signedAttributes(attrs []attributeValue) ([]byte, error) {
+	var encoded [][]byte
+	for _, attr := range attrs {
+		value, err := asn1.Marshal(attr.Value)
+		if err != nil {
+			return nil, err
+		}
+		dat, err := asn1.Marshal(attribute{Type: attr.Type, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value}})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, dat)
+	}
+	// elements of SET OF are sorted in DER
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return bytes.Join(encoded, nil), nil
+}
+
+// Issue returns the DER encoded timestamp token over the SHA-256 digest with the nonce (omitted if nil)
+func (a *LocalTSA) Issue(digest []byte, nonce *big.Int) ([]byte, error) {
+	if len(digest) != sha256.Size {
+		return nil, fmt.Errorf("digest must be %d bytes of SHA-256 (%d bytes given)", sha256.Size, len(digest))
+	}
+	sigAlgorithm, err := a.signatureAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+	a.mutex.Lock()
+	a.serial++
+	serial := a.serial
+	a.mutex.Unlock()
+
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidHashSHA256, Parameters: asn1.NullRawValue}
+	info, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         a.Policy,
+		MessageImprint: messageImprint{HashAlgorithm: sha256ID, HashedMessage: digest},
+		SerialNumber:   big.NewInt(serial),
+		GenTime:        now().UTC().Truncate(time.Second),
+		Accuracy: accuracy{
+			Seconds: int(a.Accuracy / time.Second),
+			Millis:  int(a.Accuracy % time.Second / time.Millisecond),
+			Micros:  int(a.Accuracy % time.Millisecond / time.Microsecond),
+		},
+		Nonce: nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	infoDigest := sha256.Sum256(info)
+	certDigest := sha256.Sum256(a.Certificate.Raw)
+	attrs, err := signedAttributes([]attributeValue{
+		{oidAttributeContentType, oidContentTypeTSTInfo},
+		{oidAttributeDigest, infoDigest[:]},
+		{oidAttributeSigningCertificateV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: certDigest[:]}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	signed, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, err
+	}
+	signedDigest := sha256.Sum256(signed)
+	signature, err := a.key.Sign(rand.Reader, signedDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: a.Certificate.RawIssuer}, SerialNumber: a.Certificate.SerialNumber})
+	if err != nil {
+		return nil, err
+	}
+	sd, err := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+		EncapContentInfo: encapContentInfo{EContentType: oidContentTypeTSTInfo, EContent: info},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: a.Certificate.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha256ID,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sigAlgorithm},
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidContentTypeSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
+
+// mustMarshal returns the DER encoding of the value which never fails to be encoded
+func mustMarshal(val interface{}) []byte {
+	dat, err := asn1.Marshal(val)
+	if err != nil {
+		panic(err)
+	}
+	return dat
+}
+
+// rejection returns the DER encoded response rejecting the request with the failure info bit
+func rejection(failure int, message string) []byte {
+	bits := asn1.BitString{Bytes: []byte{0x80 >> uint(failure)}, BitLength: failure + 1}
+	return mustMarshal(timeStampResp{Status: pkiStatusInfo{Status: pkiStatusRejection, StatusString: []string{message}, FailInfo: bits}})
+}
+
+// Respond returns the DER encoded timestamp response to the DER encoded timestamp request
+// The request is rejected if it is broken or the message imprint is not of SHA-256.
+func (a *LocalTSA) Respond(request []byte) []byte {
+	var req timeStampReq
+	if rest, err := asn1.Unmarshal(request, &req); err != nil || len(rest) > 0 {
+		return rejection(failureBadDataFormat, "broken request")
+	}
+	if req.Version != 1 {
+		return rejection(failureBadRequest, "unsupported version")
+	}
+	if !req.MessageImprint.HashAlgorithm.Algorithm.Equal(oidHashSHA256) || len(req.MessageImprint.HashedMessage) != sha256.Size {
+		return rejection(failureBadAlg, "message imprint must be SHA-256")
+	}
+	token, err := a.Issue(req.MessageImprint.HashedMessage, req.Nonce)
+	if err != nil {
+		return mustMarshal(timeStampResp{Status: pkiStatusInfo{Status: pkiStatusRejection, StatusString: []string{err.Error()}}})
+	}
+	return mustMarshal(timeStampResp{TimeStampToken: asn1.RawValue{FullBytes: token}})
+}
+
+// ServeHTTP responds to the timestamp request over HTTP (RFC 3161 section 3.4)
+func (a *LocalTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("Content-Type") != TimeStampQueryContentType {
+		http.Error(w, "content type must be "+TimeStampQueryContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	request, err := ioutil.ReadAll(io.LimitReader(r.Body, maxTimeStampResponseSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", TimeStampReplyContentType)
+	_, _ = w.Write(a.Respond(request))
+}
@@ -0,0 +1,119 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package anchor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalTSA(t *testing.T) {
+	tsa, err := NewLocalTSA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("transaction"))
+
+	t.Run("rejections", func(t *testing.T) {
+		sha384, _ := asn1.Marshal(timeStampReq{
+			Version:        1,
+			MessageImprint: messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidHashSHA384}, HashedMessage: make([]byte, 48)},
+		})
+		version2, _ := asn1.Marshal(timeStampReq{
+			Version:        2,
+			MessageImprint: messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidHashSHA256}, HashedMessage: digest[:]},
+		})
+		for name, req := range map[string][]byte{"broken": []byte("broken"), "sha384": sha384, "version": version2} {
+			var resp timeStampResp
+			if _, err := asn1.Unmarshal(tsa.Respond(req), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status.Status != pkiStatusRejection || len(resp.Status.FailInfo.Bytes) == 0 || len(resp.TimeStampToken.FullBytes) != 0 {
+				t.Fatalf("%s request must be rejected: %+v", name, resp.Status)
+			}
+			if _, err := ParseTimeStampResponse(tsa.Respond(req)); err == nil {
+				t.Fatalf("%s request must not be granted", name)
+			}
+		}
+	})
+
+	t.Run("http", func(t *testing.T) {
+		server := httptest.NewServer(tsa)
+		defer server.Close()
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Fatalf("GET must not be allowed: %s", resp.Status)
+		}
+		req, _ := NewTimeStampRequest(digest[:], nil)
+		resp, err = http.Post(server.URL, "application/octet-stream", bytes.NewReader(req))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Fatalf("request must be %s: %s", TimeStampQueryContentType, resp.Status)
+		}
+		resp, err = http.Post(server.URL, TimeStampQueryContentType, strings.NewReader("broken"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != TimeStampReplyContentType {
+			t.Fatalf("rejection must be a timestamp response: %s", resp.Status)
+		}
+	})
+
+	t.Run("rsa", func(t *testing.T) {
+		key, _ := rsa.GenerateKey(rand.Reader, 2048)
+		template := &x509.Certificate{
+			SerialNumber:    big.NewInt(1),
+			Subject:         pkix.Name{CommonName: "rsa tsa"},
+			NotBefore:       time.Now().Add(-time.Hour),
+			NotAfter:        time.Now().Add(time.Hour),
+			KeyUsage:        x509.KeyUsageDigitalSignature,
+			ExtraExtensions: []pkix.Extension{TimeStampingExtension()},
+		}
+		rsaTSA := NewLocalTSAWithCertificate(newTestCertificate(t, template, template, &key.PublicKey, key), key, nil)
+		rsaTSA.Accuracy = 1500 * time.Microsecond
+		der, err := rsaTSA.Issue(digest[:], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := VerifyTimeStampToken(der, digest[:], rsaTSA.Roots(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Accuracy != rsaTSA.Accuracy || !token.Policy.Equal(LocalTSAPolicy) || token.SerialNumber.Int64() != 1 {
+			t.Fatalf("unexpected token: %+v", token)
+		}
+	})
+}
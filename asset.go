@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/ugorji/go/codec"
 )
@@ -27,9 +28,11 @@ import (
 /*
 BBcAsset definition
 
-"IDLength" and "digestCalculating" are not included in a packed data. They are for internal use only.
+"IDLength" is not included in a packed data. It is for internal use only.
 
 "AssetID" is the SHA256 digest of packed BBcAsset data, which contains from "UserID" to "AssetBody".
+It is calculated by Digest, or by Pack if nil, and is reset by the methods changing the content (Add, AddFile and AddBody*).
+If the fields are changed directly, AssetID must be reset to nil (or Digest must be called) to calculate it again.
 The length of "AssetID" and "UserID" is defined by "IDLength".
 "Nonce" is automatically determined with random value.
 BBcAsset can contain a digest of a file, string, map[string]interface{} object as asset.
@@ -38,7 +41,6 @@ type (
 	BBcAsset struct {
 		IdLengthConf      *BBcIdConfig
 		Version			  uint32
-		digestCalculating bool
 		AssetID           []byte
 		UserID            []byte
 		Nonce             []byte
@@ -50,9 +52,14 @@ type (
 	}
 )
 
-// An object for messagepack encoding/decoding
+// An object for messagepack encoding/decoding (canonical mode sorts map keys so that the encoded data is deterministic)
 var (
-	mh codec.MsgpackHandle
+	mh = codec.MsgpackHandle{BasicHandle: codec.BasicHandle{EncodeOptions: codec.EncodeOptions{Canonical: true}}}
+)
+
+// Maximum size of AssetBody (AssetBodySize is uint16)
+const (
+	maxAssetBodySize = 0xFFFF
 )
 
 // encodeMessagePack encodes object in messagepack data
@@ -103,9 +110,26 @@ func (p *BBcAsset) SetIdLengthConf(conf * BBcIdConfig) {
 func (p *BBcAsset) Add(userID *[]byte) {
 	if userID != nil {
 		p.UserID = make([]byte, p.IdLengthConf.UserIdLength)
-		copy(p.UserID, (*userID)[:p.IdLengthConf.UserIdLength])
+		copy(p.UserID, *userID)
 	}
 	p.Nonce = GetRandomValue(p.IdLengthConf.NonceLength)
+	p.AssetID = nil
+}
+
+// newAsset creates a BBcAsset object with userID, file and body, and returns the error in setting the body with the object
+func newAsset(version uint32, conf *BBcIdConfig, userID *[]byte, fileContent *[]byte, bodyContent interface{}) (*BBcAsset, error) {
+	obj := BBcAsset{Version: version}
+	obj.SetIdLengthConf(conf)
+	obj.Add(userID)
+	if fileContent != nil {
+		obj.AddFile(fileContent)
+	}
+	if bodyContent != nil {
+		if err := obj.AddBody(bodyContent); err != nil {
+			return &obj, err
+		}
+	}
+	return &obj, nil
 }
 
 // AddFile add the digest of file in the BBcAsset object
@@ -114,91 +138,152 @@ func (p *BBcAsset) AddFile(fileContent *[]byte) {
 	p.AssetFileSize = uint32(binary.Size(fileContent))
 	digest := sha256.Sum256(*fileContent)
 	p.AssetFileDigest = digest[:]
+	p.AssetID = nil
 }
 
-// AddBody sets data in the BBcAsset object
-func (p *BBcAsset) AddBody(bodyContent interface{}) {
+// AddBody sets data in the BBcAsset object (string and []byte are stored as is, other objects are converted in MessagePack format)
+func (p *BBcAsset) AddBody(bodyContent interface{}) error {
 	if body, ok := bodyContent.(string); ok {
-		p.AssetBody = []byte(body)
-		p.AssetBodySize = uint16(len(body))
+		return p.setBody(AssetBodyTypeRaw, []byte(body))
 	} else if body, ok := bodyContent.([]byte); ok {
-		copy(p.AssetBody, body)
-		p.AssetBodySize = uint16(len(body))
-	} else {
-		_ = p.AddBodyObject(bodyContent)
+		dat := make([]byte, len(body))
+		copy(dat, body)
+		return p.setBody(AssetBodyTypeRaw, dat)
 	}
+	return p.AddBodyObject(bodyContent)
+}
+
+// setBody sets the encoded body and its type in the BBcAsset object
+func (p *BBcAsset) setBody(bodyType uint16, body []byte) error {
+	if len(body) > maxAssetBodySize {
+		return fmt.Errorf("asset body is too large (%d bytes)", len(body))
+	}
+	p.AssetBodyType = bodyType
+	p.AssetBody = body
+	p.AssetBodySize = uint16(len(body))
+	p.AssetID = nil
+	return nil
 }
 
 // AddBodyString sets a string data in the BBcAsset object
 func (p *BBcAsset) AddBodyString(bodyContent string) {
-	p.AssetBodyType = 0
+	p.AssetBodyType = AssetBodyTypeRaw
 	p.AssetBody = []byte(bodyContent)
 	p.AssetBodySize = uint16(len(bodyContent))
+	p.AssetID = nil
 }
 
 // AddBodyObject sets an object data in the BBcAsset object and convert it in MessagePack format
 func (p *BBcAsset) AddBodyObject(bodyContent interface{}) error {
-	p.AssetBodyType = 1
-	var err error
-	p.AssetBody, err = encodeMessagePack(bodyContent)
+	return p.AddBodyObjectWithType(AssetBodyTypeMsgpack, bodyContent)
+}
+
+// AddBodyObjectWithType sets an object data in the BBcAsset object and convert it by the codec registered for bodyType
+// For AssetBodyTypeRaw, the object must be string or []byte.
+func (p *BBcAsset) AddBodyObjectWithType(bodyType uint16, bodyContent interface{}) error {
+	if bodyType == AssetBodyTypeRaw {
+		switch bodyContent.(type) {
+		case string, []byte:
+			return p.AddBody(bodyContent)
+		}
+		return errors.New("raw asset body must be string or []byte")
+	}
+	c, err := GetAssetBodyCodec(bodyType)
 	if err != nil {
 		return err
 	}
-	p.AssetBodySize = uint16(len(p.AssetBody))
-	return nil
+	dat, err := c.Encode(bodyContent)
+	if err != nil {
+		return err
+	}
+	return p.setBody(bodyType, dat)
 }
 
 // GetBodyObject returns the object which is in MessagePack format
 func (p *BBcAsset) GetBodyObject() (interface{}, error) {
-	if p.AssetBodyType != 1 {
+	if p.AssetBodyType != AssetBodyTypeMsgpack {
 		return nil, nil
 	}
 	return decodeMessagePack(p.AssetBody)
 }
 
-// Digest calculates the SHA256 digest of the AssetID value of the BBcAsset object
-func (p *BBcAsset) Digest() []byte {
-	p.digestCalculating = true
-	asset, err := p.Pack()
-	if err != nil {
-		p.digestCalculating = false
+// DecodeBody decodes AssetBody into obj (a pointer to struct, map, etc.) by the codec for AssetBodyType
+// For a raw body (AssetBodyType=0), obj must be *string or *[]byte.
+func (p *BBcAsset) DecodeBody(obj interface{}) error {
+	if p.AssetBodyType == AssetBodyTypeRaw {
+		switch o := obj.(type) {
+		case *string:
+			*o = string(p.AssetBody)
+		case *[]byte:
+			*o = make([]byte, len(p.AssetBody))
+			copy(*o, p.AssetBody)
+		default:
+			return errors.New("raw asset body can be decoded into *string or *[]byte only")
+		}
 		return nil
 	}
+	c, err := GetAssetBodyCodec(p.AssetBodyType)
+	if err != nil {
+		return err
+	}
+	return c.Decode(p.AssetBody, obj)
+}
 
-	digest := sha256.Sum256(asset)
-	if p.AssetID == nil {
-		p.AssetID = make([]byte, p.IdLengthConf.AssetIdLength)
+// Digest calculates the SHA256 digest of the content (from UserID to AssetBody) of the BBcAsset object, and sets AssetID
+func (p *BBcAsset) Digest() []byte {
+	buf := new(bytes.Buffer)
+	if err := p.packContent(buf); err != nil {
+		return nil
 	}
-	p.AssetID = digest[:p.IdLengthConf.AssetIdLength]
-	p.digestCalculating = false
+	digest := sha256.Sum256(buf.Bytes())
+	p.AssetID = cloneBytes(digest[:p.IdLengthConf.AssetIdLength])
 	return digest[:]
 }
 
-// Pack returns the binary data of the BBcAsset object
+// Pack returns the binary data of the BBcAsset object (AssetID is calculated if nil)
 func (p *BBcAsset) Pack() ([]byte, error) {
 	buf := new(bytes.Buffer)
+	if p.AssetID == nil {
+		p.Digest()
+	}
+	if err := PutBigInt(buf, &p.AssetID, p.IdLengthConf.AssetIdLength); err != nil {
+		return nil, err
+	}
+	if err := p.packContent(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
 
-	if !p.digestCalculating {
-		if p.AssetID == nil {
-			p.Digest()
-		}
-		PutBigInt(buf, &p.AssetID, p.IdLengthConf.AssetIdLength)
+// packContent packs the content of the BBcAsset object from UserID to AssetBody
+func (p *BBcAsset) packContent(buf *bytes.Buffer) error {
+	if err := PutBigInt(buf, &p.UserID, p.IdLengthConf.UserIdLength); err != nil {
+		return err
+	}
+	if err := PutBigInt(buf, &p.Nonce, len(p.Nonce)); err != nil {
+		return err
+	}
+	if err := Put4byte(buf, p.AssetFileSize); err != nil {
+		return err
 	}
-	PutBigInt(buf, &p.UserID, p.IdLengthConf.UserIdLength)
-	PutBigInt(buf, &p.Nonce, len(p.Nonce))
-	Put4byte(buf, p.AssetFileSize)
 	if p.AssetFileSize > 0 {
-		PutBigInt(buf, &p.AssetFileDigest, 32)
+		if err := PutBigInt(buf, &p.AssetFileDigest, 32); err != nil {
+			return err
+		}
 	}
 
-	Put2byte(buf, p.AssetBodyType)
-	Put2byte(buf, p.AssetBodySize)
+	if err := Put2byte(buf, p.AssetBodyType); err != nil {
+		return err
+	}
+	if err := Put2byte(buf, p.AssetBodySize); err != nil {
+		return err
+	}
 	if p.AssetBodySize > 0 {
 		if err := binary.Write(buf, binary.LittleEndian, p.AssetBody); err != nil {
-			return nil, err
+			return err
 		}
 	}
-	return buf.Bytes(), nil
+	return nil
 }
 
 // Unpack the BBcAsset object to the binary data
@@ -208,43 +293,82 @@ func (p *BBcAsset) Unpack(dat *[]byte) error {
 	}
 
 	var err error
-	buf := bytes.NewBuffer(*dat)
+	d := newDecoder(*dat)
 
-	p.AssetID, p.IdLengthConf.AssetIdLength, err = GetBigInt(buf)
+	p.AssetID, p.IdLengthConf.AssetIdLength, err = d.getBigInt("asset_id")
 	if err != nil {
 		return err
 	}
 
-	p.UserID, p.IdLengthConf.UserIdLength, err = GetBigInt(buf)
+	p.UserID, p.IdLengthConf.UserIdLength, err = d.getBigInt("user_id")
 	if err != nil {
 		return err
 	}
 
-	p.Nonce, p.IdLengthConf.NonceLength, err = GetBigInt(buf)
+	p.Nonce, p.IdLengthConf.NonceLength, err = d.getBigInt("nonce")
 	if err != nil {
 		return err
 	}
 
-	p.AssetFileSize, err = Get4byte(buf)
+	p.AssetFileSize, err = d.get4byte("file_size")
 	if err != nil {
 		return err
 	}
 	if p.AssetFileSize > 0 {
-		p.AssetFileDigest, _, err = GetBigInt(buf)
+		p.AssetFileDigest, _, err = d.getBigInt("file_digest")
 		if err != nil {
 			return err
 		}
 	}
 
-	p.AssetBodyType, err = Get2byte(buf)
+	p.AssetBodyType, err = d.get2byte("body_type")
 	if err != nil {
 		return err
 	}
-	p.AssetBodySize, err = Get2byte(buf)
+	p.AssetBodySize, err = d.get2byte("body_size")
 	if err != nil {
 		return err
 	}
-	p.AssetBody, _, err = GetBytes(buf, int(p.AssetBodySize))
+	p.AssetBody, err = d.getBytes("body", int(p.AssetBodySize))
 
 	return err
 }
+
+// Clone returns a deep copy of the BBcAsset object
+func (p *BBcAsset) Clone() *BBcAsset {
+	return p.clone(newCloneContext())
+}
+
+// clone returns a deep copy of the BBcAsset object, sharing the ID length configuration in the cloneContext
+func (p *BBcAsset) clone(c *cloneContext) *BBcAsset {
+	if p == nil {
+		return nil
+	}
+	return &BBcAsset{
+		IdLengthConf:    c.conf(p.IdLengthConf),
+		Version:         p.Version,
+		AssetID:         cloneBytes(p.AssetID),
+		UserID:          cloneBytes(p.UserID),
+		Nonce:           cloneBytes(p.Nonce),
+		AssetFileSize:   p.AssetFileSize,
+		AssetFileDigest: cloneBytes(p.AssetFileDigest),
+		AssetBodyType:   p.AssetBodyType,
+		AssetBodySize:   p.AssetBodySize,
+		AssetBody:       cloneBytes(p.AssetBody),
+	}
+}
+
+// Equal returns true if the BBcAsset objects have the same content to be packed
+func (p *BBcAsset) Equal(q *BBcAsset) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	return bytes.Equal(p.AssetID, q.AssetID) &&
+		bytes.Equal(p.UserID, q.UserID) &&
+		bytes.Equal(p.Nonce, q.Nonce) &&
+		p.AssetFileSize == q.AssetFileSize &&
+		bytes.Equal(p.AssetFileDigest, q.AssetFileDigest) &&
+		p.AssetBodyType == q.AssetBodyType &&
+		p.AssetBodySize == q.AssetBodySize &&
+		bytes.Equal(p.AssetBody, q.AssetBody)
+}
@@ -0,0 +1,156 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+Asset body codecs
+
+"AssetBodyType" in BBcAsset tells how "AssetBody" is encoded.
+Type 0 means that the body is a plain string (or binary data) and type 1 means MessagePack, which is compatible with py-bbclib.
+Other types are handled by codecs registered with RegisterAssetBodyCodec.
+
+All built-in codecs produce deterministic output, so that the same object always gives the same AssetID.
+*/
+const (
+	AssetBodyTypeRaw      = 0
+	AssetBodyTypeMsgpack  = 1
+	AssetBodyTypeJSON     = 2
+	AssetBodyTypeCBOR     = 3
+	AssetBodyTypeProtobuf = 4
+)
+
+// AssetBodyCodec encodes an object into an asset body and decodes it back
+type AssetBodyCodec interface {
+	Encode(obj interface{}) ([]byte, error)
+	Decode(dat []byte, obj interface{}) error
+}
+
+type (
+	msgpackBodyCodec  struct{}
+	jsonBodyCodec     struct{}
+	cborBodyCodec     struct{}
+	protobufBodyCodec struct{}
+)
+
+var (
+	ch = codec.CborHandle{BasicHandle: codec.BasicHandle{EncodeOptions: codec.EncodeOptions{Canonical: true}}}
+
+	assetBodyCodecsMutex sync.RWMutex
+	assetBodyCodecs      = map[uint16]AssetBodyCodec{
+		AssetBodyTypeMsgpack:  msgpackBodyCodec{},
+		AssetBodyTypeJSON:     jsonBodyCodec{},
+		AssetBodyTypeCBOR:     cborBodyCodec{},
+		AssetBodyTypeProtobuf: protobufBodyCodec{},
+	}
+)
+
+// RegisterAssetBodyCodec registers a codec for the given AssetBodyType (an existing codec is replaced)
+func RegisterAssetBodyCodec(bodyType uint16, c AssetBodyCodec) error {
+	if bodyType == AssetBodyTypeRaw {
+		return errors.New("asset body type 0 is reserved for raw body")
+	}
+	if c == nil {
+		return errors.New("codec must not be nil")
+	}
+	assetBodyCodecsMutex.Lock()
+	defer assetBodyCodecsMutex.Unlock()
+	assetBodyCodecs[bodyType] = c
+	return nil
+}
+
+// UnregisterAssetBodyCodec removes the codec registered for the given AssetBodyType
+func UnregisterAssetBodyCodec(bodyType uint16) {
+	assetBodyCodecsMutex.Lock()
+	defer assetBodyCodecsMutex.Unlock()
+	delete(assetBodyCodecs, bodyType)
+}
+
+// GetAssetBodyCodec returns the codec registered for the given AssetBodyType
+func GetAssetBodyCodec(bodyType uint16) (AssetBodyCodec, error) {
+	assetBodyCodecsMutex.RLock()
+	defer assetBodyCodecsMutex.RUnlock()
+	c, ok := assetBodyCodecs[bodyType]
+	if !ok {
+		return nil, fmt.Errorf("no codec for asset body type %d", bodyType)
+	}
+	return c, nil
+}
+
+// Encode encodes object in canonical MessagePack format
+func (msgpackBodyCodec) Encode(obj interface{}) ([]byte, error) {
+	return encodeMessagePack(obj)
+}
+
+// Decode decodes MessagePack data into obj
+func (msgpackBodyCodec) Decode(dat []byte, obj interface{}) error {
+	return codec.NewDecoderBytes(dat, &mh).Decode(obj)
+}
+
+// Encode encodes object in JSON (map keys are sorted by encoding/json)
+func (jsonBodyCodec) Encode(obj interface{}) ([]byte, error) {
+	return json.Marshal(obj)
+}
+
+// Decode decodes JSON data into obj
+func (jsonBodyCodec) Decode(dat []byte, obj interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(dat))
+	decoder.UseNumber()
+	return decoder.Decode(obj)
+}
+
+// Encode encodes object in canonical CBOR format
+func (cborBodyCodec) Encode(obj interface{}) ([]byte, error) {
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, &ch).Encode(obj); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Decode decodes CBOR data into obj
+func (cborBodyCodec) Decode(dat []byte, obj interface{}) error {
+	return codec.NewDecoderBytes(dat, &ch).Decode(obj)
+}
+
+// Encode encodes proto.Message object in deterministic protobuf wire format
+func (protobufBodyCodec) Encode(obj interface{}) ([]byte, error) {
+	msg, ok := obj.(proto.Message)
+	if !ok {
+		return nil, errors.New("protobuf body must be proto.Message")
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+// Decode decodes protobuf data into obj (must be proto.Message)
+func (protobufBodyCodec) Decode(dat []byte, obj interface{}) error {
+	msg, ok := obj.(proto.Message)
+	if !ok {
+		return errors.New("protobuf body must be decoded into proto.Message")
+	}
+	return proto.Unmarshal(dat, msg)
+}
@@ -0,0 +1,174 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testAssetBody struct {
+	Name   string
+	Amount uint64
+	Tags   []string
+}
+
+type reverseBodyCodec struct{}
+
+func (reverseBodyCodec) Encode(obj interface{}) ([]byte, error) {
+	s := []byte(obj.(string))
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+	return s, nil
+}
+
+func (c reverseBodyCodec) Decode(dat []byte, obj interface{}) error {
+	s, _ := c.Encode(string(dat))
+	*(obj.(*string)) = string(s)
+	return nil
+}
+
+func TestAssetBodyCodec(t *testing.T) {
+	var idLengthConfig = BBcIdConfig {
+		TransactionIdLength: 32,
+		UserIdLength: 32,
+		AssetGroupIdLength: 32,
+		AssetIdLength: 32,
+		NonceLength: 32,
+	}
+	u1 := GetIdentifier("user1_789abcdef0123456789abcdef0", defaultIDLength)
+
+	t.Run("canonical msgpack encoding", func(t *testing.T) {
+		body := map[string]interface{}{}
+		for _, k := range []string{"k1", "k2", "k3", "k4", "k5", "k6", "k7", "k8"} {
+			body[k] = k + "_value"
+		}
+		obj := BBcAsset{}
+		obj.SetIdLengthConf(&idLengthConfig)
+		obj.Add(&u1)
+		for i := 0; i < 20; i++ {
+			obj2 := obj
+			if err := obj2.AddBodyObject(body); err != nil {
+				t.Fatalf("failed to add body object (%v)", err)
+			}
+			if err := obj.AddBodyObject(body); err != nil {
+				t.Fatalf("failed to add body object (%v)", err)
+			}
+			if bytes.Compare(obj.AssetBody, obj2.AssetBody) != 0 {
+				t.Fatal("msgpack encoding is not deterministic")
+			}
+		}
+	})
+
+	t.Run("decode into struct", func(t *testing.T) {
+		for _, bodyType := range []uint16{AssetBodyTypeMsgpack, AssetBodyTypeJSON, AssetBodyTypeCBOR} {
+			obj := BBcAsset{}
+			obj.SetIdLengthConf(&idLengthConfig)
+			obj.Add(&u1)
+			body := testAssetBody{Name: "token", Amount: 1000, Tags: []string{"a", "b"}}
+			if err := obj.AddBodyObjectWithType(bodyType, &body); err != nil {
+				t.Fatalf("failed to add body object (type=%d, %v)", bodyType, err)
+			}
+
+			dat, err := obj.Pack()
+			if err != nil {
+				t.Fatalf("failed to pack (%v)", err)
+			}
+			obj2 := BBcAsset{}
+			obj2.Unpack(&dat)
+
+			var body2 testAssetBody
+			if err := obj2.DecodeBody(&body2); err != nil {
+				t.Fatalf("failed to decode body (type=%d, %v)", bodyType, err)
+			}
+			if obj2.AssetBodyType != bodyType || body2.Name != body.Name || body2.Amount != body.Amount || len(body2.Tags) != 2 {
+				t.Fatalf("Not recovered correctly (type=%d, %v)", bodyType, body2)
+			}
+		}
+	})
+
+	t.Run("protobuf body", func(t *testing.T) {
+		obj := BBcAsset{}
+		obj.SetIdLengthConf(&idLengthConfig)
+		obj.Add(&u1)
+		if err := obj.AddBodyObjectWithType(AssetBodyTypeProtobuf, wrapperspb.String("protobuf body")); err != nil {
+			t.Fatalf("failed to add body object (%v)", err)
+		}
+		body := wrapperspb.StringValue{}
+		if err := obj.DecodeBody(&body); err != nil {
+			t.Fatalf("failed to decode body (%v)", err)
+		}
+		if body.GetValue() != "protobuf body" {
+			t.Fatal("Not recovered correctly...")
+		}
+		if err := obj.AddBodyObjectWithType(AssetBodyTypeProtobuf, "not a message"); err == nil {
+			t.Fatal("non proto.Message object must be rejected")
+		}
+	})
+
+	t.Run("raw body", func(t *testing.T) {
+		obj := BBcAsset{}
+		obj.SetIdLengthConf(&idLengthConfig)
+		obj.Add(&u1)
+		if err := obj.AddBody([]byte("binary body")); err != nil {
+			t.Fatalf("failed to add body (%v)", err)
+		}
+		var body []byte
+		if err := obj.DecodeBody(&body); err != nil {
+			t.Fatalf("failed to decode body (%v)", err)
+		}
+		if string(body) != "binary body" || obj.AssetBodySize != uint16(len(body)) {
+			t.Fatal("Not recovered correctly...")
+		}
+		if err := obj.AddBody(make([]byte, maxAssetBodySize+1)); err == nil {
+			t.Fatal("too large body must be rejected")
+		}
+	})
+
+	t.Run("registered codec", func(t *testing.T) {
+		if err := RegisterAssetBodyCodec(AssetBodyTypeRaw, reverseBodyCodec{}); err == nil {
+			t.Fatal("body type 0 must not be registered")
+		}
+		if err := RegisterAssetBodyCodec(100, reverseBodyCodec{}); err != nil {
+			t.Fatalf("failed to register codec (%v)", err)
+		}
+		defer UnregisterAssetBodyCodec(100)
+		obj := BBcAsset{}
+		obj.SetIdLengthConf(&idLengthConfig)
+		obj.Add(&u1)
+		if err := obj.AddBodyObjectWithType(100, "abcdef"); err != nil {
+			t.Fatalf("failed to add body object (%v)", err)
+		}
+		var body string
+		if err := obj.DecodeBody(&body); err != nil || string(obj.AssetBody) != "fedcba" || body != "abcdef" {
+			t.Fatal("Not recovered correctly...")
+		}
+		if err := obj.AddBodyObjectWithType(101, "abcdef"); err == nil {
+			t.Fatal("unknown body type must be rejected")
+		}
+		if err := obj.AddBodyObjectWithType(AssetBodyTypeRaw, map[string]int{"a": 1}); err == nil || obj.AssetBodyType != 100 {
+			t.Fatal("raw body must be string or []byte")
+		}
+		UnregisterAssetBodyCodec(100)
+		if _, err := GetAssetBodyCodec(100); err == nil {
+			t.Fatal("codec must be unregistered")
+		}
+	})
+}
@@ -69,9 +69,13 @@ func (p *BBcAssetHash) AddAssetId(assetId *[]byte) {
 // Pack returns the binary data of the BBcAsset object
 func (p *BBcAssetHash) Pack() ([]byte, error) {
 	buf := new(bytes.Buffer)
-	Put2byte(buf, p.AssetIdNum)
+	if err := Put2byte(buf, p.AssetIdNum); err != nil {
+		return nil, err
+	}
 	for i := 0; i < int(p.AssetIdNum); i++ {
-		PutBigInt(buf, &p.AssetIDs[i], p.IdLengthConf.AssetIdLength)
+		if err := PutBigInt(buf, &p.AssetIDs[i], p.IdLengthConf.AssetIdLength); err != nil {
+			return nil, err
+		}
 	}
 	return buf.Bytes(), nil
 }
@@ -83,14 +87,14 @@ func (p *BBcAssetHash) Unpack(dat *[]byte) error {
 	}
 
 	var err error
-	buf := bytes.NewBuffer(*dat)
-	p.AssetIdNum, err = Get2byte(buf)
+	d := newDecoder(*dat)
+	p.AssetIdNum, err = d.get2byte("asset_ids")
 	if err != nil {
 		return err
 	}
 
 	for i := 0; i < int(p.AssetIdNum); i++ {
-		assetId, ulen, err := GetBigInt(buf)
+		assetId, ulen, err := d.getBigInt(fmt.Sprintf("asset_ids[%d]", i))
 		if err != nil {
 			return err
 		}
@@ -99,3 +103,29 @@ func (p *BBcAssetHash) Unpack(dat *[]byte) error {
 	}
 	return nil
 }
+
+// Clone returns a deep copy of the BBcAssetHash object
+func (p *BBcAssetHash) Clone() *BBcAssetHash {
+	return p.clone(newCloneContext())
+}
+
+// clone returns a deep copy of the BBcAssetHash object, sharing the ID length configuration in the cloneContext
+func (p *BBcAssetHash) clone(c *cloneContext) *BBcAssetHash {
+	if p == nil {
+		return nil
+	}
+	return &BBcAssetHash{
+		IdLengthConf: c.conf(p.IdLengthConf),
+		Version:      p.Version,
+		AssetIdNum:   p.AssetIdNum,
+		AssetIDs:     cloneBytesList(p.AssetIDs),
+	}
+}
+
+// Equal returns true if the BBcAssetHash objects have the same content to be packed
+func (p *BBcAssetHash) Equal(q *BBcAssetHash) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	return p.AssetIdNum == q.AssetIdNum && equalBytesList(p.AssetIDs, q.AssetIDs)
+}
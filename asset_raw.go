@@ -76,8 +76,12 @@ func (p *BBcAssetRaw) AddBody(assetID *[]byte, assetBody interface{}) {
 // Pack returns the binary data of the BBcAsset object
 func (p *BBcAssetRaw) Pack() ([]byte, error) {
 	buf := new(bytes.Buffer)
-	PutBigInt(buf, &p.AssetID, p.IdLengthConf.AssetIdLength)
-	Put2byte(buf, p.AssetBodySize)
+	if err := PutBigInt(buf, &p.AssetID, p.IdLengthConf.AssetIdLength); err != nil {
+		return nil, err
+	}
+	if err := Put2byte(buf, p.AssetBodySize); err != nil {
+		return nil, err
+	}
 	if p.AssetBodySize > 0 {
 		if err := binary.Write(buf, binary.LittleEndian, p.AssetBody); err != nil {
 			return nil, err
@@ -93,18 +97,47 @@ func (p *BBcAssetRaw) Unpack(dat *[]byte) error {
 	}
 
 	var err error
-	buf := bytes.NewBuffer(*dat)
+	d := newDecoder(*dat)
 
-	p.AssetID, p.IdLengthConf.AssetIdLength, err = GetBigInt(buf)
+	p.AssetID, p.IdLengthConf.AssetIdLength, err = d.getBigInt("asset_id")
 	if err != nil {
 		return err
 	}
 
-	p.AssetBodySize, err = Get2byte(buf)
+	p.AssetBodySize, err = d.get2byte("body")
 	if err != nil {
 		return err
 	}
-	p.AssetBody, _, err = GetBytes(buf, int(p.AssetBodySize))
+	p.AssetBody, err = d.getBytes("body", int(p.AssetBodySize))
 
 	return err
 }
+
+// Clone returns a deep copy of the BBcAssetRaw object
+func (p *BBcAssetRaw) Clone() *BBcAssetRaw {
+	return p.clone(newCloneContext())
+}
+
+// clone returns a deep copy of the BBcAssetRaw object, sharing the ID length configuration in the cloneContext
+func (p *BBcAssetRaw) clone(c *cloneContext) *BBcAssetRaw {
+	if p == nil {
+		return nil
+	}
+	return &BBcAssetRaw{
+		IdLengthConf:  c.conf(p.IdLengthConf),
+		Version:       p.Version,
+		AssetID:       cloneBytes(p.AssetID),
+		AssetBodySize: p.AssetBodySize,
+		AssetBody:     cloneBytes(p.AssetBody),
+	}
+}
+
+// Equal returns true if the BBcAssetRaw objects have the same content to be packed
+func (p *BBcAssetRaw) Equal(q *BBcAssetRaw) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	return bytes.Equal(p.AssetID, q.AssetID) &&
+		p.AssetBodySize == q.AssetBodySize &&
+		bytes.Equal(p.AssetBody, q.AssetBody)
+}
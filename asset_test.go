@@ -134,4 +134,52 @@ func TestAssetPackUnpack(t *testing.T) {
 		}
 
 	})
+
+	t.Run("asset id is reset by a body change", func(t *testing.T) {
+		obj := BBcAsset{}
+		obj.SetIdLengthConf(&idLengthConfig)
+		u1 := GetIdentifier("user1_789abcdef0123456789abcdef0", defaultIDLength)
+		obj.Add(&u1)
+		obj.AddBodyString("before")
+		dat, err := obj.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := append([]byte{}, obj.AssetID...)
+
+		obj.AddBodyString("after")
+		if obj.AssetID != nil {
+			t.Fatal("AssetID must be reset by AddBodyString")
+		}
+		dat2, err := obj.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(before, obj.AssetID) || bytes.Equal(dat, dat2) {
+			t.Fatal("AssetID must be calculated for the new body")
+		}
+
+		obj2 := BBcAsset{}
+		obj2.SetIdLengthConf(&idLengthConfig)
+		if err := obj2.Unpack(&dat2); err != nil {
+			t.Fatal(err)
+		}
+		id := append([]byte{}, obj2.AssetID...)
+		obj2.Digest()
+		if !bytes.Equal(id, obj2.AssetID) {
+			t.Fatal("AssetID must be the digest of the content")
+		}
+
+		if err := obj.AddBodyObject(map[string]string{"a": "b"}); err != nil {
+			t.Fatal(err)
+		}
+		if obj.AssetID != nil {
+			t.Fatal("AssetID must be reset by AddBodyObject")
+		}
+		obj.Digest()
+		obj.Add(&u1)
+		if obj.AssetID != nil {
+			t.Fatal("AssetID must be reset by Add")
+		}
+	})
 }
@@ -38,7 +38,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"time"
+	"sync"
 )
 
 // Header values for serialized data
@@ -61,6 +61,8 @@ const (
 	defaultIDLength = 32
 )
 
+// IdLengthConfig is the default ID length configuration used by MakeTransaction and the utility functions
+// It should be changed only by ConfigureIdLength or ConfigureIdLengthAll. Use IdLengthProfile to handle different ID lengths concurrently.
 var IdLengthConfig = BBcIdConfig {
 	TransactionIdLength: defaultIDLength,
 	UserIdLength: defaultIDLength,
@@ -69,9 +71,13 @@ var IdLengthConfig = BBcIdConfig {
 	NonceLength: defaultIDLength,
 }
 
+var idLengthConfigMutex sync.RWMutex
+
 
 // Configure various ID length
 func ConfigureIdLength(conf *BBcIdConfig) {
+	idLengthConfigMutex.Lock()
+	defer idLengthConfigMutex.Unlock()
 	if conf.TransactionIdLength > 0 && conf.TransactionIdLength < 33 {
 		IdLengthConfig.TransactionIdLength = conf.TransactionIdLength
 	}
@@ -91,6 +97,8 @@ func ConfigureIdLength(conf *BBcIdConfig) {
 
 // Configure all kind of ID length with the same value
 func ConfigureIdLengthAll(length int) {
+	idLengthConfigMutex.Lock()
+	defer idLengthConfigMutex.Unlock()
 	if length > 0 && length < 33 {
 		IdLengthConfig.TransactionIdLength = length
 		IdLengthConfig.UserIdLength = length
@@ -105,21 +113,27 @@ func UpdateIdLengthConfig(main, refer *BBcIdConfig) {
 	if refer == nil {
 		return
 	}
-	if refer.TransactionIdLength > 0 && main.TransactionIdLength != refer.TransactionIdLength {
+	*main = MergeIdLengthConfig(*main, *refer)
+}
+
+// MergeIdLengthConfig returns a new config in which the lengths in refer (if specified) override those in main
+func MergeIdLengthConfig(main, refer BBcIdConfig) BBcIdConfig {
+	if refer.TransactionIdLength > 0 {
 		main.TransactionIdLength = refer.TransactionIdLength
 	}
-	if refer.UserIdLength > 0 && main.UserIdLength != refer.UserIdLength {
+	if refer.UserIdLength > 0 {
 		main.UserIdLength = refer.UserIdLength
 	}
-	if refer.AssetGroupIdLength > 0 && main.AssetGroupIdLength != refer.AssetGroupIdLength {
+	if refer.AssetGroupIdLength > 0 {
 		main.AssetGroupIdLength = refer.AssetGroupIdLength
 	}
-	if refer.AssetIdLength > 0 && main.AssetIdLength != refer.AssetIdLength {
+	if refer.AssetIdLength > 0 {
 		main.AssetIdLength = refer.AssetIdLength
 	}
-	if refer.NonceLength > 0 && main.NonceLength != refer.NonceLength {
+	if refer.NonceLength > 0 {
 		main.NonceLength = refer.NonceLength
 	}
+	return main
 }
 
 /*
@@ -131,7 +145,9 @@ formatType = 0x0010: Packed data is compressed using zlib, and the compressed da
 */
 func Serialize(transaction *BBcTransaction, formatType uint16) ([]byte, error) {
 	buf := new(bytes.Buffer)
-	Put2byte(buf, formatType)
+	if err := Put2byte(buf, formatType); err != nil {
+		return nil, err
+	}
 	dat, err := transaction.Pack()
 	if err != nil {
 		return nil, err
@@ -152,21 +168,25 @@ func Serialize(transaction *BBcTransaction, formatType uint16) ([]byte, error) {
 }
 
 // Deserialize BBcTransaction data with header
+// If the data is broken, *DecodeError is returned. The offset in the error is that in the packed data (after the header and decompression).
 func Deserialize(dat []byte) (*BBcTransaction, error) {
-	buf := bytes.NewBuffer(dat)
-
-	formatType, err := Get2byte(buf)
-	if err != nil {
-		return nil, err
-	}
+	return deserialize(dat, nil)
+}
 
-	txdat, _, err := GetBytes(buf, len(dat)-2)
+// deserialize deserializes BBcTransaction data with header using base as the initial ID length configuration
+func deserialize(dat []byte, base *BBcIdConfig) (*BBcTransaction, error) {
+	formatType, err := newDecoder(dat).get2byte("format_type")
 	if err != nil {
 		return nil, err
 	}
+	txdat := make([]byte, len(dat)-2)
+	copy(txdat, dat[2:])
 
 	if formatType == FormatPlain {
 		txobj := BBcTransaction{}
+		if base != nil {
+			txobj.IdLengthConf = *base
+		}
 		err2 := txobj.Unpack(&txdat)
 		return &txobj, err2
 	} else if formatType == FormatZlib {
@@ -175,6 +195,9 @@ func Deserialize(dat []byte) (*BBcTransaction, error) {
 			return nil, err
 		}
 		txobj := BBcTransaction{}
+		if base != nil {
+			txobj.IdLengthConf = *base
+		}
 		err2 := txobj.Unpack(&decompressed)
 		return &txobj, err2
 	}
@@ -185,28 +208,5 @@ func Deserialize(dat []byte) (*BBcTransaction, error) {
 
 // MakeTransaction is a utility for making simple BBcTransaction object with BBcEvent, BBcRelation or/and BBcWitness
 func MakeTransaction(eventNum, relationNum int, witness bool) *BBcTransaction {
-	txobj := BBcTransaction{Version: 2}
-	txobj.SetIdLengthConf(&IdLengthConfig)
-	txobj.Timestamp = time.Now().UnixNano() / int64(time.Microsecond)
-
-	for i := 0; i < eventNum; i++ {
-		evt := BBcEvent{Version: txobj.Version}
-		evt.SetIdLengthConf(&txobj.IdLengthConf)
-		txobj.Events = append(txobj.Events, &evt)
-	}
-
-	for i := 0; i < relationNum; i++ {
-		rtn := BBcRelation{Version: txobj.Version}
-		rtn.SetIdLengthConf(&txobj.IdLengthConf)
-		txobj.Relations = append(txobj.Relations, &rtn)
-	}
-
-	if witness {
-		wit := BBcWitness{Version: txobj.Version}
-		wit.SetIdLengthConf(&txobj.IdLengthConf)
-		wit.Transaction = &txobj
-		txobj.Witness = &wit
-	}
-
-	return &txobj
+	return DefaultIdLengthProfile().MakeTransaction(eventNum, relationNum, witness)
 }
@@ -143,7 +143,8 @@ func AddEventAssetBodyObject(transaction *BBcTransaction, eventIdx int, assetGro
 // MakeRelationWithAsset is a utility for making simple BBcTransaction object with BBcRelation with BBcAsset (old style, only for backward compatibility)
 func MakeRelationWithAsset(assetGroupId, userId *[]byte, assetBodyString string, assetBodyObject interface{}, assetFile *[]byte) *BBcRelation {
 	rtn := BBcRelation{}
-	rtn.SetIdLengthConf(&IdLengthConfig)
+	conf := DefaultIdLengthProfile().Config()
+	rtn.SetIdLengthConf(&conf)
 	copy(rtn.AssetGroupID, *assetGroupId)
 	if assetBodyString != "" {
 		rtn.CreateAsset(userId, assetFile, assetBodyString)
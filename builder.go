@@ -0,0 +1,388 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+TransactionBuilder definition
+
+TransactionBuilder builds a BBcTransaction object in the same fluent style as the methods of BBcTransaction, but records the errors instead of swallowing them.
+The content of a BBcEvent or BBcRelation object is given in a callback with EventBuilder or RelationBuilder.
+Signing is deferred until Build (or BuildDraft), so that the signatures are made for the finished content.
+
+Build returns the finished transaction only if no error is recorded and all signature slots are filled with valid signatures.
+BuildDraft does not check the signatures, which is for a draft of multi-party signing (see PartiallySignedTransaction).
+*/
+type (
+	TransactionBuilder struct {
+		txobj   *BBcTransaction
+		signers []builderSigner
+		schemas *SchemaRegistry
+		errs    []error
+		built   bool
+	}
+
+	EventBuilder struct {
+		b   *TransactionBuilder
+		idx int
+		obj *BBcEvent
+	}
+
+	RelationBuilder struct {
+		b   *TransactionBuilder
+		idx int
+		obj *BBcRelation
+	}
+
+	builderSigner struct {
+		userID   []byte
+		keyPair  *KeyPair
+		noPubkey bool
+	}
+
+	// BuildError is returned by Build and BuildDraft, and includes all errors recorded by the builder
+	BuildError struct {
+		Errors []error
+	}
+)
+
+// Error returns all error messages
+func (e *BuildError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("failed to build transaction: %s", strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the first error
+func (e *BuildError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[0]
+}
+
+// NewTransactionBuilder returns a builder of a transaction with the ID lengths in the profile (default profile if nil)
+func NewTransactionBuilder(profile *IdLengthProfile) *TransactionBuilder {
+	if profile == nil {
+		profile = DefaultIdLengthProfile()
+	}
+	return &TransactionBuilder{txobj: profile.NewTransaction(2)}
+}
+
+// fail records the error
+func (b *TransactionBuilder) fail(err error) {
+	b.errs = append(b.errs, err)
+}
+
+// checkID records the error if the ID is not given
+func (b *TransactionBuilder) checkID(context, name string, id *[]byte) bool {
+	if id == nil || len(*id) == 0 {
+		b.fail(fmt.Errorf("%s: %s must be given", context, name))
+		return false
+	}
+	return true
+}
+
+// Err returns the first error recorded by the builder
+func (b *TransactionBuilder) Err() error {
+	if len(b.errs) == 0 {
+		return nil
+	}
+	return b.errs[0]
+}
+
+// Errors returns all errors recorded by the builder
+func (b *TransactionBuilder) Errors() []error {
+	return append([]error{}, b.errs...)
+}
+
+// SetTimestamp sets the timestamp of the transaction (the current time is set in Build and BuildDraft if 0)
+func (b *TransactionBuilder) SetTimestamp(timestamp int64) *TransactionBuilder {
+	b.txobj.Timestamp = timestamp
+	return b
+}
+
+// SetSchemaRegistry sets the registry of the asset body schemas, which is checked in Build and BuildDraft
+func (b *TransactionBuilder) SetSchemaRegistry(registry *SchemaRegistry) *TransactionBuilder {
+	b.schemas = registry
+	return b
+}
+
+// AddEvent adds a BBcEvent object and builds its content with the callback (can be nil)
+func (b *TransactionBuilder) AddEvent(assetGroupID *[]byte, build func(e *EventBuilder)) *TransactionBuilder {
+	idx := len(b.txobj.Events)
+	if !b.checkID(fmt.Sprintf("events[%d]", idx), "asset_group_id", assetGroupID) {
+		return b
+	}
+	b.txobj.AddEvent(assetGroupID, nil)
+	if build != nil {
+		build(&EventBuilder{b: b, idx: idx, obj: b.txobj.Events[idx]})
+	}
+	return b
+}
+
+// AddRelation adds a BBcRelation object and builds its content with the callback (can be nil)
+func (b *TransactionBuilder) AddRelation(assetGroupID *[]byte, build func(r *RelationBuilder)) *TransactionBuilder {
+	idx := len(b.txobj.Relations)
+	if !b.checkID(fmt.Sprintf("relations[%d]", idx), "asset_group_id", assetGroupID) {
+		return b
+	}
+	b.txobj.AddRelation(assetGroupID)
+	if build != nil {
+		build(&RelationBuilder{b: b, idx: idx, obj: b.txobj.Relations[idx]})
+	}
+	return b
+}
+
+// CreateReference adds a BBcReference object that refers to the event in the transaction
+func (b *TransactionBuilder) CreateReference(assetGroupID *[]byte, refTransaction *BBcTransaction, eventIdx int) *TransactionBuilder {
+	context := fmt.Sprintf("references[%d]", len(b.txobj.References))
+	if !b.checkID(context, "asset_group_id", assetGroupID) {
+		return b
+	}
+	if refTransaction == nil {
+		b.fail(fmt.Errorf("%s: referred transaction must be given", context))
+		return b
+	}
+	if err := b.txobj.createReference(assetGroupID, refTransaction, eventIdx); err != nil {
+		b.fail(fmt.Errorf("%s: %w", context, err))
+	}
+	return b
+}
+
+// CreateCrossRef sets a BBcCrossRef object
+func (b *TransactionBuilder) CreateCrossRef(domainID, transactionID *[]byte) *TransactionBuilder {
+	if !b.checkID("cross_ref", "domain_id", domainID) || !b.checkID("cross_ref", "transaction_id", transactionID) {
+		return b
+	}
+	b.txobj.CreateCrossRef(domainID, transactionID)
+	return b
+}
+
+// AddWitness adds the user in the BBcWitness object
+func (b *TransactionBuilder) AddWitness(userID *[]byte) *TransactionBuilder {
+	if !b.checkID("witness", "user_id", userID) {
+		return b
+	}
+	if err := b.txobj.addWitness(userID); err != nil {
+		b.fail(fmt.Errorf("witness: %w", err))
+	}
+	return b
+}
+
+// Sign registers a signer of the transaction (signed in Build or BuildDraft)
+func (b *TransactionBuilder) Sign(userID *[]byte, keyPair *KeyPair, noPubkey bool) *TransactionBuilder {
+	if !b.checkID("signature", "user_id", userID) {
+		return b
+	}
+	if keyPair == nil || keyPair.PrivateKeyStructure == nil {
+		b.fail(fmt.Errorf("signature: private key must be given (user_id=%x)", *userID))
+		return b
+	}
+	b.signers = append(b.signers, builderSigner{userID: cloneBytes(*userID), keyPair: keyPair, noPubkey: noPubkey})
+	return b
+}
+
+// Build returns the finished transaction, in which all signature slots are filled with valid signatures
+func (b *TransactionBuilder) Build() (*BBcTransaction, error) {
+	txobj, err := b.BuildDraft()
+	if err != nil {
+		return nil, err
+	}
+	for i, sig := range txobj.Signatures {
+		if sig == nil || sig.KeyType == KeyTypeNotInitialized || len(sig.Signature) == 0 {
+			if i < len(txobj.SigIndexedUsers) {
+				b.fail(fmt.Errorf("signatures[%d]: not signed (user_id=%x)", i, txobj.SigIndexedUsers[i]))
+			} else {
+				b.fail(fmt.Errorf("signatures[%d]: not signed", i))
+			}
+		}
+	}
+	if result, idx := txobj.VerifyAll(); !result {
+		b.fail(fmt.Errorf("signatures[%d]: %w", idx, ErrInvalidSignature))
+	}
+	if len(b.errs) > 0 {
+		return nil, &BuildError{Errors: b.Errors()}
+	}
+	return txobj, nil
+}
+
+// BuildDraft returns the transaction signed by the registered signers without checking the signature slots
+func (b *TransactionBuilder) BuildDraft() (*BBcTransaction, error) {
+	if b.built {
+		b.fail(errors.New("transaction has already been built"))
+		return nil, &BuildError{Errors: b.Errors()}
+	}
+	b.built = true
+	if len(b.errs) > 0 {
+		return nil, &BuildError{Errors: b.Errors()}
+	}
+	if b.schemas != nil {
+		if err := b.schemas.Validate(b.txobj); err != nil {
+			b.fail(err)
+			return nil, &BuildError{Errors: b.Errors()}
+		}
+	}
+	if b.txobj.Timestamp == 0 {
+		b.txobj.Timestamp = time.Now().UnixNano() / int64(time.Microsecond)
+	}
+	if _, err := b.txobj.Pack(); err != nil {
+		b.fail(err)
+		return nil, &BuildError{Errors: b.Errors()}
+	}
+	for _, s := range b.signers {
+		if err := b.txobj.sign(&s.userID, s.keyPair, s.noPubkey); err != nil {
+			b.fail(fmt.Errorf("signature: %w (user_id=%x)", err, s.userID))
+		}
+	}
+	if len(b.errs) > 0 {
+		return nil, &BuildError{Errors: b.Errors()}
+	}
+	return b.txobj, nil
+}
+
+// Event returns the BBcEvent object being built
+func (e *EventBuilder) Event() *BBcEvent {
+	return e.obj
+}
+
+// context returns the path of the object for error messages
+func (e *EventBuilder) context() string {
+	return fmt.Sprintf("events[%d]", e.idx)
+}
+
+// AddReferenceIndex sets an index to ReferenceIndices of the BBcEvent object
+func (e *EventBuilder) AddReferenceIndex(relIndex int) *EventBuilder {
+	if relIndex < 0 {
+		e.b.fail(fmt.Errorf("%s: invalid reference index %d", e.context(), relIndex))
+		return e
+	}
+	e.obj.AddReferenceIndex(relIndex)
+	return e
+}
+
+// SetOptionParams sets values to OptionApproverNumNumerator and OptionApproverNumDenominator in the BBcEvent object
+func (e *EventBuilder) SetOptionParams(numerator int, denominator int) *EventBuilder {
+	if numerator < 0 || denominator < numerator || denominator > 0xFFFF {
+		e.b.fail(fmt.Errorf("%s: invalid option params %d/%d", e.context(), numerator, denominator))
+		return e
+	}
+	e.obj.SetOptionParams(numerator, denominator)
+	return e
+}
+
+// AddMandatoryApprover sets userID in MandatoryApprover list of the BBcEvent object
+func (e *EventBuilder) AddMandatoryApprover(userID *[]byte) *EventBuilder {
+	if e.b.checkID(e.context(), "user_id of mandatory approver", userID) {
+		e.obj.AddMandatoryApprover(userID)
+	}
+	return e
+}
+
+// AddOptionApprover sets userID in OptionApprover list of the BBcEvent object
+func (e *EventBuilder) AddOptionApprover(userID *[]byte) *EventBuilder {
+	if e.b.checkID(e.context(), "user_id of option approver", userID) {
+		e.obj.AddOptionApprover(userID)
+	}
+	return e
+}
+
+// CreateAsset sets a BBcAsset object in the BBcEvent object
+func (e *EventBuilder) CreateAsset(userID *[]byte, fileContent *[]byte, bodyContent interface{}) *EventBuilder {
+	if !e.b.checkID(e.context()+".asset", "user_id", userID) {
+		return e
+	}
+	asset, err := newAsset(e.obj.Version, e.obj.IdLengthConf, userID, fileContent, bodyContent)
+	if err != nil {
+		e.b.fail(fmt.Errorf("%s.asset: %w", e.context(), err))
+		return e
+	}
+	e.obj.Asset = asset
+	return e
+}
+
+// Relation returns the BBcRelation object being built
+func (r *RelationBuilder) Relation() *BBcRelation {
+	return r.obj
+}
+
+// context returns the path of the object for error messages
+func (r *RelationBuilder) context() string {
+	return fmt.Sprintf("relations[%d]", r.idx)
+}
+
+// CreatePointer adds a BBcPointer object in the BBcRelation object (assetID can be nil)
+func (r *RelationBuilder) CreatePointer(transactionID, assetID *[]byte) *RelationBuilder {
+	context := fmt.Sprintf("%s.pointers[%d]", r.context(), len(r.obj.Pointers))
+	if r.b.checkID(context, "transaction_id", transactionID) {
+		r.obj.CreatePointer(transactionID, assetID)
+	}
+	return r
+}
+
+// CreateAsset sets a BBcAsset object in the BBcRelation object
+func (r *RelationBuilder) CreateAsset(userID *[]byte, fileContent *[]byte, bodyContent interface{}) *RelationBuilder {
+	if !r.b.checkID(r.context()+".asset", "user_id", userID) {
+		return r
+	}
+	asset, err := newAsset(r.obj.Version, r.obj.IdLengthConf, userID, fileContent, bodyContent)
+	if err != nil {
+		r.b.fail(fmt.Errorf("%s.asset: %w", r.context(), err))
+		return r
+	}
+	r.obj.Asset = asset
+	return r
+}
+
+// CreateAssetRaw sets a BBcAssetRaw object in the BBcRelation object (body must be string or []byte)
+func (r *RelationBuilder) CreateAssetRaw(assetID *[]byte, bodyContent interface{}) *RelationBuilder {
+	if !r.b.checkID(r.context()+".asset_raw", "asset_id", assetID) {
+		return r
+	}
+	size := 0
+	switch body := bodyContent.(type) {
+	case string:
+		size = len(body)
+	case []byte:
+		size = len(body)
+	default:
+		r.b.fail(fmt.Errorf("%s.asset_raw: body must be string or []byte", r.context()))
+		return r
+	}
+	if size > maxAssetBodySize {
+		r.b.fail(fmt.Errorf("%s.asset_raw: asset body is too large (%d bytes)", r.context(), size))
+		return r
+	}
+	r.obj.CreateAssetRaw(assetID, bodyContent)
+	return r
+}
+
+// CreateAssetHash adds an asset_id in the BBcAssetHash object in the BBcRelation object
+func (r *RelationBuilder) CreateAssetHash(assetID *[]byte) *RelationBuilder {
+	if r.b.checkID(r.context()+".asset_hash", "asset_id", assetID) {
+		r.obj.CreateAssetHash(assetID)
+	}
+	return r
+}
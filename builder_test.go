@@ -0,0 +1,160 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTransactionBuilder(t *testing.T) {
+	assetgroup := GetIdentifier("asset_group_id1,,,,,,,", defaultIDLength)
+	txid1 := GetIdentifier("0123456789abcdef0123456789abcdef", defaultIDLength)
+	asid1 := GetIdentifier("123456789abcdef0123456789abcdef0", defaultIDLength)
+	keypair, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+	refTxObj := makeBaseTx(idLengthConfig)
+
+	t.Run("build transaction", func(t *testing.T) {
+		txobj, err := NewTransactionBuilder(nil).
+			AddEvent(&assetgroup, func(e *EventBuilder) {
+				e.AddMandatoryApprover(&txtest_u5).CreateAsset(&txtest_u5, nil, map[string]int{"amount": 10})
+			}).
+			AddRelation(&assetgroup, func(r *RelationBuilder) {
+				r.CreatePointer(&txid1, &asid1).CreateAsset(&txtest_u1, nil, "testString12345XXX")
+			}).
+			CreateReference(&assetgroup, &refTxObj, 0).
+			AddWitness(&txtest_u5).
+			Sign(&txtest_u1, keypair, false).
+			Sign(&txtest_u2, keypair, false).
+			Sign(&txtest_u3, keypair, false).
+			Sign(&txtest_u5, keypair, false).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dat, _ := Serialize(txobj, FormatZlib)
+		recovered, err := Deserialize(dat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(recovered.Signatures) != 4 {
+			t.Fatalf("num of signatures must be 4 (%d)", len(recovered.Signatures))
+		}
+		if result, _ := recovered.VerifyAll(); !result {
+			t.Fatal("Not recovered correctly...")
+		}
+	})
+
+	t.Run("timestamp", func(t *testing.T) {
+		txobj, err := NewTransactionBuilder(nil).SetTimestamp(0).
+			AddRelation(&assetgroup, func(r *RelationBuilder) { r.CreateAsset(&txtest_u1, nil, "body") }).
+			BuildDraft()
+		if err != nil || txobj.Timestamp == 0 {
+			t.Fatalf("current time must be set in build: %v", err)
+		}
+		txobj, err = NewTransactionBuilder(nil).SetTimestamp(1).
+			AddRelation(&assetgroup, func(r *RelationBuilder) { r.CreateAsset(&txtest_u1, nil, "body") }).
+			BuildDraft()
+		if err != nil || txobj.Timestamp != 1 {
+			t.Fatalf("given timestamp must be kept: %v", err)
+		}
+	})
+
+	t.Run("unsigned slot", func(t *testing.T) {
+		b := NewTransactionBuilder(nil).
+			AddEvent(&assetgroup, nil).
+			CreateReference(&assetgroup, &refTxObj, 0).
+			Sign(&txtest_u1, keypair, false)
+		_, err := b.Build()
+		if err == nil {
+			t.Fatal("transaction with empty signatures must not be built")
+		}
+		if len(b.Errors()) != 2 || !strings.Contains(err.Error(), "not signed") {
+			t.Fatalf("errors for the unsigned slots must be recorded: %v", err)
+		}
+
+		draft, err := NewTransactionBuilder(nil).
+			AddEvent(&assetgroup, nil).
+			CreateReference(&assetgroup, &refTxObj, 0).
+			Sign(&txtest_u1, keypair, false).
+			BuildDraft()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewPartiallySignedTransaction(draft); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("record errors", func(t *testing.T) {
+		b := NewTransactionBuilder(nil).
+			AddEvent(&assetgroup, func(e *EventBuilder) {
+				e.SetOptionParams(2, 1).CreateAsset(&txtest_u1, nil, make([]byte, maxAssetBodySize+1))
+			}).
+			AddRelation(nil, nil).
+			CreateReference(&assetgroup, &refTxObj, 5).
+			AddWitness(nil).
+			Sign(&txtest_u1, &KeyPair{}, false)
+		if b.Err() == nil || len(b.Errors()) != 6 {
+			t.Fatalf("all errors must be recorded: %v", b.Errors())
+		}
+		_, err := b.Build()
+		var buildErr *BuildError
+		if !errors.As(err, &buildErr) || len(buildErr.Errors) != 6 {
+			t.Fatalf("BuildError must be returned: %v", err)
+		}
+		if !errors.Is(err, b.Err()) {
+			t.Fatal("BuildError must wrap the first error")
+		}
+		if !strings.Contains(err.Error(), "references[0]: no event (index=5)") {
+			t.Fatalf("error must include the object path: %v", err)
+		}
+		if _, err := b.Build(); err == nil {
+			t.Fatal("builder must not be reused")
+		}
+	})
+
+	t.Run("invalid content detected in build", func(t *testing.T) {
+		_, err := NewTransactionBuilder(nil).
+			AddEvent(&assetgroup, func(e *EventBuilder) {
+				e.SetOptionParams(1, 2).AddOptionApprover(&txtest_u3)
+			}).
+			Build()
+		if err == nil || !strings.Contains(err.Error(), "OptionApproverNumDenominator") {
+			t.Fatalf("invalid event must be detected: %v", err)
+		}
+	})
+
+	t.Run("fluent methods do not store broken objects", func(t *testing.T) {
+		txobj := BBcTransaction{Version: 2}
+		txobj.SetIdLengthConf(&idLengthConfig)
+		txobj.AddEvent(&assetgroup, nil).AddWitness(&txtest_u1)
+		txobj.Sign(&txtest_u1, &KeyPair{}, false)
+		if txobj.Signatures[0].KeyType != KeyTypeNotInitialized {
+			t.Fatal("signature must not be stored when signing fails")
+		}
+		txobj.CreateReference(&assetgroup, &refTxObj, 3)
+		if len(txobj.References) != 0 {
+			t.Fatal("reference to non-existent event must not be stored")
+		}
+		ref := BBcReference{}
+		if err := ref.AddSignature(&txtest_u1, &BBcSignature{}); err == nil {
+			t.Fatal("error must be returned without transaction")
+		}
+	})
+}
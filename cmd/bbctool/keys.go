@@ -0,0 +1,124 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bbclib"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// compressionMode returns the compression mode of public key from -compress option
+func compressionMode(compressed bool) int {
+	if compressed {
+		return 0
+	}
+	return bbclib.DefaultCompressionMode
+}
+
+// readKeyPair reads PEM formatted key file
+func readKeyPair(path string, compressed bool) (*bbclib.KeyPair, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keypair := bbclib.KeyPair{}
+	if err := keypair.ConvertFromPem(string(dat), compressionMode(compressed)); err != nil {
+		return nil, err
+	}
+	return &keypair, nil
+}
+
+// writeOutput writes data into the file or stdout (if path is empty)
+func writeOutput(path string, dat []byte, stdout io.Writer) error {
+	if path == "" {
+		_, err := stdout.Write(dat)
+		return err
+	}
+	return ioutil.WriteFile(path, dat, 0600)
+}
+
+// runKeygen generates a new key pair
+func runKeygen(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	out := fs.String("out", "", "output file of the private key (stdout if omitted)")
+	pubOut := fs.String("pubout", "", "output file of the public key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keypair, err := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	if err != nil {
+		return err
+	}
+	privPem, err := keypair.OutputPem()
+	if err != nil {
+		return err
+	}
+	if err := writeOutput(*out, []byte(privPem), stdout); err != nil {
+		return err
+	}
+	if *pubOut != "" {
+		pubPem, err := keypair.OutputPublicKeyPem()
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(*pubOut, []byte(pubPem), 0644)
+	}
+	return nil
+}
+
+// runPubkey outputs the public key of the given key
+func runPubkey(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("pubkey", flag.ContinueOnError)
+	keyFile := fs.String("key", "", "PEM formatted key file (private or public key)")
+	format := fs.String("format", "pem", "output format (pem, der or hex)")
+	compressed := fs.Bool("compress", false, "output compressed public key (hex format only)")
+	out := fs.String("out", "", "output file (stdout if omitted)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *keyFile == "" {
+		return errors.New("-key is required")
+	}
+
+	keypair, err := readKeyPair(*keyFile, *compressed)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "pem":
+		pubPem, err := keypair.OutputPublicKeyPem()
+		if err != nil {
+			return err
+		}
+		return writeOutput(*out, []byte(pubPem), stdout)
+	case "der":
+		der := keypair.OutputPublicKeyDer()
+		if der == nil {
+			return errors.New("failed to export the public key")
+		}
+		return writeOutput(*out, der, stdout)
+	case "hex":
+		return writeOutput(*out, []byte(fmt.Sprintf("%x\n", keypair.Pubkey)), stdout)
+	}
+	return fmt.Errorf("unknown format: %s", *format)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Command bbctool is a command-line utility for keys and transactions of BBc-1.
+
+Usage:
+
+	bbctool <command> [options]
+
+Commands:
+
+	keygen    generate a new key pair and output it in PEM format
+	pubkey    output the public key of a PEM formatted key
+	build     build a transaction from a JSON spec
+	sign      sign a transaction with a PEM formatted private key
+	verify    verify all signatures in a transaction
+	dump      output the content of a transaction
+	convert   convert a serialized transaction into another format/encoding
+	vectors   generate or check a corpus of cross-language test vectors
+
+Serialized transaction files are read and written in "raw" (binary), "hex" or "base64" encoding (-encoding option).
+The -schema option of verify checks the asset bodies against JSON schemas given per asset_group_id.
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// command is a sub command of bbctool
+type command struct {
+	description string
+	run         func(args []string, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"keygen":  {"generate a new key pair and output it in PEM format", runKeygen},
+	"pubkey":  {"output the public key of a PEM formatted key", runPubkey},
+	"build":   {"build a transaction from a JSON spec", runBuild},
+	"sign":    {"sign a transaction with a PEM formatted private key", runSign},
+	"verify":  {"verify all signatures in a transaction", runVerify},
+	"dump":    {"output the content of a transaction", runDump},
+	"convert": {"convert a serialized transaction into another format/encoding", runConvert},
+	"vectors": {"generate or check a corpus of cross-language test vectors", runVectors},
+}
+
+// usage outputs the list of commands
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: bbctool <command> [options]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-9s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "run 'bbctool <command> -h' for the options of each command")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] == "-h" || os.Args[1] == "help" {
+			usage(os.Stdout)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", os.Args[1])
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "bbctool %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bbclib"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	user1      = bbclib.GetIdentifier("user1", 32)
+	user2      = bbclib.GetIdentifier("user2", 32)
+	assetGroup = bbclib.GetIdentifier("asset_group", 32)
+)
+
+func runCommand(t *testing.T, name string, args ...string) string {
+	out := new(bytes.Buffer)
+	if err := commands[name].run(args, out); err != nil {
+		t.Fatalf("bbctool %s failed (%v)", name, err)
+	}
+	return out.String()
+}
+
+func TestBBcTool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bbctool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	t.Run("keygen and pubkey", func(t *testing.T) {
+		runCommand(t, "keygen", "-out", path("key1.pem"), "-pubout", path("pub1.pem"))
+		runCommand(t, "keygen", "-out", path("key2.pem"))
+		pub := runCommand(t, "pubkey", "-key", path("key1.pem"))
+		pub2, _ := ioutil.ReadFile(path("pub1.pem"))
+		if pub != string(pub2) {
+			t.Fatal("public key mismatch")
+		}
+		if hexPub := runCommand(t, "pubkey", "-key", path("key1.pem"), "-format", "hex"); len(strings.TrimSpace(hexPub)) != 130 {
+			t.Fatalf("invalid public key: %s", hexPub)
+		}
+	})
+
+	t.Run("build, sign and verify", func(t *testing.T) {
+		spec := fmt.Sprintf(`{
+		  "events": [{
+		    "asset_group_id": "%x", "mandatory_approvers": ["%x"],
+		    "asset": {"user_id": "%x", "body_object": {"amount": 100, "name": "token"}}
+		  }],
+		  "relations": [{"asset_group_id": "%x", "asset": {"user_id": "%x", "body": "relation asset"}}],
+		  "witnesses": ["%x", "%x"]
+		}`, assetGroup, user1, user1, assetGroup, user2, user1, user2)
+		if err := ioutil.WriteFile(path("spec.json"), []byte(spec), 0644); err != nil {
+			t.Fatal(err)
+		}
+		runCommand(t, "build", "-spec", path("spec.json"), "-out", path("tx.bin"), "-format", "zlib")
+		runCommand(t, "sign", "-in", path("tx.bin"), "-out", path("tx.bin"), "-key", path("key1.pem"), "-user", fmt.Sprintf("%x", user1))
+		runCommand(t, "sign", "-in", path("tx.bin"), "-out", path("tx.bin"), "-key", path("key2.pem"), "-user", fmt.Sprintf("%x", user2))
+
+		out := runCommand(t, "verify", "-in", path("tx.bin"))
+		if !strings.HasPrefix(out, "OK: ") {
+			t.Fatalf("unexpected output: %s", out)
+		}
+		schema := `{"type": "object", "required": ["amount"], "properties": {"amount": {"type": "integer", "minimum": 0}}}`
+		if err := ioutil.WriteFile(path("schema.json"), []byte(schema), 0644); err != nil {
+			t.Fatal(err)
+		}
+		schemaOpt := fmt.Sprintf("%x=%s", assetGroup, path("schema.json"))
+		if err := commands["verify"].run([]string{"-in", path("tx.bin"), "-schema", schemaOpt}, new(bytes.Buffer)); err == nil || !strings.Contains(err.Error(), "relations[0].asset.asset_body#") ||
+			strings.Contains(err.Error(), "events[0]") {
+			t.Fatalf("only the relation asset (not JSON) must violate the schema: %v", err)
+		}
+		dump := runCommand(t, "dump", "-in", path("tx.bin"))
+		if !strings.Contains(dump, "format: zlib") || !strings.Contains(dump, "Signature[]: 2") {
+			t.Fatalf("unexpected output: %s", dump)
+		}
+	})
+
+	t.Run("reference to another transaction", func(t *testing.T) {
+		spec := fmt.Sprintf(`{
+		  "references": [{"asset_group_id": "%x", "transaction_file": "tx.bin", "event_index": 0}],
+		  "events": [{"asset_group_id": "%x", "reference_indices": [0], "mandatory_approvers": ["%x"], "asset": {"user_id": "%x", "body": "next"}}]
+		}`, assetGroup, assetGroup, user2, user2)
+		if err := ioutil.WriteFile(path("spec2.json"), []byte(spec), 0644); err != nil {
+			t.Fatal(err)
+		}
+		runCommand(t, "build", "-spec", path("spec2.json"), "-out", path("tx2.hex"), "-encoding", "hex")
+		runCommand(t, "convert", "-in", path("tx.bin"), "-out", path("tx.hex"), "-to", "hex")
+		runCommand(t, "sign", "-in", path("tx2.hex"), "-out", path("tx2.hex"), "-encoding", "hex", "-ref", path("tx.hex"), "-key", path("key1.pem"), "-user", fmt.Sprintf("%x", user1))
+		out := runCommand(t, "verify", "-in", path("tx2.hex"), "-encoding", "hex")
+		if !strings.Contains(out, "(1 signatures)") {
+			t.Fatalf("unexpected output: %s", out)
+		}
+	})
+
+	t.Run("option approver of a referred event", func(t *testing.T) {
+		user3 := bbclib.GetIdentifier("user3", 32)
+		spec := fmt.Sprintf(`{
+		  "events": [{"asset_group_id": "%x", "mandatory_approvers": ["%x"], "option_approvers": ["%x", "%x"], "option_approver_num": 1,
+		    "asset": {"user_id": "%x", "body": "shared"}}],
+		  "witnesses": ["%x"]
+		}`, assetGroup, user1, user2, user3, user1, user1)
+		if err := ioutil.WriteFile(path("spec3.json"), []byte(spec), 0644); err != nil {
+			t.Fatal(err)
+		}
+		runCommand(t, "build", "-spec", path("spec3.json"), "-out", path("tx3.bin"))
+		runCommand(t, "sign", "-in", path("tx3.bin"), "-out", path("tx3.bin"), "-key", path("key1.pem"), "-user", fmt.Sprintf("%x", user1))
+
+		spec = fmt.Sprintf(`{
+		  "references": [{"asset_group_id": "%x", "transaction_file": "tx3.bin", "event_index": 0}],
+		  "events": [{"asset_group_id": "%x", "reference_indices": [0], "mandatory_approvers": ["%x"], "asset": {"user_id": "%x", "body": "next"}}]
+		}`, assetGroup, assetGroup, user1, user1)
+		if err := ioutil.WriteFile(path("spec4.json"), []byte(spec), 0644); err != nil {
+			t.Fatal(err)
+		}
+		runCommand(t, "build", "-spec", path("spec4.json"), "-out", path("tx4.bin"))
+		runCommand(t, "sign", "-in", path("tx4.bin"), "-out", path("tx4.bin"), "-ref", path("tx3.bin"), "-key", path("key1.pem"), "-user", fmt.Sprintf("%x", user1))
+		runCommand(t, "sign", "-in", path("tx4.bin"), "-out", path("tx4.bin"), "-ref", path("tx3.bin"), "-key", path("key2.pem"), "-user", fmt.Sprintf("%x", user2))
+		out := runCommand(t, "verify", "-in", path("tx4.bin"))
+		if !strings.Contains(out, "(2 signatures)") {
+			t.Fatalf("unexpected output: %s", out)
+		}
+		if err := commands["sign"].run([]string{"-in", path("tx4.bin"), "-out", path("tx4_wrong.bin"), "-key", path("key2.pem"), "-user", fmt.Sprintf("%x", user2)}, ioutil.Discard); err == nil {
+			t.Fatal("option approver must not have a slot without the referred transaction")
+		}
+	})
+
+	t.Run("convert", func(t *testing.T) {
+		runCommand(t, "convert", "-in", path("tx.bin"), "-out", path("tx.b64"), "-to", "base64", "-format", "plain")
+		runCommand(t, "convert", "-in", path("tx.b64"), "-out", path("tx_plain.bin"), "-from", "base64")
+		tx1, err := readTransaction(path("tx.bin"), encodingRaw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx2, err := readTransaction(path("tx_plain.bin"), encodingRaw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tx1.Equal(tx2) || !bytes.Equal(tx1.TransactionID, tx2.TransactionID) {
+			t.Fatal("Not converted correctly...")
+		}
+	})
+
+	t.Run("vectors", func(t *testing.T) {
+		runCommand(t, "vectors", "-out", path("vectors.json"))
+		if out := runCommand(t, "vectors", "-check", path("vectors.json")); !strings.Contains(out, "vectors passed") || strings.Contains(out, "FAIL") {
+			t.Fatalf("unexpected output: %s", out)
+		}
+		if err := commands["vectors"].run([]string{"-check", path("tx.bin")}, ioutil.Discard); err == nil {
+			t.Fatal("invalid corpus must be rejected")
+		}
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		if err := commands["sign"].run([]string{"-in", path("tx.bin"), "-key", path("key1.pem"), "-user", "xyz"}, ioutil.Discard); err == nil {
+			t.Fatal("invalid user_id must be rejected")
+		}
+		wrongUser := fmt.Sprintf("%x", bbclib.GetIdentifier("unknown user", 32))
+		if err := commands["sign"].run([]string{"-in", path("tx.bin"), "-out", path("tx_wrong.bin"), "-key", path("key1.pem"), "-user", wrongUser}, ioutil.Discard); err == nil {
+			t.Fatal("user without signature slot must be rejected")
+		}
+		if _, err := os.Stat(path("tx_wrong.bin")); !os.IsNotExist(err) {
+			t.Fatal("transaction must not be written if not signed")
+		}
+		if err := commands["build"].run([]string{"-spec", path("none.json")}, ioutil.Discard); err == nil {
+			t.Fatal("missing spec file must be rejected")
+		}
+	})
+}
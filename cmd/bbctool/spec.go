@@ -0,0 +1,359 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bbclib"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+)
+
+/*
+Transaction spec
+
+A transaction spec is a JSON document describing a transaction to be built. All IDs are given in hex.
+File paths (asset file and referred transaction) are relative to the directory of the spec file.
+
+	{
+	  "id_length": {"transaction_id": 32, "user_id": 32, "asset_group_id": 32, "asset_id": 32, "nonce": 32},
+	  "timestamp": 0,
+	  "events": [{
+	    "asset_group_id": "...", "reference_indices": [0],
+	    "mandatory_approvers": ["..."], "option_approvers": ["..."], "option_approver_num": 1,
+	    "asset": {"user_id": "...", "body": "string body", "body_object": {"key": "value"}, "body_type": 1, "file": "path"}
+	  }],
+	  "references": [{"asset_group_id": "...", "transaction_file": "path", "encoding": "raw", "event_index": 0}],
+	  "relations": [{
+	    "asset_group_id": "...", "pointers": [{"transaction_id": "...", "asset_id": "..."}],
+	    "asset": {...}, "asset_raw": {"asset_id": "...", "body": "..."}, "asset_hash": ["..."]
+	  }],
+	  "witnesses": ["..."],
+	  "cross_ref": {"domain_id": "...", "transaction_id": "..."}
+	}
+*/
+type (
+	idLengthSpec struct {
+		TransactionID int `json:"transaction_id"`
+		UserID        int `json:"user_id"`
+		AssetGroupID  int `json:"asset_group_id"`
+		AssetID       int `json:"asset_id"`
+		Nonce         int `json:"nonce"`
+	}
+
+	assetSpec struct {
+		UserID     string      `json:"user_id"`
+		Body       *string     `json:"body"`
+		BodyObject interface{} `json:"body_object"`
+		BodyType   uint16      `json:"body_type"`
+		File       string      `json:"file"`
+	}
+
+	eventSpec struct {
+		AssetGroupID       string     `json:"asset_group_id"`
+		ReferenceIndices   []int      `json:"reference_indices"`
+		MandatoryApprovers []string   `json:"mandatory_approvers"`
+		OptionApprovers    []string   `json:"option_approvers"`
+		OptionApproverNum  int        `json:"option_approver_num"`
+		Asset              *assetSpec `json:"asset"`
+	}
+
+	referenceSpec struct {
+		AssetGroupID    string `json:"asset_group_id"`
+		TransactionFile string `json:"transaction_file"`
+		Encoding        string `json:"encoding"`
+		EventIndex      int    `json:"event_index"`
+	}
+
+	pointerSpec struct {
+		TransactionID string `json:"transaction_id"`
+		AssetID       string `json:"asset_id"`
+	}
+
+	assetRawSpec struct {
+		AssetID string `json:"asset_id"`
+		Body    string `json:"body"`
+	}
+
+	relationSpec struct {
+		AssetGroupID string        `json:"asset_group_id"`
+		Pointers     []pointerSpec `json:"pointers"`
+		Asset        *assetSpec    `json:"asset"`
+		AssetRaw     *assetRawSpec `json:"asset_raw"`
+		AssetHash    []string      `json:"asset_hash"`
+	}
+
+	crossRefSpec struct {
+		DomainID      string `json:"domain_id"`
+		TransactionID string `json:"transaction_id"`
+	}
+
+	transactionSpec struct {
+		IdLength   *idLengthSpec   `json:"id_length"`
+		Timestamp  int64           `json:"timestamp"`
+		Events     []eventSpec     `json:"events"`
+		References []referenceSpec `json:"references"`
+		Relations  []relationSpec  `json:"relations"`
+		Witnesses  []string        `json:"witnesses"`
+		CrossRef   *crossRefSpec   `json:"cross_ref"`
+	}
+)
+
+// decodeID decodes hex string of an ID
+func decodeID(name, val string) ([]byte, error) {
+	if val == "" {
+		return nil, fmt.Errorf("%s is required", name)
+	}
+	id, err := hex.DecodeString(val)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a hex string (%v)", name, err)
+	}
+	return id, nil
+}
+
+// normalizeNumbers converts integral float64 values (decoded from JSON) into int64, so that they are encoded as integer in the asset body
+func normalizeNumbers(val interface{}) interface{} {
+	switch v := val.(type) {
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt64 && v <= math.MaxInt64 {
+			return int64(v)
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = normalizeNumbers(v[k])
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeNumbers(v[i])
+		}
+	}
+	return val
+}
+
+// buildFromSpecFile reads a transaction spec file and builds the transaction
+func buildFromSpecFile(path string) (*bbclib.BBcTransaction, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := transactionSpec{}
+	if err := json.Unmarshal(dat, &spec); err != nil {
+		return nil, err
+	}
+	return buildFromSpec(&spec, filepath.Dir(path))
+}
+
+// buildFromSpec builds a transaction according to the spec
+func buildFromSpec(spec *transactionSpec, baseDir string) (*bbclib.BBcTransaction, error) {
+	txobj := bbclib.MakeTransaction(0, 0, false)
+	if spec.IdLength != nil {
+		conf := txobj.IdLengthConf
+		if spec.IdLength.TransactionID > 0 {
+			conf.TransactionIdLength = spec.IdLength.TransactionID
+		}
+		if spec.IdLength.UserID > 0 {
+			conf.UserIdLength = spec.IdLength.UserID
+		}
+		if spec.IdLength.AssetGroupID > 0 {
+			conf.AssetGroupIdLength = spec.IdLength.AssetGroupID
+		}
+		if spec.IdLength.AssetID > 0 {
+			conf.AssetIdLength = spec.IdLength.AssetID
+		}
+		if spec.IdLength.Nonce > 0 {
+			conf.NonceLength = spec.IdLength.Nonce
+		}
+		txobj.SetIdLengthConf(&conf)
+	}
+	if spec.Timestamp != 0 {
+		txobj.Timestamp = spec.Timestamp
+	}
+
+	for i, r := range spec.References {
+		if err := addReference(txobj, &r, baseDir); err != nil {
+			return nil, fmt.Errorf("references[%d]: %v", i, err)
+		}
+	}
+	for i, e := range spec.Events {
+		if err := addEvent(txobj, &e, baseDir); err != nil {
+			return nil, fmt.Errorf("events[%d]: %v", i, err)
+		}
+	}
+	for i, r := range spec.Relations {
+		if err := addRelation(txobj, &r, baseDir); err != nil {
+			return nil, fmt.Errorf("relations[%d]: %v", i, err)
+		}
+	}
+	for i, w := range spec.Witnesses {
+		userID, err := decodeID(fmt.Sprintf("witnesses[%d]", i), w)
+		if err != nil {
+			return nil, err
+		}
+		txobj.AddWitness(&userID)
+	}
+	if spec.CrossRef != nil {
+		domainID, err := decodeID("cross_ref.domain_id", spec.CrossRef.DomainID)
+		if err != nil {
+			return nil, err
+		}
+		txid, err := decodeID("cross_ref.transaction_id", spec.CrossRef.TransactionID)
+		if err != nil {
+			return nil, err
+		}
+		txobj.CreateCrossRef(&domainID, &txid)
+	}
+	return txobj, nil
+}
+
+// makeAsset creates the BBcAsset object according to the spec
+func makeAsset(conf *bbclib.BBcIdConfig, spec *assetSpec, baseDir string) (*bbclib.BBcAsset, error) {
+	userID, err := decodeID("asset.user_id", spec.UserID)
+	if err != nil {
+		return nil, err
+	}
+	obj := bbclib.BBcAsset{}
+	obj.SetIdLengthConf(conf)
+	obj.Add(&userID)
+	if spec.File != "" {
+		dat, err := ioutil.ReadFile(filepath.Join(baseDir, spec.File))
+		if err != nil {
+			return nil, err
+		}
+		obj.AddFile(&dat)
+	}
+	if spec.Body != nil && spec.BodyObject != nil {
+		return nil, errors.New("asset can have either body or body_object")
+	}
+	if spec.Body != nil {
+		obj.AddBodyString(*spec.Body)
+	} else if spec.BodyObject != nil {
+		bodyType := spec.BodyType
+		if bodyType == bbclib.AssetBodyTypeRaw {
+			bodyType = bbclib.AssetBodyTypeMsgpack
+		}
+		if err := obj.AddBodyObjectWithType(bodyType, normalizeNumbers(spec.BodyObject)); err != nil {
+			return nil, err
+		}
+	}
+	return &obj, nil
+}
+
+// addEvent adds a BBcEvent object according to the spec
+func addEvent(txobj *bbclib.BBcTransaction, spec *eventSpec, baseDir string) error {
+	assetGroupID, err := decodeID("asset_group_id", spec.AssetGroupID)
+	if err != nil {
+		return err
+	}
+	txobj.AddEvent(&assetGroupID, &spec.ReferenceIndices)
+	evt := txobj.Events[len(txobj.Events)-1]
+	for i, a := range spec.MandatoryApprovers {
+		userID, err := decodeID(fmt.Sprintf("mandatory_approvers[%d]", i), a)
+		if err != nil {
+			return err
+		}
+		evt.AddMandatoryApprover(&userID)
+	}
+	for i, a := range spec.OptionApprovers {
+		userID, err := decodeID(fmt.Sprintf("option_approvers[%d]", i), a)
+		if err != nil {
+			return err
+		}
+		evt.AddOptionApprover(&userID)
+	}
+	if len(spec.OptionApprovers) > 0 {
+		evt.SetOptionParams(spec.OptionApproverNum, len(spec.OptionApprovers))
+	}
+	if spec.Asset != nil {
+		ast, err := makeAsset(evt.IdLengthConf, spec.Asset, baseDir)
+		if err != nil {
+			return err
+		}
+		evt.Asset = ast
+	}
+	return nil
+}
+
+// addReference adds a BBcReference object according to the spec
+func addReference(txobj *bbclib.BBcTransaction, spec *referenceSpec, baseDir string) error {
+	assetGroupID, err := decodeID("asset_group_id", spec.AssetGroupID)
+	if err != nil {
+		return err
+	}
+	if spec.TransactionFile == "" {
+		return errors.New("transaction_file is required")
+	}
+	refTx, err := readTransaction(filepath.Join(baseDir, spec.TransactionFile), spec.Encoding)
+	if err != nil {
+		return err
+	}
+	if spec.EventIndex < 0 || spec.EventIndex >= len(refTx.Events) {
+		return fmt.Errorf("no event (index=%d) in the referred transaction", spec.EventIndex)
+	}
+	txobj.CreateReference(&assetGroupID, refTx, spec.EventIndex)
+	return nil
+}
+
+// addRelation adds a BBcRelation object according to the spec
+func addRelation(txobj *bbclib.BBcTransaction, spec *relationSpec, baseDir string) error {
+	assetGroupID, err := decodeID("asset_group_id", spec.AssetGroupID)
+	if err != nil {
+		return err
+	}
+	txobj.AddRelation(&assetGroupID)
+	rtn := txobj.Relations[len(txobj.Relations)-1]
+	for i, p := range spec.Pointers {
+		txid, err := decodeID(fmt.Sprintf("pointers[%d].transaction_id", i), p.TransactionID)
+		if err != nil {
+			return err
+		}
+		if p.AssetID == "" {
+			rtn.CreatePointer(&txid, nil)
+			continue
+		}
+		asid, err := decodeID(fmt.Sprintf("pointers[%d].asset_id", i), p.AssetID)
+		if err != nil {
+			return err
+		}
+		rtn.CreatePointer(&txid, &asid)
+	}
+	if spec.Asset != nil {
+		ast, err := makeAsset(rtn.IdLengthConf, spec.Asset, baseDir)
+		if err != nil {
+			return err
+		}
+		rtn.Asset = ast
+	}
+	if spec.AssetRaw != nil {
+		asid, err := decodeID("asset_raw.asset_id", spec.AssetRaw.AssetID)
+		if err != nil {
+			return err
+		}
+		rtn.CreateAssetRaw(&asid, spec.AssetRaw.Body)
+	}
+	for i, a := range spec.AssetHash {
+		asid, err := decodeID(fmt.Sprintf("asset_hash[%d]", i), a)
+		if err != nil {
+			return err
+		}
+		rtn.CreateAssetHash(&asid)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bbclib"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Encodings of serialized transaction files
+const (
+	encodingRaw    = "raw"
+	encodingHex    = "hex"
+	encodingBase64 = "base64"
+)
+
+// decodeData decodes file content in the given encoding
+func decodeData(dat []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", encodingRaw:
+		return dat, nil
+	case encodingHex:
+		return hex.DecodeString(string(bytes.TrimSpace(dat)))
+	case encodingBase64:
+		return base64.StdEncoding.DecodeString(string(bytes.TrimSpace(dat)))
+	}
+	return nil, fmt.Errorf("unknown encoding: %s", encoding)
+}
+
+// encodeData encodes data in the given encoding
+func encodeData(dat []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", encodingRaw:
+		return dat, nil
+	case encodingHex:
+		return []byte(hex.EncodeToString(dat) + "\n"), nil
+	case encodingBase64:
+		return []byte(base64.StdEncoding.EncodeToString(dat) + "\n"), nil
+	}
+	return nil, fmt.Errorf("unknown encoding: %s", encoding)
+}
+
+// parseFormat returns the header value of serialized data for -format option
+func parseFormat(format string) (uint16, error) {
+	switch format {
+	case "plain":
+		return bbclib.FormatPlain, nil
+	case "zlib":
+		return bbclib.FormatZlib, nil
+	}
+	return 0, fmt.Errorf("unknown format: %s", format)
+}
+
+// formatName returns the name of the header value of serialized data
+func formatName(formatType uint16) string {
+	switch formatType {
+	case bbclib.FormatPlain:
+		return "plain"
+	case bbclib.FormatZlib:
+		return "zlib"
+	}
+	return fmt.Sprintf("unknown(0x%04x)", formatType)
+}
+
+// readSerialized reads a serialized transaction file and returns the serialized data
+func readSerialized(path, encoding string) ([]byte, error) {
+	if path == "" {
+		return nil, errors.New("-in is required")
+	}
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeData(dat, encoding)
+}
+
+// readTransaction reads a serialized transaction file and deserializes it
+func readTransaction(path, encoding string) (*bbclib.BBcTransaction, error) {
+	dat, err := readSerialized(path, encoding)
+	if err != nil {
+		return nil, err
+	}
+	return bbclib.Deserialize(dat)
+}
+
+// writeTransaction serializes the transaction and writes it into the file
+func writeTransaction(txobj *bbclib.BBcTransaction, path, format, encoding string, stdout io.Writer) error {
+	formatType, err := parseFormat(format)
+	if err != nil {
+		return err
+	}
+	dat, err := bbclib.Serialize(txobj, formatType)
+	if err != nil {
+		return err
+	}
+	dat, err = encodeData(dat, encoding)
+	if err != nil {
+		return err
+	}
+	return writeOutput(path, dat, stdout)
+}
+
+// fileList is a flag.Value for an option that can be given multiple times
+type fileList []string
+
+func (l *fileList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *fileList) Set(val string) error {
+	*l = append(*l, val)
+	return nil
+}
+
+// relinkReferences links the BBcReference objects in the transaction to the referred transactions
+// The signer slots of the approvers in the referred events are restored, so that the approvers can sign the deserialized transaction.
+func relinkReferences(txobj *bbclib.BBcTransaction, refFiles []string, encoding string) error {
+	for _, path := range refFiles {
+		refTx, err := readTransaction(path, encoding)
+		if err != nil {
+			return err
+		}
+		linked := false
+		for _, ref := range txobj.References {
+			if len(ref.TransactionID) == 0 || !bytes.HasPrefix(refTx.TransactionID, ref.TransactionID) || ref.RefTransaction != nil {
+				continue
+			}
+			if int(ref.EventIndexInRef) >= len(refTx.Events) {
+				return fmt.Errorf("no event (index=%d) in %s", ref.EventIndexInRef, path)
+			}
+			ref.Add(nil, refTx, -1)
+			linked = true
+		}
+		if !linked {
+			return fmt.Errorf("%s is not referred in the transaction", path)
+		}
+	}
+	return nil
+}
+
+// runBuild builds a transaction from a JSON spec
+func runBuild(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	specFile := fs.String("spec", "", "JSON spec file of the transaction")
+	out := fs.String("out", "", "output file (stdout if omitted)")
+	format := fs.String("format", "plain", "serialization format (plain or zlib)")
+	encoding := fs.String("encoding", encodingRaw, "output encoding (raw, hex or base64)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *specFile == "" {
+		return errors.New("-spec is required")
+	}
+
+	txobj, err := buildFromSpecFile(*specFile)
+	if err != nil {
+		return err
+	}
+	return writeTransaction(txobj, *out, *format, *encoding, stdout)
+}
+
+// runSign signs a transaction
+func runSign(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("sign", flag.ContinueOnError)
+	in := fs.String("in", "", "serialized transaction file")
+	out := fs.String("out", "", "output file (stdout if omitted)")
+	keyFile := fs.String("key", "", "PEM formatted private key file")
+	user := fs.String("user", "", "user_id of the signer in hex")
+	noPubkey := fs.Bool("nopubkey", false, "do not include the public key in the signature")
+	var refFiles fileList
+	fs.Var(&refFiles, "ref", "serialized file of a referred transaction (can be given multiple times)")
+	format := fs.String("format", "", "serialization format of the output (plain or zlib, same as input if omitted)")
+	encoding := fs.String("encoding", encodingRaw, "input/output encoding (raw, hex or base64)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *keyFile == "" {
+		return errors.New("-key is required")
+	}
+	userID, err := decodeID("-user", *user)
+	if err != nil {
+		return err
+	}
+
+	dat, err := readSerialized(*in, *encoding)
+	if err != nil {
+		return err
+	}
+	txobj, err := bbclib.Deserialize(dat)
+	if err != nil {
+		return err
+	}
+	if err := relinkReferences(txobj, refFiles, *encoding); err != nil {
+		return err
+	}
+	keypair, err := readKeyPair(*keyFile, false)
+	if err != nil {
+		return err
+	}
+	if err := signSlot(txobj, userID, keypair, *noPubkey); err != nil {
+		return err
+	}
+
+	if *format == "" {
+		*format = formatName(binary.LittleEndian.Uint16(dat))
+	}
+	return writeTransaction(txobj, *out, *format, *encoding, stdout)
+}
+
+// signSlot signs the transaction and checks that the signature filled a slot reserved for the user
+// The slot is either in SigIndexedUsers (mandatory approvers) or a placeholder for the option approvers of a referred event.
+func signSlot(txobj *bbclib.BBcTransaction, userID []byte, keypair *bbclib.KeyPair, noPubkey bool) error {
+	before := make([]*bbclib.BBcSignature, len(txobj.Signatures))
+	copy(before, txobj.Signatures)
+	txobj.Sign(&userID, keypair, noPubkey)
+	if len(txobj.Signatures) != len(before) {
+		return fmt.Errorf("user_id %x has no signature slot in the transaction", userID)
+	}
+	for i, sig := range txobj.Signatures {
+		if sig != before[i] {
+			if sig == nil || len(sig.Signature) == 0 {
+				break
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to sign the transaction (user_id=%x)", userID)
+}
+
+// runVerify verifies all signatures in a transaction
+func runVerify(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	in := fs.String("in", "", "serialized transaction file")
+	encoding := fs.String("encoding", encodingRaw, "input encoding (raw, hex or base64)")
+	var schemaFiles fileList
+	fs.Var(&schemaFiles, "schema", "JSON schema of asset bodies in the form <asset_group_id in hex>=<file> (can be given multiple times)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	txobj, err := readTransaction(*in, *encoding)
+	if err != nil {
+		return err
+	}
+	result, idx := txobj.VerifyAll()
+	if !result {
+		return fmt.Errorf("verification failed (signature[%d])", idx)
+	}
+	if len(schemaFiles) > 0 {
+		registry, err := loadSchemas(schemaFiles)
+		if err != nil {
+			return err
+		}
+		if err := registry.Validate(txobj); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(stdout, "OK: transaction_id=%x (%d signatures)\n", txobj.TransactionID, len(txobj.Signatures))
+	return err
+}
+
+// loadSchemas reads the JSON schema files given in the form <asset_group_id in hex>=<file>
+func loadSchemas(specs []string) (*bbclib.SchemaRegistry, error) {
+	registry := bbclib.NewSchemaRegistry()
+	for _, spec := range specs {
+		pos := strings.Index(spec, "=")
+		if pos < 0 {
+			return nil, fmt.Errorf("-schema must be <asset_group_id>=<file> (%s)", spec)
+		}
+		assetGroupID, err := decodeID("asset_group_id of -schema", spec[:pos])
+		if err != nil {
+			return nil, err
+		}
+		dat, err := ioutil.ReadFile(spec[pos+1:])
+		if err != nil {
+			return nil, err
+		}
+		if err := registry.Register(assetGroupID, dat); err != nil {
+			return nil, fmt.Errorf("%s: %w", spec[pos+1:], err)
+		}
+	}
+	return registry, nil
+}
+
+// runDump outputs the content of a transaction
+func runDump(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	in := fs.String("in", "", "serialized transaction file")
+	encoding := fs.String("encoding", encodingRaw, "input encoding (raw, hex or base64)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dat, err := readSerialized(*in, *encoding)
+	if err != nil {
+		return err
+	}
+	txobj, err := bbclib.Deserialize(dat)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "format: %s\nsize: %d\n%s", formatName(binary.LittleEndian.Uint16(dat)), len(dat), txobj.Stringer())
+	return err
+}
+
+// runConvert converts a serialized transaction into another format/encoding
+func runConvert(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	in := fs.String("in", "", "serialized transaction file")
+	out := fs.String("out", "", "output file (stdout if omitted)")
+	from := fs.String("from", encodingRaw, "input encoding (raw, hex or base64)")
+	to := fs.String("to", encodingRaw, "output encoding (raw, hex or base64)")
+	format := fs.String("format", "plain", "serialization format of the output (plain or zlib)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	txobj, err := readTransaction(*in, *from)
+	if err != nil {
+		return err
+	}
+	return writeTransaction(txobj, *out, *format, *to, stdout)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bbclib/conformance"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// runVectors generates a new corpus of test vectors or checks the given corpus
+func runVectors(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("vectors", flag.ContinueOnError)
+	out := fs.String("out", "", "output file of the generated corpus (stdout if omitted)")
+	check := fs.String("check", "", "corpus file to check (e.g., generated by another implementation)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *check != "" {
+		corpus, err := conformance.LoadCorpus(*check)
+		if err != nil {
+			return err
+		}
+		errs := corpus.Check()
+		for _, err := range errs {
+			fmt.Fprintf(stdout, "FAIL %v\n", err)
+		}
+		fmt.Fprintf(stdout, "%d/%d vectors passed (generator: %s)\n", len(corpus.Vectors)-len(errs), len(corpus.Vectors), corpus.Generator)
+		if len(errs) > 0 {
+			return errors.New("conformance check failed")
+		}
+		return nil
+	}
+
+	corpus, err := conformance.Generate()
+	if err != nil {
+		return err
+	}
+	dat, err := corpus.Marshal()
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, dat, stdout)
+}
@@ -0,0 +1,431 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package conformance provides the cross-language test vectors of serialized transactions.
+
+A Corpus is a versioned list of Vectors. Each Vector contains a serialized transaction and the results that any implementation
+of BBc-1 transactions (e.g., bbclib-go and py-bbclib) must reproduce:
+  - the packed data (the serialized data is decompressed if necessary, since zlib output may differ between implementations),
+  - the ID length configuration of the transaction,
+  - TransactionID and TransactionBaseDigest (optional, since some outputs of other implementations do not include it),
+  - AssetIDs, asset bodies and the objects encoded in the bodies (e.g., MessagePack),
+  - the result of signature verification.
+
+All binary values are hex encoded in JSON. Check runs a Vector with this library, and Generate produces a new Corpus with this library.
+The corpora in testdata are generated by this library (vectors.json), except for two transactions serialized by py-bbclib
+(py-bbclib.json). See testdata/README.md for the provenance of the vectors and how to regenerate them.
+*/
+package conformance
+
+import (
+	"bbclib"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// FormatVersion is the version of the corpus format
+const FormatVersion = 1
+
+type (
+	// Corpus is a versioned list of test vectors
+	Corpus struct {
+		FormatVersion int      `json:"format_version"`
+		Generator     string   `json:"generator"`
+		Vectors       []Vector `json:"vectors"`
+	}
+
+	// Vector is a serialized transaction with the expected results
+	Vector struct {
+		Name                  string              `json:"name"`
+		Description           string              `json:"description"`
+		IdLength              IdLength            `json:"id_length"`
+		FormatType            uint16              `json:"format_type"`
+		Serialized            string              `json:"serialized"`
+		Packed                string              `json:"packed"`
+		TransactionID         string              `json:"transaction_id"`
+		TransactionBaseDigest string              `json:"transaction_base_digest,omitempty"`
+		Assets                []AssetVector       `json:"assets,omitempty"`
+		ExternalPublicKeys    []ExternalPublicKey `json:"external_public_keys,omitempty"`
+		Verification          Verification        `json:"verification"`
+	}
+
+	// IdLength is the ID length configuration of the transaction
+	IdLength struct {
+		TransactionID int `json:"transaction_id"`
+		UserID        int `json:"user_id"`
+		AssetGroupID  int `json:"asset_group_id"`
+		AssetID       int `json:"asset_id"`
+		Nonce         int `json:"nonce"`
+	}
+
+	// AssetVector is the expected content of BBcAsset, BBcAssetRaw or BBcAssetHash at the path (e.g., "events[0].asset", "relations[1].asset_hash")
+	AssetVector struct {
+		Path       string          `json:"path"`
+		AssetID    string          `json:"asset_id,omitempty"`
+		AssetIDs   []string        `json:"asset_ids,omitempty"`
+		BodyType   uint16          `json:"body_type"`
+		Body       string          `json:"body,omitempty"`
+		BodyObject json.RawMessage `json:"body_object,omitempty"`
+	}
+
+	// ExternalPublicKey is the public key for the signature without public key at the index
+	ExternalPublicKey struct {
+		Index     int    `json:"index"`
+		PublicKey string `json:"public_key"`
+	}
+
+	// Verification is the expected result of signature verification (InvalidSignatureIndex is -1 if all signatures are valid)
+	Verification struct {
+		Valid                 bool `json:"valid"`
+		InvalidSignatureIndex int  `json:"invalid_signature_index"`
+	}
+)
+
+// Config returns the ID length configuration for bbclib
+func (l IdLength) Config() bbclib.BBcIdConfig {
+	return bbclib.BBcIdConfig{
+		TransactionIdLength: l.TransactionID,
+		UserIdLength:        l.UserID,
+		AssetGroupIdLength:  l.AssetGroupID,
+		AssetIdLength:       l.AssetID,
+		NonceLength:         l.Nonce,
+	}
+}
+
+// idLength returns IdLength of the ID length configuration
+func idLength(conf bbclib.BBcIdConfig) IdLength {
+	return IdLength{
+		TransactionID: conf.TransactionIdLength,
+		UserID:        conf.UserIdLength,
+		AssetGroupID:  conf.AssetGroupIdLength,
+		AssetID:       conf.AssetIdLength,
+		Nonce:         conf.NonceLength,
+	}
+}
+
+// LoadCorpus reads a corpus from the JSON file
+func LoadCorpus(path string) (*Corpus, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var corpus Corpus
+	if err := json.Unmarshal(dat, &corpus); err != nil {
+		return nil, err
+	}
+	if corpus.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("unsupported format_version %d", corpus.FormatVersion)
+	}
+	return &corpus, nil
+}
+
+// Marshal returns the corpus in JSON format
+func (c *Corpus) Marshal() ([]byte, error) {
+	dat, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(dat, '\n'), nil
+}
+
+// Check runs all vectors in the corpus and returns the errors (nil if all vectors pass)
+func (c *Corpus) Check() []error {
+	var errs []error
+	for _, v := range c.Vectors {
+		if err := v.Check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Check deserializes the transaction in the vector and compares the results with the expected ones
+func (v *Vector) Check() error {
+	if err := v.check(); err != nil {
+		return fmt.Errorf("%s: %w", v.Name, err)
+	}
+	return nil
+}
+
+// check deserializes the transaction in the vector and compares the results with the expected ones
+func (v *Vector) check() error {
+	serialized, err := hex.DecodeString(v.Serialized)
+	if err != nil {
+		return fmt.Errorf("serialized: %w", err)
+	}
+	packed, err := hex.DecodeString(v.Packed)
+	if err != nil {
+		return fmt.Errorf("packed: %w", err)
+	}
+	if len(serialized) < 2 || uint16(serialized[0])|uint16(serialized[1])<<8 != v.FormatType {
+		return errors.New("format_type in the serialized data differs")
+	}
+	body := serialized[2:]
+	if v.FormatType == bbclib.FormatZlib {
+		if body, err = bbclib.ZlibDecompress(body); err != nil {
+			return fmt.Errorf("serialized: %w", err)
+		}
+	}
+	if !bytes.Equal(body, packed) {
+		return errors.New("packed data in the serialized data differs")
+	}
+
+	conf := v.IdLength.Config()
+	profile, err := bbclib.NewIdLengthProfile(&conf)
+	if err != nil {
+		return err
+	}
+	txobj, err := profile.Deserialize(serialized)
+	if err != nil {
+		return fmt.Errorf("deserialize: %w", err)
+	}
+	if l := idLength(txobj.IdLengthConf); l != v.IdLength {
+		return fmt.Errorf("id_length differs: %+v", l)
+	}
+	repacked, err := txobj.Pack()
+	if err != nil {
+		return fmt.Errorf("pack: %w", err)
+	}
+	if !bytes.Equal(repacked, packed) {
+		return errors.New("re-packed data differs")
+	}
+	if err := compareHex("transaction_id", txobj.TransactionID, v.TransactionID); err != nil {
+		return err
+	}
+	if v.TransactionBaseDigest != "" {
+		if err := compareHex("transaction_base_digest", txobj.TransactionBaseDigest, v.TransactionBaseDigest); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range v.Assets {
+		if err := a.check(txobj); err != nil {
+			return fmt.Errorf("%s: %w", a.Path, err)
+		}
+	}
+
+	result := v.verify(txobj)
+	if result != v.Verification {
+		return fmt.Errorf("verification result differs: %+v", result)
+	}
+	return nil
+}
+
+// verify verifies all signatures in the transaction using the external public keys in the vector
+func (v *Vector) verify(txobj *bbclib.BBcTransaction) Verification {
+	digest := txobj.Digest()
+	for i, sig := range txobj.Signatures {
+		if sig.KeyType == bbclib.KeyTypeNotInitialized {
+			continue
+		}
+		valid := false
+		if pubkey := v.externalPublicKey(i); pubkey != nil {
+			valid = sig.Clone().VerifyWithPublicKey(digest, pubkey)
+		} else if len(sig.Pubkey) > 0 {
+			valid = bbclib.VerifyBBcSignature(digest, sig)
+		}
+		if !valid {
+			return Verification{Valid: false, InvalidSignatureIndex: i}
+		}
+	}
+	return Verification{Valid: true, InvalidSignatureIndex: -1}
+}
+
+// externalPublicKey returns the external public key for the signature at the index (nil if not given)
+func (v *Vector) externalPublicKey(idx int) []byte {
+	for _, k := range v.ExternalPublicKeys {
+		if k.Index == idx {
+			pubkey, err := hex.DecodeString(k.PublicKey)
+			if err != nil {
+				return nil
+			}
+			return pubkey
+		}
+	}
+	return nil
+}
+
+// check compares the asset at the path in the transaction with the expected one
+func (a *AssetVector) check(txobj *bbclib.BBcTransaction) error {
+	var kind string
+	var idx int
+	if n, err := fmt.Sscanf(strings.Replace(a.Path, "[", " ", 1), "%s %d", &kind, &idx); n != 2 || err != nil {
+		return errors.New("invalid path")
+	}
+	field := a.Path[strings.Index(a.Path, "]")+1:]
+
+	switch {
+	case kind == "events" && field == ".asset" && idx < len(txobj.Events):
+		return a.checkAsset(txobj.Events[idx].Asset)
+	case kind == "relations" && field == ".asset" && idx < len(txobj.Relations):
+		return a.checkAsset(txobj.Relations[idx].Asset)
+	case kind == "relations" && field == ".asset_raw" && idx < len(txobj.Relations):
+		obj := txobj.Relations[idx].AssetRaw
+		if obj == nil {
+			return errors.New("no asset_raw")
+		}
+		if err := compareHex("asset_id", obj.AssetID, a.AssetID); err != nil {
+			return err
+		}
+		return compareHex("body", obj.AssetBody, a.Body)
+	case kind == "relations" && field == ".asset_hash" && idx < len(txobj.Relations):
+		obj := txobj.Relations[idx].AssetHash
+		if obj == nil {
+			return errors.New("no asset_hash")
+		}
+		if len(obj.AssetIDs) != len(a.AssetIDs) {
+			return errors.New("num of asset_ids differs")
+		}
+		for i := range obj.AssetIDs {
+			if err := compareHex(fmt.Sprintf("asset_ids[%d]", i), obj.AssetIDs[i], a.AssetIDs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.New("no asset at the path")
+}
+
+// checkAsset compares the BBcAsset object with the expected one
+func (a *AssetVector) checkAsset(obj *bbclib.BBcAsset) error {
+	if obj == nil {
+		return errors.New("no asset")
+	}
+	if err := compareHex("asset_id", obj.AssetID, a.AssetID); err != nil {
+		return err
+	}
+	recalculated := obj.Clone()
+	recalculated.AssetID = nil
+	recalculated.Digest()
+	if err := compareHex("recalculated asset_id", recalculated.AssetID, a.AssetID); err != nil {
+		return err
+	}
+	if obj.AssetBodyType != a.BodyType {
+		return fmt.Errorf("body_type differs: %d", obj.AssetBodyType)
+	}
+	if err := compareHex("body", obj.AssetBody, a.Body); err != nil {
+		return err
+	}
+	if len(a.BodyObject) == 0 {
+		return nil
+	}
+	bodyObj, err := decodeJSON(a.BodyObject)
+	if err != nil {
+		return fmt.Errorf("body_object: %w", err)
+	}
+	encoded := bbclib.BBcAsset{}
+	if err := encoded.AddBodyObjectWithType(a.BodyType, bodyObj); err != nil {
+		return fmt.Errorf("body_object: %w", err)
+	}
+	if bytes.Equal(encoded.AssetBody, obj.AssetBody) {
+		return nil
+	}
+
+	// Other implementations (e.g., py-bbclib) encode map keys in the insertion order, while this library sorts them.
+	// The body is correct if it decodes to the same object.
+	var decoded interface{}
+	if err := obj.DecodeBody(&decoded); err != nil {
+		return fmt.Errorf("body: %w", err)
+	}
+	if !reflect.DeepEqual(normalizeDecoded(decoded), bodyObj) {
+		return fmt.Errorf("decoded body differs from body_object: %v", decoded)
+	}
+	return nil
+}
+
+// compareHex compares the value with the expected hex string
+func compareHex(name string, val []byte, expected string) error {
+	if hex.EncodeToString(val) != strings.ToLower(expected) {
+		return fmt.Errorf("%s differs: %x", name, val)
+	}
+	return nil
+}
+
+// decodeJSON decodes JSON data, converting integral numbers into int64 (so that they are encoded as integers, as in py-bbclib)
+func decodeJSON(dat []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(dat))
+	d.UseNumber()
+	var obj interface{}
+	if err := d.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return normalizeNumbers(obj), nil
+}
+
+// normalizeNumbers converts json.Number values into int64 or float64
+func normalizeNumbers(obj interface{}) interface{} {
+	switch o := obj.(type) {
+	case json.Number:
+		if i, err := o.Int64(); err == nil {
+			return i
+		}
+		f, _ := o.Float64()
+		return f
+	case map[string]interface{}:
+		for k, v := range o {
+			o[k] = normalizeNumbers(v)
+		}
+	case []interface{}:
+		for i, v := range o {
+			o[i] = normalizeNumbers(v)
+		}
+	}
+	return obj
+}
+
+// normalizeDecoded converts a decoded asset body into the types of decodeJSON (string keys and values, int64 and float64)
+func normalizeDecoded(obj interface{}) interface{} {
+	switch o := obj.(type) {
+	case []byte:
+		return string(o)
+	case uint64:
+		if o > math.MaxInt64 {
+			return float64(o)
+		}
+		return int64(o)
+	case int:
+		return int64(o)
+	case float32:
+		return float64(o)
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(o))
+		for k, v := range o {
+			m[fmt.Sprint(normalizeDecoded(k))] = normalizeDecoded(v)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(o))
+		for k, v := range o {
+			m[k] = normalizeDecoded(v)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(o))
+		for i, v := range o {
+			l[i] = normalizeDecoded(v)
+		}
+		return l
+	}
+	return obj
+}
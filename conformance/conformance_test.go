@@ -0,0 +1,118 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conformance
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCorpus(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*", "*.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no corpus found: %v", err)
+	}
+	for _, path := range paths {
+		corpus, err := LoadCorpus(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range corpus.Vectors {
+			v := v
+			t.Run(path+"/"+v.Name, func(t *testing.T) {
+				if err := v.Check(); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	corpus, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("generated vectors pass", func(t *testing.T) {
+		if errs := corpus.Check(); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		invalid := 0
+		for _, v := range corpus.Vectors {
+			if !v.Verification.Valid {
+				invalid++
+			}
+		}
+		if invalid == 0 || invalid == len(corpus.Vectors) {
+			t.Fatalf("invalid number of vectors with invalid signature: %d", invalid)
+		}
+	})
+
+	t.Run("tampered vectors fail", func(t *testing.T) {
+		tamper := func(s string) string {
+			dat, _ := hex.DecodeString(s)
+			dat[len(dat)-1] ^= 0xff
+			return hex.EncodeToString(dat)
+		}
+		for _, v := range corpus.Vectors {
+			v1 := v
+			v1.TransactionID = tamper(v.TransactionID)
+			v2 := v
+			v2.Verification.Valid = !v.Verification.Valid
+			v3 := v
+			v3.IdLength.UserID++
+			for i, tampered := range []Vector{v1, v2, v3} {
+				if tampered.Check() == nil {
+					t.Fatalf("tampered vector must fail (%s, %d)", v.Name, i)
+				}
+			}
+			if len(v.Assets) > 0 && v.Assets[0].AssetID != "" {
+				v4 := v
+				v4.Assets = append([]AssetVector{}, v.Assets...)
+				v4.Assets[0].AssetID = tamper(v.Assets[0].AssetID)
+				if v4.Check() == nil {
+					t.Fatalf("tampered asset_id must fail (%s)", v.Name)
+				}
+			}
+		}
+	})
+
+	t.Run("body with map keys in the insertion order", func(t *testing.T) {
+		found := 0
+		for _, v := range corpus.Vectors {
+			if !strings.HasSuffix(v.Name, "/msgpack_key_order") {
+				continue
+			}
+			found++
+			if v.Assets[0].Body != hex.EncodeToString(insertionOrderedBody) {
+				t.Fatalf("body must be kept as is (%s)", v.Name)
+			}
+			tampered := v
+			tampered.Assets = append([]AssetVector{}, v.Assets...)
+			tampered.Assets[0].BodyObject = []byte(`{"owner":"alice","amount":101,"tags":["a",1.5]}`)
+			if tampered.Check() == nil {
+				t.Fatalf("tampered body_object must fail (%s)", v.Name)
+			}
+		}
+		if found != 3 {
+			t.Fatalf("vectors for all ID length configurations are expected: %d", found)
+		}
+	})
+}
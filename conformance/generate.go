@@ -0,0 +1,304 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conformance
+
+import (
+	"bbclib"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Generator is the name of this library in the generated corpus
+const Generator = "bbclib-go"
+
+// Fixed timestamp of the generated transactions (2020-01-01T00:00:00Z in microseconds)
+const generatedTimestamp = int64(1577836800000000)
+
+// insertionOrderedBody is insertionOrderedObject encoded in MessagePack with the keys in the order of "owner", "amount" and "tags"
+var insertionOrderedBody = []byte{
+	0x83,
+	0xa5, 'o', 'w', 'n', 'e', 'r', 0xa5, 'a', 'l', 'i', 'c', 'e',
+	0xa6, 'a', 'm', 'o', 'u', 'n', 't', 0x64,
+	0xa4, 't', 'a', 'g', 's', 0x92, 0xa1, 'a', 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+}
+
+var insertionOrderedObject = map[string]interface{}{"owner": "alice", "amount": 100, "tags": []interface{}{"a", 1.5}}
+
+// generator holds the key pairs and the identifiers used for generating vectors
+type generator struct {
+	conf     bbclib.BBcIdConfig
+	keypairs []*bbclib.KeyPair
+	users    [][]byte
+	group    []byte
+	domain   []byte
+	objects  map[string]interface{}
+}
+
+// Generate produces a new corpus with this library
+// Key pairs and nonces are generated randomly, so the content of the corpus differs on each call.
+func Generate() (*Corpus, error) {
+	profiles := []struct {
+		name string
+		conf bbclib.BBcIdConfig
+	}{
+		{"id32", bbclib.BBcIdConfig{TransactionIdLength: 32, UserIdLength: 32, AssetGroupIdLength: 32, AssetIdLength: 32, NonceLength: 32}},
+		{"id8", bbclib.BBcIdConfig{TransactionIdLength: 8, UserIdLength: 8, AssetGroupIdLength: 8, AssetIdLength: 8, NonceLength: 8}},
+		{"mixed", bbclib.BBcIdConfig{TransactionIdLength: 20, UserIdLength: 16, AssetGroupIdLength: 12, AssetIdLength: 24, NonceLength: 10}},
+	}
+
+	corpus := Corpus{FormatVersion: FormatVersion, Generator: Generator}
+	for _, profile := range profiles {
+		g, err := newGenerator(profile.conf)
+		if err != nil {
+			return nil, err
+		}
+		vectors, err := g.vectors(profile.name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", profile.name, err)
+		}
+		corpus.Vectors = append(corpus.Vectors, vectors...)
+	}
+	return &corpus, nil
+}
+
+// newGenerator creates a generator for the ID length configuration
+func newGenerator(conf bbclib.BBcIdConfig) (*generator, error) {
+	g := generator{conf: conf, objects: make(map[string]interface{})}
+	for i := 0; i < 4; i++ {
+		keypair, err := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+		if err != nil {
+			return nil, err
+		}
+		g.keypairs = append(g.keypairs, keypair)
+		g.users = append(g.users, bbclib.GetIdentifier(fmt.Sprintf("user%d", i+1), conf.UserIdLength))
+	}
+	g.group = bbclib.GetIdentifier("asset_group", conf.AssetGroupIdLength)
+	g.domain = bbclib.GetIdentifier("domain", bbclib.DomainIDLength)
+	return &g, nil
+}
+
+// newTransaction creates an empty transaction with the fixed timestamp
+func (g *generator) newTransaction() (*bbclib.BBcTransaction, error) {
+	profile, err := bbclib.NewIdLengthProfile(&g.conf)
+	if err != nil {
+		return nil, err
+	}
+	txobj := profile.NewTransaction(2)
+	txobj.Timestamp = generatedTimestamp
+	return txobj, nil
+}
+
+// sign signs the transaction by the users
+func (g *generator) sign(txobj *bbclib.BBcTransaction, users ...int) {
+	for _, u := range users {
+		txobj.Sign(&g.users[u], g.keypairs[u], false)
+	}
+}
+
+// vectors generates all kinds of vectors with the ID length configuration
+func (g *generator) vectors(prefix string) ([]Vector, error) {
+	var vectors []Vector
+	add := func(name, description string, txobj *bbclib.BBcTransaction, formatType uint16, external map[int][]byte) error {
+		v, err := g.vector(prefix+"/"+name, description, txobj, formatType, external)
+		if err != nil {
+			return err
+		}
+		vectors = append(vectors, v)
+		return nil
+	}
+
+	// BBcEvent with approvers and BBcAsset with MessagePack body and file
+	body := map[string]interface{}{"amount": 100, "owner": "alice", "tags": []interface{}{"a", "b"}}
+	file := []byte("file content")
+	txEvent, err := g.newTransaction()
+	if err != nil {
+		return nil, err
+	}
+	txEvent.AddEvent(&g.group, nil)
+	txEvent.Events[0].AddMandatoryApprover(&g.users[0]).AddMandatoryApprover(&g.users[1]).
+		SetOptionParams(1, 2).AddOptionApprover(&g.users[2]).AddOptionApprover(&g.users[3]).
+		CreateAsset(&g.users[0], &file, body)
+	g.objects["events[0].asset"] = body
+	txEvent.AddWitness(&g.users[0])
+	g.sign(txEvent, 0)
+	if err := add("event", "BBcEvent with approvers, BBcAsset with a MessagePack body and a file, and BBcWitness", txEvent, bbclib.FormatPlain, nil); err != nil {
+		return nil, err
+	}
+
+	// BBcReference to the event, BBcRelation with BBcPointers and BBcCrossRef
+	txid := bbclib.GetIdentifier("pointed transaction", g.conf.TransactionIdLength)
+	txRef, err := g.newTransaction()
+	if err != nil {
+		return nil, err
+	}
+	txRef.CreateReference(&g.group, txEvent, 0)
+	txRef.AddRelation(&g.group)
+	txRef.Relations[0].CreatePointer(&txEvent.TransactionID, &txEvent.Events[0].Asset.AssetID).CreatePointer(&txid, nil).
+		CreateAsset(&g.users[1], nil, "relation asset body")
+	txRef.CreateCrossRef(&g.domain, &txid)
+	g.sign(txRef, 0, 1, 2)
+	if err := add("reference", "BBcReference, BBcRelation with BBcPointers (with and without asset_id), BBcAsset with a string body and BBcCrossRef", txRef, bbclib.FormatPlain, nil); err != nil {
+		return nil, err
+	}
+	if err := add("reference_zlib", "same as reference, serialized in zlib format", txRef, bbclib.FormatZlib, nil); err != nil {
+		return nil, err
+	}
+
+	// BBcRelation with BBcAssetRaw and BBcAssetHash
+	txRaw, err := g.newTransaction()
+	if err != nil {
+		return nil, err
+	}
+	rawID := bbclib.GetIdentifier("raw asset", g.conf.AssetIdLength)
+	hashID1 := bbclib.GetIdentifier("hashed asset 1", g.conf.AssetIdLength)
+	hashID2 := bbclib.GetIdentifier("hashed asset 2", g.conf.AssetIdLength)
+	txRaw.AddRelation(&g.group).AddRelation(&g.group)
+	txRaw.Relations[0].CreateAssetRaw(&rawID, []byte{0x00, 0x01, 0x02, 0xfe, 0xff})
+	txRaw.Relations[1].CreateAssetHash(&hashID1).CreateAssetHash(&hashID2)
+	txRaw.AddWitness(&g.users[0]).AddWitness(&g.users[1])
+	g.sign(txRaw, 0, 1)
+	if err := add("asset_raw_hash", "BBcRelations with BBcAssetRaw and BBcAssetHash", txRaw, bbclib.FormatPlain, nil); err != nil {
+		return nil, err
+	}
+
+	// BBcSignature without public key
+	txNoPubkey, err := g.newTransaction()
+	if err != nil {
+		return nil, err
+	}
+	txNoPubkey.AddRelation(&g.group)
+	txNoPubkey.Relations[0].CreateAsset(&g.users[0], nil, "no public key")
+	txNoPubkey.AddWitness(&g.users[0]).AddWitness(&g.users[1])
+	g.sign(txNoPubkey, 0)
+	txNoPubkey.Sign(&g.users[1], g.keypairs[1], true)
+	if err := add("no_pubkey", "BBcSignature without public key (the public key is given externally)", txNoPubkey, bbclib.FormatPlain,
+		map[int][]byte{1: g.keypairs[1].Pubkey}); err != nil {
+		return nil, err
+	}
+
+	// BBcAsset with a MessagePack body whose keys are not sorted (py-bbclib encodes maps in the insertion order)
+	txKeyOrder, err := g.newTransaction()
+	if err != nil {
+		return nil, err
+	}
+	txKeyOrder.AddRelation(&g.group)
+	txKeyOrder.Relations[0].CreateAsset(&g.users[0], nil, "")
+	asset := txKeyOrder.Relations[0].Asset
+	asset.AssetBodyType = bbclib.AssetBodyTypeMsgpack
+	asset.AssetBody = insertionOrderedBody
+	asset.AssetBodySize = uint16(len(insertionOrderedBody))
+	asset.AssetID = nil
+	g.objects["relations[0].asset"] = insertionOrderedObject
+	txKeyOrder.AddWitness(&g.users[0])
+	g.sign(txKeyOrder, 0)
+	err = add("msgpack_key_order", "BBcAsset with a MessagePack body whose map keys are in the insertion order (not sorted)", txKeyOrder, bbclib.FormatPlain, nil)
+	delete(g.objects, "relations[0].asset")
+	if err != nil {
+		return nil, err
+	}
+
+	// Invalid signature
+	txInvalid := txNoPubkey.Clone()
+	txInvalid.Sign(&g.users[1], g.keypairs[1], false)
+	txInvalid.Signatures[1].Signature[0] ^= 0xff
+	if err := add("invalid_signature", "the second signature is tampered", txInvalid, bbclib.FormatPlain, nil); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// vector creates a Vector of the transaction
+func (g *generator) vector(name, description string, txobj *bbclib.BBcTransaction, formatType uint16, external map[int][]byte) (Vector, error) {
+	txobj.Digest()
+	serialized, err := bbclib.Serialize(txobj, formatType)
+	if err != nil {
+		return Vector{}, err
+	}
+	packed, err := txobj.Pack()
+	if err != nil {
+		return Vector{}, err
+	}
+	v := Vector{
+		Name:                  name,
+		Description:           description,
+		IdLength:              idLength(txobj.IdLengthConf),
+		FormatType:            formatType,
+		Serialized:            hex.EncodeToString(serialized),
+		Packed:                hex.EncodeToString(packed),
+		TransactionID:         hex.EncodeToString(txobj.TransactionID),
+		TransactionBaseDigest: hex.EncodeToString(txobj.TransactionBaseDigest),
+	}
+	for idx, pubkey := range external {
+		v.ExternalPublicKeys = append(v.ExternalPublicKeys, ExternalPublicKey{Index: idx, PublicKey: hex.EncodeToString(pubkey)})
+	}
+
+	for i, evt := range txobj.Events {
+		if evt.Asset != nil {
+			a, err := g.assetVector(fmt.Sprintf("events[%d].asset", i), evt.Asset)
+			if err != nil {
+				return Vector{}, err
+			}
+			v.Assets = append(v.Assets, a)
+		}
+	}
+	for i, rtn := range txobj.Relations {
+		path := fmt.Sprintf("relations[%d]", i)
+		if rtn.Asset != nil {
+			a, err := g.assetVector(path+".asset", rtn.Asset)
+			if err != nil {
+				return Vector{}, err
+			}
+			v.Assets = append(v.Assets, a)
+		}
+		if rtn.AssetRaw != nil {
+			v.Assets = append(v.Assets, AssetVector{
+				Path:    path + ".asset_raw",
+				AssetID: hex.EncodeToString(rtn.AssetRaw.AssetID),
+				Body:    hex.EncodeToString(rtn.AssetRaw.AssetBody),
+			})
+		}
+		if rtn.AssetHash != nil {
+			a := AssetVector{Path: path + ".asset_hash"}
+			for _, id := range rtn.AssetHash.AssetIDs {
+				a.AssetIDs = append(a.AssetIDs, hex.EncodeToString(id))
+			}
+			v.Assets = append(v.Assets, a)
+		}
+	}
+
+	v.Verification = v.verify(txobj)
+	return v, nil
+}
+
+// assetVector creates an AssetVector of the BBcAsset object (with the body object given in generating the transaction)
+func (g *generator) assetVector(path string, asset *bbclib.BBcAsset) (AssetVector, error) {
+	a := AssetVector{
+		Path:     path,
+		AssetID:  hex.EncodeToString(asset.AssetID),
+		BodyType: asset.AssetBodyType,
+		Body:     hex.EncodeToString(asset.AssetBody),
+	}
+	if obj, ok := g.objects[path]; ok && asset.AssetBodyType != bbclib.AssetBodyTypeRaw {
+		dat, err := json.Marshal(obj)
+		if err != nil {
+			return AssetVector{}, err
+		}
+		a.BodyObject = dat
+	}
+	return a, nil
+}
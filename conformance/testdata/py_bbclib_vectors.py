@@ -0,0 +1,200 @@
+#!/usr/bin/env python3
+# Copyright (c) 2020 Zettant Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""Generate a corpus of conformance vectors with py-bbclib.
+
+Usage:
+    pip install py-bbclib
+    python3 py_bbclib_vectors.py > v1/py-bbclib.json                   # new transactions
+    python3 py_bbclib_vectors.py tx1.bin tx2.bin > v1/py-bbclib.json   # transactions serialized by py-bbclib (32-byte IDs)
+    python3 py_bbclib_vectors.py --check v1/vectors.json               # check a corpus generated by bbclib-go
+
+All expected values in the corpus (TransactionID, TransactionBaseDigest, asset IDs and the result of signature verification)
+are calculated by py-bbclib. Check the corpus with "go test ./conformance" or "bbctool vectors -check v1/py-bbclib.json".
+New transactions are generated in the same ID length configurations as bbclib-go (id32, id8 and mixed), and include
+a MessagePack asset body with several keys, which py-bbclib encodes in the insertion order (bbclib-go sorts the keys).
+"""
+
+import binascii
+import json
+import sys
+import zlib
+
+import bbclib
+
+FORMAT_VERSION = 1
+
+# ID length configurations (same as Generate of bbclib-go)
+PROFILES = [
+    ("id32", {"transaction_id": 32, "user_id": 32, "asset_group_id": 32, "asset_id": 32, "nonce": 32}),
+    ("id8", {"transaction_id": 8, "user_id": 8, "asset_group_id": 8, "asset_id": 8, "nonce": 8}),
+    ("mixed", {"transaction_id": 20, "user_id": 16, "asset_group_id": 12, "asset_id": 24, "nonce": 10}),
+]
+
+# asset body with several keys, encoded in this order by py-bbclib
+KEY_ORDER_BODY = {"owner": "alice", "amount": 100, "tags": ["a", 1.5]}
+
+
+def hexstr(dat):
+    return binascii.b2a_hex(dat).decode() if dat is not None else ""
+
+
+def assets_of(txobj):
+    assets = []
+    for i, evt in enumerate(txobj.events):
+        if evt.asset is not None:
+            assets.append(("events[%d].asset" % i, evt.asset))
+    for i, rtn in enumerate(txobj.relations):
+        if rtn.asset is not None:
+            assets.append(("relations[%d].asset" % i, rtn.asset))
+    return assets
+
+
+def asset_vectors(txobj, objects):
+    vectors = []
+    for path, asset in assets_of(txobj):
+        v = {
+            "path": path,
+            "asset_id": hexstr(asset.asset_id),
+            "body_type": asset.asset_body_type,
+            "body": hexstr(asset.asset_body),
+        }
+        if path in objects:
+            v["body_object"] = objects[path]
+        vectors.append(v)
+    return vectors
+
+
+def verification(txobj):
+    digest = txobj.digest()
+    for i, sig in enumerate(txobj.signatures):
+        if sig.key_type == 0:
+            continue
+        if not sig.verify(digest):
+            return {"valid": False, "invalid_signature_index": i}
+    return {"valid": True, "invalid_signature_index": -1}
+
+
+def vector(name, description, serialized, id_length, objects):
+    bbclib.configure_id_length(id_length)
+    txobj, format_type = bbclib.deserialize(serialized)
+    packed = serialized[2:]
+    if format_type == bbclib.BBcFormat.FORMAT_ZLIB:
+        packed = zlib.decompress(packed)
+    return {
+        "name": name,
+        "description": description,
+        "id_length": dict(id_length),
+        "format_type": format_type,
+        "serialized": hexstr(serialized),
+        "packed": hexstr(packed),
+        "transaction_id": hexstr(txobj.transaction_id),
+        "transaction_base_digest": hexstr(txobj.transaction_base_digest),
+        "assets": asset_vectors(txobj, objects),
+        "verification": verification(txobj),
+    }
+
+
+def new_transactions(prefix, id_length):
+    bbclib.configure_id_length(id_length)
+    asset_group_id = bbclib.get_new_id("asset_group", include_timestamp=False)[:id_length["asset_group_id"]]
+    users = [bbclib.get_new_id("user%d" % i, include_timestamp=False)[:id_length["user_id"]] for i in (1, 2)]
+    keypairs = []
+    for _ in users:
+        keypair = bbclib.KeyPair()
+        keypair.generate()
+        keypairs.append(keypair)
+
+    txobj = bbclib.make_transaction(relation_num=2, witness=True)
+    bbclib.add_relation_asset(txobj, relation_idx=0, asset_group_id=asset_group_id, user_id=users[0], asset_body=b"relation_asset")
+    bbclib.add_relation_asset(txobj, relation_idx=1, asset_group_id=asset_group_id, user_id=users[1], asset_body={"amount": 100})
+    for user_id in users:
+        txobj.witness.add_witness(user_id)
+    for user_id, keypair in zip(users, keypairs):
+        txobj.witness.add_signature(user_id=user_id, signature=txobj.sign(keypair=keypair))
+
+    txkeys = bbclib.make_transaction(relation_num=1, witness=True)
+    bbclib.add_relation_asset(txkeys, relation_idx=0, asset_group_id=asset_group_id, user_id=users[0], asset_body=KEY_ORDER_BODY)
+    txkeys.witness.add_witness(users[0])
+    txkeys.witness.add_signature(user_id=users[0], signature=txkeys.sign(keypair=keypairs[0]))
+
+    return [
+        (prefix + "/relation_witness_plain", "BBcRelations and BBcWitness signed by two users (plain format)",
+         bbclib.serialize(txobj, format_type=bbclib.BBcFormat.FORMAT_PLAIN), id_length, {"relations[1].asset": {"amount": 100}}),
+        (prefix + "/relation_witness_zlib", "BBcRelations and BBcWitness signed by two users (zlib format)",
+         bbclib.serialize(txobj, format_type=bbclib.BBcFormat.FORMAT_ZLIB), id_length, {"relations[1].asset": {"amount": 100}}),
+        (prefix + "/msgpack_key_order", "BBcAsset with a MessagePack body with several keys (in the insertion order)",
+         bbclib.serialize(txkeys, format_type=bbclib.BBcFormat.FORMAT_PLAIN), id_length, {"relations[0].asset": KEY_ORDER_BODY}),
+    ]
+
+
+def check(path):
+    """Check a corpus generated by another implementation (e.g., bbclib-go) with py-bbclib."""
+    with open(path) as f:
+        corpus = json.load(f)
+    failed = 0
+    for v in corpus["vectors"]:
+        bbclib.configure_id_length(v["id_length"])
+        txobj, _ = bbclib.deserialize(binascii.a2b_hex(v["serialized"]))
+        for key in v.get("external_public_keys", []):
+            txobj.signatures[key["index"]].add(pubkey=binascii.a2b_hex(key["public_key"]))
+        errors = []
+        if hexstr(txobj.transaction_id) != v["transaction_id"]:
+            errors.append("transaction_id")
+        assets = dict(assets_of(txobj))
+        for a in v.get("assets", []):
+            asset = assets.get(a["path"])
+            if asset is None:
+                continue  # BBcAssetRaw and BBcAssetHash
+            if hexstr(asset.asset_id) != a["asset_id"] or hexstr(asset.asset_body) != a["body"]:
+                errors.append(a["path"])
+            elif "body_object" in a and asset.get_asset_body() != a["body_object"]:
+                errors.append(a["path"] + ".body_object")
+        if verification(txobj) != v["verification"]:
+            errors.append("verification")
+        if errors:
+            failed += 1
+            print("NG %s: %s" % (v["name"], ", ".join(errors)))
+        else:
+            print("OK %s" % v["name"])
+    return failed
+
+
+def main(args):
+    if args and args[0] == "--check":
+        sys.exit(1 if sum(check(path) for path in args[1:]) > 0 else 0)
+    if args:
+        id_length = dict(PROFILES[0][1])
+        inputs = []
+        for path in args:
+            with open(path, "rb") as f:
+                inputs.append((path.rsplit("/", 1)[-1].split(".")[0], "transaction serialized by py-bbclib (%s)" % path, f.read(),
+                               id_length, {}))
+    else:
+        inputs = []
+        for prefix, id_length in PROFILES:
+            inputs.extend(new_transactions(prefix, id_length))
+    corpus = {
+        "format_version": FORMAT_VERSION,
+        "generator": "py-bbclib",
+        "vectors": [vector("py-bbclib/" + name, description, dat, id_length, objects)
+                    for name, description, dat, id_length, objects in inputs],
+    }
+    json.dump(corpus, sys.stdout, indent=2)
+    sys.stdout.write("\n")
+
+
+if __name__ == "__main__":
+    main(sys.argv[1:])
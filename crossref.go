@@ -74,8 +74,12 @@ func (p *BBcCrossRef) Add(domainID *[]byte, txid *[]byte) {
 func (p *BBcCrossRef) Pack() ([]byte, error) {
 	buf := new(bytes.Buffer)
 
-	PutBigInt(buf, &p.DomainID, DomainIDLength)
-	PutBigInt(buf, &p.TransactionID, p.IdLengthConf.TransactionIdLength)
+	if err := PutBigInt(buf, &p.DomainID, DomainIDLength); err != nil {
+		return nil, err
+	}
+	if err := PutBigInt(buf, &p.TransactionID, p.IdLengthConf.TransactionIdLength); err != nil {
+		return nil, err
+	}
 
 	return buf.Bytes(), nil
 }
@@ -83,17 +87,43 @@ func (p *BBcCrossRef) Pack() ([]byte, error) {
 // Unpack the binary data to the BBcCrossRef object
 func (p *BBcCrossRef) Unpack(dat *[]byte) error {
 	var err error
-	buf := bytes.NewBuffer(*dat)
+	d := newDecoder(*dat)
 
-	p.DomainID, _, err = GetBigInt(buf)
+	p.DomainID, _, err = d.getBigInt("domain_id")
 	if err != nil {
 		return err
 	}
 
-	p.TransactionID, _, err = GetBigInt(buf)
+	p.TransactionID, _, err = d.getBigInt("transaction_id")
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// Clone returns a deep copy of the BBcCrossRef object
+func (p *BBcCrossRef) Clone() *BBcCrossRef {
+	return p.clone(newCloneContext())
+}
+
+// clone returns a deep copy of the BBcCrossRef object, sharing the ID length configuration in the cloneContext
+func (p *BBcCrossRef) clone(c *cloneContext) *BBcCrossRef {
+	if p == nil {
+		return nil
+	}
+	return &BBcCrossRef{
+		IdLengthConf:  c.conf(p.IdLengthConf),
+		Version:       p.Version,
+		DomainID:      cloneBytes(p.DomainID),
+		TransactionID: cloneBytes(p.TransactionID),
+	}
+}
+
+// Equal returns true if the BBcCrossRef objects have the same content to be packed
+func (p *BBcCrossRef) Equal(q *BBcCrossRef) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	return bytes.Equal(p.DomainID, q.DomainID) && bytes.Equal(p.TransactionID, q.TransactionID)
+}
@@ -0,0 +1,199 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+DecodeError definition
+
+DecodeError is returned by Unpack methods (and Deserialize) when the binary data cannot be decoded.
+
+"Path" is the path of the field in the object being unpacked, e.g., "events[0].asset.body" for BBcTransaction.Unpack.
+"Offset" is the byte offset of the field from the beginning of the data given to Unpack (for Deserialize, the packed data after the header and decompression).
+"Expected" is the number of bytes required for the field and "Actual" is the number of bytes actually remaining in the data.
+"Err" is the underlying error, e.g., io.ErrUnexpectedEOF for truncated data.
+
+errors.Is(err, ErrDecode) returns true for any DecodeError, and errors.Is also matches the underlying error.
+*/
+type DecodeError struct {
+	Path     string
+	Offset   int
+	Expected int
+	Actual   int
+	Err      error
+}
+
+// ErrDecode matches any DecodeError with errors.Is
+var ErrDecode = errors.New("decode error")
+
+// Error returns the description of the error
+func (e *DecodeError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "data"
+	}
+	if e.Expected > 0 || e.Actual > 0 {
+		return fmt.Sprintf("failed to decode %s at offset %d: expected %d bytes, but %d bytes remain: %v", path, e.Offset, e.Expected, e.Actual, e.Err)
+	}
+	return fmt.Sprintf("failed to decode %s at offset %d: %v", path, e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true if target is ErrDecode
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrDecode
+}
+
+// joinPath joins the path of the parent object and that of the child field
+func joinPath(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	if child == "" {
+		return parent
+	}
+	if strings.HasPrefix(child, "[") {
+		return parent + child
+	}
+	return parent + "." + child
+}
+
+// wrapDecodeError puts the error in the context of the parent object (path of the child object and its offset in the parent data)
+func wrapDecodeError(err error, path string, base int) error {
+	if err == nil {
+		return nil
+	}
+	var de *DecodeError
+	if errors.As(err, &de) {
+		wrapped := *de
+		wrapped.Path = joinPath(path, de.Path)
+		wrapped.Offset += base
+		return &wrapped
+	}
+	return &DecodeError{Path: path, Offset: base, Err: err}
+}
+
+// decoder reads values from the binary data, keeping the offset for DecodeError
+type decoder struct {
+	buf  *bytes.Buffer
+	size int
+}
+
+// newDecoder returns a decoder of the binary data
+func newDecoder(dat []byte) *decoder {
+	return &decoder{buf: bytes.NewBuffer(dat), size: len(dat)}
+}
+
+// offset returns the current position in the data
+func (d *decoder) offset() int {
+	return d.size - d.buf.Len()
+}
+
+// require returns DecodeError if the remaining data is shorter than length
+func (d *decoder) require(path string, length int) error {
+	remaining := d.buf.Len()
+	if length < 0 {
+		return &DecodeError{Path: path, Offset: d.offset(), Expected: length, Actual: remaining, Err: errors.New("invalid length")}
+	}
+	if remaining >= length {
+		return nil
+	}
+	err := io.ErrUnexpectedEOF
+	if remaining == 0 {
+		err = io.EOF
+	}
+	return &DecodeError{Path: path, Offset: d.offset(), Expected: length, Actual: remaining, Err: err}
+}
+
+// get2byte reads a uint16 value
+func (d *decoder) get2byte(path string) (uint16, error) {
+	if err := d.require(path, 2); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(d.buf.Next(2)), nil
+}
+
+// get4byte reads a uint32 value
+func (d *decoder) get4byte(path string) (uint32, error) {
+	if err := d.require(path, 4); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(d.buf.Next(4)), nil
+}
+
+// get8byte reads a int64 value
+func (d *decoder) get8byte(path string) (int64, error) {
+	if err := d.require(path, 8); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(d.buf.Next(8))), nil
+}
+
+// getBytes reads binary data with the specified length
+func (d *decoder) getBytes(path string, length int) ([]byte, error) {
+	if err := d.require(path, length); err != nil {
+		return nil, err
+	}
+	val := make([]byte, length)
+	copy(val, d.buf.Next(length))
+	return val, nil
+}
+
+// skip skips binary data with the specified length
+func (d *decoder) skip(path string, length int) error {
+	if err := d.require(path, length); err != nil {
+		return err
+	}
+	d.buf.Next(length)
+	return nil
+}
+
+// getBigInt reads an ID with the 2-byte length header
+func (d *decoder) getBigInt(path string) ([]byte, int, error) {
+	length, err := d.get2byte(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	val, err := d.getBytes(path, int(length))
+	if err != nil {
+		return nil, 0, err
+	}
+	return val, int(length), nil
+}
+
+// getObject reads the binary data of a child object with the specified length and unpacks it
+// The error in unpacking is put in the context of the child object (path and offset).
+func (d *decoder) getObject(path string, length int, unpack func(dat *[]byte) error) error {
+	base := d.offset()
+	dat, err := d.getBytes(path, length)
+	if err != nil {
+		return err
+	}
+	return wrapDecodeError(unpack(&dat), path, base)
+}
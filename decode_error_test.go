@@ -0,0 +1,160 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecodeError(t *testing.T) {
+	refTxObj := makeBaseTx(idLengthConfig)
+	followTx := makeFollowTX(idLengthConfig, &refTxObj)
+	body := []byte("testString12345XXX")
+
+	t.Run("truncated transaction", func(t *testing.T) {
+		for _, txobj := range []*BBcTransaction{&refTxObj, &followTx} {
+			dat, err := txobj.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for l := 0; l < len(dat); l++ {
+				truncated := dat[:l]
+				obj := BBcTransaction{}
+				err := obj.Unpack(&truncated)
+				var de *DecodeError
+				if !errors.As(err, &de) || !errors.Is(err, ErrDecode) {
+					t.Fatalf("DecodeError must be returned (length=%d): %v", l, err)
+				}
+				if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Fatalf("underlying error must be EOF (length=%d): %v", l, err)
+				}
+				if de.Offset > l || de.Actual >= de.Expected || de.Path == "" {
+					t.Fatalf("invalid error (length=%d): %v", l, err)
+				}
+			}
+		}
+	})
+
+	t.Run("path and offset of the broken field", func(t *testing.T) {
+		dat, _ := Serialize(&followTx, FormatPlain)
+		idx := bytes.Index(dat, body)
+		if idx < 0 {
+			t.Fatal("asset body not found")
+		}
+		broken := append([]byte{}, dat...)
+		broken[idx-2] = 0xff
+		broken[idx-1] = 0xff
+		_, err := Deserialize(broken)
+		var de *DecodeError
+		if !errors.As(err, &de) {
+			t.Fatalf("DecodeError must be returned: %v", err)
+		}
+		if de.Path != "relations[0].asset.body" || de.Offset != idx-2 || de.Expected != 0xffff || de.Actual != len(body) {
+			t.Fatalf("invalid error: %v", err)
+		}
+		if !strings.Contains(err.Error(), "relations[0].asset.body") || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("invalid error: %v", err)
+		}
+	})
+
+	t.Run("zlib compressed data", func(t *testing.T) {
+		packed, _ := followTx.Pack()
+		truncated := packed[:len(packed)-1]
+		compressed := ZlibCompress(&truncated)
+		dat := append([]byte{0x10, 0x00}, compressed...)
+		_, err := Deserialize(dat)
+		var de *DecodeError
+		if !errors.As(err, &de) || !strings.HasPrefix(de.Path, "signatures[") || de.Expected-de.Actual != 1 {
+			t.Fatalf("invalid error: %v", err)
+		}
+		if _, err := Deserialize([]byte{0x00}); !errors.Is(err, ErrDecode) {
+			t.Fatalf("DecodeError must be returned for the header: %v", err)
+		}
+	})
+
+	t.Run("invalid transaction_id_length", func(t *testing.T) {
+		packed, err := refTxObj.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range []uint16{0, 33, 0xffff} {
+			broken := append([]byte{}, packed...)
+			broken[12] = byte(l)
+			broken[13] = byte(l >> 8)
+			obj := BBcTransaction{}
+			err := obj.Unpack(&broken)
+			var de *DecodeError
+			if !errors.As(err, &de) || de.Path != "transaction_id_length" || de.Offset != 12 {
+				t.Fatalf("DecodeError must be returned (length=%d): %v", l, err)
+			}
+			if _, err := Deserialize(append([]byte{0x00, 0x00}, broken...)); !errors.As(err, &de) || de.Path != "transaction_id_length" {
+				t.Fatalf("DecodeError must be returned by Deserialize (length=%d): %v", l, err)
+			}
+			if _, err := PeekPackedTransaction(broken); !errors.As(err, &de) || de.Path != "transaction_id_length" {
+				t.Fatalf("DecodeError must be returned by PeekPackedTransaction (length=%d): %v", l, err)
+			}
+		}
+	})
+
+	t.Run("asset body size", func(t *testing.T) {
+		dat, err := followTx.Relations[0].Asset.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		truncated := dat[:len(dat)-len(body)-1]
+		err = (&BBcAsset{}).Unpack(&truncated)
+		var de *DecodeError
+		if !errors.As(err, &de) || de.Path != "body_size" || de.Offset != len(dat)-len(body)-2 {
+			t.Fatalf("invalid error: %v", err)
+		}
+	})
+
+	t.Run("child objects", func(t *testing.T) {
+		objs := []struct {
+			name   string
+			obj    interface{ Pack() ([]byte, error) }
+			unpack func(dat *[]byte) error
+		}{
+			{"event", refTxObj.Events[0], (&BBcEvent{}).Unpack},
+			{"reference", followTx.References[0], (&BBcReference{}).Unpack},
+			{"relation", followTx.Relations[0], (&BBcRelation{Version: 2}).Unpack},
+			{"pointer", followTx.Relations[0].Pointers[0], (&BBcPointer{}).Unpack},
+			{"asset", followTx.Relations[0].Asset, (&BBcAsset{}).Unpack},
+			{"witness", followTx.Witness, (&BBcWitness{}).Unpack},
+			{"crossref", followTx.Crossref, (&BBcCrossRef{}).Unpack},
+			{"signature", followTx.Signatures[0], (&BBcSignature{}).Unpack},
+			{"asset_raw", &BBcAssetRaw{IdLengthConf: &idLengthConfig, AssetID: txtest_u1, AssetBody: body, AssetBodySize: uint16(len(body))}, (&BBcAssetRaw{}).Unpack},
+			{"asset_hash", &BBcAssetHash{IdLengthConf: &idLengthConfig, AssetIdNum: 1, AssetIDs: [][]byte{txtest_u1}}, (&BBcAssetHash{}).Unpack},
+		}
+		for _, o := range objs {
+			dat, err := o.obj.Pack()
+			if err != nil {
+				t.Fatal(o.name, err)
+			}
+			truncated := dat[:len(dat)-1]
+			err = o.unpack(&truncated)
+			var de *DecodeError
+			if !errors.As(err, &de) || de.Expected-de.Actual != 1 || de.Offset+de.Expected != len(dat) {
+				t.Fatalf("invalid error for %s: %v", o.name, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,267 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/*
+TransactionDiff definition
+
+TransactionDiff is the result of field-by-field comparison of two BBcTransaction objects.
+Each Difference has the path to the field (e.g., "events[0].asset.body"), which is named in the same way as Stringer output.
+Binary values are shown in hex.
+
+Only the information included in the packed data (and TransactionID) is compared. Back-pointers and internal values are ignored.
+*/
+type (
+	DiffKind string
+
+	Difference struct {
+		Path string   `json:"path"`
+		Kind DiffKind `json:"kind"`
+		Old  string   `json:"old,omitempty"`
+		New  string   `json:"new,omitempty"`
+	}
+
+	TransactionDiff struct {
+		Differences []Difference `json:"differences"`
+	}
+)
+
+// Kind of the difference
+const (
+	DiffAdded   DiffKind = "added"
+	DiffRemoved DiffKind = "removed"
+	DiffChanged DiffKind = "changed"
+)
+
+// DiffTransactions compares two BBcTransaction objects and returns the differences from a to b
+func DiffTransactions(a, b *BBcTransaction) *TransactionDiff {
+	d := TransactionDiff{}
+	if a == nil || b == nil {
+		d.object("transaction", a == nil, b == nil)
+		return &d
+	}
+	d.bytes("transaction_id", a.TransactionID, b.TransactionID)
+	d.value("version", a.Version, b.Version)
+	d.value("timestamp", a.Timestamp, b.Timestamp)
+	d.value("transaction_id_length", a.TransactionIdLength, b.TransactionIdLength)
+
+	for i := 0; i < len(a.Events) || i < len(b.Events); i++ {
+		path := fmt.Sprintf("events[%d]", i)
+		if d.element(path, i < len(a.Events), i < len(b.Events)) {
+			d.event(path, a.Events[i], b.Events[i])
+		}
+	}
+	for i := 0; i < len(a.References) || i < len(b.References); i++ {
+		path := fmt.Sprintf("references[%d]", i)
+		if d.element(path, i < len(a.References), i < len(b.References)) {
+			d.reference(path, a.References[i], b.References[i])
+		}
+	}
+	for i := 0; i < len(a.Relations) || i < len(b.Relations); i++ {
+		path := fmt.Sprintf("relations[%d]", i)
+		if d.element(path, i < len(a.Relations), i < len(b.Relations)) {
+			d.relation(path, a.Relations[i], b.Relations[i])
+		}
+	}
+	if d.object("witness", a.Witness == nil, b.Witness == nil) {
+		d.witness("witness", a.Witness, b.Witness)
+	}
+	if d.object("cross_ref", a.Crossref == nil, b.Crossref == nil) {
+		d.bytes("cross_ref.domain_id", a.Crossref.DomainID, b.Crossref.DomainID)
+		d.bytes("cross_ref.transaction_id", a.Crossref.TransactionID, b.Crossref.TransactionID)
+	}
+	for i := 0; i < len(a.Signatures) || i < len(b.Signatures); i++ {
+		path := fmt.Sprintf("signatures[%d]", i)
+		if d.element(path, i < len(a.Signatures), i < len(b.Signatures)) {
+			d.signature(path, a.Signatures[i], b.Signatures[i])
+		}
+	}
+	return &d
+}
+
+// Empty returns true if there is no difference
+func (d *TransactionDiff) Empty() bool {
+	return len(d.Differences) == 0
+}
+
+// String outputs the differences in text, one line for each difference
+func (d *TransactionDiff) String() string {
+	if d.Empty() {
+		return "no difference\n"
+	}
+	var ret strings.Builder
+	for _, diff := range d.Differences {
+		switch diff.Kind {
+		case DiffAdded:
+			ret.WriteString(fmt.Sprintf("+ %s", diff.Path))
+		case DiffRemoved:
+			ret.WriteString(fmt.Sprintf("- %s", diff.Path))
+		default:
+			ret.WriteString(fmt.Sprintf("~ %s: %s -> %s", diff.Path, diff.Old, diff.New))
+		}
+		ret.WriteString("\n")
+	}
+	return ret.String()
+}
+
+// JSON outputs the differences in JSON format
+func (d *TransactionDiff) JSON() ([]byte, error) {
+	if d.Differences == nil {
+		return json.Marshal(TransactionDiff{Differences: []Difference{}})
+	}
+	return json.Marshal(d)
+}
+
+// add appends a difference
+func (d *TransactionDiff) add(path string, kind DiffKind, oldVal, newVal string) {
+	d.Differences = append(d.Differences, Difference{Path: path, Kind: kind, Old: oldVal, New: newVal})
+}
+
+// element records an added/removed list element and returns true if the element exists in both lists
+func (d *TransactionDiff) element(path string, inA, inB bool) bool {
+	if inA && inB {
+		return true
+	}
+	if inA {
+		d.add(path, DiffRemoved, "", "")
+	} else {
+		d.add(path, DiffAdded, "", "")
+	}
+	return false
+}
+
+// object records an added/removed object and returns true if the object exists in both
+func (d *TransactionDiff) object(path string, nilA, nilB bool) bool {
+	return !(nilA && nilB) && d.element(path, !nilA, !nilB)
+}
+
+// value records a changed value
+func (d *TransactionDiff) value(path string, a, b interface{}) {
+	if a != b {
+		d.add(path, DiffChanged, fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+	}
+}
+
+// bytes records a changed binary value
+func (d *TransactionDiff) bytes(path string, a, b []byte) {
+	if !bytes.Equal(a, b) {
+		d.add(path, DiffChanged, hexOrNone(a), hexOrNone(b))
+	}
+}
+
+// ints records a changed list of int
+func (d *TransactionDiff) ints(path string, a, b []int) {
+	if fmt.Sprint(a) != fmt.Sprint(b) {
+		d.add(path, DiffChanged, fmt.Sprint(a), fmt.Sprint(b))
+	}
+}
+
+// bytesList records added/removed/changed values in a list of binary values
+func (d *TransactionDiff) bytesList(path string, a, b [][]byte) {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		if i >= len(b) {
+			d.add(p, DiffRemoved, hexOrNone(a[i]), "")
+		} else if i >= len(a) {
+			d.add(p, DiffAdded, "", hexOrNone(b[i]))
+		} else {
+			d.bytes(p, a[i], b[i])
+		}
+	}
+}
+
+// event compares BBcEvent objects
+func (d *TransactionDiff) event(path string, a, b *BBcEvent) {
+	d.bytes(path+".asset_group_id", a.AssetGroupID, b.AssetGroupID)
+	d.ints(path+".reference_indices", a.ReferenceIndices, b.ReferenceIndices)
+	d.bytesList(path+".mandatory_approvers", a.MandatoryApprovers, b.MandatoryApprovers)
+	d.value(path+".option_approver_num_numerator", a.OptionApproverNumNumerator, b.OptionApproverNumNumerator)
+	d.value(path+".option_approver_num_denominator", a.OptionApproverNumDenominator, b.OptionApproverNumDenominator)
+	d.bytesList(path+".option_approvers", a.OptionApprovers, b.OptionApprovers)
+	if d.object(path+".asset", a.Asset == nil, b.Asset == nil) {
+		d.asset(path+".asset", a.Asset, b.Asset)
+	}
+}
+
+// reference compares BBcReference objects
+func (d *TransactionDiff) reference(path string, a, b *BBcReference) {
+	d.bytes(path+".asset_group_id", a.AssetGroupID, b.AssetGroupID)
+	d.bytes(path+".transaction_id", a.TransactionID, b.TransactionID)
+	d.value(path+".event_index_in_ref", a.EventIndexInRef, b.EventIndexInRef)
+	d.ints(path+".sig_indices", a.SigIndices, b.SigIndices)
+}
+
+// relation compares BBcRelation objects
+func (d *TransactionDiff) relation(path string, a, b *BBcRelation) {
+	d.bytes(path+".asset_group_id", a.AssetGroupID, b.AssetGroupID)
+	for i := 0; i < len(a.Pointers) || i < len(b.Pointers); i++ {
+		p := fmt.Sprintf("%s.pointers[%d]", path, i)
+		if d.element(p, i < len(a.Pointers), i < len(b.Pointers)) {
+			d.bytes(p+".transaction_id", a.Pointers[i].TransactionID, b.Pointers[i].TransactionID)
+			d.bytes(p+".asset_id", a.Pointers[i].AssetID, b.Pointers[i].AssetID)
+		}
+	}
+	if d.object(path+".asset", a.Asset == nil, b.Asset == nil) {
+		d.asset(path+".asset", a.Asset, b.Asset)
+	}
+	if d.object(path+".asset_raw", a.AssetRaw == nil, b.AssetRaw == nil) {
+		d.bytes(path+".asset_raw.asset_id", a.AssetRaw.AssetID, b.AssetRaw.AssetID)
+		d.bytes(path+".asset_raw.body", a.AssetRaw.AssetBody, b.AssetRaw.AssetBody)
+	}
+	if d.object(path+".asset_hash", a.AssetHash == nil, b.AssetHash == nil) {
+		d.bytesList(path+".asset_hash.asset_ids", a.AssetHash.AssetIDs, b.AssetHash.AssetIDs)
+	}
+}
+
+// asset compares BBcAsset objects
+func (d *TransactionDiff) asset(path string, a, b *BBcAsset) {
+	d.bytes(path+".asset_id", a.AssetID, b.AssetID)
+	d.bytes(path+".user_id", a.UserID, b.UserID)
+	d.bytes(path+".nonce", a.Nonce, b.Nonce)
+	d.value(path+".file_size", a.AssetFileSize, b.AssetFileSize)
+	d.bytes(path+".file_digest", a.AssetFileDigest, b.AssetFileDigest)
+	d.value(path+".body_type", a.AssetBodyType, b.AssetBodyType)
+	d.bytes(path+".body", a.AssetBody, b.AssetBody)
+}
+
+// witness compares BBcWitness objects
+func (d *TransactionDiff) witness(path string, a, b *BBcWitness) {
+	d.bytesList(path+".user_ids", a.UserIDs, b.UserIDs)
+	d.ints(path+".sig_indices", a.SigIndices, b.SigIndices)
+}
+
+// signature compares BBcSignature objects
+func (d *TransactionDiff) signature(path string, a, b *BBcSignature) {
+	d.value(path+".key_type", a.KeyType, b.KeyType)
+	d.bytes(path+".pubkey", a.Pubkey, b.Pubkey)
+	d.bytes(path+".signature", a.Signature, b.Signature)
+}
+
+// hexOrNone returns hex string of the value ("None" for nil)
+func hexOrNone(val []byte) string {
+	if val == nil {
+		return "None"
+	}
+	return fmt.Sprintf("%x", val)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiffTransactions(t *testing.T) {
+	txobj := makeBaseTx(idLengthConfig)
+	txobj.Digest()
+
+	t.Run("no difference", func(t *testing.T) {
+		diff := DiffTransactions(&txobj, txobj.Clone())
+		if !diff.Empty() {
+			t.Fatalf("unexpected difference:\n%s", diff.String())
+		}
+	})
+
+	t.Run("changed, added and removed", func(t *testing.T) {
+		txobj2 := txobj.Clone()
+		txobj2.Events[0].Asset.AddBodyString("modified")
+		txobj2.Events[0].AddMandatoryApprover(&txtest_u5)
+		txobj2.Crossref = nil
+		txobj2.AddRelation(&txtest_u1)
+		txobj2.Digest()
+
+		diff := DiffTransactions(&txobj, txobj2)
+		t.Log(diff.String())
+		expected := map[string]DiffKind{
+			"transaction_id":                   DiffChanged,
+			"events[0].asset.body":             DiffChanged,
+			"events[0].mandatory_approvers[2]": DiffAdded,
+			"relations[0]":                     DiffAdded,
+			"cross_ref":                        DiffRemoved,
+		}
+		for _, d := range diff.Differences {
+			if kind, ok := expected[d.Path]; ok && kind == d.Kind {
+				delete(expected, d.Path)
+			}
+		}
+		if len(expected) > 0 {
+			t.Fatalf("differences not detected: %v", expected)
+		}
+		if !strings.Contains(diff.String(), "~ events[0].asset.body: ") || !strings.Contains(diff.String(), "- cross_ref\n") {
+			t.Fatal("invalid text output")
+		}
+
+		dat, err := diff.JSON()
+		if err != nil {
+			t.Fatalf("failed to output JSON (%v)", err)
+		}
+		diff2 := TransactionDiff{}
+		if err := json.Unmarshal(dat, &diff2); err != nil || len(diff2.Differences) != len(diff.Differences) {
+			t.Fatal("invalid JSON output")
+		}
+	})
+
+	t.Run("signature difference", func(t *testing.T) {
+		txobj2 := txobj.Clone()
+		txobj2.Signatures[0].Signature[0] ^= 0xff
+		diff := DiffTransactions(&txobj, txobj2)
+		if len(diff.Differences) != 1 || diff.Differences[0].Path != "signatures[0].signature" {
+			t.Fatalf("unexpected difference:\n%s", diff.String())
+		}
+	})
+}
@@ -0,0 +1,267 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package domain handles transactions of several BBc-1 domains in a single process (e.g., a gateway serving multiple domains).
+
+A Descriptor describes a domain: its DomainID, the ID lengths of its transactions (IdLengthProfile), the public keys trusted
+for the domain (e.g., for signing ledger checkpoints) and the codec preferences (asset body types and the serialization format).
+CheckTransaction checks that a transaction conforms to the descriptor.
+
+A Registry keeps the registered domains, each of which has its own transaction store and the queue of BBcCrossRef objects
+to be included in its transactions. When a transaction is submitted to a domain, its TransactionID is queued to the other domains,
+so that the authenticity of the transaction is also recorded in them.
+*/
+package domain
+
+import (
+	"bbclib"
+	"bbclib/ledger"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUntrusted is returned when an object is not signed by any trusted key of the domain
+var ErrUntrusted = errors.New("not signed by a trusted key of the domain")
+
+/*
+Descriptor definition
+
+"DomainID" is the 256-bit identifier of the domain (see IDFromName), and "Profile" gives the ID lengths of its transactions.
+"TrustedKeys" are the public keys trusted for the domain.
+"AssetBodyTypes" are the asset body types allowed in the domain (any type if empty), and the first one is preferred for new assets.
+"Format" is the format of serialized transactions in the domain (bbclib.FormatPlain or bbclib.FormatZlib).
+*/
+type (
+	Descriptor struct {
+		Name           string
+		DomainID       []byte
+		Profile        *bbclib.IdLengthProfile
+		TrustedKeys    [][]byte
+		AssetBodyTypes []uint16
+		Format         uint16
+	}
+
+	// descriptorJSON is the JSON representation of Descriptor
+	descriptorJSON struct {
+		Name           string       `json:"name"`
+		DomainID       string       `json:"domain_id"`
+		IDLength       idLengthJSON `json:"id_length"`
+		TrustedKeys    []string     `json:"trusted_keys,omitempty"`
+		AssetBodyTypes []uint16     `json:"asset_body_types,omitempty"`
+		Format         uint16       `json:"format"`
+	}
+
+	idLengthJSON struct {
+		TransactionID int `json:"transaction_id"`
+		UserID        int `json:"user_id"`
+		AssetGroupID  int `json:"asset_group_id"`
+		AssetID       int `json:"asset_id"`
+		Nonce         int `json:"nonce"`
+	}
+)
+
+// IDFromName returns the DomainID for the domain name, i.e., SHA-256 digest of the name
+// (the same as get_new_id(name, include_timestamp=False) of py-bbclib)
+func IDFromName(name string) []byte {
+	digest := sha256.Sum256([]byte(name))
+	return digest[:]
+}
+
+// IDFromPublicKey returns the DomainID bound to the public key of the domain, i.e., SHA-256 digest of the key
+func IDFromPublicKey(publicKey []byte) []byte {
+	digest := sha256.Sum256(publicKey)
+	return digest[:]
+}
+
+// SubdomainID returns the DomainID of the sub-domain with the name under the parent domain
+func SubdomainID(parentID []byte, name string) []byte {
+	h := sha256.New()
+	h.Write(parentID)
+	h.Write([]byte(name))
+	return h.Sum(nil)
+}
+
+// NewDescriptor returns the descriptor of the domain with the name (DomainID is derived by IDFromName)
+// The default profile (bbclib.DefaultIdLengthProfile) is used if profile is nil.
+func NewDescriptor(name string, profile *bbclib.IdLengthProfile, trustedKeys ...[]byte) *Descriptor {
+	if profile == nil {
+		profile = bbclib.DefaultIdLengthProfile()
+	}
+	return &Descriptor{Name: name, DomainID: IDFromName(name), Profile: profile, TrustedKeys: trustedKeys, Format: bbclib.FormatPlain}
+}
+
+// Check checks the content of the descriptor
+func (d *Descriptor) Check() error {
+	if len(d.DomainID) != bbclib.DomainIDLength {
+		return fmt.Errorf("domain_id must be %d bytes (%d bytes given)", bbclib.DomainIDLength, len(d.DomainID))
+	}
+	if d.Profile == nil {
+		return errors.New("ID length profile must be given")
+	}
+	if d.Format != bbclib.FormatPlain && d.Format != bbclib.FormatZlib {
+		return fmt.Errorf("unsupported format 0x%04x", d.Format)
+	}
+	for _, bodyType := range d.AssetBodyTypes {
+		if bodyType == bbclib.AssetBodyTypeRaw {
+			continue
+		}
+		if _, err := bbclib.GetAssetBodyCodec(bodyType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ID returns DomainID in hex
+func (d *Descriptor) ID() string {
+	return hex.EncodeToString(d.DomainID)
+}
+
+// IsTrusted returns true if the public key is trusted for the domain
+func (d *Descriptor) IsTrusted(publicKey []byte) bool {
+	for _, key := range d.TrustedKeys {
+		if bytes.Equal(key, publicKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyCheckpoint verifies that the ledger checkpoint is of the domain and signed by a trusted key
+func (d *Descriptor) VerifyCheckpoint(checkpoint *ledger.Checkpoint) error {
+	if checkpoint == nil {
+		return errors.New("checkpoint must be given")
+	}
+	if !bytes.Equal(checkpoint.DomainID, d.DomainID) {
+		return fmt.Errorf("checkpoint of domain %x (not %x)", checkpoint.DomainID, d.DomainID)
+	}
+	for _, key := range d.TrustedKeys {
+		if checkpoint.Verify(key) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("checkpoint %d: %w", checkpoint.Sequence, ErrUntrusted)
+}
+
+// IsAllowedBodyType returns true if the asset body type is allowed in the domain
+func (d *Descriptor) IsAllowedBodyType(bodyType uint16) bool {
+	if len(d.AssetBodyTypes) == 0 {
+		return true
+	}
+	for _, t := range d.AssetBodyTypes {
+		if t == bodyType {
+			return true
+		}
+	}
+	return false
+}
+
+// PreferredBodyType returns the asset body type preferred in the domain (MessagePack if not specified)
+func (d *Descriptor) PreferredBodyType() uint16 {
+	if len(d.AssetBodyTypes) == 0 {
+		return bbclib.AssetBodyTypeMsgpack
+	}
+	return d.AssetBodyTypes[0]
+}
+
+// SetAssetBody sets the object in the asset body in the preferred type of the domain (a string or []byte as is for the raw type)
+func (d *Descriptor) SetAssetBody(asset *bbclib.BBcAsset, body interface{}) error {
+	if asset == nil {
+		return errors.New("asset must be given")
+	}
+	if bodyType := d.PreferredBodyType(); bodyType != bbclib.AssetBodyTypeRaw {
+		return asset.AddBodyObjectWithType(bodyType, body)
+	}
+	switch v := body.(type) {
+	case string:
+		asset.AddBodyString(v)
+	case []byte:
+		asset.AddBodyString(string(v))
+	default:
+		return fmt.Errorf("raw asset body must be string or []byte (%T given)", body)
+	}
+	return nil
+}
+
+// NewTransactionBuilder returns the transaction builder with the ID lengths of the domain
+func (d *Descriptor) NewTransactionBuilder() *bbclib.TransactionBuilder {
+	return bbclib.NewTransactionBuilder(d.Profile)
+}
+
+// MarshalJSON returns the JSON representation of the descriptor (IDs and keys in hex)
+func (d *Descriptor) MarshalJSON() ([]byte, error) {
+	if d.Profile == nil {
+		return nil, errors.New("ID length profile must be given")
+	}
+	conf := d.Profile.Config()
+	v := descriptorJSON{
+		Name:     d.Name,
+		DomainID: hex.EncodeToString(d.DomainID),
+		IDLength: idLengthJSON{
+			TransactionID: conf.TransactionIdLength,
+			UserID:        conf.UserIdLength,
+			AssetGroupID:  conf.AssetGroupIdLength,
+			AssetID:       conf.AssetIdLength,
+			Nonce:         conf.NonceLength,
+		},
+		AssetBodyTypes: d.AssetBodyTypes,
+		Format:         d.Format,
+	}
+	for _, key := range d.TrustedKeys {
+		v.TrustedKeys = append(v.TrustedKeys, hex.EncodeToString(key))
+	}
+	return json.Marshal(&v)
+}
+
+// UnmarshalJSON sets the descriptor from the JSON representation (DomainID is derived from the name if omitted)
+func (d *Descriptor) UnmarshalJSON(dat []byte) error {
+	var v descriptorJSON
+	if err := json.Unmarshal(dat, &v); err != nil {
+		return err
+	}
+	domainID := IDFromName(v.Name)
+	if v.DomainID != "" {
+		var err error
+		if domainID, err = hex.DecodeString(v.DomainID); err != nil {
+			return fmt.Errorf("domain_id: %v", err)
+		}
+	}
+	profile, err := bbclib.NewIdLengthProfile(&bbclib.BBcIdConfig{
+		TransactionIdLength: v.IDLength.TransactionID,
+		UserIdLength:        v.IDLength.UserID,
+		AssetGroupIdLength:  v.IDLength.AssetGroupID,
+		AssetIdLength:       v.IDLength.AssetID,
+		NonceLength:         v.IDLength.Nonce,
+	})
+	if err != nil {
+		return fmt.Errorf("id_length: %v", err)
+	}
+	var keys [][]byte
+	for i, s := range v.TrustedKeys {
+		key, err := hex.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("trusted_keys[%d]: %v", i, err)
+		}
+		keys = append(keys, key)
+	}
+	*d = Descriptor{Name: v.Name, DomainID: domainID, Profile: profile, TrustedKeys: keys, AssetBodyTypes: v.AssetBodyTypes, Format: v.Format}
+	return d.Check()
+}
@@ -0,0 +1,184 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package domain
+
+import (
+	"bbclib"
+	"bbclib/ledger"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestDescriptor(t *testing.T) {
+	keypair, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	otherKey, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	user := bbclib.GetIdentifier("user", 32)
+	group := bbclib.GetIdentifier("group", 32)
+
+	t.Run("domain IDs", func(t *testing.T) {
+		id := IDFromName("domain")
+		if len(id) != bbclib.DomainIDLength || !bytes.Equal(id, IDFromName("domain")) || bytes.Equal(id, IDFromName("other")) {
+			t.Fatalf("unexpected domain_id: %x", id)
+		}
+		if len(IDFromPublicKey(keypair.Pubkey)) != bbclib.DomainIDLength {
+			t.Fatal("domain_id from the public key must be 32 bytes")
+		}
+		sub := SubdomainID(id, "sub")
+		if bytes.Equal(sub, SubdomainID(IDFromName("other"), "sub")) || bytes.Equal(sub, SubdomainID(id, "sub2")) {
+			t.Fatal("sub-domain IDs must be different")
+		}
+	})
+
+	t.Run("check", func(t *testing.T) {
+		desc := NewDescriptor("domain", nil)
+		if err := desc.Check(); err != nil {
+			t.Fatal(err)
+		}
+		for name, broken := range map[string]Descriptor{
+			"domain_id": {DomainID: []byte{1}, Profile: desc.Profile},
+			"profile":   {DomainID: desc.DomainID},
+			"format":    {DomainID: desc.DomainID, Profile: desc.Profile, Format: 0x00ff},
+			"body type": {DomainID: desc.DomainID, Profile: desc.Profile, AssetBodyTypes: []uint16{0xffff}},
+		} {
+			if err := broken.Check(); err == nil {
+				t.Fatalf("broken %s must be rejected", name)
+			}
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		profile, _ := bbclib.NewIdLengthProfile(&bbclib.BBcIdConfig{TransactionIdLength: 8, UserIdLength: 16})
+		desc := NewDescriptor("domain", profile, keypair.Pubkey)
+		desc.AssetBodyTypes = []uint16{bbclib.AssetBodyTypeJSON, bbclib.AssetBodyTypeRaw}
+		desc.Format = bbclib.FormatZlib
+		dat, err := json.Marshal(desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var recovered Descriptor
+		if err := json.Unmarshal(dat, &recovered); err != nil {
+			t.Fatal(err)
+		}
+		if recovered.Name != desc.Name || !bytes.Equal(recovered.DomainID, desc.DomainID) || recovered.Profile.Config() != profile.Config() ||
+			!recovered.IsTrusted(keypair.Pubkey) || recovered.PreferredBodyType() != bbclib.AssetBodyTypeJSON || recovered.Format != bbclib.FormatZlib {
+			t.Fatalf("unexpected descriptor: %s", dat)
+		}
+
+		if err := json.Unmarshal([]byte(`{"name":"named","id_length":{}}`), &recovered); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(recovered.DomainID, IDFromName("named")) || recovered.Profile.Config().TransactionIdLength != 32 {
+			t.Fatalf("domain_id must be derived from the name: %x", recovered.DomainID)
+		}
+		for _, broken := range []string{`{"domain_id":"zz"}`, `{"domain_id":"00"}`, `{"name":"a","id_length":{"user_id":33}}`, `{"name":"a","trusted_keys":["zz"]}`} {
+			if err := json.Unmarshal([]byte(broken), &recovered); err == nil {
+				t.Fatalf("broken descriptor must be rejected: %s", broken)
+			}
+		}
+	})
+
+	t.Run("checkpoint", func(t *testing.T) {
+		desc := NewDescriptor("domain", nil, keypair.Pubkey)
+		l, _ := ledger.New(desc.DomainID, keypair)
+		_, _ = l.Append(bbclib.GetIdentifier("tx", 32))
+		cp, _ := l.Checkpoint(1000)
+		if err := desc.VerifyCheckpoint(cp); err != nil {
+			t.Fatal(err)
+		}
+		untrusted, _ := ledger.New(desc.DomainID, otherKey)
+		_, _ = untrusted.Append(bbclib.GetIdentifier("tx", 32))
+		cp, _ = untrusted.Checkpoint(1000)
+		if err := desc.VerifyCheckpoint(cp); !errors.Is(err, ErrUntrusted) {
+			t.Fatalf("checkpoint signed by an untrusted key must be rejected: %v", err)
+		}
+		if err := NewDescriptor("domain", nil).VerifyCheckpoint(cp); !errors.Is(err, ErrUntrusted) {
+			t.Fatalf("checkpoint must not be verified without trusted keys: %v", err)
+		}
+		other, _ := ledger.New(IDFromName("other"), keypair)
+		_, _ = other.Append(bbclib.GetIdentifier("tx", 32))
+		cp, _ = other.Checkpoint(1000)
+		if err := desc.VerifyCheckpoint(cp); err == nil {
+			t.Fatal("checkpoint of another domain must be rejected")
+		}
+	})
+
+	t.Run("profile conformance", func(t *testing.T) {
+		profile, _ := bbclib.NewIdLengthProfile(&bbclib.BBcIdConfig{TransactionIdLength: 8})
+		desc := NewDescriptor("domain", profile)
+		desc.AssetBodyTypes = []uint16{bbclib.AssetBodyTypeJSON}
+		txobj, err := desc.NewTransactionBuilder().SetTimestamp(1).
+			AddEvent(&group, func(e *bbclib.EventBuilder) {
+				e.CreateAsset(&user, nil, nil)
+				if err := desc.SetAssetBody(e.Event().Asset, map[string]int{"amount": 1}); err != nil {
+					t.Fatal(err)
+				}
+			}).Sign(&user, keypair, false).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txobj.Events[0].Asset.AssetBodyType != bbclib.AssetBodyTypeJSON {
+			t.Fatalf("asset body must be in the preferred type: %d", txobj.Events[0].Asset.AssetBodyType)
+		}
+		if err := desc.CheckTransaction(txobj); err != nil {
+			t.Fatal(err)
+		}
+		dat, err := desc.Serialize(txobj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := desc.Deserialize(dat); err != nil {
+			t.Fatal(err)
+		}
+
+		// the transaction of the default profile does not conform to the domain
+		other, _ := bbclib.NewTransactionBuilder(nil).SetTimestamp(1).
+			AddEvent(&group, func(e *bbclib.EventBuilder) { e.CreateAsset(&user, nil, "string body") }).
+			Sign(&user, keypair, false).Build()
+		other.Crossref = &bbclib.BBcCrossRef{DomainID: desc.DomainID, TransactionID: make([]byte, 16)}
+		err = desc.CheckTransaction(other)
+		var verr *bbclib.ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("nonconforming transaction must be rejected: %v", err)
+		}
+		paths := map[string]bool{}
+		for _, v := range verr.Violations {
+			if v.Rule != RuleDomainProfile {
+				t.Fatalf("unexpected rule: %+v", v)
+			}
+			paths[v.Path] = true
+		}
+		for _, path := range []string{"transaction_id", "events[0].asset.asset_body_type", "cross_ref.transaction_id", "cross_ref.domain_id"} {
+			if !paths[path] {
+				t.Fatalf("violation at %s must be reported: %v", path, verr)
+			}
+		}
+		if _, err := desc.Serialize(other); err == nil {
+			t.Fatal("nonconforming transaction must not be serialized")
+		}
+
+		engine := bbclib.NewRuleEngine()
+		engine.RegisterGlobal(desc.Rule())
+		if err := engine.Validate(txobj, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Validate(other, nil); err == nil {
+			t.Fatal("nonconforming transaction must be rejected by the rule")
+		}
+	})
+}
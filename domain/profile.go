@@ -0,0 +1,174 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package domain
+
+import (
+	"bbclib"
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// RuleDomainProfile is the name of the rule returned by Descriptor.Rule
+const RuleDomainProfile = "domain_profile"
+
+// profileChecker collects the violations of the profile in a transaction
+type profileChecker struct {
+	conf       bbclib.BBcIdConfig
+	violations []bbclib.Violation
+}
+
+// id checks the length of the ID at the path
+func (c *profileChecker) id(path string, id []byte, length int) {
+	if len(id) != length {
+		c.violations = append(c.violations, bbclib.Violation{Rule: RuleDomainProfile, Path: path,
+			Message: fmt.Sprintf("%d bytes (%d bytes in the domain)", len(id), length)})
+	}
+}
+
+// ids checks the lengths of the IDs at the path
+func (c *profileChecker) ids(path string, ids [][]byte, length int) {
+	for i, id := range ids {
+		c.id(fmt.Sprintf("%s[%d]", path, i), id, length)
+	}
+}
+
+// add adds the violation at the path
+func (c *profileChecker) add(path, format string, args ...interface{}) {
+	c.violations = append(c.violations, bbclib.Violation{Rule: RuleDomainProfile, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// asset checks the IDs and the body type of the asset at the path
+func (c *profileChecker) asset(d *Descriptor, path string, asset *bbclib.BBcAsset) {
+	c.id(path+".asset_id", asset.AssetID, c.conf.AssetIdLength)
+	if asset.UserID != nil {
+		c.id(path+".user_id", asset.UserID, c.conf.UserIdLength)
+	}
+	c.id(path+".nonce", asset.Nonce, c.conf.NonceLength)
+	if len(asset.AssetBody) > 0 && !d.IsAllowedBodyType(asset.AssetBodyType) {
+		c.add(path+".asset_body_type", "type %d is not allowed in the domain", asset.AssetBodyType)
+	}
+}
+
+// violations returns the violations of the profile in the transaction
+func (d *Descriptor) violations(txobj *bbclib.BBcTransaction) []bbclib.Violation {
+	c := profileChecker{conf: d.Profile.Config()}
+	if txobj.TransactionIdLength != 0 && txobj.TransactionIdLength != c.conf.TransactionIdLength {
+		c.add("transaction_id_length", "%d (%d in the domain)", txobj.TransactionIdLength, c.conf.TransactionIdLength)
+	}
+	if txobj.TransactionID != nil {
+		c.id("transaction_id", txobj.TransactionID, c.conf.TransactionIdLength)
+	}
+	for i, evt := range txobj.Events {
+		path := fmt.Sprintf("events[%d]", i)
+		if evt == nil {
+			continue
+		}
+		c.id(path+".asset_group_id", evt.AssetGroupID, c.conf.AssetGroupIdLength)
+		c.ids(path+".mandatory_approvers", evt.MandatoryApprovers, c.conf.UserIdLength)
+		c.ids(path+".option_approvers", evt.OptionApprovers, c.conf.UserIdLength)
+		if evt.Asset != nil {
+			c.asset(d, path+".asset", evt.Asset)
+		}
+	}
+	for i, ref := range txobj.References {
+		path := fmt.Sprintf("references[%d]", i)
+		if ref == nil {
+			continue
+		}
+		c.id(path+".asset_group_id", ref.AssetGroupID, c.conf.AssetGroupIdLength)
+		c.id(path+".transaction_id", ref.TransactionID, c.conf.TransactionIdLength)
+	}
+	for i, rtn := range txobj.Relations {
+		path := fmt.Sprintf("relations[%d]", i)
+		if rtn == nil {
+			continue
+		}
+		c.id(path+".asset_group_id", rtn.AssetGroupID, c.conf.AssetGroupIdLength)
+		for j, ptr := range rtn.Pointers {
+			if ptr == nil {
+				continue
+			}
+			c.id(fmt.Sprintf("%s.pointers[%d].transaction_id", path, j), ptr.TransactionID, c.conf.TransactionIdLength)
+			if ptr.AssetID != nil {
+				c.id(fmt.Sprintf("%s.pointers[%d].asset_id", path, j), ptr.AssetID, c.conf.AssetIdLength)
+			}
+		}
+		if rtn.Asset != nil {
+			c.asset(d, path+".asset", rtn.Asset)
+		}
+		if rtn.AssetRaw != nil {
+			c.id(path+".asset_raw.asset_id", rtn.AssetRaw.AssetID, c.conf.AssetIdLength)
+			if !d.IsAllowedBodyType(bbclib.AssetBodyTypeRaw) {
+				c.add(path+".asset_raw", "raw asset body is not allowed in the domain")
+			}
+		}
+		if rtn.AssetHash != nil {
+			c.ids(path+".asset_hash.asset_ids", rtn.AssetHash.AssetIDs, c.conf.AssetIdLength)
+		}
+	}
+	if txobj.Witness != nil {
+		c.ids("witness.user_ids", txobj.Witness.UserIDs, c.conf.UserIdLength)
+	}
+	if xref := txobj.Crossref; xref != nil {
+		c.id("cross_ref.domain_id", xref.DomainID, bbclib.DomainIDLength)
+		c.id("cross_ref.transaction_id", xref.TransactionID, c.conf.TransactionIdLength)
+		if bytes.Equal(xref.DomainID, d.DomainID) {
+			c.add("cross_ref.domain_id", "cross_ref must refer to another domain")
+		}
+	}
+	return c.violations
+}
+
+// CheckTransaction checks that the IDs in the transaction have the lengths of the domain profile and the asset bodies
+// have the allowed types, and returns *bbclib.ValidationError with all violations (nil if the transaction conforms)
+func (d *Descriptor) CheckTransaction(txobj *bbclib.BBcTransaction) error {
+	if txobj == nil {
+		return errors.New("transaction must be given")
+	}
+	if violations := d.violations(txobj); len(violations) > 0 {
+		return &bbclib.ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// Rule returns the validation rule which checks transactions by CheckTransaction (to be registered globally in RuleEngine)
+func (d *Descriptor) Rule() bbclib.ValidationRule {
+	return bbclib.NewRule(RuleDomainProfile, func(ctx *bbclib.ValidationContext) []bbclib.Violation {
+		return d.violations(ctx.Transaction)
+	})
+}
+
+// Serialize checks the transaction by CheckTransaction, and serializes it in the format of the domain
+func (d *Descriptor) Serialize(txobj *bbclib.BBcTransaction) ([]byte, error) {
+	if err := d.CheckTransaction(txobj); err != nil {
+		return nil, err
+	}
+	return bbclib.Serialize(txobj, d.Format)
+}
+
+// Deserialize deserializes the transaction with the profile of the domain, and checks it by CheckTransaction
+func (d *Descriptor) Deserialize(dat []byte) (*bbclib.BBcTransaction, error) {
+	txobj, err := d.Profile.Deserialize(dat)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.CheckTransaction(txobj); err != nil {
+		return nil, err
+	}
+	return txobj, nil
+}
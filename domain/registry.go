@@ -0,0 +1,311 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package domain
+
+import (
+	"bbclib"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrUnknownDomain is returned when the domain is not registered
+	ErrUnknownDomain = errors.New("unknown domain")
+	// ErrDuplicated is returned when the domain or the transaction has already been registered
+	ErrDuplicated = errors.New("already registered")
+	// ErrNotFound is returned when the transaction is not in the store
+	ErrNotFound = errors.New("transaction not found")
+)
+
+type (
+	// Store keeps the transactions of a domain in memory (safe for concurrent use)
+	Store struct {
+		mutex        sync.RWMutex
+		transactions map[string]*bbclib.BBcTransaction
+		order        [][]byte
+	}
+
+	// CrossRefQueue is the FIFO queue of BBcCrossRef objects to be included in the transactions of a domain (safe for concurrent use)
+	CrossRefQueue struct {
+		mutex sync.Mutex
+		items []*bbclib.BBcCrossRef
+	}
+
+	// Domain is a domain registered in Registry
+	Domain struct {
+		Descriptor *Descriptor
+		Store      *Store
+		CrossRefs  *CrossRefQueue
+	}
+
+	// Registry keeps the domains served in the process (safe for concurrent use)
+	Registry struct {
+		mutex   sync.RWMutex
+		domains map[string]*Domain
+	}
+)
+
+// NewStore returns an empty store
+func NewStore() *Store {
+	return &Store{transactions: make(map[string]*bbclib.BBcTransaction)}
+}
+
+// Put stores a copy of the transaction (ErrDuplicated if the TransactionID is already in the store)
+func (s *Store) Put(txobj *bbclib.BBcTransaction) error {
+	if txobj == nil || len(txobj.TransactionID) == 0 {
+		return errors.New("transaction with transaction_id must be given")
+	}
+	key := hex.EncodeToString(txobj.TransactionID)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.transactions[key]; ok {
+		return fmt.Errorf("transaction %s: %w", key, ErrDuplicated)
+	}
+	s.transactions[key] = txobj.Clone()
+	s.order = append(s.order, append([]byte{}, txobj.TransactionID...))
+	return nil
+}
+
+// Get returns a copy of the transaction of the TransactionID (usable as bbclib.TransactionResolver)
+func (s *Store) Get(transactionID []byte) (*bbclib.BBcTransaction, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	txobj, ok := s.transactions[hex.EncodeToString(transactionID)]
+	if !ok {
+		return nil, fmt.Errorf("transaction %x: %w", transactionID, ErrNotFound)
+	}
+	return txobj.Clone(), nil
+}
+
+// Find returns a copy of the transaction whose TransactionID starts with the prefix (a TransactionID truncated for another domain)
+func (s *Store) Find(prefix []byte) (*bbclib.BBcTransaction, error) {
+	if txobj, err := s.Get(prefix); err == nil {
+		return txobj, nil
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if len(prefix) > 0 {
+		for _, id := range s.order {
+			if bytes.HasPrefix(id, prefix) {
+				return s.transactions[hex.EncodeToString(id)].Clone(), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("transaction %x: %w", prefix, ErrNotFound)
+}
+
+// Len returns the number of the transactions in the store
+func (s *Store) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.order)
+}
+
+// TransactionIDs returns the TransactionIDs in the order of Put
+func (s *Store) TransactionIDs() [][]byte {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	ids := make([][]byte, len(s.order))
+	for i, id := range s.order {
+		ids[i] = append([]byte{}, id...)
+	}
+	return ids
+}
+
+// Push appends the cross reference to the queue
+func (q *CrossRefQueue) Push(xref *bbclib.BBcCrossRef) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.items = append(q.items, xref)
+}
+
+// Pop removes and returns the oldest cross reference in the queue (nil if empty)
+func (q *CrossRefQueue) Pop() *bbclib.BBcCrossRef {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.items) == 0 {
+		return nil
+	}
+	xref := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	return xref
+}
+
+// Len returns the number of the cross references in the queue
+func (q *CrossRefQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.items)
+}
+
+// AttachCrossRef pops a cross reference from the queue of the domain and sets it to the transaction builder,
+// and returns the cross reference (nil if the queue is empty)
+func (d *Domain) AttachCrossRef(b *bbclib.TransactionBuilder) *bbclib.BBcCrossRef {
+	xref := d.CrossRefs.Pop()
+	if xref != nil {
+		b.CreateCrossRef(&xref.DomainID, &xref.TransactionID)
+	}
+	return xref
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{domains: make(map[string]*Domain)}
+}
+
+// Register registers the domain of the descriptor with an empty store and cross reference queue
+func (r *Registry) Register(descriptor *Descriptor) (*Domain, error) {
+	if descriptor == nil {
+		return nil, errors.New("descriptor must be given")
+	}
+	if err := descriptor.Check(); err != nil {
+		return nil, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.domains[descriptor.ID()]; ok {
+		return nil, fmt.Errorf("domain %s: %w", descriptor.ID(), ErrDuplicated)
+	}
+	d := &Domain{Descriptor: descriptor, Store: NewStore(), CrossRefs: &CrossRefQueue{}}
+	r.domains[descriptor.ID()] = d
+	return d, nil
+}
+
+// Unregister removes the domain from the registry
+func (r *Registry) Unregister(domainID []byte) error {
+	key := hex.EncodeToString(domainID)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.domains[key]; !ok {
+		return fmt.Errorf("domain %s: %w", key, ErrUnknownDomain)
+	}
+	delete(r.domains, key)
+	return nil
+}
+
+// Domain returns the registered domain of the DomainID
+func (r *Registry) Domain(domainID []byte) (*Domain, error) {
+	key := hex.EncodeToString(domainID)
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	d, ok := r.domains[key]
+	if !ok {
+		return nil, fmt.Errorf("domain %s: %w", key, ErrUnknownDomain)
+	}
+	return d, nil
+}
+
+// Lookup returns the registered domain with the name
+func (r *Registry) Lookup(name string) (*Domain, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, d := range r.domains {
+		if d.Descriptor.Name == name {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("domain %q: %w", name, ErrUnknownDomain)
+}
+
+// Domains returns the registered domains in the order of DomainID
+func (r *Registry) Domains() []*Domain {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	domains := make([]*Domain, 0, len(r.domains))
+	for _, d := range r.domains {
+		domains = append(domains, d)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		return bytes.Compare(domains[i].Descriptor.DomainID, domains[j].Descriptor.DomainID) < 0
+	})
+	return domains
+}
+
+// ResolveCrossRef returns the transaction referred by the cross reference from the store of the registered domain
+func (r *Registry) ResolveCrossRef(xref *bbclib.BBcCrossRef) (*bbclib.BBcTransaction, error) {
+	if xref == nil {
+		return nil, errors.New("cross_ref must be given")
+	}
+	d, err := r.Domain(xref.DomainID)
+	if err != nil {
+		return nil, err
+	}
+	return d.Store.Find(xref.TransactionID)
+}
+
+// Submit checks the transaction against the profile of the domain and stores it, and then queues its cross reference to the other domains.
+// The transaction must have the up-to-date TransactionID (see BBcTransaction.IsDirty).
+// The cross reference in the transaction must refer to a stored transaction if the referred domain is registered.
+// The TransactionID is truncated for the domains with shorter TransactionIDs (a prefix of TransactionID is the TransactionID
+// of the same transaction in shorter length), and is not queued to the domains with longer TransactionIDs.
+func (r *Registry) Submit(domainID []byte, txobj *bbclib.BBcTransaction) error {
+	d, err := r.Domain(domainID)
+	if err != nil {
+		return err
+	}
+	if err := d.Descriptor.CheckTransaction(txobj); err != nil {
+		return err
+	}
+	if len(txobj.TransactionID) == 0 {
+		return errors.New("transaction_id must be calculated")
+	}
+	if txobj.IsDirty() {
+		return errors.New("transaction_id does not match the content of the transaction")
+	}
+	if txobj.Crossref != nil {
+		if _, err := r.ResolveCrossRef(txobj.Crossref); err != nil && !errors.Is(err, ErrUnknownDomain) {
+			return fmt.Errorf("cross_ref: %w", err)
+		}
+	}
+	if err := d.Store.Put(txobj); err != nil {
+		return err
+	}
+	for _, other := range r.Domains() {
+		conf := other.Descriptor.Profile.Config()
+		if other == d || conf.TransactionIdLength > len(txobj.TransactionID) {
+			continue
+		}
+		xref := &bbclib.BBcCrossRef{
+			DomainID:      append([]byte{}, d.Descriptor.DomainID...),
+			TransactionID: append([]byte{}, txobj.TransactionID[:conf.TransactionIdLength]...),
+		}
+		xref.SetIdLengthConf(&conf)
+		other.CrossRefs.Push(xref)
+	}
+	return nil
+}
+
+// Deserialize deserializes the transaction for the domain (see Descriptor.Deserialize) and submits it
+func (r *Registry) Deserialize(domainID []byte, dat []byte) (*bbclib.BBcTransaction, error) {
+	d, err := r.Domain(domainID)
+	if err != nil {
+		return nil, err
+	}
+	txobj, err := d.Descriptor.Deserialize(dat)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Submit(domainID, txobj); err != nil {
+		return nil, err
+	}
+	return txobj, nil
+}
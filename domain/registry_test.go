@@ -0,0 +1,182 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package domain
+
+import (
+	"bbclib"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	keypair, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	user := bbclib.GetIdentifier("user", 32)
+	group := bbclib.GetIdentifier("group", 32)
+	newDomain := func(r *Registry, name string, idLength int) *Domain {
+		profile, _ := bbclib.NewIdLengthProfile(&bbclib.BBcIdConfig{TransactionIdLength: idLength})
+		d, err := r.Register(NewDescriptor(name, profile, keypair.Pubkey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	makeTransaction := func(d *Domain, body string) *bbclib.BBcTransaction {
+		b := d.Descriptor.NewTransactionBuilder().SetTimestamp(1).
+			AddEvent(&group, func(e *bbclib.EventBuilder) { e.CreateAsset(&user, nil, body) })
+		d.AttachCrossRef(b)
+		txobj, err := b.Sign(&user, keypair, false).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return txobj
+	}
+
+	t.Run("domains", func(t *testing.T) {
+		r := NewRegistry()
+		a := newDomain(r, "domain_a", 32)
+		b := newDomain(r, "domain_b", 8)
+		if _, err := r.Register(NewDescriptor("domain_a", nil)); !errors.Is(err, ErrDuplicated) {
+			t.Fatalf("duplicated domain must be rejected: %v", err)
+		}
+		if _, err := r.Register(&Descriptor{Name: "broken"}); err == nil {
+			t.Fatal("broken descriptor must be rejected")
+		}
+		if d, err := r.Lookup("domain_b"); err != nil || d != b {
+			t.Fatalf("domain must be found by the name: %v", err)
+		}
+		if d, err := r.Domain(a.Descriptor.DomainID); err != nil || d != a {
+			t.Fatalf("domain must be found by the domain_id: %v", err)
+		}
+		domains := r.Domains()
+		if len(domains) != 2 || bytes.Compare(domains[0].Descriptor.DomainID, domains[1].Descriptor.DomainID) >= 0 {
+			t.Fatal("domains must be sorted by the domain_id")
+		}
+		if err := r.Unregister(a.Descriptor.DomainID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Lookup("domain_a"); !errors.Is(err, ErrUnknownDomain) {
+			t.Fatalf("unregistered domain must not be found: %v", err)
+		}
+		if err := r.Unregister(a.Descriptor.DomainID); !errors.Is(err, ErrUnknownDomain) {
+			t.Fatalf("unknown domain must be reported: %v", err)
+		}
+	})
+
+	t.Run("cross references", func(t *testing.T) {
+		r := NewRegistry()
+		a := newDomain(r, "domain_a", 32)
+		b := newDomain(r, "domain_b", 8)
+		c := newDomain(r, "domain_c", 16)
+
+		txA := makeTransaction(a, "asset in a")
+		if err := r.Submit(a.Descriptor.DomainID, txA); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Submit(a.Descriptor.DomainID, txA); !errors.Is(err, ErrDuplicated) {
+			t.Fatalf("duplicated transaction must be rejected: %v", err)
+		}
+		if a.CrossRefs.Len() != 0 || b.CrossRefs.Len() != 1 || c.CrossRefs.Len() != 1 {
+			t.Fatal("cross reference must be queued to the other domains")
+		}
+		xref := b.CrossRefs.Pop()
+		dat, err := xref.Pack()
+		if err != nil {
+			t.Fatalf("queued cross reference must be packed with the ID lengths of the domain: %v", err)
+		}
+		var unpacked bbclib.BBcCrossRef
+		if err := unpacked.Unpack(&dat); err != nil || !bytes.Equal(unpacked.TransactionID, txA.TransactionID[:8]) {
+			t.Fatalf("queued cross reference must be unpacked: %v", err)
+		}
+		b.CrossRefs.Push(xref)
+
+		// the TransactionID truncated for domain_b refers to the transaction in domain_a
+		txB := makeTransaction(b, "asset in b")
+		if txB.Crossref == nil || !bytes.Equal(txB.Crossref.TransactionID, txA.TransactionID[:8]) {
+			t.Fatal("cross reference must be attached from the queue")
+		}
+		if err := r.Submit(b.Descriptor.DomainID, txB); err != nil {
+			t.Fatal(err)
+		}
+		if resolved, err := r.ResolveCrossRef(txB.Crossref); err != nil || !bytes.Equal(resolved.TransactionID, txA.TransactionID) {
+			t.Fatalf("cross reference must be resolved: %v", err)
+		}
+		if a.CrossRefs.Len() != 0 || c.CrossRefs.Len() != 1 {
+			t.Fatal("the shorter TransactionID must not be queued to domains with longer TransactionIDs")
+		}
+
+		// a cross reference to an unknown transaction of a registered domain is rejected
+		xref = c.CrossRefs.Pop()
+		xref.TransactionID = bytes.Repeat([]byte{0xff}, 16)
+		c.CrossRefs.Push(xref)
+		txC := makeTransaction(c, "asset in c")
+		if err := r.Submit(c.Descriptor.DomainID, txC); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("unresolved cross reference must be rejected: %v", err)
+		}
+		if c.Store.Len() != 0 {
+			t.Fatal("rejected transaction must not be stored")
+		}
+
+		// the transaction must not be modified after TransactionID is calculated
+		tampered := makeTransaction(a, "tampered")
+		tampered.Events[0].Asset.AssetBody = []byte("modified")
+		if err := r.Submit(a.Descriptor.DomainID, tampered); err == nil {
+			t.Fatal("modified transaction must be rejected")
+		}
+		if _, err := a.Store.Find(tampered.TransactionID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("modified transaction must not be stored: %v", err)
+		}
+
+		// the transaction is checked against the profile of the domain
+		if err := r.Submit(c.Descriptor.DomainID, txA); err == nil {
+			t.Fatal("nonconforming transaction must be rejected")
+		}
+		if err := r.Submit(IDFromName("unknown"), txA); !errors.Is(err, ErrUnknownDomain) {
+			t.Fatalf("unknown domain must be reported: %v", err)
+		}
+	})
+
+	t.Run("store", func(t *testing.T) {
+		r := NewRegistry()
+		a := newDomain(r, "domain_a", 32)
+		txobj := makeTransaction(a, "asset")
+		dat, err := a.Descriptor.Serialize(txobj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Deserialize(a.Descriptor.DomainID, dat); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := a.Store.Get(txobj.TransactionID)
+		if err != nil || !bytes.Equal(stored.TransactionID, txobj.TransactionID) {
+			t.Fatalf("transaction must be stored: %v", err)
+		}
+		stored.Events[0].Asset.AssetBody = []byte("modified")
+		if again, _ := a.Store.Get(txobj.TransactionID); bytes.Equal(again.Events[0].Asset.AssetBody, stored.Events[0].Asset.AssetBody) {
+			t.Fatal("store must return a copy")
+		}
+		if _, err := a.Store.Find(txobj.TransactionID[:4]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.Store.Find(nil); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("empty prefix must not match: %v", err)
+		}
+		if ids := a.Store.TransactionIDs(); len(ids) != 1 || !bytes.Equal(ids[0], txobj.TransactionID) {
+			t.Fatal("unexpected TransactionIDs")
+		}
+	})
+}
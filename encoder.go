@@ -0,0 +1,650 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+/*
+Fast packing path
+
+AppendPack, PackedSize and PackBuffer are the high-performance alternative to Pack and Serialize.
+The output is byte-identical to Pack (and Serialize), but the encoder
+  * computes the size of the packed data up front and grows the destination buffer only once,
+  * writes the values directly into the buffer without reflection (encoding/binary.Write),
+  * writes the child objects in place instead of packing them separately and copying,
+  * updates the digest cache (see BBcTransaction) from the packed data, instead of packing the base part again in Digest().
+
+Unlike Pack, AppendPack does not set TransactionData, because the packed data belongs to the caller's buffer.
+*/
+
+// maxPooledBufferSize is the maximum capacity of the buffer returned to the pool (larger buffers are discarded)
+const maxPooledBufferSize = 1 << 20
+
+// encoder appends the packed values to the buffer
+type encoder struct {
+	buf []byte
+}
+
+// grow makes sure that n bytes can be appended without reallocation
+func (e *encoder) grow(n int) {
+	if cap(e.buf)-len(e.buf) >= n {
+		return
+	}
+	buf := make([]byte, len(e.buf), len(e.buf)+n)
+	copy(buf, e.buf)
+	e.buf = buf
+}
+
+// put2byte appends a uint16 value
+func (e *encoder) put2byte(val uint16) {
+	e.buf = append(e.buf, byte(val), byte(val>>8))
+}
+
+// put4byte appends a uint32 value
+func (e *encoder) put4byte(val uint32) {
+	e.buf = append(e.buf, byte(val), byte(val>>8), byte(val>>16), byte(val>>24))
+}
+
+// put8byte appends a int64 value
+func (e *encoder) put8byte(val int64) {
+	v := uint64(val)
+	e.buf = append(e.buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24), byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56))
+}
+
+// putBytes appends binary data as is
+func (e *encoder) putBytes(val []byte) {
+	e.buf = append(e.buf, val...)
+}
+
+// putBigInt appends an ID with the 2-byte length header (same as PutBigInt)
+func (e *encoder) putBigInt(val []byte, length int) error {
+	if len(val) != length || length > 0xFFFF {
+		return fmt.Errorf("invalid ID length (data=%d, length=%d)", len(val), length)
+	}
+	e.put2byte(uint16(length))
+	e.putBytes(val)
+	return nil
+}
+
+// beginLength reserves the length header (2 or 4 bytes) of a child object and returns its position
+func (e *encoder) beginLength(headerSize int) int {
+	pos := len(e.buf)
+	for i := 0; i < headerSize; i++ {
+		e.buf = append(e.buf, 0)
+	}
+	return pos
+}
+
+// endLength writes the length of the child object written after the header reserved by beginLength
+func (e *encoder) endLength(pos, headerSize int) {
+	length := len(e.buf) - pos - headerSize
+	for i := 0; i < headerSize; i++ {
+		e.buf[pos+i] = byte(length >> (8 * uint(i)))
+	}
+}
+
+// idSize returns the size of an ID with the 2-byte length header
+func idSize(val []byte) int {
+	return 2 + len(val)
+}
+
+// PackedSize returns the size of the packed data of the BBcTransaction object (i.e., len of the result of Pack)
+func (p *BBcTransaction) PackedSize() int {
+	size := 4 + 8
+	if hasIdLengthHeader(p.Version) {
+		size += 2
+	}
+	size += 2
+	for _, obj := range p.Events {
+		size += 4 + obj.packedSize()
+	}
+	size += 2
+	for _, obj := range p.References {
+		size += 4 + obj.packedSize()
+	}
+	size += 2
+	for _, obj := range p.Relations {
+		size += 4 + obj.packedSize()
+	}
+	size += 2
+	if p.Witness != nil {
+		size += 4 + p.Witness.packedSize()
+	}
+	size += 2
+	if p.Crossref != nil {
+		size += 4 + p.Crossref.packedSize()
+	}
+	size += 2
+	for _, obj := range p.Signatures {
+		size += 4 + obj.packedSize()
+	}
+	return size
+}
+
+// AppendPack appends the packed data of the BBcTransaction object to dst and returns the extended buffer
+// The appended data is the same as that of Pack. If dst has enough capacity (see PackedSize), no memory is allocated for the packed data.
+func (p *BBcTransaction) AppendPack(dst []byte) ([]byte, error) {
+	if err := p.checkVersion(); err != nil {
+		return dst, err
+	}
+
+	e := encoder{buf: dst}
+	e.grow(p.PackedSize())
+	start := len(e.buf)
+	var baseSize int
+	var err error
+	if e.buf, baseSize, err = p.packDigestTarget(e.buf); err != nil {
+		return dst, err
+	}
+	p.updateDigest(e.buf[start:], baseSize)
+
+	e.put2byte(uint16(len(p.Signatures)))
+	for _, obj := range p.Signatures {
+		pos := e.beginLength(4)
+		if err := obj.encode(&e); err != nil {
+			return dst, err
+		}
+		e.endLength(pos, 4)
+	}
+	return e.buf, nil
+}
+
+// encodeBase appends the base part of BBcTransaction object (from version to witness)
+func (p *BBcTransaction) encodeBase(e *encoder) error {
+	e.put4byte(p.Version)
+	e.put8byte(p.Timestamp)
+	if hasIdLengthHeader(p.Version) {
+		e.put2byte(uint16(p.TransactionIdLength))
+	}
+
+	e.put2byte(uint16(len(p.Events)))
+	for _, obj := range p.Events {
+		pos := e.beginLength(4)
+		if err := obj.encode(e); err != nil {
+			return err
+		}
+		e.endLength(pos, 4)
+	}
+
+	e.put2byte(uint16(len(p.References)))
+	for _, obj := range p.References {
+		pos := e.beginLength(4)
+		if err := obj.encode(e); err != nil {
+			return err
+		}
+		e.endLength(pos, 4)
+	}
+
+	e.put2byte(uint16(len(p.Relations)))
+	for _, obj := range p.Relations {
+		pos := e.beginLength(4)
+		if err := obj.encode(e); err != nil {
+			return err
+		}
+		e.endLength(pos, 4)
+	}
+
+	if p.Witness != nil {
+		e.put2byte(1)
+		pos := e.beginLength(4)
+		if err := p.Witness.encode(e); err != nil {
+			return err
+		}
+		e.endLength(pos, 4)
+	} else {
+		e.put2byte(0)
+	}
+	return nil
+}
+
+// encodeCrossRef appends the BBcCrossRef part of BBcTransaction object
+func (p *BBcTransaction) encodeCrossRef(e *encoder) error {
+	if p.Crossref == nil {
+		e.put2byte(0)
+		return nil
+	}
+	e.put2byte(1)
+	pos := e.beginLength(4)
+	if err := p.Crossref.encode(e); err != nil {
+		return err
+	}
+	e.endLength(pos, 4)
+	return nil
+}
+
+// packedSize returns the size of the packed data of the BBcEvent object
+func (p *BBcEvent) packedSize() int {
+	size := idSize(p.AssetGroupID)
+	size += 2 + 2*len(p.ReferenceIndices)
+	size += 2
+	for _, id := range p.MandatoryApprovers {
+		size += idSize(id)
+	}
+	size += 2 + 2
+	for _, id := range p.OptionApprovers {
+		size += idSize(id)
+	}
+	size += 4
+	if p.Asset != nil {
+		size += p.Asset.packedSize()
+	}
+	return size
+}
+
+// encode appends the packed data of the BBcEvent object
+func (p *BBcEvent) encode(e *encoder) error {
+	if len(p.OptionApprovers) != int(p.OptionApproverNumDenominator) {
+		return errors.New("num of option approvers must be equal to OptionApproverNumDenominator")
+	}
+	if p.AssetGroupID == nil {
+		return errors.New("need asset_group_id in BBcEvent")
+	}
+	if err := e.putBigInt(p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength); err != nil {
+		return err
+	}
+
+	e.put2byte(uint16(len(p.ReferenceIndices)))
+	for _, idx := range p.ReferenceIndices {
+		e.put2byte(uint16(idx))
+	}
+
+	e.put2byte(uint16(len(p.MandatoryApprovers)))
+	for _, id := range p.MandatoryApprovers {
+		if err := e.putBigInt(id, p.IdLengthConf.UserIdLength); err != nil {
+			return err
+		}
+	}
+
+	e.put2byte(p.OptionApproverNumNumerator)
+	e.put2byte(p.OptionApproverNumDenominator)
+	for _, id := range p.OptionApprovers {
+		if err := e.putBigInt(id, p.IdLengthConf.UserIdLength); err != nil {
+			return err
+		}
+	}
+
+	pos := e.beginLength(4)
+	if p.Asset != nil {
+		if err := p.Asset.encode(e); err != nil {
+			return err
+		}
+	}
+	e.endLength(pos, 4)
+	return nil
+}
+
+// packedSize returns the size of the packed data of the BBcReference object
+func (p *BBcReference) packedSize() int {
+	return idSize(p.AssetGroupID) + idSize(p.TransactionID) + 2 + 2 + 2*len(p.SigIndices)
+}
+
+// encode appends the packed data of the BBcReference object
+func (p *BBcReference) encode(e *encoder) error {
+	if err := e.putBigInt(p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength); err != nil {
+		return err
+	}
+	if err := e.putBigInt(p.TransactionID, p.IdLengthConf.TransactionIdLength); err != nil {
+		return err
+	}
+	e.put2byte(p.EventIndexInRef)
+	e.put2byte(uint16(len(p.SigIndices)))
+	for _, idx := range p.SigIndices {
+		e.put2byte(uint16(idx))
+	}
+	return nil
+}
+
+// packedSize returns the size of the packed data of the BBcRelation object
+func (p *BBcRelation) packedSize() int {
+	size := idSize(p.AssetGroupID)
+	size += 2
+	for _, obj := range p.Pointers {
+		size += 2 + obj.packedSize()
+	}
+	size += 4
+	if p.Asset != nil {
+		size += p.Asset.packedSize()
+	}
+	if p.Version >= 2 {
+		size += 4
+		if p.AssetRaw != nil {
+			size += p.AssetRaw.packedSize()
+		}
+		size += 4
+		if p.AssetHash != nil {
+			size += p.AssetHash.packedSize()
+		}
+	}
+	return size
+}
+
+// encode appends the packed data of the BBcRelation object
+func (p *BBcRelation) encode(e *encoder) error {
+	if p.AssetGroupID == nil {
+		return errors.New("need asset_group_id in BBcRelation")
+	}
+	if err := e.putBigInt(p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength); err != nil {
+		return err
+	}
+
+	e.put2byte(uint16(len(p.Pointers)))
+	for _, obj := range p.Pointers {
+		pos := e.beginLength(2)
+		if err := obj.encode(e); err != nil {
+			return err
+		}
+		e.endLength(pos, 2)
+	}
+
+	pos := e.beginLength(4)
+	if p.Asset != nil {
+		if err := p.Asset.encode(e); err != nil {
+			return err
+		}
+	}
+	e.endLength(pos, 4)
+
+	if p.Version >= 2 {
+		pos = e.beginLength(4)
+		if p.AssetRaw != nil {
+			if err := p.AssetRaw.encode(e); err != nil {
+				return err
+			}
+		}
+		e.endLength(pos, 4)
+
+		pos = e.beginLength(4)
+		if p.AssetHash != nil {
+			if err := p.AssetHash.encode(e); err != nil {
+				return err
+			}
+		}
+		e.endLength(pos, 4)
+	}
+	return nil
+}
+
+// packedSize returns the size of the packed data of the BBcPointer object
+func (p *BBcPointer) packedSize() int {
+	size := idSize(p.TransactionID) + 2
+	if p.AssetID != nil {
+		size += idSize(p.AssetID)
+	}
+	return size
+}
+
+// encode appends the packed data of the BBcPointer object
+func (p *BBcPointer) encode(e *encoder) error {
+	if err := e.putBigInt(p.TransactionID, p.IdLengthConf.TransactionIdLength); err != nil {
+		return err
+	}
+	if p.AssetID == nil {
+		e.put2byte(0)
+		return nil
+	}
+	e.put2byte(1)
+	return e.putBigInt(p.AssetID, p.IdLengthConf.AssetIdLength)
+}
+
+// packedSize returns the size of the packed data of the BBcAsset object
+func (p *BBcAsset) packedSize() int {
+	size := 2 + p.IdLengthConf.AssetIdLength
+	if p.AssetID != nil {
+		size = idSize(p.AssetID)
+	}
+	size += idSize(p.UserID) + idSize(p.Nonce) + 4
+	if p.AssetFileSize > 0 {
+		size += idSize(p.AssetFileDigest)
+	}
+	size += 2 + 2
+	if p.AssetBodySize > 0 {
+		size += len(p.AssetBody)
+	}
+	return size
+}
+
+// encode appends the packed data of the BBcAsset object
+func (p *BBcAsset) encode(e *encoder) error {
+	if p.AssetID == nil {
+		p.Digest()
+	}
+	if err := e.putBigInt(p.AssetID, p.IdLengthConf.AssetIdLength); err != nil {
+		return err
+	}
+	if err := e.putBigInt(p.UserID, p.IdLengthConf.UserIdLength); err != nil {
+		return err
+	}
+	if err := e.putBigInt(p.Nonce, len(p.Nonce)); err != nil {
+		return err
+	}
+	e.put4byte(p.AssetFileSize)
+	if p.AssetFileSize > 0 {
+		if err := e.putBigInt(p.AssetFileDigest, 32); err != nil {
+			return err
+		}
+	}
+	e.put2byte(p.AssetBodyType)
+	e.put2byte(p.AssetBodySize)
+	if p.AssetBodySize > 0 {
+		e.putBytes(p.AssetBody)
+	}
+	return nil
+}
+
+// packedSize returns the size of the packed data of the BBcAssetRaw object
+func (p *BBcAssetRaw) packedSize() int {
+	size := idSize(p.AssetID) + 2
+	if p.AssetBodySize > 0 {
+		size += len(p.AssetBody)
+	}
+	return size
+}
+
+// encode appends the packed data of the BBcAssetRaw object
+func (p *BBcAssetRaw) encode(e *encoder) error {
+	if err := e.putBigInt(p.AssetID, p.IdLengthConf.AssetIdLength); err != nil {
+		return err
+	}
+	e.put2byte(p.AssetBodySize)
+	if p.AssetBodySize > 0 {
+		e.putBytes(p.AssetBody)
+	}
+	return nil
+}
+
+// packedSize returns the size of the packed data of the BBcAssetHash object
+func (p *BBcAssetHash) packedSize() int {
+	size := 2
+	for i := 0; i < int(p.AssetIdNum) && i < len(p.AssetIDs); i++ {
+		size += idSize(p.AssetIDs[i])
+	}
+	return size
+}
+
+// encode appends the packed data of the BBcAssetHash object
+func (p *BBcAssetHash) encode(e *encoder) error {
+	if int(p.AssetIdNum) > len(p.AssetIDs) {
+		return errors.New("num of asset_ids is less than AssetIdNum")
+	}
+	e.put2byte(p.AssetIdNum)
+	for i := 0; i < int(p.AssetIdNum); i++ {
+		if err := e.putBigInt(p.AssetIDs[i], p.IdLengthConf.AssetIdLength); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packedSize returns the size of the packed data of the BBcWitness object
+func (p *BBcWitness) packedSize() int {
+	size := 2
+	for _, id := range p.UserIDs {
+		size += idSize(id) + 2
+	}
+	return size
+}
+
+// encode appends the packed data of the BBcWitness object
+func (p *BBcWitness) encode(e *encoder) error {
+	if len(p.SigIndices) < len(p.UserIDs) {
+		return errors.New("num of sig_indices is less than that of user_ids")
+	}
+	e.put2byte(uint16(len(p.UserIDs)))
+	for i, id := range p.UserIDs {
+		if err := e.putBigInt(id, p.IdLengthConf.UserIdLength); err != nil {
+			return err
+		}
+		e.put2byte(uint16(p.SigIndices[i]))
+	}
+	return nil
+}
+
+// packedSize returns the size of the packed data of the BBcCrossRef object
+func (p *BBcCrossRef) packedSize() int {
+	return idSize(p.DomainID) + idSize(p.TransactionID)
+}
+
+// encode appends the packed data of the BBcCrossRef object
+func (p *BBcCrossRef) encode(e *encoder) error {
+	if err := e.putBigInt(p.DomainID, DomainIDLength); err != nil {
+		return err
+	}
+	return e.putBigInt(p.TransactionID, p.IdLengthConf.TransactionIdLength)
+}
+
+// packedSize returns the size of the packed data of the BBcSignature object
+func (p *BBcSignature) packedSize() int {
+	size := 4
+	if p.KeyType == KeyTypeNotInitialized {
+		return size
+	}
+	size += 4
+	if p.PubkeyLen > 0 {
+		size += len(p.Pubkey)
+	}
+	return size + 4 + len(p.Signature)
+}
+
+// encode appends the packed data of the BBcSignature object
+func (p *BBcSignature) encode(e *encoder) error {
+	e.put4byte(p.KeyType)
+	if p.KeyType == KeyTypeNotInitialized {
+		return nil
+	}
+	e.put4byte(p.PubkeyLen)
+	if p.PubkeyLen > 0 {
+		e.putBytes(p.Pubkey)
+	}
+	e.put4byte(p.SignatureLen)
+	e.putBytes(p.Signature)
+	return nil
+}
+
+/*
+PackBuffer definition
+
+PackBuffer is a reusable buffer for packing and serializing BBcTransaction objects, taken from a pool by GetPackBuffer.
+The data returned by Pack and Serialize refers to the internal buffer, so it is valid only until the next call or Release.
+Copy the data if it must be kept longer. A PackBuffer must not be used by multiple goroutines concurrently.
+*/
+type PackBuffer struct {
+	packed     []byte
+	serialized sliceWriter
+	zlibWriter *zlib.Writer
+}
+
+// sliceWriter is an io.Writer appending data to the slice
+type sliceWriter struct {
+	buf []byte
+}
+
+// Write appends the data to the slice
+func (w *sliceWriter) Write(dat []byte) (int, error) {
+	w.buf = append(w.buf, dat...)
+	return len(dat), nil
+}
+
+var packBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &PackBuffer{}
+	},
+}
+
+// GetPackBuffer returns a PackBuffer from the pool
+func GetPackBuffer() *PackBuffer {
+	return packBufferPool.Get().(*PackBuffer)
+}
+
+// Release returns the PackBuffer to the pool. The buffer and the data returned by it must not be used after Release.
+func (b *PackBuffer) Release() {
+	if cap(b.packed) > maxPooledBufferSize || cap(b.serialized.buf) > maxPooledBufferSize {
+		return
+	}
+	b.packed = b.packed[:0]
+	b.serialized.buf = b.serialized.buf[:0]
+	packBufferPool.Put(b)
+}
+
+// Pack packs the BBcTransaction object into the buffer (same as BBcTransaction.Pack)
+func (b *PackBuffer) Pack(transaction *BBcTransaction) ([]byte, error) {
+	var err error
+	b.packed, err = transaction.AppendPack(b.packed[:0])
+	if err != nil {
+		return nil, err
+	}
+	return b.packed, nil
+}
+
+// Serialize serializes the BBcTransaction object with the header into the buffer (same as Serialize)
+// Unlike Serialize, an unsupported formatType is an error.
+func (b *PackBuffer) Serialize(transaction *BBcTransaction, formatType uint16) ([]byte, error) {
+	if formatType != FormatPlain && formatType != FormatZlib {
+		return nil, errors.New("formatType not supported")
+	}
+	if formatType == FormatPlain {
+		var err error
+		b.serialized.buf = append(b.serialized.buf[:0], byte(formatType), byte(formatType>>8))
+		b.serialized.buf, err = transaction.AppendPack(b.serialized.buf)
+		if err != nil {
+			return nil, err
+		}
+		return b.serialized.buf, nil
+	}
+
+	dat, err := b.Pack(transaction)
+	if err != nil {
+		return nil, err
+	}
+	b.serialized.buf = append(b.serialized.buf[:0], byte(formatType), byte(formatType>>8))
+	if b.zlibWriter == nil {
+		b.zlibWriter = zlib.NewWriter(&b.serialized)
+	} else {
+		b.zlibWriter.Reset(&b.serialized)
+	}
+	if _, err := b.zlibWriter.Write(dat); err != nil {
+		return nil, err
+	}
+	if err := b.zlibWriter.Close(); err != nil {
+		return nil, err
+	}
+	return b.serialized.buf, nil
+}
@@ -0,0 +1,200 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAppendPack(t *testing.T) {
+	refTxObj := makeBaseTx(idLengthConfig)
+	followTx := makeFollowTX(idLengthConfig, &refTxObj)
+	rawTx := makeFollowTXWithAssetRaw(idLengthConfig, &refTxObj)
+	hashTx := makeFollowTXWithAssetHash(idLengthConfig, &refTxObj)
+	domainID := GetIdentifier("domain_id", DomainIDLength)
+	crossTx := makeFollowTX(idLengthConfig, &refTxObj)
+	crossTx.CreateCrossRef(&domainID, &refTxObj.TransactionID)
+	crossTx.TransactionID = nil
+
+	t.Run("same as Pack", func(t *testing.T) {
+		for i, txobj := range []*BBcTransaction{&refTxObj, &followTx, &rawTx, &hashTx, &crossTx, makeBaseTxWithUtility()} {
+			expected, err := txobj.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if txobj.PackedSize() != len(expected) {
+				t.Fatalf("invalid size (%d): %d != %d", i, txobj.PackedSize(), len(expected))
+			}
+			prefix := []byte{0xff, 0xee}
+			dat, err := txobj.AppendPack(prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(dat[:2], prefix) || !bytes.Equal(dat[2:], expected) {
+				t.Fatalf("packed data differs (%d)", i)
+			}
+		}
+	})
+
+	t.Run("transaction_id and base digest", func(t *testing.T) {
+		txobj := makeFollowTX(idLengthConfig, &refTxObj)
+		txobj.CreateCrossRef(&domainID, &refTxObj.TransactionID)
+		txobj.TransactionID = nil
+		txobj.TransactionBaseDigest = nil
+		if _, err := txobj.AppendPack(nil); err != nil {
+			t.Fatal(err)
+		}
+		txid := txobj.TransactionID
+		baseDigest := txobj.TransactionBaseDigest
+		txobj.TransactionID = nil
+		if !bytes.Equal(txobj.Digest()[:txobj.TransactionIdLength], txid) || !bytes.Equal(txobj.TransactionBaseDigest, baseDigest) {
+			t.Fatal("transaction_id must be the same as Digest")
+		}
+	})
+
+	t.Run("pack buffer", func(t *testing.T) {
+		b := GetPackBuffer()
+		defer b.Release()
+		for _, format := range []uint16{FormatPlain, FormatZlib} {
+			expected, _ := Serialize(&followTx, format)
+			dat, err := b.Serialize(&followTx, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(dat, expected) {
+				t.Fatalf("serialized data differs (format=%d)", format)
+			}
+			obj, err := Deserialize(dat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result, _ := obj.VerifyAll(); !result {
+				t.Fatal("Not recovered correctly...")
+			}
+		}
+		if _, err := b.Serialize(&followTx, 0xffff); err == nil {
+			t.Fatal("unsupported formatType must be rejected")
+		}
+		packed, _ := followTx.Pack()
+		dat, err := b.Pack(&followTx)
+		if err != nil || !bytes.Equal(dat, packed) {
+			t.Fatalf("packed data differs: %v", err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		txobj := makeFollowTX(idLengthConfig, &refTxObj)
+		txobj.Relations[0].AssetGroupID = []byte{0x01}
+		_, err1 := txobj.Pack()
+		_, err2 := txobj.AppendPack(nil)
+		if err1 == nil || err2 == nil || err1.Error() != err2.Error() {
+			t.Fatalf("same error must be returned: %v, %v", err1, err2)
+		}
+		if _, err := (&BBcTransaction{}).AppendPack(nil); err == nil {
+			t.Fatal("version=0 transaction must not be packed")
+		}
+	})
+
+	t.Run("no allocation", func(t *testing.T) {
+		buf := make([]byte, 0, followTx.PackedSize())
+		allocs := testing.AllocsPerRun(100, func() {
+			dat, _ := followTx.AppendPack(buf[:0])
+			if len(dat) == 0 {
+				t.Fatal("not packed")
+			}
+		})
+		if allocs != 0 {
+			t.Fatalf("too many allocations: %f", allocs)
+		}
+	})
+}
+
+func BenchmarkPack(b *testing.B) {
+	refTxObj := makeBaseTx(idLengthConfig)
+	followTx := makeFollowTX(idLengthConfig, &refTxObj)
+
+	b.Run("Pack", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			followTx.TransactionID = nil
+			if _, err := followTx.Pack(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("AppendPack", func(b *testing.B) {
+		b.ReportAllocs()
+		buf := make([]byte, 0, followTx.PackedSize())
+		for i := 0; i < b.N; i++ {
+			followTx.TransactionID = nil
+			if _, err := followTx.AppendPack(buf[:0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Pack (transaction_id set)", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := followTx.Pack(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("AppendPack (transaction_id set)", func(b *testing.B) {
+		b.ReportAllocs()
+		buf := make([]byte, 0, followTx.PackedSize())
+		for i := 0; i < b.N; i++ {
+			if _, err := followTx.AppendPack(buf[:0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSerialize(b *testing.B) {
+	refTxObj := makeBaseTx(idLengthConfig)
+	followTx := makeFollowTX(idLengthConfig, &refTxObj)
+
+	for _, format := range []uint16{FormatPlain, FormatZlib} {
+		name := "plain"
+		if format == FormatZlib {
+			name = "zlib"
+		}
+		b.Run("Serialize/"+name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Serialize(&followTx, format); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run("PackBuffer/"+name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf := GetPackBuffer()
+				if _, err := buf.Serialize(&followTx, format); err != nil {
+					b.Fatal(err)
+				}
+				buf.Release()
+			}
+		})
+	}
+}
@@ -98,7 +98,7 @@ func (p *BBcEvent) SetIdLengthConf(conf * BBcIdConfig) {
 func (p *BBcEvent) Add(assetGroupID *[]byte, asset *BBcAsset) {
 	if assetGroupID != nil {
 		p.AssetGroupID = make([]byte, p.IdLengthConf.AssetGroupIdLength)
-		copy(p.AssetGroupID, (*assetGroupID)[:p.IdLengthConf.AssetGroupIdLength])
+		copy(p.AssetGroupID, *assetGroupID)
 	}
 	if asset != nil {
 		p.Asset = asset
@@ -109,7 +109,7 @@ func (p *BBcEvent) Add(assetGroupID *[]byte, asset *BBcAsset) {
 // SetAssetGroup sets asset_group_id in the BBcEvent object
 func (p *BBcEvent) SetAssetGroup(assetGroupId *[]byte) *BBcEvent {
 	p.AssetGroupID = make([]byte, p.IdLengthConf.AssetGroupIdLength)
-	copy(p.AssetGroupID, (*assetGroupId)[:p.IdLengthConf.AssetGroupIdLength])
+	copy(p.AssetGroupID, *assetGroupId)
 	return p
 }
 
@@ -146,16 +146,9 @@ func (p *BBcEvent) AddOptionApprover(userID *[]byte) *BBcEvent {
 
 // Add sets essential information (assetGroupID and BBcAsset object) to the BBcEvent object
 func (p *BBcEvent) CreateAsset(userId *[]byte, fileContent *[]byte, bodyContent interface{}) *BBcEvent {
-	obj := BBcAsset{Version: p.Version}
-	obj.SetIdLengthConf(p.IdLengthConf)
-	obj.Add(userId)
-	if fileContent != nil {
-		obj.AddFile(fileContent)
-	}
-	if bodyContent != nil {
-		obj.AddBody(bodyContent)
-	}
-	p.Asset = &obj
+	var err error
+	p.Asset, err = newAsset(p.Version, p.IdLengthConf, userId, fileContent, bodyContent)
+	_ = logError(err, "failed to set asset body in BBcEvent")
 	return p
 }
 
@@ -169,22 +162,38 @@ func (p *BBcEvent) Pack() ([]byte, error) {
 	}
 	buf := new(bytes.Buffer)
 
-	PutBigInt(buf, &p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength)
+	if err := PutBigInt(buf, &p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength); err != nil {
+		return nil, err
+	}
 
-	Put2byte(buf, uint16(len(p.ReferenceIndices)))
+	if err := Put2byte(buf, uint16(len(p.ReferenceIndices))); err != nil {
+		return nil, err
+	}
 	for i := 0; i < len(p.ReferenceIndices); i++ {
-		Put2byte(buf, uint16(p.ReferenceIndices[i]))
+		if err := Put2byte(buf, uint16(p.ReferenceIndices[i])); err != nil {
+			return nil, err
+		}
 	}
 
-	Put2byte(buf, uint16(len(p.MandatoryApprovers)))
+	if err := Put2byte(buf, uint16(len(p.MandatoryApprovers))); err != nil {
+		return nil, err
+	}
 	for i := 0; i < len(p.MandatoryApprovers); i++ {
-		PutBigInt(buf, &p.MandatoryApprovers[i], p.IdLengthConf.UserIdLength)
+		if err := PutBigInt(buf, &p.MandatoryApprovers[i], p.IdLengthConf.UserIdLength); err != nil {
+			return nil, err
+		}
 	}
 
-	Put2byte(buf, p.OptionApproverNumNumerator)
-	Put2byte(buf, p.OptionApproverNumDenominator)
+	if err := Put2byte(buf, p.OptionApproverNumNumerator); err != nil {
+		return nil, err
+	}
+	if err := Put2byte(buf, p.OptionApproverNumDenominator); err != nil {
+		return nil, err
+	}
 	for i := 0; i < int(p.OptionApproverNumDenominator); i++ {
-		PutBigInt(buf, &p.OptionApprovers[i], p.IdLengthConf.UserIdLength)
+		if err := PutBigInt(buf, &p.OptionApprovers[i], p.IdLengthConf.UserIdLength); err != nil {
+			return nil, err
+		}
 	}
 
 	if p.Asset != nil {
@@ -192,25 +201,29 @@ func (p *BBcEvent) Pack() ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		Put4byte(buf, uint32(binary.Size(ast)))
+		if err := Put4byte(buf, uint32(binary.Size(ast))); err != nil {
+			return nil, err
+		}
 		if err := binary.Write(buf, binary.LittleEndian, ast); err != nil {
 			return nil, err
 		}
 	} else {
-		Put4byte(buf, 0)
+		if err := Put4byte(buf, 0); err != nil {
+			return nil, err
+		}
 	}
 
 	return buf.Bytes(), nil
 }
 
 // unpackApprovers unpacks the approver part of the binary data
-func (p *BBcEvent) unpackApprovers(buf *bytes.Buffer) error {
-	numMandatory, err := Get2byte(buf)
+func (p *BBcEvent) unpackApprovers(d *decoder) error {
+	numMandatory, err := d.get2byte("mandatory_approvers")
 	if err != nil {
 		return err
 	}
 	for i := 0; i < int(numMandatory); i++ {
-		userID, ulen, err2 := GetBigInt(buf)
+		userID, ulen, err2 := d.getBigInt(fmt.Sprintf("mandatory_approvers[%d]", i))
 		if err2 != nil {
 			return err2
 		}
@@ -218,17 +231,17 @@ func (p *BBcEvent) unpackApprovers(buf *bytes.Buffer) error {
 		p.MandatoryApprovers = append(p.MandatoryApprovers, userID)
 	}
 
-	p.OptionApproverNumNumerator, err = Get2byte(buf)
+	p.OptionApproverNumNumerator, err = d.get2byte("option_approver_num_numerator")
 	if err != nil {
 		return err
 	}
-	p.OptionApproverNumDenominator, err = Get2byte(buf)
+	p.OptionApproverNumDenominator, err = d.get2byte("option_approver_num_denominator")
 	if err != nil {
 		return err
 	}
 
 	for i := 0; i < int(p.OptionApproverNumDenominator); i++ {
-		userID, ulen, err2 := GetBigInt(buf)
+		userID, ulen, err2 := d.getBigInt(fmt.Sprintf("option_approvers[%d]", i))
 		if err2 != nil {
 			return err2
 		}
@@ -245,42 +258,86 @@ func (p *BBcEvent) Unpack(dat *[]byte) error {
 	}
 
 	var err error
-	buf := bytes.NewBuffer(*dat)
+	d := newDecoder(*dat)
 
-	p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength, err = GetBigInt(buf)
+	p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength, err = d.getBigInt("asset_group_id")
 	if err != nil {
 		return err
 	}
 
-	numReferences, err := Get2byte(buf)
+	numReferences, err := d.get2byte("reference_indices")
 	if err != nil {
 		return err
 	}
 	for i := 0; i < int(numReferences); i++ {
-		idx, err2 := Get2byte(buf)
+		idx, err2 := d.get2byte(fmt.Sprintf("reference_indices[%d]", i))
 		if err2 != nil {
 			return err2
 		}
 		p.ReferenceIndices = append(p.ReferenceIndices, int(idx))
 	}
 
-	if err = p.unpackApprovers(buf); err != nil {
+	if err = p.unpackApprovers(d); err != nil {
 		return err
 	}
 
-	assetSize, err := Get4byte(buf)
+	assetSize, err := d.get4byte("asset")
 	if err != nil {
 		return err
 	}
 	if assetSize > 0 {
-		ast, _, err := GetBytes(buf, int(assetSize))
-		if err != nil {
+		p.Asset = &BBcAsset{}
+		if err = d.getObject("asset", int(assetSize), p.Asset.Unpack); err != nil {
 			return err
 		}
-		p.Asset = &BBcAsset{}
-		p.Asset.Unpack(&ast)
 		UpdateIdLengthConfig(p.IdLengthConf, p.Asset.IdLengthConf)
 	}
 
 	return nil
 }
+
+// Clone returns a deep copy of the BBcEvent object
+func (p *BBcEvent) Clone() *BBcEvent {
+	return p.clone(newCloneContext())
+}
+
+// clone returns a deep copy of the BBcEvent object, sharing the ID length configuration in the cloneContext
+func (p *BBcEvent) clone(c *cloneContext) *BBcEvent {
+	if p == nil {
+		return nil
+	}
+	obj := BBcEvent{
+		IdLengthConf:                 c.conf(p.IdLengthConf),
+		Version:                      p.Version,
+		AssetGroupID:                 cloneBytes(p.AssetGroupID),
+		MandatoryApprovers:           cloneBytesList(p.MandatoryApprovers),
+		OptionApproverNumNumerator:   p.OptionApproverNumNumerator,
+		OptionApproverNumDenominator: p.OptionApproverNumDenominator,
+		OptionApprovers:              cloneBytesList(p.OptionApprovers),
+		Asset:                        p.Asset.clone(c),
+	}
+	if p.ReferenceIndices != nil {
+		obj.ReferenceIndices = append([]int{}, p.ReferenceIndices...)
+	}
+	return &obj
+}
+
+// Equal returns true if the BBcEvent objects have the same content to be packed
+func (p *BBcEvent) Equal(q *BBcEvent) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	if !bytes.Equal(p.AssetGroupID, q.AssetGroupID) || len(p.ReferenceIndices) != len(q.ReferenceIndices) {
+		return false
+	}
+	for i := range p.ReferenceIndices {
+		if p.ReferenceIndices[i] != q.ReferenceIndices[i] {
+			return false
+		}
+	}
+	return equalBytesList(p.MandatoryApprovers, q.MandatoryApprovers) &&
+		p.OptionApproverNumNumerator == q.OptionApproverNumNumerator &&
+		p.OptionApproverNumDenominator == q.OptionApproverNumDenominator &&
+		equalBytesList(p.OptionApprovers, q.OptionApprovers) &&
+		p.Asset.Equal(q.Asset)
+}
@@ -6,4 +6,5 @@ require (
 	github.com/beyond-blockchain/bbclib-go v1.6.0
 	github.com/lestrrat-go/jwx v1.0.2
 	github.com/ugorji/go/codec v1.1.7
+	google.golang.org/protobuf v1.25.0
 )
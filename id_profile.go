@@ -0,0 +1,138 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+IdLengthProfile definition
+
+IdLengthProfile is an explicit set of ID lengths used for creating and deserializing transactions.
+A profile is immutable once created, so that it can be shared by goroutines without synchronization.
+Unlike the package-level IdLengthConfig, multiple profiles can be used at the same time (e.g., for domains with different ID lengths).
+
+Each transaction created by a profile has its own copy of the configuration, so that modifying a transaction does not affect the profile nor other transactions.
+*/
+type IdLengthProfile struct {
+	conf BBcIdConfig
+}
+
+const (
+	maxIDLength = 32
+)
+
+// NewIdLengthProfile creates a profile with the given ID lengths
+// A zero length is replaced with the default length (32 bytes). A length out of range (1-32) causes an error.
+func NewIdLengthProfile(conf *BBcIdConfig) (*IdLengthProfile, error) {
+	p := IdLengthProfile{conf: BBcIdConfig{
+		TransactionIdLength: defaultIDLength,
+		UserIdLength:        defaultIDLength,
+		AssetGroupIdLength:  defaultIDLength,
+		AssetIdLength:       defaultIDLength,
+		NonceLength:         defaultIDLength,
+	}}
+	if conf == nil {
+		return &p, nil
+	}
+	fields := []struct {
+		name  string
+		value int
+		dst   *int
+	}{
+		{"TransactionIdLength", conf.TransactionIdLength, &p.conf.TransactionIdLength},
+		{"UserIdLength", conf.UserIdLength, &p.conf.UserIdLength},
+		{"AssetGroupIdLength", conf.AssetGroupIdLength, &p.conf.AssetGroupIdLength},
+		{"AssetIdLength", conf.AssetIdLength, &p.conf.AssetIdLength},
+		{"NonceLength", conf.NonceLength, &p.conf.NonceLength},
+	}
+	for _, f := range fields {
+		if f.value == 0 {
+			continue
+		}
+		if f.value < 0 || f.value > maxIDLength {
+			return nil, fmt.Errorf("invalid %s: %d", f.name, f.value)
+		}
+		*f.dst = f.value
+	}
+	return &p, nil
+}
+
+// NewIdLengthProfileAll creates a profile in which all kinds of ID have the same length
+func NewIdLengthProfileAll(length int) (*IdLengthProfile, error) {
+	return NewIdLengthProfile(&BBcIdConfig{
+		TransactionIdLength: length,
+		UserIdLength:        length,
+		AssetGroupIdLength:  length,
+		AssetIdLength:       length,
+		NonceLength:         length,
+	})
+}
+
+// DefaultIdLengthProfile returns a profile with the current values of the package-level IdLengthConfig
+func DefaultIdLengthProfile() *IdLengthProfile {
+	idLengthConfigMutex.RLock()
+	defer idLengthConfigMutex.RUnlock()
+	return &IdLengthProfile{conf: IdLengthConfig}
+}
+
+// Config returns a copy of the ID length configuration in the profile
+func (p *IdLengthProfile) Config() BBcIdConfig {
+	return p.conf
+}
+
+// NewTransaction creates an empty BBcTransaction object with the ID lengths in the profile
+func (p *IdLengthProfile) NewTransaction(version uint32) *BBcTransaction {
+	txobj := BBcTransaction{Version: version}
+	txobj.SetIdLengthConf(&p.conf)
+	txobj.Timestamp = time.Now().UnixNano() / int64(time.Microsecond)
+	return &txobj
+}
+
+// MakeTransaction is a utility for making simple BBcTransaction object with BBcEvent, BBcRelation or/and BBcWitness (same as MakeTransaction in the package)
+func (p *IdLengthProfile) MakeTransaction(eventNum, relationNum int, witness bool) *BBcTransaction {
+	txobj := p.NewTransaction(2)
+
+	for i := 0; i < eventNum; i++ {
+		evt := BBcEvent{Version: txobj.Version}
+		evt.SetIdLengthConf(&txobj.IdLengthConf)
+		txobj.Events = append(txobj.Events, &evt)
+	}
+
+	for i := 0; i < relationNum; i++ {
+		rtn := BBcRelation{Version: txobj.Version}
+		rtn.SetIdLengthConf(&txobj.IdLengthConf)
+		txobj.Relations = append(txobj.Relations, &rtn)
+	}
+
+	if witness {
+		wit := BBcWitness{Version: txobj.Version}
+		wit.SetIdLengthConf(&txobj.IdLengthConf)
+		wit.Transaction = txobj
+		txobj.Witness = &wit
+	}
+
+	return txobj
+}
+
+// Deserialize BBcTransaction data with header
+// The ID lengths found in the data take precedence. The lengths of the IDs not included in the data (e.g., UserIdLength of a transaction without user_id) are taken from the profile.
+func (p *IdLengthProfile) Deserialize(dat []byte) (*BBcTransaction, error) {
+	return deserialize(dat, &p.conf)
+}
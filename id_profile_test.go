@@ -0,0 +1,126 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestIdLengthProfile(t *testing.T) {
+	t.Run("create profile", func(t *testing.T) {
+		profile, err := NewIdLengthProfile(&BBcIdConfig{TransactionIdLength: 24, UserIdLength: 8})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := profile.Config()
+		if conf.TransactionIdLength != 24 || conf.UserIdLength != 8 || conf.AssetIdLength != defaultIDLength {
+			t.Fatalf("invalid config: %v", conf)
+		}
+		if _, err := NewIdLengthProfile(&BBcIdConfig{UserIdLength: 33}); err == nil {
+			t.Fatal("length out of range must be rejected")
+		}
+		if _, err := NewIdLengthProfileAll(-1); err == nil {
+			t.Fatal("length out of range must be rejected")
+		}
+	})
+
+	t.Run("profile is independent of transactions", func(t *testing.T) {
+		profile, _ := NewIdLengthProfileAll(16)
+		txobj := profile.MakeTransaction(1, 1, true)
+		txobj.IdLengthConf.UserIdLength = 4
+		if profile.Config().UserIdLength != 16 {
+			t.Fatal("profile must not be modified through the transaction")
+		}
+		if txobj.Events[0].IdLengthConf != &txobj.IdLengthConf || txobj.Witness.Transaction != txobj {
+			t.Fatal("objects in the transaction must share the configuration of the transaction")
+		}
+	})
+
+	t.Run("deserialize with profile", func(t *testing.T) {
+		profile, _ := NewIdLengthProfile(&BBcIdConfig{TransactionIdLength: 20, UserIdLength: 12})
+		txobj := profile.MakeTransaction(0, 0, false)
+		dat, err := Serialize(txobj, FormatPlain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recovered, err := profile.Deserialize(dat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recovered.IdLengthConf != profile.Config() {
+			t.Fatalf("lengths not included in the data must be taken from the profile: %v", recovered.IdLengthConf)
+		}
+		other, _ := NewIdLengthProfileAll(8)
+		recovered, _ = other.Deserialize(dat)
+		if recovered.TransactionIdLength != 20 || recovered.IdLengthConf.UserIdLength != 8 {
+			t.Fatalf("lengths in the data must take precedence: %v", recovered.IdLengthConf)
+		}
+	})
+
+	t.Run("merge config", func(t *testing.T) {
+		main := BBcIdConfig{TransactionIdLength: 32, UserIdLength: 32, AssetGroupIdLength: 32, AssetIdLength: 32, NonceLength: 32}
+		merged := MergeIdLengthConfig(main, BBcIdConfig{UserIdLength: 8})
+		if merged.UserIdLength != 8 || main.UserIdLength != 32 || merged.AssetIdLength != 32 {
+			t.Fatalf("invalid merge: %v", merged)
+		}
+	})
+
+	t.Run("concurrent use of profiles", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 32)
+		for i := 0; i < 32; i++ {
+			wg.Add(1)
+			go func(length int) {
+				defer wg.Done()
+				profile, _ := NewIdLengthProfileAll(length)
+				user := GetIdentifier(fmt.Sprintf("user%d", length), length)
+				assetGroup := GetIdentifier("asset_group", length)
+				txobj := profile.MakeTransaction(1, 0, true)
+				txobj.Events[0].SetAssetGroup(&assetGroup).AddMandatoryApprover(&user).CreateAsset(&user, nil, "concurrent")
+				txobj.AddWitness(&user)
+				keypair, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+				txobj.Sign(&user, keypair, false)
+				dat, err := Serialize(txobj, FormatZlib)
+				if err != nil {
+					errs <- err
+					return
+				}
+				recovered, err := profile.Deserialize(dat)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if recovered.IdLengthConf != profile.Config() || !bytes.Equal(recovered.Events[0].Asset.UserID, user) {
+					errs <- fmt.Errorf("ID length mismatch (length=%d): %v", length, recovered.IdLengthConf)
+					return
+				}
+				if result, _ := recovered.VerifyAll(); !result {
+					errs <- fmt.Errorf("verification failed (length=%d)", length)
+				}
+			}(i%16 + 16)
+		}
+		ConfigureIdLengthAll(32)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,238 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package hashlock provides the hash lock and the claim of package swap in transactions, and the checks of a claim.
+
+Package swap creates and validates the locks and the claims with it. Packages token and ownership follow an asset
+through a lock with it (without importing package swap), so that the format of the lock is defined only here.
+*/
+package hashlock
+
+import (
+	"bbclib"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+const (
+	// LockBodyType is the value of Type in the lock body
+	LockBodyType = "bbc1-hash-lock"
+	// ClaimBodyType is the value of Type in the claim body
+	ClaimBodyType = "bbc1-hash-lock-claim"
+	// Rule is the name of the rule of the violations
+	Rule = "hash_lock"
+)
+
+var (
+	// ErrNotLock is returned when an asset does not have the lock body
+	ErrNotLock = errors.New("not a hash lock asset")
+	// ErrNotClaim is returned when a transaction does not have the claim body
+	ErrNotClaim = errors.New("not a hash lock claim")
+	// ErrInvalidPreimage is returned when the preimage does not match the hash lock
+	ErrInvalidPreimage = errors.New("preimage does not match the hash lock")
+)
+
+type (
+	// LockBody is the asset body of a hash lock (Timeout is in microseconds, the same as the timestamp of the transaction)
+	LockBody struct {
+		Type          string `codec:"type"`
+		HashLock      []byte `codec:"hash_lock"`
+		Sender        []byte `codec:"sender"`
+		Recipient     []byte `codec:"recipient"`
+		Timeout       int64  `codec:"timeout"`
+		AssetBodyType uint16 `codec:"asset_body_type"`
+		AssetBody     []byte `codec:"asset_body"`
+	}
+
+	// ClaimBody is the asset body of a claim (no preimage for a refund)
+	ClaimBody struct {
+		Type     string `codec:"type"`
+		Preimage []byte `codec:"preimage,omitempty"`
+	}
+
+	// Lock is a hash lock, i.e., a BBcEvent in a transaction
+	Lock struct {
+		Transaction  *bbclib.BBcTransaction
+		EventIndex   int
+		AssetGroupID []byte
+		AssetID      []byte
+		Body         LockBody
+	}
+
+	// Claim is a release or a refund of a hash lock, i.e., a BBcRelation in a transaction
+	Claim struct {
+		Transaction       *bbclib.BBcTransaction
+		RelationIndex     int
+		LockTransactionID []byte
+		LockAssetID       []byte
+		Claimant          []byte
+		Body              ClaimBody
+	}
+)
+
+// GetLock returns the hash lock in the event of the transaction
+func GetLock(txobj *bbclib.BBcTransaction, eventIdx int) (*Lock, error) {
+	if txobj == nil || eventIdx < 0 || eventIdx >= len(txobj.Events) || txobj.Events[eventIdx] == nil {
+		return nil, fmt.Errorf("no event (index=%d)", eventIdx)
+	}
+	evt := txobj.Events[eventIdx]
+	if evt.Asset == nil || evt.Asset.AssetBodyType != bbclib.AssetBodyTypeMsgpack {
+		return nil, fmt.Errorf("events[%d]: %w", eventIdx, ErrNotLock)
+	}
+	var body LockBody
+	if err := evt.Asset.DecodeBody(&body); err != nil || body.Type != LockBodyType {
+		return nil, fmt.Errorf("events[%d]: %w", eventIdx, ErrNotLock)
+	}
+	return &Lock{
+		Transaction:  txobj,
+		EventIndex:   eventIdx,
+		AssetGroupID: evt.AssetGroupID,
+		AssetID:      evt.Asset.AssetID,
+		Body:         body,
+	}, nil
+}
+
+// LockedAsset returns the asset with the locked asset body owned by the sender (for decoding the body)
+func (l *Lock) LockedAsset() *bbclib.BBcAsset {
+	return &bbclib.BBcAsset{UserID: l.Body.Sender, AssetBodyType: l.Body.AssetBodyType, AssetBody: l.Body.AssetBody}
+}
+
+// Matches returns true if the preimage matches the hash lock
+func (l *Lock) Matches(preimage []byte) bool {
+	digest := sha256.Sum256(preimage)
+	return bytes.Equal(digest[:], l.Body.HashLock)
+}
+
+// GetClaim returns the claim in the relation of the transaction
+func GetClaim(txobj *bbclib.BBcTransaction, relationIdx int) (*Claim, error) {
+	if txobj == nil || relationIdx < 0 || relationIdx >= len(txobj.Relations) || txobj.Relations[relationIdx] == nil {
+		return nil, fmt.Errorf("no relation (index=%d)", relationIdx)
+	}
+	rtn := txobj.Relations[relationIdx]
+	if rtn.Asset == nil || rtn.Asset.AssetBodyType != bbclib.AssetBodyTypeMsgpack || len(rtn.Pointers) != 1 || rtn.Pointers[0] == nil {
+		return nil, fmt.Errorf("relations[%d]: %w", relationIdx, ErrNotClaim)
+	}
+	var body ClaimBody
+	if err := rtn.Asset.DecodeBody(&body); err != nil || body.Type != ClaimBodyType {
+		return nil, fmt.Errorf("relations[%d]: %w", relationIdx, ErrNotClaim)
+	}
+	return &Claim{
+		Transaction:       txobj,
+		RelationIndex:     relationIdx,
+		LockTransactionID: rtn.Pointers[0].TransactionID,
+		LockAssetID:       rtn.Pointers[0].AssetID,
+		Claimant:          rtn.Asset.UserID,
+		Body:              body,
+	}, nil
+}
+
+// Of returns true if the claim is of the lock
+func (c *Claim) Of(lock *Lock) bool {
+	return bytes.Equal(c.LockTransactionID, lock.Transaction.TransactionID) && bytes.Equal(c.LockAssetID, lock.AssetID)
+}
+
+// Violation returns the violation of Rule at the path
+func Violation(path, format string, args ...interface{}) bbclib.Violation {
+	return bbclib.Violation{Rule: Rule, Path: path, Message: fmt.Sprintf(format, args...)}
+}
+
+// ClaimViolations returns the violations of the claim of the lock spent by the reference at the index of the transaction
+// now is the time in microseconds at which the claim is accepted (e.g., the clock of the domain), in addition to the timestamp of the transaction.
+// The checks are:
+//   - a release has the preimage of the hash lock and the timestamp and now earlier than the timeout, and is signed by the recipient
+//   - a refund has the timestamp and now not earlier than the timeout, and is signed by the sender
+//   - the lock is spent by only one event, which has the locked asset body for the claimant (the owner and the only mandatory approver)
+func ClaimViolations(txobj *bbclib.BBcTransaction, refIdx int, lock *Lock, keys bbclib.KeyResolver, now int64) []bbclib.Violation {
+	path := fmt.Sprintf("references[%d]", refIdx)
+	var c *Claim
+	for i := range txobj.Relations {
+		if claim, err := GetClaim(txobj, i); err == nil && claim.Of(lock) {
+			c = claim
+			break
+		}
+	}
+	if c == nil {
+		return []bbclib.Violation{Violation(path, "lock %x is spent without a claim", lock.Transaction.TransactionID)}
+	}
+
+	var v []bbclib.Violation
+	claimPath := fmt.Sprintf("relations[%d]", c.RelationIndex)
+	if len(c.Body.Preimage) > 0 {
+		if !bytes.Equal(c.Claimant, lock.Body.Recipient) {
+			v = append(v, Violation(claimPath+".asset.user_id", "release must be claimed by the recipient %x", lock.Body.Recipient))
+		}
+		if !lock.Matches(c.Body.Preimage) {
+			v = append(v, Violation(claimPath+".asset", "%v", ErrInvalidPreimage))
+		}
+		if txobj.Timestamp >= lock.Body.Timeout || now >= lock.Body.Timeout {
+			v = append(v, Violation("timestamp", "release at %d is not earlier than the timeout %d", txobj.Timestamp, lock.Body.Timeout))
+		}
+	} else {
+		if !bytes.Equal(c.Claimant, lock.Body.Sender) {
+			v = append(v, Violation(claimPath+".asset.user_id", "refund must be claimed by the sender %x", lock.Body.Sender))
+		}
+		if txobj.Timestamp < lock.Body.Timeout || now < lock.Body.Timeout {
+			v = append(v, Violation("timestamp", "refund at %d is earlier than the timeout %d", txobj.Timestamp, lock.Body.Timeout))
+		}
+	}
+	if err := SignedBy(txobj, c.Claimant, keys); err != nil {
+		v = append(v, Violation(claimPath, "claim must be signed by the claimant %x: %v", c.Claimant, err))
+	}
+
+	var outputs []int
+	for i, evt := range txobj.Events {
+		if evt == nil {
+			continue
+		}
+		for _, idx := range evt.ReferenceIndices {
+			if idx == refIdx {
+				outputs = append(outputs, i)
+				break
+			}
+		}
+	}
+	if len(outputs) != 1 {
+		return append(v, Violation(path, "lock must be spent by one event (%d events)", len(outputs)))
+	}
+	evtPath := fmt.Sprintf("events[%d]", outputs[0])
+	evt := txobj.Events[outputs[0]]
+	switch {
+	case !bytes.Equal(evt.AssetGroupID, lock.AssetGroupID):
+		v = append(v, Violation(evtPath+".asset_group_id", "output must be in the asset group of the lock"))
+	case evt.Asset == nil || !bytes.Equal(evt.Asset.UserID, c.Claimant):
+		v = append(v, Violation(evtPath+".asset.user_id", "output must be owned by the claimant"))
+	case len(evt.MandatoryApprovers) != 1 || !bytes.Equal(evt.MandatoryApprovers[0], c.Claimant):
+		v = append(v, Violation(evtPath+".mandatory_approvers", "claimant must be the only mandatory approver of the output"))
+	case evt.Asset.AssetBodyType != lock.Body.AssetBodyType || !bytes.Equal(evt.Asset.AssetBody, lock.Body.AssetBody):
+		v = append(v, Violation(evtPath+".asset.asset_body", "output must have the locked asset body"))
+	}
+	return v
+}
+
+// SignedBy verifies that the user is a witness of the transaction and has signed it with the public key given by keys
+func SignedBy(txobj *bbclib.BBcTransaction, userID []byte, keys bbclib.KeyResolver) error {
+	if txobj.Witness != nil {
+		for i, uid := range txobj.Witness.UserIDs {
+			if bytes.Equal(uid, userID) && i < len(txobj.Witness.SigIndices) {
+				return txobj.VerifySignedBy(txobj.Witness.SigIndices[i], userID, keys)
+			}
+		}
+	}
+	return errors.New("not a witness")
+}
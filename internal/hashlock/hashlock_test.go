@@ -0,0 +1,68 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hashlock
+
+import (
+	"bbclib"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestLockAndClaim(t *testing.T) {
+	sender := bbclib.GetIdentifier("sender", 32)
+	recipient := bbclib.GetIdentifier("recipient", 32)
+	group := bbclib.GetIdentifier("group", 32)
+	preimage := []byte("preimage")
+	hash := sha256.Sum256(preimage)
+
+	body := LockBody{Type: LockBodyType, HashLock: hash[:], Sender: sender, Recipient: recipient, Timeout: 100,
+		AssetBodyType: bbclib.AssetBodyTypeRaw, AssetBody: []byte("asset")}
+	lockTx, err := bbclib.NewTransactionBuilder(nil).SetTimestamp(1).
+		AddEvent(&group, func(e *bbclib.EventBuilder) { e.CreateAsset(&sender, nil, "not a lock") }).
+		AddEvent(&group, func(e *bbclib.EventBuilder) { e.CreateAsset(&sender, nil, &body) }).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetLock(lockTx, 0); !errors.Is(err, ErrNotLock) {
+		t.Fatalf("event without the lock body must not be a lock: %v", err)
+	}
+	lock, err := GetLock(lockTx, 1)
+	if err != nil || !bytes.Equal(lock.Body.Recipient, recipient) || !lock.Matches(preimage) || lock.Matches([]byte("wrong")) {
+		t.Fatalf("lock must be decoded: %v", err)
+	}
+	if asset := lock.LockedAsset(); !bytes.Equal(asset.UserID, sender) || string(asset.AssetBody) != "asset" {
+		t.Fatal("locked asset must have the locked asset body")
+	}
+
+	lockTxID, lockAssetID := lockTx.TransactionID, lock.AssetID
+	claimTx, err := bbclib.NewTransactionBuilder(nil).SetTimestamp(2).
+		AddRelation(&group, func(r *bbclib.RelationBuilder) {
+			r.CreatePointer(&lockTxID, &lockAssetID).CreateAsset(&recipient, nil, &ClaimBody{Type: ClaimBodyType, Preimage: preimage})
+		}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := GetClaim(claimTx, 0)
+	if err != nil || !c.Of(lock) || !bytes.Equal(c.Claimant, recipient) || !bytes.Equal(c.Body.Preimage, preimage) {
+		t.Fatalf("claim must be decoded: %v", err)
+	}
+	if v := ClaimViolations(claimTx, 0, lock, nil, 2); len(v) == 0 {
+		t.Fatal("claim without the reference and the signature must be rejected")
+	}
+}
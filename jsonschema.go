@@ -0,0 +1,681 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+JSON Schema
+
+JSONSchema is a compiled JSON Schema (draft-07) supporting the keywords below, which cover the validation of asset bodies:
+
+  - type, enum, const
+  - properties, required, additionalProperties, minProperties, maxProperties
+  - items (a single schema), minItems, maxItems, uniqueItems
+  - minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf
+  - minLength, maxLength, pattern (Go regexp syntax)
+  - allOf, anyOf, oneOf, not
+  - $ref to a local definition (e.g., "#/definitions/amount")
+
+The other validation keywords (e.g., patternProperties, if/then/else) are rejected by CompileJSONSchema, so that a schema is never
+partially enforced. Annotations (title, description, $schema, $id, default, examples, format) are accepted and ignored.
+
+Numbers are compared as float64, so that integers beyond 2^53 may lose precision in minimum/maximum/multipleOf.
+Byte strings in a decoded body (e.g., MessagePack) are validated as strings: the text if valid UTF-8, otherwise the standard base64
+encoding of the bytes, so that a binary field (e.g., an ID) can be declared as {"type": "string", "contentEncoding": "base64"}.
+*/
+type (
+	JSONSchema struct {
+		root *schemaNode
+	}
+
+	// SchemaError is a problem found by JSONSchema.Validate
+	SchemaError struct {
+		Pointer string // JSON pointer to the value in the instance (e.g., "/items/0/amount", "" for the root)
+		Keyword string
+		Message string
+	}
+
+	schemaNode struct {
+		always               *bool
+		types                []string
+		enum                 []interface{}
+		constValue           interface{}
+		hasConst             bool
+		properties           map[string]*schemaNode
+		required             []string
+		additionalProperties *schemaNode
+		minProperties        *int
+		maxProperties        *int
+		items                *schemaNode
+		minItems             *int
+		maxItems             *int
+		uniqueItems          bool
+		minimum              *float64
+		maximum              *float64
+		exclusiveMinimum     *float64
+		exclusiveMaximum     *float64
+		multipleOf           *float64
+		minLength            *int
+		maxLength            *int
+		pattern              *regexp.Regexp
+		allOf                []*schemaNode
+		anyOf                []*schemaNode
+		oneOf                []*schemaNode
+		not                  *schemaNode
+	}
+
+	schemaCompiler struct {
+		doc  interface{}
+		refs map[string]*schemaNode
+	}
+)
+
+// keywords accepted and ignored
+var schemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "format": true, "definitions": true, "$defs": true,
+	"readOnly": true, "writeOnly": true, "contentEncoding": true, "contentMediaType": true,
+}
+
+// Error returns the problem with the pointer
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", displayPointer(e.Pointer), e.Keyword, e.Message)
+}
+
+// displayPointer returns the pointer for messages ("/" for the root)
+func displayPointer(pointer string) string {
+	if pointer == "" {
+		return "/"
+	}
+	return pointer
+}
+
+// CompileJSONSchema compiles the JSON Schema document
+func CompileJSONSchema(schema []byte) (*JSONSchema, error) {
+	decoder := json.NewDecoder(bytes.NewReader(schema))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	if decoder.More() {
+		return nil, errors.New("invalid JSON schema: trailing data")
+	}
+	doc, serr := normalizeJSONValue(doc, "")
+	if serr != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", serr)
+	}
+	c := schemaCompiler{doc: doc, refs: make(map[string]*schemaNode)}
+	root, err := c.compile(doc, "#")
+	if err != nil {
+		return nil, err
+	}
+	return &JSONSchema{root: root}, nil
+}
+
+// MustCompileJSONSchema is like CompileJSONSchema but panics if the schema is invalid
+func MustCompileJSONSchema(schema []byte) *JSONSchema {
+	s, err := CompileJSONSchema(schema)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// compile compiles the schema at the location (a JSON pointer in URI fragment form)
+func (c *schemaCompiler) compile(val interface{}, location string) (*schemaNode, error) {
+	if b, ok := val.(bool); ok {
+		return &schemaNode{always: &b}, nil
+	}
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or a boolean", location)
+	}
+	if ref, ok := obj["$ref"]; ok {
+		return c.compileRef(ref, location)
+	}
+
+	n := &schemaNode{}
+	var err error
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := obj[key]
+		loc := location + "/" + escapePointer(key)
+		switch key {
+		case "type":
+			n.types, err = schemaTypes(v, loc)
+		case "enum":
+			list, ok := v.([]interface{})
+			if !ok {
+				err = fmt.Errorf("%s: must be an array", loc)
+			}
+			n.enum = list
+		case "const":
+			n.constValue, n.hasConst = v, true
+		case "properties":
+			n.properties, err = c.compileMap(v, loc)
+		case "required":
+			n.required, err = schemaStrings(v, loc)
+		case "additionalProperties":
+			n.additionalProperties, err = c.compile(v, loc)
+		case "minProperties":
+			n.minProperties, err = schemaInt(v, loc)
+		case "maxProperties":
+			n.maxProperties, err = schemaInt(v, loc)
+		case "items":
+			if _, ok := v.([]interface{}); ok {
+				err = fmt.Errorf("%s: array form of items is not supported", loc)
+			} else {
+				n.items, err = c.compile(v, loc)
+			}
+		case "minItems":
+			n.minItems, err = schemaInt(v, loc)
+		case "maxItems":
+			n.maxItems, err = schemaInt(v, loc)
+		case "uniqueItems":
+			b, ok := v.(bool)
+			if !ok {
+				err = fmt.Errorf("%s: must be a boolean", loc)
+			}
+			n.uniqueItems = b
+		case "minimum":
+			n.minimum, err = schemaNumber(v, loc)
+		case "maximum":
+			n.maximum, err = schemaNumber(v, loc)
+		case "exclusiveMinimum":
+			n.exclusiveMinimum, err = schemaNumber(v, loc)
+		case "exclusiveMaximum":
+			n.exclusiveMaximum, err = schemaNumber(v, loc)
+		case "multipleOf":
+			n.multipleOf, err = schemaNumber(v, loc)
+			if err == nil && *n.multipleOf <= 0 {
+				err = fmt.Errorf("%s: must be positive", loc)
+			}
+		case "minLength":
+			n.minLength, err = schemaInt(v, loc)
+		case "maxLength":
+			n.maxLength, err = schemaInt(v, loc)
+		case "pattern":
+			s, ok := v.(string)
+			if !ok {
+				err = fmt.Errorf("%s: must be a string", loc)
+				break
+			}
+			if n.pattern, err = regexp.Compile(s); err != nil {
+				err = fmt.Errorf("%s: %w", loc, err)
+			}
+		case "allOf":
+			n.allOf, err = c.compileList(v, loc)
+		case "anyOf":
+			n.anyOf, err = c.compileList(v, loc)
+		case "oneOf":
+			n.oneOf, err = c.compileList(v, loc)
+		case "not":
+			n.not, err = c.compile(v, loc)
+		default:
+			if !schemaAnnotations[key] {
+				err = fmt.Errorf("%s: keyword is not supported", loc)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// compileRef compiles the schema referred by $ref (recursive references share the node)
+func (c *schemaCompiler) compileRef(ref interface{}, location string) (*schemaNode, error) {
+	s, ok := ref.(string)
+	if !ok || !strings.HasPrefix(s, "#") {
+		return nil, fmt.Errorf("%s/$ref: only local references (\"#/...\") are supported", location)
+	}
+	if n, ok := c.refs[s]; ok {
+		return n, nil
+	}
+	target, err := resolvePointer(c.doc, strings.TrimPrefix(s, "#"))
+	if err != nil {
+		return nil, fmt.Errorf("%s/$ref: %w", location, err)
+	}
+	n := &schemaNode{}
+	c.refs[s] = n
+	compiled, err := c.compile(target, s)
+	if err != nil {
+		return nil, err
+	}
+	*n = *compiled
+	return n, nil
+}
+
+// compileMap compiles the schemas in the object (properties)
+func (c *schemaCompiler) compileMap(val interface{}, location string) (map[string]*schemaNode, error) {
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: must be an object", location)
+	}
+	nodes := make(map[string]*schemaNode, len(obj))
+	for k, v := range obj {
+		n, err := c.compile(v, location+"/"+escapePointer(k))
+		if err != nil {
+			return nil, err
+		}
+		nodes[k] = n
+	}
+	return nodes, nil
+}
+
+// compileList compiles the schemas in the array (allOf, anyOf and oneOf)
+func (c *schemaCompiler) compileList(val interface{}, location string) ([]*schemaNode, error) {
+	list, ok := val.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("%s: must be a non-empty array", location)
+	}
+	nodes := make([]*schemaNode, len(list))
+	for i, v := range list {
+		n, err := c.compile(v, fmt.Sprintf("%s/%d", location, i))
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = n
+	}
+	return nodes, nil
+}
+
+// schemaTypes returns the value of "type"
+func schemaTypes(val interface{}, location string) ([]string, error) {
+	var types []string
+	if s, ok := val.(string); ok {
+		types = []string{s}
+	} else {
+		var err error
+		if types, err = schemaStrings(val, location); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range types {
+		switch t {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, fmt.Errorf("%s: unknown type %q", location, t)
+		}
+	}
+	return types, nil
+}
+
+// schemaStrings returns the array of strings
+func schemaStrings(val interface{}, location string) ([]string, error) {
+	list, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: must be an array of strings", location)
+	}
+	strs := make([]string, len(list))
+	for i, v := range list {
+		if strs[i], ok = v.(string); !ok {
+			return nil, fmt.Errorf("%s: must be an array of strings", location)
+		}
+	}
+	return strs, nil
+}
+
+// schemaNumber returns the number
+func schemaNumber(val interface{}, location string) (*float64, error) {
+	f, ok := val.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a number", location)
+	}
+	return &f, nil
+}
+
+// schemaInt returns the non-negative integer
+func schemaInt(val interface{}, location string) (*int, error) {
+	f, ok := val.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("%s: must be a non-negative integer", location)
+	}
+	i := int(f)
+	return &i, nil
+}
+
+// escapePointer escapes the reference token of a JSON pointer
+func escapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+// resolvePointer returns the value at the JSON pointer in the document
+func resolvePointer(doc interface{}, pointer string) (interface{}, error) {
+	if pointer == "" {
+		return doc, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	cur := doc
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			next, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("%q not found", pointer)
+			}
+			cur = next
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("%q not found", pointer)
+			}
+			cur = v[i]
+		default:
+			return nil, fmt.Errorf("%q not found", pointer)
+		}
+	}
+	return cur, nil
+}
+
+// normalizeJSONValue converts a decoded value (JSON, MessagePack or CBOR) into the JSON data model
+// (nil, bool, float64, string, []interface{} and map[string]interface{}), and reports a value which cannot be converted at its pointer
+// A byte string which is not valid UTF-8 is converted into its standard base64 encoding.
+func normalizeJSONValue(val interface{}, pointer string) (interface{}, *SchemaError) {
+	switch v := val.(type) {
+	case nil, bool, string, float64:
+		return v, nil
+	case []byte:
+		if !utf8.Valid(v) {
+			return base64.StdEncoding.EncodeToString(v), nil
+		}
+		return string(v), nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return nil, &SchemaError{Pointer: pointer, Keyword: "type", Message: err.Error()}
+		}
+		return f, nil
+	case float32:
+		return float64(v), nil
+	case int, int8, int16, int32, int64:
+		return float64(reflect.ValueOf(v).Int()), nil
+	case uint, uint8, uint16, uint32, uint64:
+		return float64(reflect.ValueOf(v).Uint()), nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			n, err := normalizeJSONValue(item, fmt.Sprintf("%s/%d", pointer, i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = n
+		}
+		return list, nil
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			n, err := normalizeJSONValue(item, pointer+"/"+escapePointer(k))
+			if err != nil {
+				return nil, err
+			}
+			obj[k] = n
+		}
+		return obj, nil
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			var key string
+			switch kv := k.(type) {
+			case string:
+				key = kv
+			case []byte:
+				key = string(kv)
+			default:
+				return nil, &SchemaError{Pointer: pointer, Keyword: "type", Message: fmt.Sprintf("map key %v is not a string", k)}
+			}
+			n, err := normalizeJSONValue(item, pointer+"/"+escapePointer(key))
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = n
+		}
+		return obj, nil
+	}
+	return nil, &SchemaError{Pointer: pointer, Keyword: "type", Message: fmt.Sprintf("%T cannot be expressed in JSON", val)}
+}
+
+// Validate validates the value (decoded from JSON, MessagePack or CBOR) and returns all problems
+func (s *JSONSchema) Validate(val interface{}) []*SchemaError {
+	instance, err := normalizeJSONValue(val, "")
+	if err != nil {
+		return []*SchemaError{err}
+	}
+	return s.root.validate(instance, "")
+}
+
+// ValidateJSON validates the JSON document and returns all problems
+func (s *JSONSchema) ValidateJSON(doc []byte) []*SchemaError {
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+	var val interface{}
+	if err := decoder.Decode(&val); err != nil {
+		return []*SchemaError{{Keyword: "json", Message: err.Error()}}
+	}
+	if decoder.More() {
+		return []*SchemaError{{Keyword: "json", Message: "trailing data after JSON value"}}
+	}
+	return s.Validate(val)
+}
+
+// jsonType returns the JSON type of the normalized value
+func jsonType(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// validate validates the normalized value at the pointer
+func (n *schemaNode) validate(val interface{}, pointer string) []*SchemaError {
+	if n.always != nil {
+		if *n.always {
+			return nil
+		}
+		return []*SchemaError{{Pointer: pointer, Keyword: "false", Message: "no value is allowed"}}
+	}
+	var errs []*SchemaError
+	fail := func(keyword, format string, args ...interface{}) {
+		errs = append(errs, &SchemaError{Pointer: pointer, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+
+	actual := jsonType(val)
+	if len(n.types) > 0 {
+		matched := false
+		for _, t := range n.types {
+			matched = matched || t == actual || (t == "number" && actual == "integer")
+		}
+		if !matched {
+			fail("type", "expected %s, got %s", strings.Join(n.types, " or "), actual)
+			return errs
+		}
+	}
+	if n.enum != nil {
+		found := false
+		for _, e := range n.enum {
+			found = found || reflect.DeepEqual(e, val)
+		}
+		if !found {
+			fail("enum", "value is not one of the allowed values")
+		}
+	}
+	if n.hasConst && !reflect.DeepEqual(n.constValue, val) {
+		fail("const", "value must be %v", n.constValue)
+	}
+
+	switch v := val.(type) {
+	case map[string]interface{}:
+		errs = append(errs, n.validateObject(v, pointer)...)
+	case []interface{}:
+		errs = append(errs, n.validateArray(v, pointer)...)
+	case float64:
+		if n.minimum != nil && v < *n.minimum {
+			fail("minimum", "must be >= %v", *n.minimum)
+		}
+		if n.maximum != nil && v > *n.maximum {
+			fail("maximum", "must be <= %v", *n.maximum)
+		}
+		if n.exclusiveMinimum != nil && v <= *n.exclusiveMinimum {
+			fail("exclusiveMinimum", "must be > %v", *n.exclusiveMinimum)
+		}
+		if n.exclusiveMaximum != nil && v >= *n.exclusiveMaximum {
+			fail("exclusiveMaximum", "must be < %v", *n.exclusiveMaximum)
+		}
+		if n.multipleOf != nil {
+			if q := v / *n.multipleOf; q != math.Trunc(q) {
+				fail("multipleOf", "must be a multiple of %v", *n.multipleOf)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n.minLength != nil && length < *n.minLength {
+			fail("minLength", "length %d is shorter than %d", length, *n.minLength)
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			fail("maxLength", "length %d is longer than %d", length, *n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(v) {
+			fail("pattern", "does not match %q", n.pattern.String())
+		}
+	}
+
+	for _, sub := range n.allOf {
+		errs = append(errs, sub.validate(val, pointer)...)
+	}
+	if n.anyOf != nil {
+		matched := false
+		for _, sub := range n.anyOf {
+			if len(sub.validate(val, pointer)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("anyOf", "value does not match any of the schemas")
+		}
+	}
+	if n.oneOf != nil {
+		matched := 0
+		for _, sub := range n.oneOf {
+			if len(sub.validate(val, pointer)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail("oneOf", "value matches %d of the schemas (must be exactly one)", matched)
+		}
+	}
+	if n.not != nil && len(n.not.validate(val, pointer)) == 0 {
+		fail("not", "value must not match the schema")
+	}
+	return errs
+}
+
+// validateObject validates the properties of the object
+func (n *schemaNode) validateObject(obj map[string]interface{}, pointer string) []*SchemaError {
+	var errs []*SchemaError
+	for _, name := range n.required {
+		if _, ok := obj[name]; !ok {
+			errs = append(errs, &SchemaError{Pointer: pointer, Keyword: "required", Message: fmt.Sprintf("property %q is missing", name)})
+		}
+	}
+	if n.minProperties != nil && len(obj) < *n.minProperties {
+		errs = append(errs, &SchemaError{Pointer: pointer, Keyword: "minProperties", Message: fmt.Sprintf("%d properties are fewer than %d", len(obj), *n.minProperties)})
+	}
+	if n.maxProperties != nil && len(obj) > *n.maxProperties {
+		errs = append(errs, &SchemaError{Pointer: pointer, Keyword: "maxProperties", Message: fmt.Sprintf("%d properties are more than %d", len(obj), *n.maxProperties)})
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p := pointer + "/" + escapePointer(k)
+		if sub, ok := n.properties[k]; ok {
+			errs = append(errs, sub.validate(obj[k], p)...)
+		} else if n.additionalProperties != nil {
+			if n.additionalProperties.always != nil && !*n.additionalProperties.always {
+				errs = append(errs, &SchemaError{Pointer: p, Keyword: "additionalProperties", Message: "property is not allowed"})
+			} else {
+				errs = append(errs, n.additionalProperties.validate(obj[k], p)...)
+			}
+		}
+	}
+	return errs
+}
+
+// validateArray validates the items of the array
+func (n *schemaNode) validateArray(list []interface{}, pointer string) []*SchemaError {
+	var errs []*SchemaError
+	if n.minItems != nil && len(list) < *n.minItems {
+		errs = append(errs, &SchemaError{Pointer: pointer, Keyword: "minItems", Message: fmt.Sprintf("%d items are fewer than %d", len(list), *n.minItems)})
+	}
+	if n.maxItems != nil && len(list) > *n.maxItems {
+		errs = append(errs, &SchemaError{Pointer: pointer, Keyword: "maxItems", Message: fmt.Sprintf("%d items are more than %d", len(list), *n.maxItems)})
+	}
+	if n.uniqueItems {
+		for i := range list {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(list[i], list[j]) {
+					errs = append(errs, &SchemaError{Pointer: fmt.Sprintf("%s/%d", pointer, i), Keyword: "uniqueItems", Message: fmt.Sprintf("duplicate of item %d", j)})
+					break
+				}
+			}
+		}
+	}
+	if n.items != nil {
+		for i, item := range list {
+			errs = append(errs, n.items.validate(item, fmt.Sprintf("%s/%d", pointer, i))...)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,173 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"strings"
+	"testing"
+)
+
+const testOrderSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["order_id", "items"],
+  "additionalProperties": false,
+  "properties": {
+    "order_id": {"type": "string", "pattern": "^ORD-[0-9]+$"},
+    "status": {"enum": ["open", "closed"]},
+    "items": {"type": "array", "minItems": 1, "uniqueItems": true, "items": {"$ref": "#/definitions/item"}},
+    "note": {"type": ["string", "null"], "maxLength": 5}
+  },
+  "definitions": {
+    "item": {
+      "type": "object",
+      "required": ["sku", "amount"],
+      "properties": {
+        "sku": {"type": "string", "minLength": 1},
+        "amount": {"type": "integer", "minimum": 1, "maximum": 100}
+      }
+    }
+  }
+}`
+
+func TestJSONSchema(t *testing.T) {
+	schema := MustCompileJSONSchema([]byte(testOrderSchema))
+
+	t.Run("valid documents", func(t *testing.T) {
+		for _, doc := range []string{
+			`{"order_id": "ORD-1", "items": [{"sku": "a", "amount": 1}]}`,
+			`{"order_id": "ORD-2", "status": "open", "note": null, "items": [{"sku": "a", "amount": 100}, {"sku": "b", "amount": 2.0}]}`,
+		} {
+			if errs := schema.ValidateJSON([]byte(doc)); len(errs) > 0 {
+				t.Fatalf("%s: %v", doc, errs)
+			}
+		}
+	})
+
+	t.Run("error paths", func(t *testing.T) {
+		doc := `{"order_id": "X-1", "status": "unknown", "extra": 1, "note": "too long",
+		         "items": [{"sku": "a", "amount": 1}, {"sku": "", "amount": 1.5}, {"sku": "a", "amount": 1}]}`
+		errs := schema.ValidateJSON([]byte(doc))
+		expected := []string{
+			"/extra: additionalProperties: property is not allowed",
+			"/items/2: uniqueItems: duplicate of item 0",
+			"/items/1/amount: type: expected integer, got number",
+			"/items/1/sku: minLength: length 0 is shorter than 1",
+			"/note: maxLength: length 8 is longer than 5",
+			"/order_id: pattern: does not match \"^ORD-[0-9]+$\"",
+			"/status: enum: value is not one of the allowed values",
+		}
+		if len(errs) != len(expected) {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		for i, e := range expected {
+			if errs[i].Error() != e {
+				t.Fatalf("error %d: %q (expected %q)", i, errs[i].Error(), e)
+			}
+		}
+	})
+
+	t.Run("required and type", func(t *testing.T) {
+		errs := schema.ValidateJSON([]byte(`{"items": "none"}`))
+		if len(errs) != 2 || errs[0].Error() != `/: required: property "order_id" is missing` || errs[1].Pointer != "/items" {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		if errs := schema.ValidateJSON([]byte(`[1, 2]`)); len(errs) != 1 || errs[0].Keyword != "type" {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		if errs := schema.ValidateJSON([]byte(`{"order_id": `)); len(errs) != 1 || errs[0].Keyword != "json" {
+			t.Fatalf("broken JSON must be reported: %v", errs)
+		}
+	})
+
+	t.Run("combinators", func(t *testing.T) {
+		s := MustCompileJSONSchema([]byte(`{
+		  "allOf": [{"type": "number"}],
+		  "anyOf": [{"multipleOf": 5}, {"maximum": 0}],
+		  "oneOf": [{"minimum": 10}, {"exclusiveMaximum": 20}],
+		  "not": {"const": 15}
+		}`))
+		cases := map[string]string{
+			`5`:    "",
+			`-1`:   "",
+			`7`:    "anyOf",
+			`15`:   "oneOf",
+			`25`:   "",
+			`"a"`:  "type",
+			`12.5`: "anyOf",
+		}
+		for doc, keyword := range cases {
+			errs := s.ValidateJSON([]byte(doc))
+			if keyword == "" && len(errs) > 0 || keyword != "" && (len(errs) == 0 || errs[0].Keyword != keyword) {
+				t.Fatalf("%s: unexpected errors %v (expected %q)", doc, errs, keyword)
+			}
+		}
+	})
+
+	t.Run("recursive reference", func(t *testing.T) {
+		s := MustCompileJSONSchema([]byte(`{
+		  "$ref": "#/definitions/node",
+		  "definitions": {"node": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/definitions/node"}}, "name": {"type": "string"}}}}
+		}`))
+		errs := s.ValidateJSON([]byte(`{"children": [{"children": [{"name": 1}]}]}`))
+		if len(errs) != 1 || errs[0].Pointer != "/children/0/children/0/name" {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+	})
+
+	t.Run("decoded values", func(t *testing.T) {
+		val := map[interface{}]interface{}{
+			"order_id": []byte("ORD-3"),
+			"items":    []interface{}{map[interface{}]interface{}{"sku": "a", "amount": uint64(3)}},
+		}
+		if errs := schema.Validate(val); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		// binary data is validated as the base64 string at its pointer
+		errs := schema.Validate(map[string]interface{}{"order_id": []byte{0xff}, "items": []interface{}{map[string]interface{}{"sku": "a", "amount": 1}}})
+		if len(errs) != 1 || errs[0].Pointer != "/order_id" || errs[0].Keyword != "pattern" {
+			t.Fatalf("binary data must be validated as base64 string: %v", errs)
+		}
+		binary := MustCompileJSONSchema([]byte(`{"properties": {"id": {"type": "string", "contentEncoding": "base64", "minLength": 44, "maxLength": 44}}}`))
+		if errs := binary.Validate(map[interface{}]interface{}{"id": append([]byte{0xff}, make([]byte, 31)...)}); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		errs = schema.Validate(map[string]interface{}{"order_id": "ORD-4", "items": []interface{}{map[interface{}]interface{}{1: "a"}}})
+		if len(errs) != 1 || errs[0].Pointer != "/items/0" || !strings.Contains(errs[0].Message, "not a string") {
+			t.Fatalf("value which cannot be expressed in JSON must be reported at its pointer: %v", errs)
+		}
+	})
+
+	t.Run("invalid schemas", func(t *testing.T) {
+		for _, s := range []string{
+			`{"type": "decimal"}`,
+			`{"patternProperties": {}}`,
+			`{"items": [{"type": "string"}]}`,
+			`{"$ref": "#/definitions/none"}`,
+			`{"$ref": "http://example.com/schema.json"}`,
+			`{"minLength": -1}`,
+			`{"pattern": "("}`,
+			`{"anyOf": []}`,
+			`[]`,
+			`{} {}`,
+		} {
+			if _, err := CompileJSONSchema([]byte(s)); err == nil {
+				t.Fatalf("%s must be rejected", s)
+			}
+		}
+	})
+}
@@ -21,11 +21,9 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
-	"fmt"
 	"math/big"
 	"github.com/lestrrat-go/jwx/jwk"
 )
@@ -130,12 +128,12 @@ func (k *KeyPair) GetKeyId() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	a, _ := jsonKey.(*jwk.ECDSAPublicKey).MarshalJSON()
-	h := sha256.Sum256(a)
-	fmt.Printf("hex=%x\n", a)
-	fmt.Printf("--> %x\n", h)
 	thumbprint, err := jsonKey.Thumbprint(crypto.SHA256)
-	return thumbprint, err
+	if err != nil {
+		return nil, err
+	}
+	logf(LogLevelDebug, "key id calculated", LogField{"key_id", thumbprint})
+	return thumbprint, nil
 }
 
 // GetPublicKeyUncompressed gets a public key (uncompressed) from private key
@@ -303,7 +301,7 @@ func VerifyBBcSignature(digest []byte, sig *BBcSignature) bool {
 	if sig.Pubkey == nil || sig.PubkeyLen == 0 {
 		return true
 	}
-	if sig.KeyType != KeyTypeEcdsaP256v1 {
+	if sig.CheckFormat() != nil {
 		return false
 	}
 
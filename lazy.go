@@ -0,0 +1,297 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// TransactionSection is the position of a packed object (e.g., BBcEvent) in the packed transaction data
+type TransactionSection struct {
+	Offset int // offset of the packed object (after its length header)
+	Size   int // size of the packed object
+}
+
+/*
+LazyTransaction definition
+
+LazyTransaction gives the header fields of a serialized transaction and the positions of the packed objects in it without unpacking them.
+Each object is unpacked on demand by Event, Reference, Relation, Witness, CrossRef and Signature, and the whole transaction by Transaction.
+This is useful for routing or indexing transactions, since the asset bodies do not need to be decoded.
+
+"TransactionID" and "TransactionBaseDigest" are calculated from the packed data as is (see BBcTransaction for the calculation).
+For the data packed by this library, they are the same as those of the unpacked transaction.
+
+The packed data given to PeekPackedTransaction is referred to by the LazyTransaction without copying, so it must not be modified.
+*/
+type LazyTransaction struct {
+	FormatType            uint16
+	Version               uint32
+	Timestamp             int64
+	TransactionIdLength   int
+	TransactionID         []byte
+	TransactionBaseDigest []byte
+	EventSections         []TransactionSection
+	ReferenceSections     []TransactionSection
+	RelationSections      []TransactionSection
+	WitnessSection        *TransactionSection
+	CrossRefSection       *TransactionSection
+	SignatureSections     []TransactionSection
+	data                  []byte
+}
+
+// PeekTransaction reads the header and the section positions of serialized transaction data (with the header of Serialize)
+// Zlib compressed data is decompressed, but the objects in the transaction are not unpacked. The offsets are those in the packed data.
+func PeekTransaction(dat []byte) (*LazyTransaction, error) {
+	formatType, err := newDecoder(dat).get2byte("format_type")
+	if err != nil {
+		return nil, err
+	}
+
+	var packed []byte
+	if formatType == FormatPlain {
+		packed = dat[2:]
+	} else if formatType == FormatZlib {
+		packed, err = ZlibDecompress(dat[2:])
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.New("formatType not supported")
+	}
+
+	obj, err := PeekPackedTransaction(packed)
+	if err != nil {
+		return nil, err
+	}
+	obj.FormatType = formatType
+	return obj, nil
+}
+
+// PeekPackedTransaction reads the header and the section positions of packed transaction data (the result of Pack)
+func PeekPackedTransaction(packed []byte) (*LazyTransaction, error) {
+	p := &LazyTransaction{data: packed}
+	d := newDecoder(packed)
+
+	var err error
+	if p.Version, err = d.get4byte("version"); err != nil {
+		return nil, err
+	}
+	if p.Timestamp, err = d.get8byte("timestamp"); err != nil {
+		return nil, err
+	}
+	idLen := uint16(legacyIDLength)
+	if hasIdLengthHeader(p.Version) {
+		if idLen, err = d.get2byte("transaction_id_length"); err != nil {
+			return nil, err
+		}
+	}
+	p.TransactionIdLength = int(idLen)
+	if p.TransactionIdLength == 0 || p.TransactionIdLength > sha256.Size {
+		return nil, &DecodeError{Path: "transaction_id_length", Offset: d.offset() - 2, Err: fmt.Errorf("invalid length %d", idLen)}
+	}
+
+	if p.EventSections, err = scanSections(d, "events"); err != nil {
+		return nil, err
+	}
+	if p.ReferenceSections, err = scanSections(d, "references"); err != nil {
+		return nil, err
+	}
+	if p.RelationSections, err = scanSections(d, "relations"); err != nil {
+		return nil, err
+	}
+	if p.WitnessSection, err = scanOptionalSection(d, "witness"); err != nil {
+		return nil, err
+	}
+	baseDigest := sha256.Sum256(packed[:d.offset()])
+	p.TransactionBaseDigest = baseDigest[:]
+
+	crossRefStart := d.offset()
+	if p.CrossRefSection, err = scanOptionalSection(d, "cross_ref"); err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(baseDigest[:])
+	h.Write(packed[crossRefStart:d.offset()])
+	p.TransactionID = h.Sum(nil)[:p.TransactionIdLength]
+
+	if p.SignatureSections, err = scanSections(d, "signatures"); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// scanSections reads the positions of the list of packed objects with 4-byte length headers
+func scanSections(d *decoder, path string) ([]TransactionSection, error) {
+	num, err := d.get2byte(path)
+	if err != nil {
+		return nil, err
+	}
+	sections := make([]TransactionSection, num)
+	for i := range sections {
+		size, err := d.get4byte("")
+		if err == nil {
+			sections[i] = TransactionSection{Offset: d.offset(), Size: int(size)}
+			err = d.skip("", int(size))
+		}
+		if err != nil {
+			return nil, wrapDecodeError(err, fmt.Sprintf("%s[%d]", path, i), 0)
+		}
+	}
+	return sections, nil
+}
+
+// scanOptionalSection reads the position of the optional packed object (witness or cross_ref)
+func scanOptionalSection(d *decoder, path string) (*TransactionSection, error) {
+	num, err := d.get2byte(path)
+	if err != nil || num == 0 {
+		return nil, err
+	}
+	size, err := d.get4byte(path)
+	if err != nil {
+		return nil, err
+	}
+	section := TransactionSection{Offset: d.offset(), Size: int(size)}
+	if err := d.skip(path, int(size)); err != nil {
+		return nil, err
+	}
+	return &section, nil
+}
+
+// sectionData returns the packed data of the section
+func (p *LazyTransaction) sectionData(section TransactionSection) []byte {
+	return p.data[section.Offset : section.Offset+section.Size]
+}
+
+// unpackSection unpacks the packed object in the section, putting the error in the context of the transaction
+func (p *LazyTransaction) unpackSection(path string, section TransactionSection, unpack func(dat *[]byte) error) error {
+	dat := p.sectionData(section)
+	return wrapDecodeError(unpack(&dat), path, section.Offset)
+}
+
+// AssetGroupIDs returns the asset_group_ids in the BBcEvent, BBcReference and BBcRelation objects (without duplication)
+// Only the asset_group_id at the beginning of each object is read.
+func (p *LazyTransaction) AssetGroupIDs() ([][]byte, error) {
+	var ids [][]byte
+	lists := []struct {
+		path     string
+		sections []TransactionSection
+	}{
+		{"events", p.EventSections},
+		{"references", p.ReferenceSections},
+		{"relations", p.RelationSections},
+	}
+	for _, l := range lists {
+		for i, section := range l.sections {
+			id, _, err := newDecoder(p.sectionData(section)).getBigInt("asset_group_id")
+			if err != nil {
+				return nil, wrapDecodeError(err, fmt.Sprintf("%s[%d]", l.path, i), section.Offset)
+			}
+			if !containsID(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Event unpacks the BBcEvent object at the index
+func (p *LazyTransaction) Event(idx int) (*BBcEvent, error) {
+	if idx < 0 || idx >= len(p.EventSections) {
+		return nil, fmt.Errorf("no event (index=%d)", idx)
+	}
+	obj := BBcEvent{Version: p.Version}
+	if err := p.unpackSection(fmt.Sprintf("events[%d]", idx), p.EventSections[idx], obj.Unpack); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// Reference unpacks the BBcReference object at the index (the object is not linked to a transaction)
+func (p *LazyTransaction) Reference(idx int) (*BBcReference, error) {
+	if idx < 0 || idx >= len(p.ReferenceSections) {
+		return nil, fmt.Errorf("no reference (index=%d)", idx)
+	}
+	obj := BBcReference{Version: p.Version}
+	if err := p.unpackSection(fmt.Sprintf("references[%d]", idx), p.ReferenceSections[idx], obj.Unpack); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// Relation unpacks the BBcRelation object at the index
+func (p *LazyTransaction) Relation(idx int) (*BBcRelation, error) {
+	if idx < 0 || idx >= len(p.RelationSections) {
+		return nil, fmt.Errorf("no relation (index=%d)", idx)
+	}
+	obj := BBcRelation{Version: p.Version}
+	if err := p.unpackSection(fmt.Sprintf("relations[%d]", idx), p.RelationSections[idx], obj.Unpack); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// Witness unpacks the BBcWitness object (nil if the transaction has no witness, and the object is not linked to a transaction)
+func (p *LazyTransaction) Witness() (*BBcWitness, error) {
+	if p.WitnessSection == nil {
+		return nil, nil
+	}
+	obj := BBcWitness{Version: p.Version}
+	if err := p.unpackSection("witness", *p.WitnessSection, obj.Unpack); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// CrossRef unpacks the BBcCrossRef object (nil if the transaction has no cross_ref)
+// The transaction_id length of the object is taken from the header.
+func (p *LazyTransaction) CrossRef() (*BBcCrossRef, error) {
+	if p.CrossRefSection == nil {
+		return nil, nil
+	}
+	obj := BBcCrossRef{Version: p.Version}
+	obj.SetIdLengthConf(&BBcIdConfig{TransactionIdLength: p.TransactionIdLength})
+	if err := p.unpackSection("cross_ref", *p.CrossRefSection, obj.Unpack); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// Signature unpacks the BBcSignature object at the index
+func (p *LazyTransaction) Signature(idx int) (*BBcSignature, error) {
+	if idx < 0 || idx >= len(p.SignatureSections) {
+		return nil, fmt.Errorf("no signature (index=%d)", idx)
+	}
+	obj := BBcSignature{Version: p.Version}
+	if err := p.unpackSection(fmt.Sprintf("signatures[%d]", idx), p.SignatureSections[idx], obj.Unpack); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// Transaction unpacks the whole BBcTransaction object
+func (p *LazyTransaction) Transaction() (*BBcTransaction, error) {
+	dat := make([]byte, len(p.data))
+	copy(dat, p.data)
+	obj := BBcTransaction{}
+	if err := obj.Unpack(&dat); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
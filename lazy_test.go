@@ -0,0 +1,167 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestLazyTransaction(t *testing.T) {
+	refTxObj := makeBaseTx(idLengthConfig)
+	followTx := makeFollowTX(idLengthConfig, &refTxObj)
+	domainID := GetIdentifier("domain_id", DomainIDLength)
+	followTx.CreateCrossRef(&domainID, &refTxObj.TransactionID)
+	followTx.TransactionID = nil
+	followTx.Digest()
+
+	t.Run("peek header", func(t *testing.T) {
+		for _, format := range []uint16{FormatPlain, FormatZlib} {
+			dat, _ := Serialize(&followTx, format)
+			lazy, err := PeekTransaction(dat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lazy.FormatType != format || lazy.Version != followTx.Version || lazy.Timestamp != followTx.Timestamp {
+				t.Fatal("invalid header")
+			}
+			if !bytes.Equal(lazy.TransactionID, followTx.TransactionID) || !bytes.Equal(lazy.TransactionBaseDigest, followTx.TransactionBaseDigest) {
+				t.Fatal("invalid transaction_id")
+			}
+			if len(lazy.EventSections) != 0 || len(lazy.ReferenceSections) != 1 || len(lazy.RelationSections) != 1 ||
+				lazy.WitnessSection == nil || lazy.CrossRefSection == nil || len(lazy.SignatureSections) != len(followTx.Signatures) {
+				t.Fatal("invalid sections")
+			}
+			ids, err := lazy.AssetGroupIDs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != 1 || !bytes.Equal(ids[0], followTx.Relations[0].AssetGroupID) {
+				t.Fatalf("invalid asset_group_ids: %x", ids)
+			}
+		}
+	})
+
+	t.Run("decode on demand", func(t *testing.T) {
+		packed, _ := followTx.Pack()
+		lazy, err := PeekPackedTransaction(packed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rtn, err := lazy.Relation(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rtn.Equal(followTx.Relations[0]) {
+			t.Fatal("relation is not decoded correctly")
+		}
+		ref, err := lazy.Reference(0)
+		if err != nil || !bytes.Equal(ref.TransactionID, refTxObj.TransactionID) {
+			t.Fatalf("reference is not decoded correctly: %v", err)
+		}
+		for i := range followTx.Signatures {
+			sig, err := lazy.Signature(i)
+			if err != nil || !sig.Equal(followTx.Signatures[i]) {
+				t.Fatalf("signature[%d] is not decoded correctly: %v", i, err)
+			}
+		}
+		wit, err := lazy.Witness()
+		if err != nil || len(wit.UserIDs) != len(followTx.Witness.UserIDs) {
+			t.Fatalf("witness is not decoded correctly: %v", err)
+		}
+		crossref, err := lazy.CrossRef()
+		if err != nil || !bytes.Equal(crossref.DomainID, domainID) {
+			t.Fatalf("cross_ref is not decoded correctly: %v", err)
+		}
+		if dat, err := crossref.Pack(); err != nil || !bytes.Equal(dat, lazy.sectionData(*lazy.CrossRefSection)) {
+			t.Fatalf("cross_ref is not packed correctly: %v", err)
+		}
+		if _, err := lazy.Event(0); err == nil {
+			t.Fatal("error must be returned for non-existent event")
+		}
+
+		txobj, err := lazy.Transaction()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !txobj.Equal(&followTx) {
+			t.Fatal("transaction is not decoded correctly")
+		}
+
+		lazy, _ = PeekPackedTransaction(func() []byte { d, _ := refTxObj.Pack(); return d }())
+		evt, err := lazy.Event(0)
+		if err != nil || !evt.Equal(refTxObj.Events[0]) {
+			t.Fatalf("event is not decoded correctly: %v", err)
+		}
+	})
+
+	t.Run("broken data", func(t *testing.T) {
+		packed, _ := followTx.Pack()
+		for l := 0; l < len(packed); l++ {
+			if _, err := PeekPackedTransaction(packed[:l]); !errors.Is(err, ErrDecode) {
+				t.Fatalf("DecodeError must be returned (length=%d): %v", l, err)
+			}
+		}
+
+		lazy, _ := PeekPackedTransaction(packed)
+		broken := append([]byte{}, packed...)
+		section := lazy.RelationSections[0]
+		broken[section.Offset] = 0xff
+		broken[section.Offset+1] = 0xff
+		lazy, err := PeekPackedTransaction(broken)
+		if err != nil {
+			t.Fatal("section contents must not be checked in peek")
+		}
+		_, err = lazy.Relation(0)
+		var de *DecodeError
+		if !errors.As(err, &de) || de.Path != "relations[0].asset_group_id" || de.Offset != section.Offset+2 {
+			t.Fatalf("invalid error: %v", err)
+		}
+		if _, err := lazy.AssetGroupIDs(); !errors.As(err, &de) || de.Path != "relations[0].asset_group_id" {
+			t.Fatalf("invalid error: %v", err)
+		}
+	})
+}
+
+func BenchmarkPeekTransaction(b *testing.B) {
+	refTxObj := makeBaseTx(idLengthConfig)
+	followTx := makeFollowTX(idLengthConfig, &refTxObj)
+	dat, _ := Serialize(&followTx, FormatPlain)
+
+	b.Run("Deserialize", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := Deserialize(dat); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("PeekTransaction", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			lazy, err := PeekTransaction(dat)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := lazy.AssetGroupIDs(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,244 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bbclib"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// CheckpointVersion is the version of the checkpoint format
+const CheckpointVersion = 1
+
+/*
+Checkpoint definition
+
+A checkpoint fixes the TransactionIDs appended to the ledger since the previous checkpoint (Size IDs from FirstIndex) by their Merkle root.
+"PrevHash" is the Hash of the previous checkpoint (empty for the first checkpoint), so that the checkpoints form a hash chain,
+and "Signature" is made over the Hash by the domain key.
+
+The packed data of a checkpoint is in little endian as BBcTransaction:
+
+	version (4) | domain_id (2+n) | sequence (8) | timestamp (8) | first_index (8) | size (8) | prev_hash (2+n) | merkle_root (2+32)
+	| signature_len (4) | BBcSignature (signature_len bytes)
+
+Hash is the SHA-256 digest of the packed data before signature_len.
+*/
+type (
+	Checkpoint struct {
+		Version    uint32
+		DomainID   []byte
+		Sequence   uint64
+		Timestamp  int64
+		FirstIndex uint64
+		Size       uint64
+		PrevHash   []byte
+		MerkleRoot []byte
+		Signature  *bbclib.BBcSignature
+	}
+)
+
+// packBody returns the packed data of the checkpoint without the signature
+func (c *Checkpoint) packBody() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := bbclib.Put4byte(buf, c.Version); err != nil {
+		return nil, err
+	}
+	if err := bbclib.PutBigInt(buf, &c.DomainID, len(c.DomainID)); err != nil {
+		return nil, err
+	}
+	for _, v := range []int64{int64(c.Sequence), c.Timestamp, int64(c.FirstIndex), int64(c.Size)} {
+		if err := bbclib.Put8byte(buf, v); err != nil {
+			return nil, err
+		}
+	}
+	if err := bbclib.PutBigInt(buf, &c.PrevHash, len(c.PrevHash)); err != nil {
+		return nil, err
+	}
+	if err := bbclib.PutBigInt(buf, &c.MerkleRoot, len(c.MerkleRoot)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Hash returns the hash of the checkpoint, which is signed and chained from the next checkpoint
+func (c *Checkpoint) Hash() ([]byte, error) {
+	body, err := c.packBody()
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(body)
+	return digest[:], nil
+}
+
+// Pack returns the binary data of the checkpoint
+func (c *Checkpoint) Pack() ([]byte, error) {
+	body, err := c.packBody()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(body)
+	var sig []byte
+	if c.Signature != nil {
+		if sig, err = c.Signature.Pack(); err != nil {
+			return nil, err
+		}
+	}
+	if err := bbclib.Put4byte(buf, uint32(len(sig))); err != nil {
+		return nil, err
+	}
+	buf.Write(sig)
+	return buf.Bytes(), nil
+}
+
+// Unpack the binary data to the checkpoint
+func (c *Checkpoint) Unpack(dat []byte) error {
+	buf := bytes.NewBuffer(dat)
+	var err error
+	if c.Version, err = bbclib.Get4byte(buf); err != nil {
+		return fmt.Errorf("checkpoint: version: %w", err)
+	}
+	if c.Version != CheckpointVersion {
+		return fmt.Errorf("checkpoint: unsupported version %d", c.Version)
+	}
+	if c.DomainID, _, err = bbclib.GetBigInt(buf); err != nil {
+		return fmt.Errorf("checkpoint: domain_id: %w", err)
+	}
+	var vals [4]int64
+	for i, name := range []string{"sequence", "timestamp", "first_index", "size"} {
+		if vals[i], err = bbclib.Get8byte(buf); err != nil {
+			return fmt.Errorf("checkpoint: %s: %w", name, err)
+		}
+	}
+	c.Sequence, c.Timestamp, c.FirstIndex, c.Size = uint64(vals[0]), vals[1], uint64(vals[2]), uint64(vals[3])
+	if c.PrevHash, _, err = bbclib.GetBigInt(buf); err != nil {
+		return fmt.Errorf("checkpoint: prev_hash: %w", err)
+	}
+	if c.MerkleRoot, _, err = bbclib.GetBigInt(buf); err != nil {
+		return fmt.Errorf("checkpoint: merkle_root: %w", err)
+	}
+	sigLen, err := bbclib.Get4byte(buf)
+	if err != nil {
+		return fmt.Errorf("checkpoint: signature_len: %w", err)
+	}
+	if int(sigLen) > buf.Len() {
+		return fmt.Errorf("checkpoint: signature: %d bytes required but %d bytes left", sigLen, buf.Len())
+	}
+	c.Signature = nil
+	if sigLen > 0 {
+		sig, _, err := bbclib.GetBytes(buf, int(sigLen))
+		if err != nil {
+			return fmt.Errorf("checkpoint: signature: %w", err)
+		}
+		c.Signature = &bbclib.BBcSignature{}
+		if err := c.Signature.Unpack(&sig); err != nil {
+			return fmt.Errorf("checkpoint: signature: %w", err)
+		}
+		if err := c.Signature.CheckFormat(); err != nil {
+			return fmt.Errorf("checkpoint: signature: %w", err)
+		}
+	}
+	if buf.Len() > 0 {
+		return fmt.Errorf("checkpoint: %d bytes of trailing data", buf.Len())
+	}
+	return nil
+}
+
+// UnpackCheckpoint returns the checkpoint in the binary data
+func UnpackCheckpoint(dat []byte) (*Checkpoint, error) {
+	c := &Checkpoint{}
+	if err := c.Unpack(dat); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// sign signs the hash of the checkpoint with the key pair
+func (c *Checkpoint) sign(keypair *bbclib.KeyPair) error {
+	digest, err := c.Hash()
+	if err != nil {
+		return err
+	}
+	s := keypair.Sign(digest)
+	if s == nil {
+		return errors.New("fail to sign the checkpoint")
+	}
+	sig := &bbclib.BBcSignature{Version: 2}
+	sig.SetPublicKeyByKeypair(keypair)
+	sig.SetSignature(&s)
+	c.Signature = sig
+	return nil
+}
+
+// Verify verifies the signature of the checkpoint with the trusted public key of the domain
+// The public key in the signature is not trusted, so the public key must be given.
+func (c *Checkpoint) Verify(publicKey []byte) error {
+	if len(publicKey) == 0 {
+		return errors.New("public key must be given")
+	}
+	if c.Signature == nil || c.Signature.KeyType == bbclib.KeyTypeNotInitialized {
+		return fmt.Errorf("checkpoint %d: %w", c.Sequence, ErrNotSigned)
+	}
+	if err := c.Signature.CheckFormat(); err != nil {
+		return fmt.Errorf("checkpoint %d: %w: %v", c.Sequence, bbclib.ErrInvalidSignature, err)
+	}
+	digest, err := c.Hash()
+	if err != nil {
+		return err
+	}
+	if !c.Signature.Clone().VerifyWithPublicKey(digest, publicKey) {
+		return fmt.Errorf("checkpoint %d: %w", c.Sequence, bbclib.ErrInvalidSignature)
+	}
+	return nil
+}
+
+// VerifyChain verifies the signatures (with the trusted public key) and the hash chain of the consecutive checkpoints (from the first checkpoint of the ledger
+// if the first one has no PrevHash), and that the checkpoints cover the TransactionIDs without gaps
+func VerifyChain(checkpoints []*Checkpoint, publicKey []byte) error {
+	for i, c := range checkpoints {
+		if err := c.Verify(publicKey); err != nil {
+			return err
+		}
+		if i == 0 {
+			if c.Sequence == 0 && (len(c.PrevHash) != 0 || c.FirstIndex != 0) {
+				return fmt.Errorf("%w: checkpoint 0 must start the chain", ErrBrokenChain)
+			}
+			continue
+		}
+		prev := checkpoints[i-1]
+		prevHash, err := prev.Hash()
+		if err != nil {
+			return err
+		}
+		switch {
+		case !bytes.Equal(c.DomainID, prev.DomainID):
+			return fmt.Errorf("%w: checkpoint %d: domain_id differs", ErrBrokenChain, c.Sequence)
+		case c.Sequence != prev.Sequence+1:
+			return fmt.Errorf("%w: checkpoint %d follows checkpoint %d", ErrBrokenChain, c.Sequence, prev.Sequence)
+		case !bytes.Equal(c.PrevHash, prevHash):
+			return fmt.Errorf("%w: checkpoint %d: prev_hash mismatch", ErrBrokenChain, c.Sequence)
+		case c.FirstIndex != prev.FirstIndex+prev.Size:
+			return fmt.Errorf("%w: checkpoint %d: first_index %d (expected %d)", ErrBrokenChain, c.Sequence, c.FirstIndex, prev.FirstIndex+prev.Size)
+		case c.Timestamp < prev.Timestamp:
+			return fmt.Errorf("%w: checkpoint %d: timestamp goes back", ErrBrokenChain, c.Sequence)
+		}
+	}
+	return nil
+}
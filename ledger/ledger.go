@@ -0,0 +1,358 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package ledger provides a local ledger of TransactionIDs with hash-chained checkpoints, as the ledger subsystem of BBc-1.
+
+TransactionIDs are appended to the ledger in order. A checkpoint fixes the IDs appended since the previous checkpoint
+by the root of their Merkle tree (RFC 6962 hashing: leaves and interior nodes are hashed with different prefixes),
+chains to the previous checkpoint by its hash, and is signed with the KeyPair of the domain.
+
+For an auditor, Prove returns the inclusion proof of a transaction in its checkpoint, which is checked by VerifyProof,
+and VerifyChain checks that the checkpoints are signed, chained and cover all IDs without gaps.
+Checkpoints are created explicitly by Checkpoint, or automatically every N IDs (SetAutoCheckpoint).
+*/
+package ledger
+
+import (
+	"bbclib"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDuplicated is returned when the TransactionID is already in the ledger
+	ErrDuplicated = errors.New("transaction_id is already in the ledger")
+	// ErrNotFound is returned when the TransactionID is not in the ledger
+	ErrNotFound = errors.New("transaction_id is not in the ledger")
+	// ErrNotCheckpointed is returned when the TransactionID is not fixed by a checkpoint yet
+	ErrNotCheckpointed = errors.New("transaction_id is not in a checkpoint yet")
+	// ErrNoPending is returned by Checkpoint when no TransactionID is appended since the previous checkpoint
+	ErrNoPending = errors.New("no transaction_id since the previous checkpoint")
+	// ErrNotSigned is returned when a checkpoint has no signature
+	ErrNotSigned = errors.New("checkpoint is not signed")
+	// ErrBrokenChain is returned when the checkpoints are not chained correctly
+	ErrBrokenChain = errors.New("broken checkpoint chain")
+	// ErrInvalidProof is returned when an inclusion proof does not lead to the Merkle root of the checkpoint
+	ErrInvalidProof = errors.New("invalid inclusion proof")
+)
+
+type (
+	// Ledger is a local ledger of TransactionIDs (safe for concurrent use)
+	Ledger struct {
+		mutex          sync.RWMutex
+		domainID       []byte
+		keypair        *bbclib.KeyPair
+		transactionIDs [][]byte
+		index          map[string]uint64
+		checkpoints    []*Checkpoint
+		autoSize       int
+	}
+
+	// Proof is the inclusion proof of a TransactionID in a checkpoint
+	Proof struct {
+		TransactionID []byte
+		Sequence      uint64   // sequence of the checkpoint
+		LeafIndex     uint64   // index in the checkpoint
+		TreeSize      uint64   // number of TransactionIDs in the checkpoint
+		Path          [][]byte // audit path from the leaf to the Merkle root
+	}
+)
+
+// New returns an empty ledger of the domain, whose checkpoints are signed with the key pair
+func New(domainID []byte, keypair *bbclib.KeyPair) (*Ledger, error) {
+	if len(domainID) == 0 {
+		return nil, errors.New("domain_id must be given")
+	}
+	if keypair == nil || keypair.PrivateKeyStructure == nil {
+		return nil, errors.New("key pair with private key must be given")
+	}
+	return &Ledger{
+		domainID: append([]byte{}, domainID...),
+		keypair:  keypair,
+		index:    make(map[string]uint64),
+	}, nil
+}
+
+// SetAutoCheckpoint makes a checkpoint automatically when the number of pending TransactionIDs reaches size (0 disables it)
+func (l *Ledger) SetAutoCheckpoint(size int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.autoSize = size
+}
+
+// DomainID returns the domain_id of the ledger
+func (l *Ledger) DomainID() []byte {
+	return append([]byte{}, l.domainID...)
+}
+
+// Append appends the TransactionIDs to the ledger in order
+// It returns the checkpoint if one is made automatically (nil otherwise).
+func (l *Ledger) Append(transactionIDs ...[]byte) (*Checkpoint, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	seen := make(map[string]bool)
+	for i, id := range transactionIDs {
+		key := hex.EncodeToString(id)
+		if len(id) == 0 {
+			return nil, fmt.Errorf("transaction_ids[%d]: empty transaction_id", i)
+		}
+		if _, ok := l.index[key]; ok || seen[key] {
+			return nil, fmt.Errorf("transaction_ids[%d]: %w (%s)", i, ErrDuplicated, key)
+		}
+		seen[key] = true
+	}
+
+	var made *Checkpoint
+	for _, id := range transactionIDs {
+		l.index[hex.EncodeToString(id)] = uint64(len(l.transactionIDs))
+		l.transactionIDs = append(l.transactionIDs, append([]byte{}, id...))
+		if l.autoSize > 0 && l.pending() >= l.autoSize {
+			c, err := l.checkpoint(0)
+			if err != nil {
+				return made, err
+			}
+			made = c
+		}
+	}
+	return made, nil
+}
+
+// AppendTransaction appends the TransactionID of the transaction
+func (l *Ledger) AppendTransaction(txobj *bbclib.BBcTransaction) (*Checkpoint, error) {
+	if txobj == nil || len(txobj.TransactionID) == 0 {
+		return nil, errors.New("transaction with transaction_id must be given")
+	}
+	return l.Append(txobj.TransactionID)
+}
+
+// Len returns the number of TransactionIDs in the ledger
+func (l *Ledger) Len() int {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return len(l.transactionIDs)
+}
+
+// Pending returns the number of TransactionIDs not fixed by a checkpoint yet
+func (l *Ledger) Pending() int {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.pending()
+}
+
+// pending returns the number of TransactionIDs since the last checkpoint
+func (l *Ledger) pending() int {
+	return len(l.transactionIDs) - int(l.checkpointed())
+}
+
+// checkpointed returns the number of TransactionIDs fixed by the checkpoints
+func (l *Ledger) checkpointed() uint64 {
+	if len(l.checkpoints) == 0 {
+		return 0
+	}
+	last := l.checkpoints[len(l.checkpoints)-1]
+	return last.FirstIndex + last.Size
+}
+
+// Checkpoint makes a checkpoint of the pending TransactionIDs at the timestamp in microseconds (now if 0)
+func (l *Ledger) Checkpoint(timestamp int64) (*Checkpoint, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.checkpoint(timestamp)
+}
+
+// checkpoint makes and signs a checkpoint
+func (l *Ledger) checkpoint(timestamp int64) (*Checkpoint, error) {
+	if l.pending() == 0 {
+		return nil, ErrNoPending
+	}
+	if timestamp == 0 {
+		timestamp = time.Now().UnixNano() / int64(time.Microsecond)
+	}
+	first := l.checkpointed()
+	c := &Checkpoint{
+		Version:    CheckpointVersion,
+		DomainID:   l.domainID,
+		Sequence:   uint64(len(l.checkpoints)),
+		Timestamp:  timestamp,
+		FirstIndex: first,
+		Size:       uint64(len(l.transactionIDs)) - first,
+		MerkleRoot: MerkleRoot(l.transactionIDs[first:]),
+	}
+	if len(l.checkpoints) > 0 {
+		prev := l.checkpoints[len(l.checkpoints)-1]
+		if timestamp < prev.Timestamp {
+			return nil, fmt.Errorf("timestamp %d is older than that of the previous checkpoint", timestamp)
+		}
+		prevHash, err := prev.Hash()
+		if err != nil {
+			return nil, err
+		}
+		c.PrevHash = prevHash
+	}
+	if err := c.sign(l.keypair); err != nil {
+		return nil, err
+	}
+	l.checkpoints = append(l.checkpoints, c)
+	return c, nil
+}
+
+// Checkpoints returns all checkpoints
+func (l *Ledger) Checkpoints() []*Checkpoint {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return append([]*Checkpoint{}, l.checkpoints...)
+}
+
+// GetCheckpoint returns the checkpoint of the sequence
+func (l *Ledger) GetCheckpoint(sequence uint64) (*Checkpoint, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if sequence >= uint64(len(l.checkpoints)) {
+		return nil, fmt.Errorf("no checkpoint %d", sequence)
+	}
+	return l.checkpoints[sequence], nil
+}
+
+// Latest returns the latest checkpoint (nil if no checkpoint)
+func (l *Ledger) Latest() *Checkpoint {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if len(l.checkpoints) == 0 {
+		return nil
+	}
+	return l.checkpoints[len(l.checkpoints)-1]
+}
+
+// Prove returns the inclusion proof of the TransactionID and the checkpoint including it
+func (l *Ledger) Prove(transactionID []byte) (*Proof, *Checkpoint, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	idx, ok := l.index[hex.EncodeToString(transactionID)]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	if idx >= l.checkpointed() {
+		return nil, nil, ErrNotCheckpointed
+	}
+	c := l.findCheckpoint(idx)
+	ids := l.transactionIDs[c.FirstIndex : c.FirstIndex+c.Size]
+	leaves := make([][]byte, len(ids))
+	for i, id := range ids {
+		leaves[i] = LeafHash(id)
+	}
+	leafIndex := idx - c.FirstIndex
+	return &Proof{
+		TransactionID: append([]byte{}, transactionID...),
+		Sequence:      c.Sequence,
+		LeafIndex:     leafIndex,
+		TreeSize:      c.Size,
+		Path:          auditPath(int(leafIndex), leaves),
+	}, c, nil
+}
+
+// findCheckpoint returns the checkpoint including the index (binary search)
+func (l *Ledger) findCheckpoint(idx uint64) *Checkpoint {
+	lo, hi := 0, len(l.checkpoints)-1
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if idx < l.checkpoints[mid].FirstIndex+l.checkpoints[mid].Size {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return l.checkpoints[lo]
+}
+
+// VerifyProof verifies the signature of the checkpoint with the trusted public key of the domain,
+// and that the inclusion proof leads the TransactionID to the Merkle root of the checkpoint
+func VerifyProof(proof *Proof, checkpoint *Checkpoint, publicKey []byte) error {
+	if proof == nil || checkpoint == nil {
+		return errors.New("proof and checkpoint must be given")
+	}
+	if err := checkpoint.Verify(publicKey); err != nil {
+		return err
+	}
+	if proof.Sequence != checkpoint.Sequence || proof.TreeSize != checkpoint.Size {
+		return fmt.Errorf("%w: proof is for checkpoint %d (size %d), not %d (size %d)",
+			ErrInvalidProof, proof.Sequence, proof.TreeSize, checkpoint.Sequence, checkpoint.Size)
+	}
+	if !verifyPath(checkpoint.MerkleRoot, LeafHash(proof.TransactionID), proof.LeafIndex, proof.TreeSize, proof.Path) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// Pack returns the binary data of the proof
+//
+//	transaction_id (2+n) | sequence (8) | leaf_index (8) | tree_size (8) | path_num (2) | path_num * hash (2+32)
+func (p *Proof) Pack() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := bbclib.PutBigInt(buf, &p.TransactionID, len(p.TransactionID)); err != nil {
+		return nil, err
+	}
+	for _, v := range []uint64{p.Sequence, p.LeafIndex, p.TreeSize} {
+		if err := bbclib.Put8byte(buf, int64(v)); err != nil {
+			return nil, err
+		}
+	}
+	if err := bbclib.Put2byte(buf, uint16(len(p.Path))); err != nil {
+		return nil, err
+	}
+	for i := range p.Path {
+		if err := bbclib.PutBigInt(buf, &p.Path[i], len(p.Path[i])); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnpackProof returns the proof in the binary data
+func UnpackProof(dat []byte) (*Proof, error) {
+	buf := bytes.NewBuffer(dat)
+	p := &Proof{}
+	var err error
+	if p.TransactionID, _, err = bbclib.GetBigInt(buf); err != nil {
+		return nil, fmt.Errorf("proof: transaction_id: %w", err)
+	}
+	for _, v := range []*uint64{&p.Sequence, &p.LeafIndex, &p.TreeSize} {
+		n, err := bbclib.Get8byte(buf)
+		if err != nil {
+			return nil, fmt.Errorf("proof: %w", err)
+		}
+		*v = uint64(n)
+	}
+	num, err := bbclib.Get2byte(buf)
+	if err != nil {
+		return nil, fmt.Errorf("proof: path_num: %w", err)
+	}
+	for i := 0; i < int(num); i++ {
+		h, _, err := bbclib.GetBigInt(buf)
+		if err != nil {
+			return nil, fmt.Errorf("proof: path[%d]: %w", i, err)
+		}
+		p.Path = append(p.Path, h)
+	}
+	if buf.Len() > 0 {
+		return nil, fmt.Errorf("proof: %d bytes of trailing data", buf.Len())
+	}
+	return p, nil
+}
@@ -0,0 +1,233 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bbclib"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func makeIDs(prefix string, n int) [][]byte {
+	ids := make([][]byte, n)
+	for i := range ids {
+		ids[i] = bbclib.GetIdentifier(fmt.Sprintf("%s%d", prefix, i), 32)
+	}
+	return ids
+}
+
+func TestLedger(t *testing.T) {
+	domainID := bbclib.GetIdentifier("ledger_test_domain", 32)
+	keypair, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	otherKey, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	ids := makeIDs("tx", 10)
+
+	t.Run("checkpoints and proofs", func(t *testing.T) {
+		l, err := New(domainID, keypair)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.Checkpoint(1000); !errors.Is(err, ErrNoPending) {
+			t.Fatalf("empty checkpoint must fail: %v", err)
+		}
+		_, _ = l.Append(ids[:3]...)
+		if _, _, err := l.Prove(ids[0]); !errors.Is(err, ErrNotCheckpointed) {
+			t.Fatalf("pending transaction must not be proved: %v", err)
+		}
+		cp0, err := l.Checkpoint(1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = l.Append(ids[3:]...)
+		cp1, err := l.Checkpoint(2000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cp0.Size != 3 || cp1.FirstIndex != 3 || cp1.Size != 7 || l.Pending() != 0 || l.Len() != 10 {
+			t.Fatalf("unexpected checkpoints: %+v %+v", cp0, cp1)
+		}
+		if err := VerifyChain(l.Checkpoints(), keypair.Pubkey); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, id := range ids {
+			proof, cp, err := l.Prove(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := map[bool]uint64{true: 0, false: 1}[i < 3]; cp.Sequence != expected {
+				t.Fatalf("ids[%d] must be in checkpoint %d", i, expected)
+			}
+			dat, _ := proof.Pack()
+			recovered, err := UnpackProof(dat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyProof(recovered, cp, keypair.Pubkey); err != nil {
+				t.Fatalf("ids[%d]: %v", i, err)
+			}
+		}
+
+		proof, _, _ := l.Prove(ids[5])
+		if err := VerifyProof(proof, cp0, keypair.Pubkey); !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("proof for another checkpoint must fail: %v", err)
+		}
+		proof.TransactionID = ids[6]
+		if err := VerifyProof(proof, cp1, keypair.Pubkey); !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("proof for another transaction must fail: %v", err)
+		}
+		if err := VerifyProof(proof, cp1, otherKey.Pubkey); !errors.Is(err, bbclib.ErrInvalidSignature) {
+			t.Fatalf("checkpoint must be verified with the domain key: %v", err)
+		}
+		if _, _, err := l.Prove(bbclib.GetIdentifier("unknown", 32)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("unknown transaction must not be proved: %v", err)
+		}
+	})
+
+	t.Run("duplicates", func(t *testing.T) {
+		l, _ := New(domainID, keypair)
+		_, _ = l.Append(ids[0])
+		if _, err := l.Append(ids[1], ids[0]); !errors.Is(err, ErrDuplicated) || l.Len() != 1 {
+			t.Fatalf("duplicated transaction_id must be rejected atomically: %v", err)
+		}
+		if _, err := l.Append(ids[1], ids[1]); !errors.Is(err, ErrDuplicated) {
+			t.Fatalf("duplicated transaction_id must be rejected: %v", err)
+		}
+	})
+
+	t.Run("auto checkpoint", func(t *testing.T) {
+		l, _ := New(domainID, keypair)
+		l.SetAutoCheckpoint(4)
+		var made []*Checkpoint
+		for _, id := range ids {
+			cp, err := l.Append(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cp != nil {
+				made = append(made, cp)
+			}
+		}
+		if len(made) != 2 || l.Pending() != 2 || l.Latest() != made[1] {
+			t.Fatalf("checkpoints must be made every 4 transactions (%d made, %d pending)", len(made), l.Pending())
+		}
+		if err := VerifyChain(l.Checkpoints(), keypair.Pubkey); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("tampered chain", func(t *testing.T) {
+		l, _ := New(domainID, keypair)
+		for i := 0; i < 3; i++ {
+			_, _ = l.Append(ids[i])
+			_, _ = l.Checkpoint(int64(1000 * (i + 1)))
+		}
+		var cps []*Checkpoint
+		for _, cp := range l.Checkpoints() {
+			dat, err := cp.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			recovered, err := UnpackCheckpoint(dat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cps = append(cps, recovered)
+		}
+		if err := VerifyChain(cps, keypair.Pubkey); err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyChain([]*Checkpoint{cps[0], cps[2]}, keypair.Pubkey); !errors.Is(err, ErrBrokenChain) {
+			t.Fatalf("missing checkpoint must be detected: %v", err)
+		}
+		cps[1].MerkleRoot = MerkleRoot(ids[5:6])
+		if err := VerifyChain(cps, keypair.Pubkey); !errors.Is(err, bbclib.ErrInvalidSignature) {
+			t.Fatalf("modified checkpoint must be detected: %v", err)
+		}
+
+		forged, _ := New(domainID, keypair)
+		_, _ = forged.Append(ids[0])
+		_, _ = forged.Checkpoint(1000)
+		_, _ = forged.Append(ids[5])
+		_, _ = forged.Checkpoint(2000)
+		if err := VerifyChain([]*Checkpoint{l.Checkpoints()[0], forged.Checkpoints()[1], l.Checkpoints()[2]}, keypair.Pubkey); !errors.Is(err, ErrBrokenChain) {
+			t.Fatalf("replaced checkpoint must be detected: %v", err)
+		}
+		if _, err := UnpackCheckpoint([]byte{1, 0, 0, 0, 32}); err == nil {
+			t.Fatal("broken checkpoint must not be unpacked")
+		}
+	})
+
+	t.Run("untrusted signatures", func(t *testing.T) {
+		forged, _ := New(domainID, otherKey)
+		_, _ = forged.Append(ids[0])
+		cp, _ := forged.Checkpoint(1000)
+		if err := cp.Verify(nil); err == nil {
+			t.Fatal("public key must be required")
+		}
+		if err := VerifyChain(forged.Checkpoints(), nil); err == nil {
+			t.Fatal("public key must be required")
+		}
+		if err := cp.Verify(keypair.Pubkey); !errors.Is(err, bbclib.ErrInvalidSignature) {
+			t.Fatalf("checkpoint signed by another key must be rejected: %v", err)
+		}
+	})
+
+	t.Run("malformed signatures", func(t *testing.T) {
+		l, _ := New(domainID, keypair)
+		_, _ = l.Append(ids[0])
+		cp, _ := l.Checkpoint(1000)
+		for name, modify := range map[string]func(sig *bbclib.BBcSignature){
+			"short signature": func(sig *bbclib.BBcSignature) {
+				sig.Signature = []byte{1, 2, 3}
+				sig.SignatureLen = 24
+			},
+			"unknown key type": func(sig *bbclib.BBcSignature) { sig.KeyType = 5 },
+		} {
+			malformed := *cp
+			malformed.Signature = cp.Signature.Clone()
+			modify(malformed.Signature)
+			if err := malformed.Verify(keypair.Pubkey); !errors.Is(err, bbclib.ErrInvalidSignature) {
+				t.Fatalf("%s: checkpoint must be rejected: %v", name, err)
+			}
+			dat, err := malformed.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := UnpackCheckpoint(dat); err == nil {
+				t.Fatalf("%s: checkpoint must not be unpacked", name)
+			}
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		if _, err := New(nil, keypair); err == nil {
+			t.Fatal("domain_id must be required")
+		}
+		if _, err := New(domainID, &bbclib.KeyPair{}); err == nil {
+			t.Fatal("private key must be required")
+		}
+		l, _ := New(domainID, keypair)
+		_, _ = l.Append(ids[0])
+		_, _ = l.Checkpoint(2000)
+		_, _ = l.Append(ids[1])
+		if _, err := l.Checkpoint(1000); err == nil {
+			t.Fatal("timestamp must not go back")
+		}
+	})
+}
@@ -0,0 +1,123 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+// Prefixes of the hashes in the Merkle tree (RFC 6962), so that a leaf cannot be taken for an interior node
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// LeafHash returns the hash of the leaf for the TransactionID
+func LeafHash(transactionID []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(transactionID)
+	return h.Sum(nil)
+}
+
+// nodeHash returns the hash of the interior node
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// MerkleRoot returns the Merkle tree hash of the TransactionIDs (SHA-256 of the empty string if no ID is given)
+func MerkleRoot(transactionIDs [][]byte) []byte {
+	leaves := make([][]byte, len(transactionIDs))
+	for i, id := range transactionIDs {
+		leaves[i] = LeafHash(id)
+	}
+	return treeHash(leaves)
+}
+
+// treeHash returns the Merkle tree hash of the leaf hashes
+func treeHash(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		h := sha256.Sum256(nil)
+		return h[:]
+	case 1:
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return nodeHash(treeHash(leaves[:k]), treeHash(leaves[k:]))
+}
+
+// auditPath returns the hashes needed to calculate the tree hash from the leaf at the index
+func auditPath(index int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := splitPoint(len(leaves))
+	if index < k {
+		return append(auditPath(index, leaves[:k]), treeHash(leaves[k:]))
+	}
+	return append(auditPath(index-k, leaves[k:]), treeHash(leaves[:k]))
+}
+
+// splitPoint returns the largest power of 2 smaller than n (n > 1)
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// rootFromPath calculates the tree hash from the leaf hash and the audit path (nil if the path does not fit the tree size)
+func rootFromPath(leaf []byte, index, size uint64, path [][]byte) []byte {
+	if index >= size {
+		return nil
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range path {
+		if sn == 0 {
+			return nil
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return nil
+	}
+	return r
+}
+
+// verifyPath returns true if the audit path leads the leaf to the root
+func verifyPath(root, leaf []byte, index, size uint64, path [][]byte) bool {
+	r := rootFromPath(leaf, index, size, path)
+	return r != nil && bytes.Equal(r, root)
+}
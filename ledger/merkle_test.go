@@ -0,0 +1,67 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func TestMerkleTree(t *testing.T) {
+	t.Run("RFC 6962 test vectors", func(t *testing.T) {
+		var leaves [][]byte
+		for _, h := range []string{"", "00", "10", "2021", "3031", "40414243", "5051525354555657", "606162636465666768696a6b6c6d6e6f"} {
+			l, _ := hex.DecodeString(h)
+			leaves = append(leaves, l)
+		}
+		expected := map[int]string{
+			0: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			1: "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+			8: "5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+		}
+		for n, root := range expected {
+			if got := hex.EncodeToString(MerkleRoot(leaves[:n])); got != root {
+				t.Fatalf("root of %d leaves: %s (expected %s)", n, got, root)
+			}
+		}
+	})
+
+	t.Run("audit paths", func(t *testing.T) {
+		for n := 1; n <= 33; n++ {
+			var ids, leaves [][]byte
+			for i := 0; i < n; i++ {
+				id := []byte(fmt.Sprintf("tx%d", i))
+				ids = append(ids, id)
+				leaves = append(leaves, LeafHash(id))
+			}
+			root := MerkleRoot(ids)
+			for i := 0; i < n; i++ {
+				path := auditPath(i, leaves)
+				if !verifyPath(root, leaves[i], uint64(i), uint64(n), path) {
+					t.Fatalf("path of leaf %d in %d leaves must be valid", i, n)
+				}
+				if n > 1 && verifyPath(root, leaves[(i+1)%n], uint64(i), uint64(n), path) {
+					t.Fatalf("path of leaf %d in %d leaves must not prove another leaf", i, n)
+				}
+				if verifyPath(root, leaves[i], uint64(n), uint64(n), path) || verifyPath(root, leaves[i], uint64(i), 0, path) {
+					t.Fatalf("path of leaf %d in %d leaves must not fit another position", i, n)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,230 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+/*
+Transaction format versions
+
+The version in the header of BBcTransaction determines the wire format:
+  * version 0: the header has no transaction_id_length, and all IDs are 32 bytes. BBcRelation has no asset_raw and asset_hash.
+  * version 1: transaction_id_length is in the header (ID length configuration). BBcRelation has no asset_raw and asset_hash.
+  * version 2 (current): BBcRelation has asset_raw and asset_hash (BBcAssetRaw and BBcAssetHash).
+
+Transactions of all versions can be packed, unpacked and verified. The digest calculation is the same in all versions,
+but the packed data differs, so TransactionID changes if a legacy transaction is re-expressed in the current version (see UpgradeTransaction).
+*/
+
+// CurrentTransactionVersion is the version of the transaction format for new transactions
+const CurrentTransactionVersion = 2
+
+// legacyIDLength is the fixed length of IDs in version 0 transactions
+const legacyIDLength = 32
+
+// hasIdLengthHeader returns true if the transaction header of the version includes transaction_id_length
+func hasIdLengthHeader(version uint32) bool {
+	return version != 0
+}
+
+// checkVersion checks whether the transaction can be packed in the wire format of its version
+func (p *BBcTransaction) checkVersion() error {
+	if p.Version == 0 && p.TransactionIdLength != legacyIDLength {
+		return fmt.Errorf("version=0 transaction must have %d-byte transaction_id (%d)", legacyIDLength, p.TransactionIdLength)
+	}
+	if p.Version < 2 {
+		for i, obj := range p.Relations {
+			if obj != nil && (obj.AssetRaw != nil || obj.AssetHash != nil) {
+				return fmt.Errorf("relations[%d]: asset_raw and asset_hash are not supported in version=%d transaction", i, p.Version)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+UpgradeReport definition
+
+UpgradeReport describes what UpgradeTransaction changed in re-expressing a legacy transaction in the current version.
+Since the packed data changes, the transaction has a new TransactionID, and all signatures must be made again (ResignRequired).
+Transactions pointing to OldTransactionID (BBcPointer, BBcReference, BBcCrossRef) are not updated.
+*/
+type (
+	UpgradeReport struct {
+		FromVersion      uint32
+		ToVersion        uint32
+		OldTransactionID []byte
+		NewTransactionID []byte
+		Changes          []string
+		ResignRequired   []SignatureSlot
+	}
+
+	// SignatureSlot is the position of a signature in the transaction (UserID is nil if the signer is unknown)
+	SignatureSlot struct {
+		Index  int
+		UserID []byte
+	}
+)
+
+// UpgradeTransaction returns a copy of the legacy transaction re-expressed in the current version, and the report of the changes
+// The signatures in the copy are cleared (the slots are kept), so the copy must be signed again by the users in ResignRequired.
+// The signers of BBcReference objects are the mandatory approvers of the referred events, so the referred transactions are resolved by resolve
+// unless the references are linked (e.g., created by CreateReference); an unresolved reference is an error (ErrUnlinkedReference if resolve is nil).
+// If the transaction is already in the current version, an unchanged copy and an empty report are returned.
+func UpgradeTransaction(transaction *BBcTransaction, resolve TransactionResolver) (*BBcTransaction, *UpgradeReport, error) {
+	if transaction == nil {
+		return nil, nil, errors.New("transaction must be given")
+	}
+	if transaction.Version > CurrentTransactionVersion {
+		return nil, nil, fmt.Errorf("unknown transaction version %d", transaction.Version)
+	}
+	if transaction.TransactionIdLength <= 0 || transaction.TransactionIdLength > sha256.Size {
+		return nil, nil, fmt.Errorf("invalid transaction_id length %d", transaction.TransactionIdLength)
+	}
+	txobj := transaction.Clone()
+	oldDigest := txobj.Digest()
+	if oldDigest == nil {
+		return nil, nil, errors.New("failed to calculate transaction_id")
+	}
+	report := UpgradeReport{
+		FromVersion:      txobj.Version,
+		ToVersion:        CurrentTransactionVersion,
+		OldTransactionID: cloneBytes(oldDigest[:txobj.TransactionIdLength]),
+	}
+	if txobj.Version == CurrentTransactionVersion {
+		report.NewTransactionID = cloneBytes(report.OldTransactionID)
+		return txobj, &report, nil
+	}
+
+	report.Changes = append(report.Changes, fmt.Sprintf("version: %d -> %d", txobj.Version, CurrentTransactionVersion))
+	if !hasIdLengthHeader(txobj.Version) {
+		report.Changes = append(report.Changes, fmt.Sprintf("header: transaction_id_length (%d) added", txobj.TransactionIdLength))
+	}
+	for i := range txobj.Relations {
+		report.Changes = append(report.Changes, fmt.Sprintf("relations[%d]: empty asset_raw and asset_hash added", i))
+	}
+	txobj.setVersion(CurrentTransactionVersion)
+
+	users, err := txobj.signatureUsers(resolve)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range txobj.Signatures {
+		report.ResignRequired = append(report.ResignRequired, SignatureSlot{Index: i, UserID: users[i]})
+		txobj.Signatures[i] = &BBcSignature{Version: CurrentTransactionVersion}
+		report.Changes = append(report.Changes, fmt.Sprintf("signatures[%d]: cleared (must be signed again)", i))
+	}
+	if len(txobj.SigIndexedUsers) == 0 {
+		txobj.SigIndexedUsers = users
+	}
+
+	newDigest := txobj.Digest()
+	if newDigest == nil {
+		return nil, nil, errors.New("failed to calculate transaction_id")
+	}
+	report.NewTransactionID = cloneBytes(newDigest[:txobj.TransactionIdLength])
+	txobj.TransactionID = cloneBytes(report.NewTransactionID)
+	report.Changes = append(report.Changes, fmt.Sprintf("transaction_id: %x -> %x", report.OldTransactionID, report.NewTransactionID))
+	return txobj, &report, nil
+}
+
+// setVersion sets the version in the transaction and all objects in it
+func (p *BBcTransaction) setVersion(version uint32) {
+	p.Version = version
+	for _, obj := range p.Events {
+		obj.Version = version
+		if obj.Asset != nil {
+			obj.Asset.Version = version
+		}
+	}
+	for _, obj := range p.References {
+		obj.Version = version
+	}
+	for _, obj := range p.Relations {
+		obj.SetVersion(version)
+		if obj.Asset != nil {
+			obj.Asset.Version = version
+		}
+	}
+	if p.Witness != nil {
+		p.Witness.Version = version
+	}
+	if p.Crossref != nil {
+		p.Crossref.Version = version
+	}
+	for _, obj := range p.Signatures {
+		if obj != nil {
+			obj.Version = version
+		}
+	}
+}
+
+// signatureUsers returns the user_ids of the signatures known from BBcWitness and the mandatory approvers of the referred events
+// (the signers for option approvers are not known until they sign)
+func (p *BBcTransaction) signatureUsers(resolve TransactionResolver) ([][]byte, error) {
+	users := make([][]byte, len(p.Signatures))
+	set := func(idx int, userID []byte) {
+		if idx >= 0 && idx < len(users) && users[idx] == nil && len(userID) > 0 {
+			users[idx] = cloneBytes(userID)
+		}
+	}
+	if p.Witness != nil {
+		for i, uid := range p.Witness.UserIDs {
+			if i < len(p.Witness.SigIndices) {
+				set(p.Witness.SigIndices[i], uid)
+			}
+		}
+	}
+	for i, ref := range p.References {
+		approvers, err := referredApprovers(ref, resolve)
+		if err != nil {
+			return nil, fmt.Errorf("references[%d]: %w", i, err)
+		}
+		for j, idx := range ref.SigIndices {
+			if j < len(approvers) {
+				set(idx, approvers[j])
+			}
+		}
+	}
+	return users, nil
+}
+
+// referredApprovers returns the mandatory approvers of the event referred by the reference (from the linked or resolved transaction)
+func referredApprovers(ref *BBcReference, resolve TransactionResolver) ([][]byte, error) {
+	if ref.RefTransaction != nil {
+		return ref.RefEvent.MandatoryApprovers, nil
+	}
+	if resolve == nil {
+		return nil, ErrUnlinkedReference
+	}
+	refTx, err := resolve(ref.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	if refTx == nil || !bytes.Equal(refTx.TransactionID, ref.TransactionID) {
+		return nil, fmt.Errorf("referred transaction %x not found", ref.TransactionID)
+	}
+	if int(ref.EventIndexInRef) >= len(refTx.Events) || refTx.Events[ref.EventIndexInRef] == nil {
+		return nil, fmt.Errorf("no event %d in the referred transaction %x", ref.EventIndexInRef, ref.TransactionID)
+	}
+	return refTx.Events[ref.EventIndexInRef].MandatoryApprovers, nil
+}
@@ -0,0 +1,302 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// legacyFixture is a legacy transaction serialized by another implementation (conformance/testdata/legacy.json)
+type legacyFixture struct {
+	Name          string `json:"name"`
+	Version       uint32 `json:"version"`
+	FormatType    uint16 `json:"format_type"`
+	Serialized    string `json:"serialized"`
+	TransactionID string `json:"transaction_id"`
+}
+
+func loadLegacyFixtures(t *testing.T) []legacyFixture {
+	dat, err := ioutil.ReadFile(filepath.Join("conformance", "testdata", "legacy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixtures struct {
+		Fixtures []legacyFixture `json:"fixtures"`
+	}
+	if err := json.Unmarshal(dat, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures.Fixtures) == 0 {
+		t.Fatal("no legacy fixture")
+	}
+	return fixtures.Fixtures
+}
+
+func makeLegacyTx(t *testing.T, version uint32, keypair *KeyPair) *BBcTransaction {
+	profile, err := NewIdLengthProfileAll(legacyIDLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assetgroup := GetIdentifier("asset_group_id1,,,,,,,", defaultIDLength)
+	txid := GetIdentifier("0123456789abcdef0123456789abcdef", defaultIDLength)
+
+	txobj := profile.NewTransaction(version)
+	txobj.AddEvent(&assetgroup, nil)
+	txobj.Events[0].AddMandatoryApprover(&txtest_u1).CreateAsset(&txtest_u1, nil, "legacy event asset")
+	txobj.AddRelation(&assetgroup)
+	txobj.Relations[0].CreatePointer(&txid, nil).CreateAsset(&txtest_u2, nil, map[string]int{"amount": 10})
+	txobj.AddWitness(&txtest_u1).AddWitness(&txtest_u2)
+	txobj.Sign(&txtest_u1, keypair, false)
+	txobj.Sign(&txtest_u2, keypair, false)
+	return txobj
+}
+
+func TestLegacyTransaction(t *testing.T) {
+	keypair, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+
+	for _, version := range []uint32{0, 1} {
+		txobj := makeLegacyTx(t, version, keypair)
+
+		t.Run("pack, unpack and verify", func(t *testing.T) {
+			packed, err := txobj.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(packed) != txobj.PackedSize() {
+				t.Fatalf("invalid size (version=%d): %d != %d", version, len(packed), txobj.PackedSize())
+			}
+			if dat, err := txobj.AppendPack(nil); err != nil || !bytes.Equal(dat, packed) {
+				t.Fatalf("packed data differs (version=%d): %v", version, err)
+			}
+
+			dat, err := Serialize(txobj, FormatZlib)
+			if err != nil {
+				t.Fatal(err)
+			}
+			obj, err := Deserialize(dat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if obj.Version != version || obj.TransactionIdLength != legacyIDLength || !bytes.Equal(obj.TransactionID, txobj.TransactionID) {
+				t.Fatalf("invalid header (version=%d)", version)
+			}
+			if !obj.Equal(txobj) {
+				t.Fatalf("Not recovered correctly (version=%d)", version)
+			}
+			if result, idx := obj.VerifyAll(); !result {
+				t.Fatalf("failed to verify (version=%d, signature[%d])", version, idx)
+			}
+
+			lazy, err := PeekTransaction(dat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(lazy.TransactionID, txobj.TransactionID) || len(lazy.RelationSections) != 1 {
+				t.Fatalf("invalid peek result (version=%d)", version)
+			}
+			if _, err := NewSignedTransaction(obj); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("header of version 0", func(t *testing.T) {
+		tx0, _ := makeLegacyTx(t, 0, keypair).Pack()
+		tx1, _ := makeLegacyTx(t, 1, keypair).Pack()
+		if len(tx1)-len(tx0) != 2 {
+			t.Fatalf("version 0 must not have transaction_id_length: %d, %d", len(tx0), len(tx1))
+		}
+	})
+
+	t.Run("unsupported objects", func(t *testing.T) {
+		profile, _ := NewIdLengthProfileAll(8)
+		if _, err := profile.NewTransaction(0).Pack(); err == nil {
+			t.Fatal("version 0 transaction with 8-byte transaction_id must not be packed")
+		}
+		txobj := makeLegacyTx(t, 1, keypair)
+		asid := GetIdentifier("asset", defaultIDLength)
+		txobj.Relations[0].CreateAssetRaw(&asid, "raw")
+		if _, err := txobj.Pack(); err == nil {
+			t.Fatal("asset_raw must not be packed in version 1 transaction")
+		}
+		if _, err := txobj.AppendPack(nil); err == nil {
+			t.Fatal("asset_raw must not be packed in version 1 transaction")
+		}
+	})
+}
+
+func TestUpgradeTransaction(t *testing.T) {
+	keypair, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+	dat, _ := Serialize(makeLegacyTx(t, 0, keypair), FormatPlain)
+	legacy, err := Deserialize(dat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("upgrade legacy transaction", func(t *testing.T) {
+		txobj, report, err := UpgradeTransaction(legacy, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.FromVersion != 0 || report.ToVersion != CurrentTransactionVersion || txobj.Version != CurrentTransactionVersion {
+			t.Fatalf("invalid versions: %+v", report)
+		}
+		if !bytes.Equal(report.OldTransactionID, legacy.TransactionID) || bytes.Equal(report.NewTransactionID, report.OldTransactionID) ||
+			!bytes.Equal(report.NewTransactionID, txobj.TransactionID) {
+			t.Fatal("invalid transaction_id in the report")
+		}
+		if len(report.Changes) == 0 || len(report.ResignRequired) != 2 {
+			t.Fatalf("invalid report: %+v", report)
+		}
+		for i, uid := range [][]byte{txtest_u1, txtest_u2} {
+			if report.ResignRequired[i].Index != i || !bytes.Equal(report.ResignRequired[i].UserID, uid) {
+				t.Fatalf("invalid signature slot: %+v", report.ResignRequired[i])
+			}
+		}
+		if _, err := NewSignedTransaction(txobj); !errors.Is(err, ErrNotFinalized) {
+			t.Fatalf("upgraded transaction must be signed again: %v", err)
+		}
+
+		for _, slot := range report.ResignRequired {
+			txobj.Sign(&slot.UserID, keypair, false)
+		}
+		if len(txobj.Signatures) != 2 {
+			t.Fatalf("signatures must be set in the slots: %d", len(txobj.Signatures))
+		}
+		dat, _ := Serialize(txobj, FormatPlain)
+		obj, err := Deserialize(dat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, _ := obj.VerifyAll(); !result || obj.Version != CurrentTransactionVersion {
+			t.Fatal("failed to verify the upgraded transaction")
+		}
+
+		if result, _ := legacy.VerifyAll(); !result || legacy.Version != 0 {
+			t.Fatal("original transaction must not be modified")
+		}
+	})
+
+	t.Run("legacy fixtures", func(t *testing.T) {
+		for _, f := range loadLegacyFixtures(t) {
+			dat, _ := hex.DecodeString(f.Serialized)
+			fixture, err := Deserialize(dat)
+			if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+			if fixture.Version != f.Version || hex.EncodeToString(fixture.TransactionID) != f.TransactionID {
+				t.Fatalf("%s: invalid transaction (version=%d, transaction_id=%x)", f.Name, fixture.Version, fixture.TransactionID)
+			}
+			if result, idx := fixture.VerifyAll(); !result {
+				t.Fatalf("%s: failed to verify (signature[%d])", f.Name, idx)
+			}
+			if f.FormatType == FormatPlain {
+				if serialized, err := Serialize(fixture, FormatPlain); err != nil || !bytes.Equal(serialized, dat) {
+					t.Fatalf("%s: re-serialized data differs: %v", f.Name, err)
+				}
+			}
+
+			txobj, report, err := UpgradeTransaction(fixture, nil)
+			if len(fixture.References) > 0 {
+				// the referred transaction is not included in the fixtures
+				if !errors.Is(err, ErrUnlinkedReference) {
+					t.Fatalf("%s: unresolved reference must be reported: %v", f.Name, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+			if report.FromVersion != f.Version || hex.EncodeToString(report.OldTransactionID) != f.TransactionID ||
+				bytes.Equal(report.NewTransactionID, report.OldTransactionID) || len(report.ResignRequired) != len(fixture.Signatures) {
+				t.Fatalf("%s: invalid report: %+v", f.Name, report)
+			}
+			for _, slot := range report.ResignRequired {
+				txobj.Signatures[slot.Index] = fixture.Signatures[slot.Index]
+			}
+			if result, _ := txobj.VerifyAll(); result {
+				t.Fatalf("%s: legacy signatures must not be valid for the upgraded transaction", f.Name)
+			}
+		}
+	})
+
+	t.Run("deserialized references", func(t *testing.T) {
+		profile, _ := NewIdLengthProfileAll(legacyIDLength)
+		assetgroup := GetIdentifier("asset_group_id1,,,,,,,", defaultIDLength)
+		refTx := makeLegacyTx(t, 0, keypair)
+		withRef := profile.NewTransaction(0)
+		withRef.CreateReference(&assetgroup, refTx, 0)
+		withRef.AddEvent(&assetgroup, &[]int{0})
+		withRef.Events[0].AddMandatoryApprover(&txtest_u2).CreateAsset(&txtest_u2, nil, "transferred asset")
+		withRef.Sign(&txtest_u1, keypair, false)
+		dat, _ := Serialize(withRef, FormatPlain)
+		obj, err := Deserialize(dat)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := UpgradeTransaction(obj, nil); !errors.Is(err, ErrUnlinkedReference) {
+			t.Fatalf("reference without the resolver must be reported: %v", err)
+		}
+		if _, _, err := UpgradeTransaction(obj, make(TransactionMap).Resolve); err == nil {
+			t.Fatal("unresolved reference must be reported")
+		}
+		store := make(TransactionMap)
+		store.Add(refTx)
+		_, report, err := UpgradeTransaction(obj, store.Resolve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.ResignRequired) != 1 || !bytes.Equal(report.ResignRequired[0].UserID, txtest_u1) {
+			t.Fatalf("signer of the reference must be reported: %+v", report.ResignRequired)
+		}
+	})
+
+	t.Run("invalid transaction_id length", func(t *testing.T) {
+		for _, l := range []int{0, sha256.Size + 1} {
+			txobj := legacy.Clone()
+			txobj.TransactionIdLength = l
+			if _, _, err := UpgradeTransaction(txobj, nil); err == nil {
+				t.Fatalf("transaction_id length %d must be rejected", l)
+			}
+		}
+	})
+
+	t.Run("current version", func(t *testing.T) {
+		refTxObj := makeBaseTx(idLengthConfig)
+		txobj, report, err := UpgradeTransaction(&refTxObj, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Changes) != 0 || len(report.ResignRequired) != 0 || !bytes.Equal(report.NewTransactionID, refTxObj.TransactionID) {
+			t.Fatalf("transaction in the current version must not be changed: %+v", report)
+		}
+		if result, _ := txobj.VerifyAll(); !result {
+			t.Fatal("failed to verify")
+		}
+		if _, _, err := UpgradeTransaction(&BBcTransaction{Version: CurrentTransactionVersion + 1}, nil); err == nil {
+			t.Fatal("unknown version must be rejected")
+		}
+	})
+}
@@ -0,0 +1,137 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// LogLevel is the severity of a log message
+type LogLevel int
+
+// Log levels
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+// String returns the name of the log level
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+/*
+Logger definition
+
+Logger is the hook for the log messages of the library. The library does not output anything by default.
+A Logger is set by SetLogger, and receives the level, message and structured fields (key-value pairs) of each log.
+Log may be called from multiple goroutines concurrently.
+
+The library logs, for example, the errors that are not returned by the fluent methods (e.g., BBcTransaction.Sign).
+*/
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...LogField)
+}
+
+// LogField is a structured field of a log message
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+var (
+	loggerMutex sync.RWMutex
+	logger      Logger
+)
+
+// SetLogger sets the logger of the library (nil disables logging)
+func SetLogger(l Logger) {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+	logger = l
+}
+
+// logf outputs a log message to the logger (if set)
+func logf(level LogLevel, msg string, fields ...LogField) {
+	loggerMutex.RLock()
+	l := logger
+	loggerMutex.RUnlock()
+	if l != nil {
+		l.Log(level, msg, fields...)
+	}
+}
+
+// logError outputs the error with the fields if err is not nil, and returns err as is
+func logError(err error, msg string, fields ...LogField) error {
+	if err != nil {
+		logf(LogLevelWarn, msg, append(fields, LogField{"error", err})...)
+	}
+	return err
+}
+
+// writerLogger is a Logger that outputs logs in key=value format
+type writerLogger struct {
+	mutex    sync.Mutex
+	w        io.Writer
+	minLevel LogLevel
+}
+
+// NewWriterLogger returns a Logger that outputs the logs at minLevel or higher into w in the format of "level=warn msg=\"...\" key=value ..."
+func NewWriterLogger(w io.Writer, minLevel LogLevel) Logger {
+	return &writerLogger{w: w, minLevel: minLevel}
+}
+
+// Log outputs a log message
+func (l *writerLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	if level < l.minLevel {
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "level=%s msg=%q", level, msg)
+	for _, f := range fields {
+		switch v := f.Value.(type) {
+		case []byte:
+			fmt.Fprintf(&sb, " %s=%x", f.Key, v)
+		case string:
+			fmt.Fprintf(&sb, " %s=%q", f.Key, v)
+		case error:
+			fmt.Fprintf(&sb, " %s=%q", f.Key, v.Error())
+		default:
+			fmt.Fprintf(&sb, " %s=%v", f.Key, v)
+		}
+	}
+	sb.WriteString("\n")
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, _ = io.WriteString(l.w, sb.String())
+}
@@ -0,0 +1,77 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	assetgroup := GetIdentifier("asset_group_id1,,,,,,,", defaultIDLength)
+	refTxObj := makeBaseTx(idLengthConfig)
+
+	t.Run("level and fields", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		l := NewWriterLogger(buf, LogLevelInfo)
+		l.Log(LogLevelDebug, "not output")
+		l.Log(LogLevelWarn, "output", LogField{"id", []byte{0x01, 0xab}}, LogField{"name", "a b"}, LogField{"error", errors.New("e")}, LogField{"num", 3})
+		expected := "level=warn msg=\"output\" id=01ab name=\"a b\" error=\"e\" num=3\n"
+		if buf.String() != expected {
+			t.Fatalf("invalid log: %q", buf.String())
+		}
+	})
+
+	t.Run("errors in fluent methods", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		SetLogger(NewWriterLogger(buf, LogLevelDebug))
+		defer SetLogger(nil)
+
+		txobj := BBcTransaction{Version: 2}
+		txobj.SetIdLengthConf(&idLengthConfig)
+		txobj.AddEvent(&assetgroup, nil).AddWitness(&txtest_u1)
+		txobj.Sign(&txtest_u1, &KeyPair{}, false)
+		txobj.CreateReference(&assetgroup, &refTxObj, 3)
+		logs := buf.String()
+		if !strings.Contains(logs, "level=warn msg=\"failed to sign transaction\"") || !strings.Contains(logs, "msg=\"failed to create BBcReference\"") {
+			t.Fatalf("errors must be logged: %s", logs)
+		}
+
+		buf.Reset()
+		SetLogger(nil)
+		txobj.Sign(&txtest_u1, &KeyPair{}, false)
+		if buf.Len() != 0 {
+			t.Fatal("log must not be output after the logger is unset")
+		}
+	})
+
+	t.Run("packing error", func(t *testing.T) {
+		txobj := MakeTransaction(1, 0, true)
+		txobj.Events[0].AssetGroupID = []byte{0x01, 0x02}
+		if _, err := txobj.Pack(); err == nil {
+			t.Fatal("ID with invalid length must not be packed")
+		}
+		if _, err := Serialize(txobj, FormatZlib); err == nil {
+			t.Fatal("error must be propagated to Serialize")
+		}
+		if err := PutBigInt(new(bytes.Buffer), nil, 32); err == nil {
+			t.Fatal("nil value must not be packed")
+		}
+	})
+}
@@ -0,0 +1,503 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+/*
+PartiallySignedTransaction definition
+
+PartiallySignedTransaction is a portable draft of a transaction that is signed by multiple approvers in different places.
+The draft is exported from a built transaction, passed to each approver (e.g., in JSON by Marshal), signed offline and merged.
+When all signer slots are filled, Finalize returns the transaction with all signatures.
+
+"Transaction" is the packed transaction without signatures (all signatures are empty placeholders).
+"Slots" is the signer slot map, i.e., which user must sign at which position in the Signatures list of the transaction.
+A slot for option approvers of a BBcReference has "Option" flag and the list of the approvers who can sign for the slot ("Candidates"),
+because the slot is not bound to a specific user until one of the option approvers signs.
+This information is not included in the packed transaction, so that a deserialized transaction cannot be signed by option approvers without the draft.
+"Signatures" is the list of signatures collected so far.
+*/
+type (
+	SignerSlot struct {
+		Index          int      `json:"index"`
+		UserID         []byte   `json:"user_id,omitempty"`
+		Option         bool     `json:"option,omitempty"`
+		Candidates     [][]byte `json:"candidates,omitempty"`
+		ReferenceIndex int      `json:"reference_index"`
+	}
+
+	CollectedSignature struct {
+		Index     int    `json:"index"`
+		Signer    []byte `json:"signer,omitempty"`
+		Signature []byte `json:"signature"`
+	}
+
+	PartiallySignedTransaction struct {
+		FormatVersion int                  `json:"format_version"`
+		TransactionID []byte               `json:"transaction_id"`
+		Transaction   []byte               `json:"transaction"`
+		Slots         []SignerSlot         `json:"slots"`
+		Signatures    []CollectedSignature `json:"signatures"`
+		txobj         *BBcTransaction
+		digest        []byte
+	}
+)
+
+const (
+	partiallySignedTransactionVersion = 1
+)
+
+// Errors of multi-party signing
+var (
+	ErrDraftMismatch     = errors.New("drafts are made from different transactions")
+	ErrNotSigner         = errors.New("the user is not a signer of the transaction")
+	ErrAlreadySigned     = errors.New("the user has already signed the transaction")
+	ErrSignatureConflict = errors.New("different signers signed the same slot")
+	ErrInvalidSignature  = errors.New("signature verification failed")
+	ErrIncompleteDraft   = errors.New("some signatures are missing")
+	ErrUnlinkedReference = errors.New("BBcReference must be linked to the referred transaction")
+)
+
+// NewPartiallySignedTransaction exports the draft from the transaction
+// All BBcReference objects in the transaction must be linked to the referred transaction (i.e., created by CreateReference).
+// The signatures already in the transaction are taken into the draft.
+func NewPartiallySignedTransaction(txobj *BBcTransaction) (*PartiallySignedTransaction, error) {
+	slotNum := len(txobj.Signatures)
+	slots := make([]SignerSlot, slotNum)
+	for i := range slots {
+		slots[i].Index = i
+		slots[i].ReferenceIndex = -1
+		if i < len(txobj.SigIndexedUsers) {
+			slots[i].UserID = cloneBytes(txobj.SigIndexedUsers[i])
+		}
+	}
+	for i, ref := range txobj.References {
+		if ref.RefTransaction == nil {
+			return nil, ErrUnlinkedReference
+		}
+		mandatoryNum := len(ref.RefEvent.MandatoryApprovers)
+		for j, idx := range ref.SigIndices {
+			if j < mandatoryNum || idx >= slotNum {
+				continue
+			}
+			slots[idx].UserID = nil
+			slots[idx].Option = true
+			slots[idx].Candidates = cloneBytesList(ref.RefEvent.OptionApprovers)
+			slots[idx].ReferenceIndex = i
+		}
+	}
+
+	draftTx := txobj.Clone()
+	draftTx.Signatures = make([]*BBcSignature, slotNum)
+	for i := range draftTx.Signatures {
+		draftTx.Signatures[i] = &BBcSignature{}
+	}
+	dat, err := draftTx.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	p := PartiallySignedTransaction{
+		FormatVersion: partiallySignedTransactionVersion,
+		TransactionID: cloneBytes(draftTx.TransactionID),
+		Transaction:   dat,
+		Slots:         slots,
+	}
+	for i, sig := range txobj.Signatures {
+		if sig == nil || sig.KeyType == KeyTypeNotInitialized {
+			continue
+		}
+		if err := p.addSignatureAt(i, slots[i].UserID, sig); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// UnmarshalPartiallySignedTransaction restores the draft from the data output by Marshal
+func UnmarshalPartiallySignedTransaction(dat []byte) (*PartiallySignedTransaction, error) {
+	p := PartiallySignedTransaction{}
+	if err := json.Unmarshal(dat, &p); err != nil {
+		return nil, err
+	}
+	if p.FormatVersion != partiallySignedTransactionVersion {
+		return nil, fmt.Errorf("not supported format version=%d", p.FormatVersion)
+	}
+	txobj, err := p.Draft()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(txobj.TransactionID, p.TransactionID) {
+		return nil, ErrDraftMismatch
+	}
+	if len(txobj.Signatures) != len(p.Slots) {
+		return nil, errors.New("num of slots must be equal to num of signatures")
+	}
+	if err := p.checkCollected(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Marshal outputs the draft in JSON format
+func (p *PartiallySignedTransaction) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// Draft returns the transaction object in the draft (without signatures)
+func (p *PartiallySignedTransaction) Draft() (*BBcTransaction, error) {
+	if p.txobj == nil {
+		txobj := BBcTransaction{}
+		dat := cloneBytes(p.Transaction)
+		if err := txobj.Unpack(&dat); err != nil {
+			return nil, err
+		}
+		p.txobj = &txobj
+		p.digest = txobj.Digest()
+	}
+	return p.txobj, nil
+}
+
+// Sign signs the draft as the given user and adds the signature in the draft
+// The signature in the draft must include the public key, so noPubkey must be false (kept for compatibility with BBcTransaction.Sign).
+func (p *PartiallySignedTransaction) Sign(userID []byte, keyPair *KeyPair, noPubkey bool) error {
+	if noPubkey {
+		return fmt.Errorf("%w: signature in the draft must include the public key", ErrInvalidSignature)
+	}
+	idx, err := p.findSlot(userID)
+	if err != nil {
+		return err
+	}
+	if _, err := p.Draft(); err != nil {
+		return err
+	}
+	signature := keyPair.Sign(p.digest)
+	if signature == nil {
+		return errors.New("fail to sign")
+	}
+	sig := BBcSignature{Version: p.txobj.Version}
+	sig.SetPublicKeyByKeypair(keyPair)
+	sig.SetSignature(&signature)
+	return p.addSignatureAt(idx, userID, &sig)
+}
+
+// AddSignature adds the signature made by the given user in the draft
+func (p *PartiallySignedTransaction) AddSignature(userID []byte, sig *BBcSignature) error {
+	idx, err := p.findSlot(userID)
+	if err != nil {
+		return err
+	}
+	return p.addSignatureAt(idx, userID, sig)
+}
+
+// Merge takes the signatures in the other draft of the same transaction into this draft
+// If both drafts have a signature for the same slot by different signers, ErrSignatureConflict is returned and this draft is not changed.
+func (p *PartiallySignedTransaction) Merge(other *PartiallySignedTransaction) error {
+	if !bytes.Equal(p.TransactionID, other.TransactionID) || !bytes.Equal(p.Transaction, other.Transaction) {
+		return ErrDraftMismatch
+	}
+	merged := *p
+	merged.Signatures = append([]CollectedSignature{}, p.Signatures...)
+	for _, s := range other.Signatures {
+		if existing := merged.collected(s.Index); existing != nil {
+			if existing.Signer != nil && s.Signer != nil && !bytes.Equal(existing.Signer, s.Signer) {
+				return ErrSignatureConflict
+			}
+			if existing.Signer == nil && s.Signer == nil && !bytes.Equal(existing.Signature, s.Signature) {
+				return ErrSignatureConflict
+			}
+			continue
+		}
+		sig, err := unpackCollected(s.Signature)
+		if err != nil {
+			return err
+		}
+		if err := merged.addSignatureAt(s.Index, s.Signer, sig); err != nil {
+			if err == ErrAlreadySigned {
+				return ErrSignatureConflict
+			}
+			return err
+		}
+	}
+	p.Signatures = merged.Signatures
+	return nil
+}
+
+// Missing returns the signer slots that have not been signed yet
+func (p *PartiallySignedTransaction) Missing() []SignerSlot {
+	var ret []SignerSlot
+	for _, slot := range p.Slots {
+		if p.collected(slot.Index) == nil {
+			ret = append(ret, slot)
+		}
+	}
+	return ret
+}
+
+// IsComplete returns true if all signer slots have been signed
+func (p *PartiallySignedTransaction) IsComplete() bool {
+	return len(p.Missing()) == 0
+}
+
+// Finalize returns the transaction object with all signatures in the draft
+// Each signature must be made by the key of the user of the slot given by keys (for an option slot, the signer or one of the candidates).
+func (p *PartiallySignedTransaction) Finalize(keys KeyResolver) (*BBcTransaction, error) {
+	if keys == nil {
+		return nil, errors.New("key resolver must be given")
+	}
+	if !p.IsComplete() {
+		return nil, ErrIncompleteDraft
+	}
+	draftTx, err := p.Draft()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkCollected(); err != nil {
+		return nil, err
+	}
+	txobj := draftTx.Clone()
+	for _, s := range p.Signatures {
+		sig, err := unpackCollected(s.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("%w (signature[%d])", err, s.Index)
+		}
+		txobj.Signatures[s.Index] = sig
+	}
+	optionSigners := make(map[int][][]byte)
+	for _, s := range p.Signatures {
+		slot := p.Slots[s.Index]
+		if !slot.Option {
+			if err := txobj.VerifySignedBy(s.Index, slot.UserID, keys); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		signer, err := p.optionSigner(txobj, s, optionSigners[slot.ReferenceIndex], keys)
+		if err != nil {
+			return nil, err
+		}
+		optionSigners[slot.ReferenceIndex] = append(optionSigners[slot.ReferenceIndex], signer)
+	}
+	if result, idx := txobj.VerifyAll(); !result {
+		return nil, fmt.Errorf("%w (signature[%d])", ErrInvalidSignature, idx)
+	}
+	return txobj, nil
+}
+
+// optionSigner returns the option approver who made the signature for the option slot with the key given by keys
+// The signer is one of the candidates who has not signed the other option slots of the same BBcReference.
+func (p *PartiallySignedTransaction) optionSigner(txobj *BBcTransaction, s CollectedSignature, signed [][]byte, keys KeyResolver) ([]byte, error) {
+	candidates := p.Slots[s.Index].Candidates
+	if s.Signer != nil {
+		candidates = [][]byte{s.Signer}
+	}
+	err := fmt.Errorf("%w (signature[%d])", ErrNotSigner, s.Index)
+	for _, uid := range candidates {
+		if containsID(signed, uid) {
+			continue
+		}
+		if err = txobj.VerifySignedBy(s.Index, uid, keys); err == nil {
+			return uid, nil
+		}
+	}
+	return nil, err
+}
+
+// checkCollected checks that each slot has at most one signature, that the signer is the user of the slot (or one of the candidates),
+// and that the signatures are valid for the draft
+func (p *PartiallySignedTransaction) checkCollected() error {
+	indices := make(map[int]bool)
+	for _, s := range p.Signatures {
+		if s.Index < 0 || s.Index >= len(p.Slots) {
+			return fmt.Errorf("no signer slot (index=%d)", s.Index)
+		}
+		if indices[s.Index] {
+			return fmt.Errorf("%w (signature[%d] is collected twice)", ErrSignatureConflict, s.Index)
+		}
+		indices[s.Index] = true
+		slot := p.Slots[s.Index]
+		switch {
+		case !slot.Option && !bytes.Equal(s.Signer, slot.UserID):
+			return fmt.Errorf("%w (signature[%d] by %x)", ErrNotSigner, s.Index, s.Signer)
+		case slot.Option && s.Signer != nil && !containsID(slot.Candidates, s.Signer):
+			return fmt.Errorf("%w (signature[%d] by %x)", ErrNotSigner, s.Index, s.Signer)
+		}
+		for _, other := range p.Signatures {
+			if other.Index != s.Index && s.Signer != nil && bytes.Equal(other.Signer, s.Signer) &&
+				slot.Option && p.Slots[other.Index].Option && p.Slots[other.Index].ReferenceIndex == slot.ReferenceIndex {
+				return fmt.Errorf("%w (signature[%d] by %x)", ErrAlreadySigned, s.Index, s.Signer)
+			}
+		}
+		sig, err := unpackCollected(s.Signature)
+		if err == nil {
+			err = p.checkSignature(sig)
+		}
+		if err != nil {
+			return fmt.Errorf("%w (signature[%d])", err, s.Index)
+		}
+	}
+	return nil
+}
+
+// collected returns the signature collected for the slot
+func (p *PartiallySignedTransaction) collected(idx int) *CollectedSignature {
+	for i := range p.Signatures {
+		if p.Signatures[i].Index == idx {
+			return &p.Signatures[i]
+		}
+	}
+	return nil
+}
+
+// userIdLength returns the length of user_id in the draft
+func (p *PartiallySignedTransaction) userIdLength(userID []byte) int {
+	for _, slot := range p.Slots {
+		if slot.UserID != nil {
+			return len(slot.UserID)
+		}
+		if len(slot.Candidates) > 0 {
+			return len(slot.Candidates[0])
+		}
+	}
+	return len(userID)
+}
+
+// normalizeUserID pads or truncates userID to the length in the draft
+func (p *PartiallySignedTransaction) normalizeUserID(userID []byte) []byte {
+	uid := make([]byte, p.userIdLength(userID))
+	copy(uid, userID)
+	return uid
+}
+
+// findSlot returns the index of the slot that the user should sign next
+func (p *PartiallySignedTransaction) findSlot(userID []byte) (int, error) {
+	uid := p.normalizeUserID(userID)
+	signer := false
+	for _, slot := range p.Slots {
+		if !slot.Option && bytes.Equal(slot.UserID, uid) {
+			if p.collected(slot.Index) != nil {
+				return -1, ErrAlreadySigned
+			}
+			return slot.Index, nil
+		}
+	}
+	for _, slot := range p.Slots {
+		if !slot.Option || !containsID(slot.Candidates, uid) {
+			continue
+		}
+		signer = true
+		if p.signedInReference(slot.ReferenceIndex, uid) {
+			return -1, ErrAlreadySigned
+		}
+		if p.collected(slot.Index) == nil {
+			return slot.Index, nil
+		}
+	}
+	if signer {
+		return -1, ErrAlreadySigned
+	}
+	return -1, ErrNotSigner
+}
+
+// signedInReference returns true if the user has signed an option slot of the BBcReference
+func (p *PartiallySignedTransaction) signedInReference(refIdx int, uid []byte) bool {
+	for _, slot := range p.Slots {
+		if !slot.Option || slot.ReferenceIndex != refIdx {
+			continue
+		}
+		if s := p.collected(slot.Index); s != nil && bytes.Equal(s.Signer, uid) {
+			return true
+		}
+	}
+	return false
+}
+
+// addSignatureAt verifies the signature and adds it for the slot
+func (p *PartiallySignedTransaction) addSignatureAt(idx int, userID []byte, sig *BBcSignature) error {
+	if idx < 0 || idx >= len(p.Slots) {
+		return fmt.Errorf("no signer slot (index=%d)", idx)
+	}
+	if p.collected(idx) != nil {
+		return ErrAlreadySigned
+	}
+	var uid []byte
+	if userID != nil {
+		uid = p.normalizeUserID(userID)
+		slot := p.Slots[idx]
+		if (!slot.Option && !bytes.Equal(slot.UserID, uid)) || (slot.Option && !containsID(slot.Candidates, uid)) {
+			return ErrNotSigner
+		}
+		if slot.Option && p.signedInReference(slot.ReferenceIndex, uid) {
+			return ErrAlreadySigned
+		}
+	}
+	if _, err := p.Draft(); err != nil {
+		return err
+	}
+	if err := p.checkSignature(sig); err != nil {
+		return err
+	}
+	dat, err := sig.Pack()
+	if err != nil {
+		return err
+	}
+	p.Signatures = append(p.Signatures, CollectedSignature{Index: idx, Signer: uid, Signature: dat})
+	return nil
+}
+
+// checkSignature checks that the signature is well-formed, includes the public key and is valid for the draft
+// The draft must have been unpacked by Draft.
+func (p *PartiallySignedTransaction) checkSignature(sig *BBcSignature) error {
+	if sig == nil {
+		return ErrInvalidSignature
+	}
+	if err := sig.CheckFormat(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if len(sig.Pubkey) == 0 {
+		return fmt.Errorf("%w: public key must be included", ErrInvalidSignature)
+	}
+	if !VerifyBBcSignature(p.digest, sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// unpackCollected returns the BBcSignature object of the packed signature in the draft
+func unpackCollected(dat []byte) (*BBcSignature, error) {
+	sig := BBcSignature{}
+	if err := sig.Unpack(&dat); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return &sig, nil
+}
+
+// containsID returns true if the list includes the ID
+func containsID(ids [][]byte, id []byte) bool {
+	for _, i := range ids {
+		if bytes.Equal(i, id) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,360 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func makeDraftTx(refTxObj *BBcTransaction) *BBcTransaction {
+	assetgroup := GetIdentifier("asset_group_id1,,,,,,,", defaultIDLength)
+	txobj := BBcTransaction{Version: 2, Timestamp: time.Now().UnixNano()}
+	txobj.SetIdLengthConf(&idLengthConfig)
+	txobj.AddEvent(&assetgroup, nil)
+	txobj.Events[0].AddMandatoryApprover(&txtest_u5).CreateAsset(&txtest_u5, nil, "multisig test")
+	txobj.CreateReference(&assetgroup, refTxObj, 0)
+	txobj.AddWitness(&txtest_u5).AddWitness(&txtest_u6)
+	return &txobj
+}
+
+func transferDraft(t *testing.T, draft *PartiallySignedTransaction) *PartiallySignedTransaction {
+	dat, err := draft.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := UnmarshalPartiallySignedTransaction(dat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recovered
+}
+
+func TestPartiallySignedTransaction(t *testing.T) {
+	refTxObj := makeBaseTx(idLengthConfig)
+	keypairs := make(map[string]*KeyPair)
+	for _, name := range []string{"u1", "u2", "u3", "u4", "u5", "u6"} {
+		keypairs[name], _ = GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+	}
+	publicKeys := make(PublicKeyMap)
+	for i, uid := range [][]byte{txtest_u1, txtest_u2, txtest_u3, txtest_u4, txtest_u5, txtest_u6} {
+		publicKeys.Add(uid, keypairs[fmt.Sprintf("u%d", i+1)].Pubkey)
+	}
+
+	t.Run("export draft", func(t *testing.T) {
+		draft, err := NewPartiallySignedTransaction(makeDraftTx(&refTxObj))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(draft.Slots) != 5 || len(draft.Signatures) != 0 {
+			t.Fatalf("invalid slots: %d slots, %d signatures", len(draft.Slots), len(draft.Signatures))
+		}
+		options := 0
+		for _, slot := range draft.Slots {
+			if slot.Option {
+				options++
+				if slot.ReferenceIndex != 0 || len(slot.Candidates) != 2 || slot.UserID != nil {
+					t.Fatal("invalid option slot")
+				}
+			}
+		}
+		if options != 1 {
+			t.Fatalf("num of option slots must be 1 (%d)", options)
+		}
+		if draft.IsComplete() || len(draft.Missing()) != 5 {
+			t.Fatal("draft must not be completed")
+		}
+	})
+
+	t.Run("sign offline and merge", func(t *testing.T) {
+		draft, _ := NewPartiallySignedTransaction(makeDraftTx(&refTxObj))
+		party1 := transferDraft(t, draft)
+		party2 := transferDraft(t, draft)
+		party3 := transferDraft(t, draft)
+
+		if err := party1.Sign(txtest_u1, keypairs["u1"], false); err != nil {
+			t.Fatal(err)
+		}
+		if err := party1.Sign(txtest_u2, keypairs["u2"], true); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatal("signature without public key must be rejected:", err)
+		}
+		if err := party1.Sign(txtest_u2, keypairs["u2"], false); err != nil {
+			t.Fatal(err)
+		}
+		if err := party2.Sign(txtest_u4, keypairs["u4"], false); err != nil {
+			t.Fatal(err)
+		}
+		if err := party2.Sign(txtest_u5, keypairs["u5"], false); err != nil {
+			t.Fatal(err)
+		}
+		if err := party3.Sign(txtest_u6, keypairs["u6"], false); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, p := range []*PartiallySignedTransaction{party1, party2, party3} {
+			if err := draft.Merge(transferDraft(t, p)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := draft.Merge(party1); err != nil {
+			t.Fatal("merging the same signatures again must not fail:", err)
+		}
+		if !draft.IsComplete() {
+			t.Fatalf("draft must be completed (missing %d)", len(draft.Missing()))
+		}
+
+		txobj, err := draft.Finalize(publicKeys.Resolve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(txobj.TransactionID, draft.TransactionID) {
+			t.Fatal("transaction_id mismatch")
+		}
+		dat, _ := Serialize(txobj, FormatZlib)
+		recovered, err := Deserialize(dat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, idx := recovered.VerifyAll(); !result {
+			t.Fatalf("Not recovered correctly... (signature[%d])", idx)
+		}
+		for i, sig := range recovered.Signatures {
+			if sig.KeyType == KeyTypeNotInitialized {
+				t.Fatalf("signature[%d] is not set", i)
+			}
+		}
+	})
+
+	t.Run("take signatures in the transaction", func(t *testing.T) {
+		txobj := makeDraftTx(&refTxObj)
+		txobj.Sign(&txtest_u5, keypairs["u5"], false)
+		txobj.Sign(&txtest_u3, keypairs["u3"], false)
+		draft, err := NewPartiallySignedTransaction(txobj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(draft.Signatures) != 2 || len(draft.Missing()) != 3 {
+			t.Fatalf("signatures are not taken (%d)", len(draft.Signatures))
+		}
+		if err := draft.Sign(txtest_u4, keypairs["u4"], false); !errors.Is(err, ErrAlreadySigned) {
+			t.Fatal("option slot must have been filled:", err)
+		}
+		for _, u := range []struct {
+			id   []byte
+			name string
+		}{{txtest_u1, "u1"}, {txtest_u2, "u2"}, {txtest_u6, "u6"}} {
+			if err := draft.Sign(u.id, keypairs[u.name], false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := draft.Finalize(publicKeys.Resolve); err != nil {
+			t.Fatal("signer of the option slot must be found among the candidates:", err)
+		}
+		others := make(PublicKeyMap)
+		for uid, key := range publicKeys {
+			others[uid] = key
+		}
+		others.Add(txtest_u3, keypairs["u4"].Pubkey)
+		if _, err := draft.Finalize(others.Resolve); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatal("option slot signed by a key of no candidate must be rejected:", err)
+		}
+	})
+
+	t.Run("detect errors", func(t *testing.T) {
+		draft, _ := NewPartiallySignedTransaction(makeDraftTx(&refTxObj))
+		nobody := GetIdentifier("nobody", defaultIDLength)
+		if err := draft.Sign(nobody, keypairs["u1"], false); !errors.Is(err, ErrNotSigner) {
+			t.Fatal("ErrNotSigner must be returned:", err)
+		}
+		if err := draft.Sign(txtest_u1, keypairs["u1"], false); err != nil {
+			t.Fatal(err)
+		}
+		if err := draft.Sign(txtest_u1, keypairs["u1"], false); !errors.Is(err, ErrAlreadySigned) {
+			t.Fatal("ErrAlreadySigned must be returned:", err)
+		}
+		if err := draft.Sign(txtest_u3, keypairs["u3"], false); err != nil {
+			t.Fatal(err)
+		}
+		if err := draft.Sign(txtest_u4, keypairs["u4"], false); !errors.Is(err, ErrAlreadySigned) {
+			t.Fatal("option slots must be exhausted:", err)
+		}
+
+		sig := BBcSignature{Version: 2}
+		sig.SetPublicKeyByKeypair(keypairs["u2"])
+		wrong := keypairs["u2"].Sign(GetIdentifier("wrong digest", 32))
+		sig.SetSignature(&wrong)
+		if err := draft.AddSignature(txtest_u2, &sig); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatal("ErrInvalidSignature must be returned:", err)
+		}
+		if _, err := draft.Finalize(publicKeys.Resolve); !errors.Is(err, ErrIncompleteDraft) {
+			t.Fatal("ErrIncompleteDraft must be returned:", err)
+		}
+	})
+
+	t.Run("detect conflicts", func(t *testing.T) {
+		draft, _ := NewPartiallySignedTransaction(makeDraftTx(&refTxObj))
+		party1 := transferDraft(t, draft)
+		party2 := transferDraft(t, draft)
+		_ = party1.Sign(txtest_u3, keypairs["u3"], false)
+		_ = party2.Sign(txtest_u4, keypairs["u4"], false)
+		_ = party2.Sign(txtest_u6, keypairs["u6"], false)
+
+		if err := draft.Merge(party1); err != nil {
+			t.Fatal(err)
+		}
+		if err := draft.Merge(party2); !errors.Is(err, ErrSignatureConflict) {
+			t.Fatal("ErrSignatureConflict must be returned:", err)
+		}
+		if len(draft.Signatures) != 1 {
+			t.Fatal("draft must not be changed by the failed merge")
+		}
+
+		other, _ := NewPartiallySignedTransaction(makeDraftTx(&refTxObj))
+		if err := draft.Merge(other); !errors.Is(err, ErrDraftMismatch) {
+			t.Fatal("ErrDraftMismatch must be returned:", err)
+		}
+	})
+
+	t.Run("malformed signatures", func(t *testing.T) {
+		draft, _ := NewPartiallySignedTransaction(makeDraftTx(&refTxObj))
+		signed := transferDraft(t, draft)
+		if err := signed.Sign(txtest_u1, keypairs["u1"], false); err != nil {
+			t.Fatal(err)
+		}
+		digest := signed.digest
+
+		short := BBcSignature{}
+		short.SetPublicKeyByKeypair(keypairs["u1"])
+		short.SetSignature(&[]byte{1, 2, 3})
+		noPubkey := BBcSignature{}
+		noPubkey.SetPublicKeyInfo(KeyTypeEcdsaP256v1)
+		sigDat := keypairs["u1"].Sign(digest)
+		noPubkey.SetSignature(&sigDat)
+		unknownKeyType := BBcSignature{}
+		unknownKeyType.SetPublicKeyByKeypair(keypairs["u1"])
+		unknownKeyType.SetSignature(&sigDat)
+		unknownKeyType.KeyType = 99
+
+		for name, sig := range map[string]*BBcSignature{"short": &short, "no pubkey": &noPubkey, "unknown key type": &unknownKeyType} {
+			if err := draft.AddSignature(txtest_u1, sig); !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("%s: ErrInvalidSignature must be returned: %v", name, err)
+			}
+			dat, _ := sig.Pack()
+			signed.Signatures[0].Signature = dat
+			if err := draft.Merge(signed); !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("%s: ErrInvalidSignature must be returned by Merge: %v", name, err)
+			}
+			j, _ := signed.Marshal()
+			if _, err := UnmarshalPartiallySignedTransaction(j); !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("%s: malformed JSON must be rejected: %v", name, err)
+			}
+		}
+
+		// signatures put in the draft without UnmarshalPartiallySignedTransaction are checked by Finalize
+		complete := transferDraft(t, draft)
+		for _, u := range []struct {
+			id   []byte
+			name string
+		}{{txtest_u1, "u1"}, {txtest_u2, "u2"}, {txtest_u3, "u3"}, {txtest_u5, "u5"}, {txtest_u6, "u6"}} {
+			if err := complete.Sign(u.id, keypairs[u.name], false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dat, _ := short.Pack()
+		complete.Signatures[0].Signature = dat
+		if _, err := complete.Finalize(publicKeys.Resolve); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatal("ErrInvalidSignature must be returned by Finalize:", err)
+		}
+		complete.Signatures[0].Signature = []byte{1}
+		if _, err := complete.Finalize(publicKeys.Resolve); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatal("ErrInvalidSignature must be returned for broken data:", err)
+		}
+	})
+
+	t.Run("forged signers", func(t *testing.T) {
+		draft, _ := NewPartiallySignedTransaction(makeDraftTx(&refTxObj))
+		for _, u := range []struct {
+			id   []byte
+			name string
+		}{{txtest_u1, "u1"}, {txtest_u2, "u2"}, {txtest_u3, "u3"}, {txtest_u5, "u5"}, {txtest_u6, "u6"}} {
+			if err := draft.Sign(u.id, keypairs[u.name], false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := draft.Finalize(nil); err == nil {
+			t.Fatal("key resolver must be required")
+		}
+
+		// the slot of u1 is signed with the key of u2
+		forged := transferDraft(t, draft)
+		forged.Signatures = forged.Signatures[1:]
+		sig := BBcSignature{Version: 2}
+		sig.SetPublicKeyByKeypair(keypairs["u2"])
+		signature := keypairs["u2"].Sign(forged.digest)
+		sig.SetSignature(&signature)
+		if err := forged.AddSignature(txtest_u1, &sig); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := forged.Finalize(publicKeys.Resolve); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatal("signature with the key of another user must be rejected:", err)
+		}
+
+		// the signature is collected twice for the slot
+		duplicated := transferDraft(t, draft)
+		duplicated.Signatures = append(duplicated.Signatures, forged.Signatures[len(forged.Signatures)-1])
+		j, _ := duplicated.Marshal()
+		if _, err := UnmarshalPartiallySignedTransaction(j); !errors.Is(err, ErrSignatureConflict) {
+			t.Fatal("duplicate signatures for a slot must be rejected:", err)
+		}
+		if _, err := duplicated.Finalize(publicKeys.Resolve); !errors.Is(err, ErrSignatureConflict) {
+			t.Fatal("duplicate signatures for a slot must be rejected by Finalize:", err)
+		}
+
+		// the signer differs from the user of the slot
+		mismatched := transferDraft(t, draft)
+		mismatched.Signatures[0].Signer = txtest_u2
+		j, _ = mismatched.Marshal()
+		if _, err := UnmarshalPartiallySignedTransaction(j); !errors.Is(err, ErrNotSigner) {
+			t.Fatal("signer of another slot must be rejected:", err)
+		}
+		mismatched = transferDraft(t, draft)
+		for i, s := range mismatched.Signatures {
+			if mismatched.Slots[s.Index].Option {
+				mismatched.Signatures[i].Signer = txtest_u5
+			}
+		}
+		j, _ = mismatched.Marshal()
+		if _, err := UnmarshalPartiallySignedTransaction(j); !errors.Is(err, ErrNotSigner) {
+			t.Fatal("signer who is not a candidate must be rejected:", err)
+		}
+	})
+
+	t.Run("unlinked reference", func(t *testing.T) {
+		dat, _ := Serialize(makeDraftTx(&refTxObj), FormatPlain)
+		txobj, _ := Deserialize(dat)
+		if _, err := NewPartiallySignedTransaction(txobj); !errors.Is(err, ErrUnlinkedReference) {
+			t.Fatal("ErrUnlinkedReference must be returned:", err)
+		}
+		txobj.References[0].Add(nil, &refTxObj, -1)
+		if _, err := NewPartiallySignedTransaction(txobj); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,391 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package ownership provides the ownership transfer of unique (non-fungible) items, such as certificates and artworks.
+
+An ownership record is a BBcEvent whose BBcAsset has the item body (Body) in MessagePack format.
+The owner is the user_id of the asset, and is also the only mandatory approver of the event.
+Register creates the first record of an item. Transfer creates a new record for the new owner with a BBcReference to the
+current record, so that the transfer must be signed by the current owner (the mandatory approver of the referred event).
+
+History walks the chain of BBcReference objects back to the registration, and validates that each transfer was approved by the owner of record
+and that the registration was signed by one of the trusted registrars.
+The signatures of the owners and the registrar are verified with their public keys given by bbclib.KeyResolver.
+A record can be transferred only once: the spent outputs given by bbclib.SpentResolver reject the second transfer of a record,
+and CurrentOwner rejects a record which has already been transferred.
+A hash lock of package swap keeping the item body is transparent in the history: the record claiming the lock follows the record
+locked by it. The claim is checked as swap.Validate does (the preimage or the timeout, and the signature of the claimant) at the timestamp
+of the claim transaction.
+*/
+package ownership
+
+import (
+	"bbclib"
+	"bbclib/internal/hashlock"
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// BodyType is the value of Type in the item body
+const BodyType = "bbc1-unique-item"
+
+var (
+	// ErrNotItem is returned when an asset does not have the item body
+	ErrNotItem = errors.New("not a unique item asset")
+	// ErrInvalidTransfer is returned when a transfer in the history is not valid
+	ErrInvalidTransfer = errors.New("invalid ownership transfer")
+	// ErrTransferred is returned by CurrentOwner when the record has already been transferred
+	ErrTransferred = errors.New("ownership record already transferred")
+)
+
+type (
+	// Body is the asset body of an ownership record
+	Body struct {
+		Type     string            `codec:"type"`
+		ItemID   []byte            `codec:"item_id"`
+		Metadata map[string]string `codec:"metadata,omitempty"`
+	}
+
+	// Record is an ownership record of an item, i.e., a BBcEvent in a transaction
+	Record struct {
+		Transaction  *bbclib.BBcTransaction
+		EventIndex   int
+		AssetGroupID []byte
+		ItemID       []byte
+		Owner        []byte
+		Metadata     map[string]string
+	}
+)
+
+// DecodeBody decodes the item body in the asset (ErrNotItem if the asset is not an item)
+func DecodeBody(asset *bbclib.BBcAsset) (*Body, error) {
+	if asset == nil || asset.AssetBodyType != bbclib.AssetBodyTypeMsgpack {
+		return nil, ErrNotItem
+	}
+	var body Body
+	if err := asset.DecodeBody(&body); err != nil || body.Type != BodyType || len(body.ItemID) == 0 {
+		return nil, ErrNotItem
+	}
+	return &body, nil
+}
+
+// GetRecord returns the ownership record in the event of the transaction
+func GetRecord(txobj *bbclib.BBcTransaction, eventIdx int) (*Record, error) {
+	if txobj == nil || eventIdx < 0 || eventIdx >= len(txobj.Events) {
+		return nil, fmt.Errorf("no event (index=%d)", eventIdx)
+	}
+	evt := txobj.Events[eventIdx]
+	body, err := DecodeBody(evt.Asset)
+	if err != nil {
+		return nil, fmt.Errorf("events[%d]: %w", eventIdx, err)
+	}
+	return &Record{
+		Transaction:  txobj,
+		EventIndex:   eventIdx,
+		AssetGroupID: evt.AssetGroupID,
+		ItemID:       body.ItemID,
+		Owner:        evt.Asset.UserID,
+		Metadata:     body.Metadata,
+	}, nil
+}
+
+// FindRecord returns the ownership record of the item in the transaction
+func FindRecord(txobj *bbclib.BBcTransaction, itemID []byte) (*Record, error) {
+	for i := range txobj.Events {
+		if r, err := GetRecord(txobj, i); err == nil && bytes.Equal(r.ItemID, itemID) {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("no record of the item %x", itemID)
+}
+
+// Register returns a builder of the transaction registering the item to the owner
+// If itemID is nil, a random ID is assigned. The registrar is a witness, and must sign the transaction (can be the owner).
+func Register(profile *bbclib.IdLengthProfile, assetGroupID, itemID, owner, registrar []byte, metadata map[string]string) (*bbclib.TransactionBuilder, error) {
+	if len(owner) == 0 || len(registrar) == 0 {
+		return nil, errors.New("owner and registrar must be given")
+	}
+	if itemID == nil {
+		if profile == nil {
+			profile = bbclib.DefaultIdLengthProfile()
+		}
+		itemID = bbclib.GetRandomValue(profile.Config().AssetIdLength)
+	}
+	b := bbclib.NewTransactionBuilder(profile)
+	addRecord(b, assetGroupID, itemID, owner, metadata, false)
+	b.AddWitness(&registrar)
+	return b, b.Err()
+}
+
+// Transfer returns a builder of the transaction transferring the item in the current record to the new owner
+// The current owner must sign the transaction by TransactionBuilder.Sign. If metadata is nil, that of the current record is kept.
+func Transfer(profile *bbclib.IdLengthProfile, current *Record, newOwner []byte, metadata map[string]string) (*bbclib.TransactionBuilder, error) {
+	if current == nil || current.Transaction == nil {
+		return nil, errors.New("current record must be given")
+	}
+	if len(newOwner) == 0 {
+		return nil, errors.New("new owner must be given")
+	}
+	if metadata == nil {
+		metadata = current.Metadata
+	}
+	b := bbclib.NewTransactionBuilder(profile)
+	b.CreateReference(&current.AssetGroupID, current.Transaction, current.EventIndex)
+	addRecord(b, current.AssetGroupID, current.ItemID, newOwner, metadata, true)
+	return b, b.Err()
+}
+
+// addRecord adds the event of the ownership record
+func addRecord(b *bbclib.TransactionBuilder, assetGroupID, itemID, owner []byte, metadata map[string]string, transfer bool) {
+	body := Body{Type: BodyType, ItemID: itemID, Metadata: metadata}
+	b.AddEvent(&assetGroupID, func(e *bbclib.EventBuilder) {
+		if transfer {
+			e.AddReferenceIndex(0)
+		}
+		e.AddMandatoryApprover(&owner).CreateAsset(&owner, nil, &body)
+	})
+}
+
+// History returns the ownership records of the item from the registration to the record in the transaction
+// Each transfer in the history is validated by ValidateTransfer, and the registration must be signed by one of the registrars (trusted user IDs).
+func History(txobj *bbclib.BBcTransaction, itemID []byte, registrars [][]byte, resolve bbclib.TransactionResolver, spent bbclib.SpentResolver,
+	keys bbclib.KeyResolver) ([]*Record, error) {
+	if resolve == nil || spent == nil || keys == nil {
+		return nil, errors.New("resolvers must be given")
+	}
+	record, err := FindRecord(txobj, itemID)
+	if err != nil {
+		return nil, err
+	}
+	history := []*Record{record}
+	visited := map[string]bool{string(txobj.TransactionID): true}
+	for {
+		prev, err := previousRecord(record, resolve, spent, keys)
+		if err != nil {
+			return nil, err
+		}
+		if prev == nil {
+			break
+		}
+		if visited[string(prev.Transaction.TransactionID)] {
+			return nil, fmt.Errorf("%w: loop in the history", ErrInvalidTransfer)
+		}
+		visited[string(prev.Transaction.TransactionID)] = true
+		history = append(history, prev)
+		record = prev
+	}
+
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	if err := validateRegistration(history[0], registrars, keys); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// CurrentOwner returns the owner of the item in the latest transaction after validating the history
+// The record in the latest transaction must not have been spent (ErrTransferred).
+func CurrentOwner(latest *bbclib.BBcTransaction, itemID []byte, registrars [][]byte, resolve bbclib.TransactionResolver, spent bbclib.SpentResolver,
+	keys bbclib.KeyResolver) ([]byte, error) {
+	history, err := History(latest, itemID, registrars, resolve, spent, keys)
+	if err != nil {
+		return nil, err
+	}
+	record := history[len(history)-1]
+	spender, err := spent(record.Transaction.TransactionID, record.EventIndex)
+	if err != nil {
+		return nil, err
+	}
+	if spender != nil {
+		return nil, fmt.Errorf("%w: transaction %x by %x", ErrTransferred, record.Transaction.TransactionID, spender)
+	}
+	return record.Owner, nil
+}
+
+// ValidateTransfer checks the transfer of the item in the transaction, and returns the previous record (nil for the registration)
+// The checks are:
+//   - all signatures in the transaction are valid
+//   - the record refers to the previous record of the same item in the same asset group, and the previous owner has signed with the public key
+//   - the previous record has not been spent by another transaction (given by spent)
+//   - the new owner is the only mandatory approver of the record
+//   - the registration is signed by the witnesses with their public keys, and one of them is a registrar (trusted user IDs)
+func ValidateTransfer(txobj *bbclib.BBcTransaction, itemID []byte, registrars [][]byte, resolve bbclib.TransactionResolver, spent bbclib.SpentResolver,
+	keys bbclib.KeyResolver) (*Record, error) {
+	if resolve == nil || spent == nil || keys == nil {
+		return nil, errors.New("resolvers must be given")
+	}
+	record, err := FindRecord(txobj, itemID)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := previousRecord(record, resolve, spent, keys)
+	if err != nil {
+		return nil, err
+	}
+	if prev == nil {
+		return nil, validateRegistration(record, registrars, keys)
+	}
+	return prev, nil
+}
+
+// previousRecord validates the record and returns the record referred by it (nil if the record is the registration)
+func previousRecord(record *Record, resolve bbclib.TransactionResolver, spent bbclib.SpentResolver, keys bbclib.KeyResolver) (*Record, error) {
+	txobj := record.Transaction
+	context := fmt.Sprintf("transaction %x", txobj.TransactionID)
+	if result, idx := txobj.VerifyAll(); !result {
+		return nil, fmt.Errorf("%w: %s: signatures[%d]: %v", ErrInvalidTransfer, context, idx, bbclib.ErrInvalidSignature)
+	}
+	evt := txobj.Events[record.EventIndex]
+	if len(evt.MandatoryApprovers) != 1 || !bytes.Equal(evt.MandatoryApprovers[0], record.Owner) {
+		return nil, fmt.Errorf("%w: %s: owner must be the only mandatory approver", ErrInvalidTransfer, context)
+	}
+
+	var prev *Record
+	for _, refIdx := range evt.ReferenceIndices {
+		r, err := referredRecord(record, refIdx, resolve, spent, keys)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			continue
+		}
+		if prev != nil {
+			return nil, fmt.Errorf("%w: %s: multiple previous records", ErrInvalidTransfer, context)
+		}
+		prev = r
+	}
+	return prev, nil
+}
+
+// referredRecord returns the record of the same item referred by the reference at the index (nil if the referred event is not the item)
+// If the referred event is a hash lock of package swap keeping the item body, the record locked by it is returned
+// (the lock must be signed by the owner of the locked record, and the transaction must be a valid claim of the lock).
+func referredRecord(record *Record, refIdx int, resolve bbclib.TransactionResolver, spent bbclib.SpentResolver, keys bbclib.KeyResolver) (*Record, error) {
+	txobj := record.Transaction
+	context := fmt.Sprintf("transaction %x", txobj.TransactionID)
+	if refIdx < 0 || refIdx >= len(txobj.References) {
+		return nil, fmt.Errorf("%w: %s: invalid reference index %d", ErrInvalidTransfer, context, refIdx)
+	}
+	ref := txobj.References[refIdx]
+	refTx, err := resolve(ref.TransactionID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: references[%d]: %w", context, refIdx, err)
+	}
+	if refTx == nil || !bytes.Equal(refTx.TransactionID, ref.TransactionID) {
+		return nil, fmt.Errorf("%s: references[%d]: referred transaction not found", context, refIdx)
+	}
+	r, err := GetRecord(refTx, int(ref.EventIndexInRef))
+	var lock *hashlock.Lock
+	if errors.Is(err, ErrNotItem) {
+		r, lock, err = getLock(refTx, int(ref.EventIndexInRef))
+	}
+	if err != nil || !bytes.Equal(r.ItemID, record.ItemID) {
+		return nil, nil
+	}
+	if !bytes.Equal(ref.AssetGroupID, r.AssetGroupID) || !bytes.Equal(r.AssetGroupID, record.AssetGroupID) {
+		return nil, fmt.Errorf("%w: %s: asset_group_id differs from the previous record", ErrInvalidTransfer, context)
+	}
+	if lock == nil {
+		if len(ref.SigIndices) == 0 {
+			return nil, fmt.Errorf("%w: %s: not approved by the owner of record %x", ErrInvalidTransfer, context, r.Owner)
+		}
+		if err := txobj.VerifySignedBy(ref.SigIndices[0], r.Owner, keys); err != nil {
+			return nil, fmt.Errorf("%w: %s: not approved by the owner of record %x: %v", ErrInvalidTransfer, context, r.Owner, err)
+		}
+	}
+	spender, err := spent(refTx.TransactionID, r.EventIndex)
+	if err != nil {
+		return nil, fmt.Errorf("%s: references[%d]: %w", context, refIdx, err)
+	}
+	if spender != nil && !bytes.Equal(spender, txobj.TransactionID) {
+		return nil, fmt.Errorf("%w: %s: previous record has been transferred by transaction %x", ErrInvalidTransfer, context, spender)
+	}
+	if lock == nil {
+		return r, nil
+	}
+
+	if v := hashlock.ClaimViolations(txobj, refIdx, lock, keys, txobj.Timestamp); len(v) > 0 {
+		return nil, fmt.Errorf("%w: %s: invalid claim of the lock: %v", ErrInvalidTransfer, context, &bbclib.ValidationError{Violations: v})
+	}
+	context = fmt.Sprintf("lock %x", refTx.TransactionID)
+	if result, idx := refTx.VerifyAll(); !result {
+		return nil, fmt.Errorf("%w: %s: signatures[%d]: %v", ErrInvalidTransfer, context, idx, bbclib.ErrInvalidSignature)
+	}
+	if indices := refTx.Events[r.EventIndex].ReferenceIndices; len(indices) == 1 {
+		locked, err := referredRecord(r, indices[0], resolve, spent, keys)
+		if err != nil {
+			return nil, err
+		}
+		if locked != nil && bytes.Equal(locked.Owner, lock.Body.Sender) {
+			return locked, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s: lock must refer to the record of the sender", ErrInvalidTransfer, context)
+}
+
+// getLock returns the hash lock in the event of the transaction as a record owned by the sender (ErrNotItem if the event is not a lock of an item)
+func getLock(txobj *bbclib.BBcTransaction, eventIdx int) (*Record, *hashlock.Lock, error) {
+	lock, err := hashlock.GetLock(txobj, eventIdx)
+	if errors.Is(err, hashlock.ErrNotLock) {
+		return nil, nil, ErrNotItem
+	} else if err != nil {
+		return nil, nil, err
+	}
+	body, err := DecodeBody(lock.LockedAsset())
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Record{
+		Transaction:  txobj,
+		EventIndex:   eventIdx,
+		AssetGroupID: lock.AssetGroupID,
+		ItemID:       body.ItemID,
+		Owner:        lock.Body.Sender,
+		Metadata:     body.Metadata,
+	}, lock, nil
+}
+
+// validateRegistration checks the record of the registration (signed by the witnesses with their public keys, including a registrar)
+func validateRegistration(record *Record, registrars [][]byte, keys bbclib.KeyResolver) error {
+	txobj := record.Transaction
+	if txobj.Witness == nil || len(txobj.Witness.SigIndices) == 0 || len(txobj.Witness.UserIDs) != len(txobj.Witness.SigIndices) {
+		return fmt.Errorf("%w: registration must be signed by the registrar", ErrInvalidTransfer)
+	}
+	registered := false
+	for i, idx := range txobj.Witness.SigIndices {
+		if err := txobj.VerifySignedBy(idx, txobj.Witness.UserIDs[i], keys); err != nil {
+			return fmt.Errorf("%w: registration must be signed by the registrar %x: %v", ErrInvalidTransfer, txobj.Witness.UserIDs[i], err)
+		}
+		registered = registered || isRegistrar(txobj.Witness.UserIDs[i], registrars)
+	}
+	if !registered {
+		return fmt.Errorf("%w: registration is not signed by a trusted registrar", ErrInvalidTransfer)
+	}
+	return nil
+}
+
+// isRegistrar returns true if the user is one of the registrars
+func isRegistrar(userID []byte, registrars [][]byte) bool {
+	for _, r := range registrars {
+		if bytes.Equal(r, userID) {
+			return true
+		}
+	}
+	return false
+}
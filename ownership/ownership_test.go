@@ -0,0 +1,315 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ownership
+
+import (
+	"bbclib"
+	"bbclib/internal/hashlock"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+var (
+	registrar = bbclib.GetIdentifier("registrar", 32)
+	alice     = bbclib.GetIdentifier("alice", 32)
+	bob       = bbclib.GetIdentifier("bob", 32)
+	carol     = bbclib.GetIdentifier("carol", 32)
+	itemGroup = bbclib.GetIdentifier("certificates", 32)
+	itemID    = bbclib.GetIdentifier("certificate #1", 32)
+)
+
+func TestOwnership(t *testing.T) {
+	keys := make(map[string]*bbclib.KeyPair)
+	for _, uid := range [][]byte{registrar, alice, bob, carol} {
+		keys[string(uid)], _ = bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	}
+	build := func(b *bbclib.TransactionBuilder, err error, signer []byte) *bbclib.BBcTransaction {
+		if err != nil {
+			t.Fatal(err)
+		}
+		txobj, err := b.Sign(&signer, keys[string(signer)], false).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return txobj
+	}
+	publicKeys := make(bbclib.PublicKeyMap)
+	for uid, keypair := range keys {
+		publicKeys.Add([]byte(uid), keypair.Pubkey)
+	}
+	publicKey := publicKeys.Resolve
+	registrars := [][]byte{registrar}
+	store := make(bbclib.TransactionMap)
+	spent := make(bbclib.SpentMap)
+	add := func(txobj *bbclib.BBcTransaction) *bbclib.BBcTransaction {
+		return spent.Add(store.Add(txobj))
+	}
+
+	b, err := Register(nil, itemGroup, itemID, alice, registrar, map[string]string{"title": "diploma"})
+	regTx := add(build(b, err, registrar))
+	r0, _ := FindRecord(regTx, itemID)
+	b, err = Transfer(nil, r0, bob, nil)
+	tx1 := add(build(b, err, alice))
+	r1, _ := FindRecord(tx1, itemID)
+	b, err = Transfer(nil, r1, carol, map[string]string{"title": "diploma", "note": "resold"})
+	tx2 := add(build(b, err, bob))
+
+	t.Run("history and current owner", func(t *testing.T) {
+		history, err := History(tx2, itemID, registrars, store.Resolve, spent.Resolve, publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 3 {
+			t.Fatalf("invalid history: %d", len(history))
+		}
+		for i, owner := range [][]byte{alice, bob, carol} {
+			if !bytes.Equal(history[i].Owner, owner) || !bytes.Equal(history[i].ItemID, itemID) {
+				t.Fatalf("invalid record %d", i)
+			}
+		}
+		if history[1].Metadata["title"] != "diploma" || history[2].Metadata["note"] != "resold" {
+			t.Fatal("invalid metadata")
+		}
+		owner, err := CurrentOwner(tx2, itemID, registrars, store.Resolve, spent.Resolve, publicKey)
+		if err != nil || !bytes.Equal(owner, carol) {
+			t.Fatalf("invalid current owner: %v", err)
+		}
+		prev, err := ValidateTransfer(tx2, itemID, registrars, store.Resolve, spent.Resolve, publicKey)
+		if err != nil || !bytes.Equal(prev.Transaction.TransactionID, tx1.TransactionID) {
+			t.Fatalf("invalid previous record: %v", err)
+		}
+		if prev, err := ValidateTransfer(regTx, itemID, registrars, store.Resolve, spent.Resolve, publicKey); err != nil || prev != nil {
+			t.Fatalf("registration must have no previous record: %v", err)
+		}
+	})
+
+	t.Run("schema of the item body", func(t *testing.T) {
+		registry := bbclib.NewSchemaRegistry()
+		err := registry.Register(itemGroup, []byte(`{
+		  "type": "object", "required": ["type", "item_id"],
+		  "properties": {
+		    "type": {"const": "bbc1-unique-item"},
+		    "item_id": {"type": "string", "contentEncoding": "base64"},
+		    "metadata": {"type": "object", "additionalProperties": {"type": "string"}}
+		  }
+		}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, txobj := range []*bbclib.BBcTransaction{regTx, tx1, tx2} {
+			if err := registry.Validate(txobj); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("random item id", func(t *testing.T) {
+		b, err := Register(nil, itemGroup, nil, alice, alice, nil)
+		txobj := build(b, err, alice)
+		r, err := GetRecord(txobj, 0)
+		if err != nil || len(r.ItemID) != 32 {
+			t.Fatalf("item id must be assigned: %v", err)
+		}
+	})
+
+	t.Run("transfer not approved by the owner", func(t *testing.T) {
+		// carol tries to transfer bob's record
+		b, err := Transfer(nil, r1, carol, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		draft, err := b.Sign(&carol, keys[string(carol)], false).BuildDraft()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := History(draft, itemID, registrars, store.Resolve, spent.Resolve, publicKey); !errors.Is(err, ErrInvalidTransfer) {
+			t.Fatalf("transfer without approval must be rejected: %v", err)
+		}
+
+		// the signature of the owner is tampered
+		forged := tx2.Clone()
+		forged.Signatures[0].Signature[0] ^= 0xff
+		if _, err := ValidateTransfer(forged, itemID, registrars, store.Resolve, spent.Resolve, publicKey); !errors.Is(err, ErrInvalidTransfer) {
+			t.Fatalf("invalid signature must be rejected: %v", err)
+		}
+	})
+
+	t.Run("forged signers", func(t *testing.T) {
+		mallory, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+
+		// mallory signs the transfer of carol's record in the name of carol
+		r2, _ := FindRecord(tx2, itemID)
+		b, err := Transfer(nil, r2, alice, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forged, err := b.Sign(&carol, mallory, false).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ValidateTransfer(forged, itemID, registrars, store.Resolve, spent.Resolve, publicKey); !errors.Is(err, ErrInvalidTransfer) {
+			t.Fatalf("transfer signed with a wrong key must be rejected: %v", err)
+		}
+		if _, err := History(forged, itemID, registrars, store.Resolve, spent.Resolve, publicKey); !errors.Is(err, ErrInvalidTransfer) {
+			t.Fatalf("transfer signed with a wrong key must be rejected in the history: %v", err)
+		}
+
+		// mallory registers an item in the name of the registrar
+		otherItem := bbclib.GetIdentifier("certificate #2", 32)
+		b, err = Register(nil, itemGroup, otherItem, alice, registrar, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fakeReg, err := b.Sign(&registrar, mallory, false).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ValidateTransfer(fakeReg, otherItem, registrars, store.Resolve, spent.Resolve, publicKey); !errors.Is(err, ErrInvalidTransfer) {
+			t.Fatalf("registration signed with a wrong key must be rejected: %v", err)
+		}
+
+		// the signature without public key is not accepted
+		b, err = Register(nil, itemGroup, otherItem, alice, registrar, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		noPubkey, err := b.Sign(&registrar, keys[string(registrar)], true).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ValidateTransfer(noPubkey, otherItem, registrars, store.Resolve, spent.Resolve, publicKey); !errors.Is(err, ErrInvalidTransfer) {
+			t.Fatalf("signature without public key must be rejected: %v", err)
+		}
+		unknownKey := func(uid []byte) ([]byte, error) { return nil, errors.New("unknown user") }
+		if _, err := History(tx2, itemID, registrars, store.Resolve, spent.Resolve, unknownKey); !errors.Is(err, ErrInvalidTransfer) {
+			t.Fatalf("signer without public key must be rejected: %v", err)
+		}
+	})
+
+	t.Run("registration not signed by a registrar", func(t *testing.T) {
+		// alice registers an item by herself with her own key, and transfers it to bob
+		otherItem := bbclib.GetIdentifier("certificate #3", 32)
+		b, err := Register(nil, itemGroup, otherItem, alice, alice, nil)
+		selfReg := add(build(b, err, alice))
+		if _, err := ValidateTransfer(selfReg, otherItem, registrars, store.Resolve, spent.Resolve, publicKey); !errors.Is(err, ErrInvalidTransfer) {
+			t.Fatalf("registration by an untrusted user must be rejected: %v", err)
+		}
+		r, _ := FindRecord(selfReg, otherItem)
+		b, err = Transfer(nil, r, bob, nil)
+		txobj := build(b, err, alice)
+		if _, err := CurrentOwner(txobj, otherItem, registrars, store.Resolve, spent.Resolve, publicKey); !errors.Is(err, ErrInvalidTransfer) {
+			t.Fatalf("history from an untrusted registration must be rejected: %v", err)
+		}
+		if _, err := History(tx2, itemID, nil, store.Resolve, spent.Resolve, publicKey); !errors.Is(err, ErrInvalidTransfer) {
+			t.Fatalf("registration must be rejected without registrars: %v", err)
+		}
+		if owner, err := CurrentOwner(txobj, otherItem, [][]byte{alice}, store.Resolve, spent.Resolve, publicKey); err != nil || !bytes.Equal(owner, bob) {
+			t.Fatalf("registration by a trusted registrar must be accepted: %v", err)
+		}
+	})
+
+	t.Run("double transfer", func(t *testing.T) {
+		// bob transfers the record, which he has already transferred to carol, to alice
+		b, err := Transfer(nil, r1, alice, nil)
+		double := build(b, err, bob)
+		if _, err := ValidateTransfer(double, itemID, registrars, store.Resolve, spent.Resolve, publicKey); !errors.Is(err, ErrInvalidTransfer) {
+			t.Fatalf("second transfer of a record must be rejected: %v", err)
+		}
+		if _, err := CurrentOwner(double, itemID, registrars, store.Resolve, spent.Resolve, publicKey); !errors.Is(err, ErrInvalidTransfer) {
+			t.Fatalf("history with the second transfer of a record must be rejected: %v", err)
+		}
+
+		// the record of bob is not current any more
+		if _, err := History(tx1, itemID, registrars, store.Resolve, spent.Resolve, publicKey); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := CurrentOwner(tx1, itemID, registrars, store.Resolve, spent.Resolve, publicKey); !errors.Is(err, ErrTransferred) {
+			t.Fatalf("transferred record must not be current: %v", err)
+		}
+	})
+
+	t.Run("unknown history", func(t *testing.T) {
+		if _, err := History(tx2, itemID, registrars, make(bbclib.TransactionMap).Resolve, spent.Resolve, publicKey); err == nil {
+			t.Fatal("unknown previous record must be rejected")
+		}
+		if _, err := History(tx2, bbclib.GetIdentifier("other item", 32), registrars, store.Resolve, spent.Resolve, publicKey); err == nil {
+			t.Fatal("unknown item must be rejected")
+		}
+	})
+
+	t.Run("hash lock", func(t *testing.T) {
+		// carol locks her record for alice (see package swap)
+		r2, _ := FindRecord(tx2, itemID)
+		preimage := []byte("preimage")
+		hash := sha256.Sum256(preimage)
+		timeout := int64(1000000)
+		body := hashlock.LockBody{Type: hashlock.LockBodyType, HashLock: hash[:], Sender: carol, Recipient: alice, Timeout: timeout,
+			AssetBodyType: tx2.Events[0].Asset.AssetBodyType, AssetBody: tx2.Events[0].Asset.AssetBody}
+		b := bbclib.NewTransactionBuilder(nil).SetTimestamp(timeout-100).CreateReference(&itemGroup, tx2, 0).
+			AddEvent(&itemGroup, func(e *bbclib.EventBuilder) { e.AddReferenceIndex(0).CreateAsset(&carol, nil, &body) }).
+			AddWitness(&carol)
+		lockTx := add(build(b, nil, carol))
+		lock, _, err := getLock(lockTx, 0)
+		if err != nil || !bytes.Equal(lock.ItemID, itemID) || !bytes.Equal(lock.Owner, carol) {
+			t.Fatalf("lock must keep the item body: %v", err)
+		}
+		claim := func(claimant, preimage []byte, timestamp int64) *bbclib.BBcTransaction {
+			lockTxID, lockAssetID := lockTx.TransactionID, lockTx.Events[0].Asset.AssetID
+			b := bbclib.NewTransactionBuilder(nil).SetTimestamp(timestamp).CreateReference(&itemGroup, lockTx, 0).
+				AddEvent(&itemGroup, func(e *bbclib.EventBuilder) {
+					e.AddReferenceIndex(0).AddMandatoryApprover(&claimant).CreateAsset(&claimant, nil, append([]byte{}, body.AssetBody...))
+					e.Event().Asset.AssetBodyType = body.AssetBodyType
+				}).
+				AddRelation(&itemGroup, func(r *bbclib.RelationBuilder) {
+					r.CreatePointer(&lockTxID, &lockAssetID).CreateAsset(&claimant, nil, &hashlock.ClaimBody{Type: hashlock.ClaimBodyType, Preimage: preimage})
+				}).
+				AddWitness(&claimant)
+			return build(b, nil, claimant)
+		}
+
+		for _, tc := range []struct {
+			name     string
+			claimTx  *bbclib.BBcTransaction
+			accepted bool
+		}{
+			{"release by another user", claim(bob, preimage, timeout-1), false},
+			{"release without the preimage", claim(alice, nil, timeout-1), false},
+			{"release with a wrong preimage", claim(alice, []byte("wrong"), timeout-1), false},
+			{"release after the timeout", claim(alice, preimage, timeout), false},
+			{"refund before the timeout", claim(carol, nil, timeout-1), false},
+			{"refund after the timeout", claim(carol, nil, timeout), true},
+		} {
+			_, err := History(tc.claimTx, itemID, registrars, store.Resolve, spent.Resolve, publicKey)
+			if tc.accepted && err != nil {
+				t.Fatalf("%s must be accepted: %v", tc.name, err)
+			} else if !tc.accepted && !errors.Is(err, ErrInvalidTransfer) {
+				t.Fatalf("%s must be rejected: %v", tc.name, err)
+			}
+		}
+
+		release := add(claim(alice, preimage, timeout-1))
+		history, err := History(release, itemID, registrars, store.Resolve, spent.Resolve, publicKey)
+		if err != nil || len(history) != 4 || history[2].Transaction != r2.Transaction {
+			t.Fatalf("history must follow the lock: %v", err)
+		}
+		if owner, err := CurrentOwner(release, itemID, registrars, store.Resolve, spent.Resolve, publicKey); err != nil || !bytes.Equal(owner, alice) {
+			t.Fatalf("record claiming the lock must be current: %v", err)
+		}
+	})
+}
@@ -65,16 +65,24 @@ func (p *BBcPointer) Add(txid *[]byte, asid *[]byte) {
 func (p *BBcPointer) Pack() ([]byte, error) {
 	buf := new(bytes.Buffer)
 
-	PutBigInt(buf, &p.TransactionID, p.IdLengthConf.TransactionIdLength)
+	if err := PutBigInt(buf, &p.TransactionID, p.IdLengthConf.TransactionIdLength); err != nil {
+		return nil, err
+	}
 
 	if p.AssetID != nil {
-		Put2byte(buf, 1)
+		if err := Put2byte(buf, 1); err != nil {
+			return nil, err
+		}
 	} else {
-		Put2byte(buf, 0)
+		if err := Put2byte(buf, 0); err != nil {
+			return nil, err
+		}
 		return buf.Bytes(), nil
 	}
 
-	PutBigInt(buf, &p.AssetID, p.IdLengthConf.AssetIdLength)
+	if err := PutBigInt(buf, &p.AssetID, p.IdLengthConf.AssetIdLength); err != nil {
+		return nil, err
+	}
 
 	return buf.Bytes(), nil
 }
@@ -86,24 +94,49 @@ func (p *BBcPointer) Unpack(dat *[]byte) error {
 	}
 
 	var err error
-	buf := bytes.NewBuffer(*dat)
+	d := newDecoder(*dat)
 
-	p.TransactionID, p.IdLengthConf.TransactionIdLength, err = GetBigInt(buf)
+	p.TransactionID, p.IdLengthConf.TransactionIdLength, err = d.getBigInt("transaction_id")
 	if err != nil {
 		return err
 	}
 
-	if val, err := Get2byte(buf); err != nil {
+	if val, err := d.get2byte("asset_id"); err != nil {
 		return err
 	} else if val == 0 {
 		p.AssetID = nil
 		return nil
 	}
 
-	p.AssetID, p.IdLengthConf.AssetIdLength, err = GetBigInt(buf)
+	p.AssetID, p.IdLengthConf.AssetIdLength, err = d.getBigInt("asset_id")
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// Clone returns a deep copy of the BBcPointer object
+func (p *BBcPointer) Clone() *BBcPointer {
+	return p.clone(newCloneContext())
+}
+
+// clone returns a deep copy of the BBcPointer object, sharing the ID length configuration in the cloneContext
+func (p *BBcPointer) clone(c *cloneContext) *BBcPointer {
+	if p == nil {
+		return nil
+	}
+	return &BBcPointer{
+		IdLengthConf:  c.conf(p.IdLengthConf),
+		TransactionID: cloneBytes(p.TransactionID),
+		AssetID:       cloneBytes(p.AssetID),
+	}
+}
+
+// Equal returns true if the BBcPointer objects have the same content to be packed
+func (p *BBcPointer) Equal(q *BBcPointer) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	return bytes.Equal(p.TransactionID, q.TransactionID) && bytes.Equal(p.AssetID, q.AssetID)
+}
@@ -0,0 +1,193 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"bbclib"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Result is the evaluation result of a clause
+// Approved is the number of satisfied children (1 or 0 for a user clause), and Required is the number needed to satisfy the clause.
+// For a threshold clause, Approved is at most the number of distinct users approving in the satisfied children.
+type Result struct {
+	Clause    *Clause
+	Satisfied bool
+	Approved  int
+	Required  int
+	Children  []*Result
+}
+
+// EvaluateUsers evaluates the policy with the users who have approved
+func (p *Policy) EvaluateUsers(approved [][]byte) *Result {
+	return evaluate(p.Root, approved)
+}
+
+// Evaluate evaluates the policy with the signatures in the transaction
+// The public keys of the users in the policy are given by keys (looked up by user_id). A user has approved if a valid signature
+// in the transaction is made with the public key (for a signature without public key, it is verified with the public key).
+func (p *Policy) Evaluate(txobj *bbclib.BBcTransaction, keys bbclib.KeyResolver) (*Result, error) {
+	approved, err := p.ApprovedUsers(txobj, keys)
+	if err != nil {
+		return nil, err
+	}
+	return p.EvaluateUsers(approved), nil
+}
+
+// ApprovedUsers returns the users in the policy who have signed the transaction
+// A user whose public key is not given by keys has not approved.
+func (p *Policy) ApprovedUsers(txobj *bbclib.BBcTransaction, keys bbclib.KeyResolver) ([][]byte, error) {
+	if txobj == nil {
+		return nil, errors.New("transaction must be given")
+	}
+	if keys == nil {
+		return nil, errors.New("key resolver must be given")
+	}
+	if result, idx := txobj.VerifyAll(); !result {
+		return nil, fmt.Errorf("signatures[%d]: %w", idx, bbclib.ErrInvalidSignature)
+	}
+	digest := txobj.Digest()
+	var approved [][]byte
+	for _, u := range p.Users() {
+		pubkey, err := keys(u.UserID)
+		if err != nil || len(pubkey) == 0 {
+			continue
+		}
+		for _, sig := range txobj.Signatures {
+			if sig == nil || sig.KeyType == bbclib.KeyTypeNotInitialized {
+				continue
+			}
+			if (len(sig.Pubkey) > 0 && bytes.Equal(sig.Pubkey, pubkey) && bbclib.VerifyBBcSignature(digest, sig)) ||
+				(len(sig.Pubkey) == 0 && sig.Clone().VerifyWithPublicKey(digest, pubkey)) {
+				approved = append(approved, u.UserID)
+				break
+			}
+		}
+	}
+	return approved, nil
+}
+
+// evaluate evaluates the clause with the approved users
+func evaluate(c *Clause, approved [][]byte) *Result {
+	r, _ := evaluateClause(c, approved)
+	return r
+}
+
+// evaluateClause evaluates the clause, and returns the approved users in its satisfied subtree (by user_id)
+// A user appearing more than once in the children of a clause is counted once, and a threshold clause needs as many
+// distinct approved users in its satisfied children as its threshold (a user nested in several children is counted once).
+func evaluateClause(c *Clause, approved [][]byte) (*Result, map[string]bool) {
+	r := Result{Clause: c}
+	users := make(map[string]bool)
+	if c.Kind == KindUser {
+		r.Required = 1
+		for _, id := range approved {
+			if bytes.Equal(id, c.UserID) {
+				r.Approved = 1
+				users[string(c.UserID)] = true
+			}
+		}
+		r.Satisfied = r.Approved == 1
+		return &r, users
+	}
+
+	distinct := 0
+	seen := make(map[string]bool)
+	for _, child := range c.Children {
+		cr, childUsers := evaluateClause(child, approved)
+		r.Children = append(r.Children, cr)
+		if child.Kind == KindUser {
+			if seen[string(child.UserID)] {
+				continue
+			}
+			seen[string(child.UserID)] = true
+		}
+		distinct++
+		if cr.Satisfied {
+			r.Approved++
+			for id := range childUsers {
+				users[id] = true
+			}
+		}
+	}
+	switch c.Kind {
+	case KindAnd:
+		r.Required = distinct
+	case KindOr:
+		r.Required = 1
+	case KindThreshold:
+		r.Required = c.Threshold
+		if len(users) < r.Approved {
+			r.Approved = len(users)
+		}
+	}
+	r.Satisfied = r.Approved >= r.Required
+	return &r, users
+}
+
+// Missing returns the names of the users who have not approved in the unsatisfied clauses
+// (for "or" and threshold clauses, any of them can satisfy the clause)
+func (r *Result) Missing() []string {
+	if r.Satisfied {
+		return nil
+	}
+	if r.Clause.Kind == KindUser {
+		return []string{r.Clause.Name}
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, cr := range r.Children {
+		for _, name := range cr.Missing() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// Explain returns the evaluation result of each clause in a human-readable tree
+func (r *Result) Explain() string {
+	var sb strings.Builder
+	r.explain(&sb, 0)
+	return sb.String()
+}
+
+// explain writes the result of the clause and its children
+func (r *Result) explain(sb *strings.Builder, depth int) {
+	status := "satisfied"
+	if !r.Satisfied {
+		status = "missing"
+	}
+	fmt.Fprintf(sb, "%s[%s] %s", strings.Repeat("  ", depth), status, r.Clause)
+	if r.Clause.Kind != KindUser {
+		fmt.Fprintf(sb, " (%d of %d required)", r.Approved, r.Required)
+	}
+	if !r.Satisfied {
+		if names := r.Missing(); len(names) > 0 && r.Clause.Kind != KindUser {
+			fmt.Fprintf(sb, " needs: %s", strings.Join(names, ", "))
+		}
+	}
+	sb.WriteString("\n")
+	for _, cr := range r.Children {
+		cr.explain(sb, depth+1)
+	}
+}
@@ -0,0 +1,275 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SyntaxError is returned by Parse when the policy text is invalid
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+// Error returns the error message with the offset
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("policy syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// token is a lexical token of the policy language
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenNumber
+	tokenAnd
+	tokenOr
+	tokenOf
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+// lex splits the policy text into tokens
+func lex(text string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(text); {
+		c := rune(text[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+		case isNameChar(c):
+			start := i
+			for i < len(text) && isNameChar(rune(text[i])) {
+				i++
+			}
+			word := text[start:i]
+			kind := tokenName
+			switch {
+			case word == "and":
+				kind = tokenAnd
+			case word == "or":
+				kind = tokenOr
+			case word == "of":
+				kind = tokenOf
+			case isNumber(word):
+				kind = tokenNumber
+			}
+			tokens = append(tokens, token{kind, word, start})
+		default:
+			return nil, &SyntaxError{Offset: i, Msg: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(text)}), nil
+}
+
+// isNameChar returns true if the character can be used in a name
+func isNameChar(c rune) bool {
+	return c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '-' || c == '.')
+}
+
+// isNumber returns true if the word consists of digits only
+func isNumber(word string) bool {
+	for _, c := range word {
+		if !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// parser is a recursive descent parser of the policy language
+type parser struct {
+	tokens []token
+	pos    int
+	users  map[string][]byte
+}
+
+// peek returns the current token
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// next returns the current token and advances the position
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// expect consumes the token of the kind
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.unexpected(t, what)
+	}
+	return t, nil
+}
+
+// unexpected returns the syntax error for the token
+func (p *parser) unexpected(t token, expected string) error {
+	if t.kind == tokenEOF {
+		return &SyntaxError{Offset: t.offset, Msg: fmt.Sprintf("unexpected end of policy (expected %s)", expected)}
+	}
+	return &SyntaxError{Offset: t.offset, Msg: fmt.Sprintf("unexpected %q (expected %s)", t.text, expected)}
+}
+
+// parseOr parses: and-clause ("or" and-clause)*
+func (p *parser) parseOr() (*Clause, error) {
+	c, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	clauses := []*Clause{c}
+	for p.peek().kind == tokenOr {
+		p.next()
+		c, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, c)
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	return &Clause{Kind: KindOr, Children: clauses}, nil
+}
+
+// parseAnd parses: term ("and" term)*
+func (p *parser) parseAnd() (*Clause, error) {
+	c, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	clauses := []*Clause{c}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		offset := p.peek().offset
+		c, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkDuplicate(clauses, c, offset); err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, c)
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	return &Clause{Kind: KindAnd, Children: clauses}, nil
+}
+
+// parseTerm parses: "(" or-clause ")" | NUMBER "of" "(" or-clause ("," or-clause)* ")" | NAME
+func (p *parser) parseTerm() (*Clause, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenLParen:
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRParen, "\")\""); err != nil {
+			return nil, err
+		}
+		return c, nil
+
+	case tokenNumber:
+		threshold, err := strconv.Atoi(t.text)
+		if err != nil {
+			return nil, &SyntaxError{Offset: t.offset, Msg: fmt.Sprintf("invalid number %q", t.text)}
+		}
+		if _, err := p.expect(tokenOf, "\"of\""); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenLParen, "\"(\""); err != nil {
+			return nil, err
+		}
+		var children []*Clause
+		for {
+			offset := p.peek().offset
+			c, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := checkDuplicate(children, c, offset); err != nil {
+				return nil, err
+			}
+			children = append(children, c)
+			sep := p.next()
+			if sep.kind == tokenRParen {
+				break
+			}
+			if sep.kind != tokenComma {
+				return nil, p.unexpected(sep, "\",\" or \")\"")
+			}
+		}
+		if threshold < 1 || threshold > len(children) {
+			return nil, &SyntaxError{Offset: t.offset, Msg: fmt.Sprintf("threshold %d out of range (1-%d)", threshold, len(children))}
+		}
+		return &Clause{Kind: KindThreshold, Threshold: threshold, Children: children}, nil
+
+	case tokenName:
+		if id, ok := p.users[t.text]; ok {
+			return &Clause{Kind: KindUser, Name: t.text, UserID: append([]byte{}, id...)}, nil
+		}
+		if strings.HasPrefix(t.text, "0x") {
+			if id, err := hex.DecodeString(t.text[2:]); err == nil && len(id) > 0 {
+				return &Clause{Kind: KindUser, Name: t.text, UserID: id}, nil
+			}
+		}
+		return nil, &SyntaxError{Offset: t.offset, Msg: fmt.Sprintf("unknown user %q", t.text)}
+	}
+	return nil, p.unexpected(t, "user, threshold or \"(\"")
+}
+
+// checkDuplicate returns a syntax error if the clause is a user already in the clauses (compared by user_id)
+func checkDuplicate(clauses []*Clause, c *Clause, offset int) error {
+	if c.Kind != KindUser {
+		return nil
+	}
+	for _, other := range clauses {
+		if other.Kind == KindUser && bytes.Equal(other.UserID, c.UserID) {
+			return &SyntaxError{Offset: offset, Msg: fmt.Sprintf("duplicate user %q (same as %q)", c.Name, other.Name)}
+		}
+	}
+	return nil
+}
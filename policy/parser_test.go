@@ -0,0 +1,92 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"bbclib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var users = map[string][]byte{
+	"owner":    bbclib.GetIdentifier("owner", 32),
+	"auditor1": bbclib.GetIdentifier("auditor1", 32),
+	"auditor2": bbclib.GetIdentifier("auditor2", 32),
+	"auditor3": bbclib.GetIdentifier("auditor3", 32),
+	"legal":    bbclib.GetIdentifier("legal", 32),
+}
+
+func TestParse(t *testing.T) {
+	t.Run("normalized text", func(t *testing.T) {
+		cases := map[string]string{
+			"owner and 2 of (auditor1, auditor2, auditor3) or legal": "owner and 2 of (auditor1, auditor2, auditor3) or legal",
+			"owner and (auditor1 or legal)":                          "owner and (auditor1 or legal)",
+			"((owner))":                                              "owner",
+			"1 of (owner and legal, auditor1)":                       "1 of (owner and legal, auditor1)",
+			"0x0102 or owner":                                        "0x0102 or owner",
+		}
+		for text, expected := range cases {
+			p, err := Parse(text, users)
+			if err != nil {
+				t.Fatalf("%s: %v", text, err)
+			}
+			if p.String() != expected {
+				t.Fatalf("%s: invalid normalized text %s", text, p.String())
+			}
+			if p2, err := Parse(p.String(), users); err != nil || p2.String() != expected {
+				t.Fatalf("%s: normalized text must be parsed again: %v", text, err)
+			}
+		}
+	})
+
+	t.Run("precedence", func(t *testing.T) {
+		p := MustParse("owner and auditor1 or legal", users)
+		if p.Root.Kind != KindOr || p.Root.Children[0].Kind != KindAnd || len(p.Users()) != 3 {
+			t.Fatal("\"and\" must bind tighter than \"or\"")
+		}
+	})
+
+	t.Run("syntax errors", func(t *testing.T) {
+		for _, text := range []string{"", "owner and", "unknown", "4 of (auditor1, auditor2, auditor3)", "0 of (owner)",
+			"2 of owner", "(owner", "owner legal", "owner & legal", "2 of (owner legal)", "0xzz"} {
+			_, err := Parse(text, users)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("%q: syntax error must be returned: %v", text, err)
+			}
+		}
+	})
+
+	t.Run("duplicate users", func(t *testing.T) {
+		owner := fmt.Sprintf("0x%x", users["owner"])
+		for _, text := range []string{"2 of (auditor1, auditor1, auditor2)", "owner and owner", "owner and " + owner,
+			"1 of (" + owner + ", legal, owner)", "(owner) and legal and (owner)"} {
+			_, err := Parse(text, users)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) || !strings.Contains(err.Error(), "duplicate user") {
+				t.Fatalf("%q: duplicate user must be rejected: %v", text, err)
+			}
+		}
+		for _, text := range []string{"owner or owner", "owner and (owner or legal)"} {
+			if _, err := Parse(text, users); err != nil {
+				t.Fatalf("%q: %v", text, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,263 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package policy provides a declarative approval policy language and its engine for BBcEvent.
+
+A policy is a boolean combination of users who must approve (sign) a transaction spending the event:
+
+		owner and 2 of (auditor1, auditor2, auditor3) or legal
+
+	  - a user is a name bound to a user_id (given to Parse), or a user_id in hex with "0x" prefix
+	  - "A and B" requires both, "A or B" requires either ("and" binds tighter than "or")
+	  - "N of (A, B, ...)" requires N of the listed clauses
+	  - parentheses group clauses
+	  - a user must not appear twice in the same "and" or "N of" clause (compared by user_id, e.g. a name and its hex)
+
+A BBcEvent can express a policy of the form "mandatory approvers and (optionally) N of option approvers".
+Apply sets such a policy to a BBcEvent, and returns ErrNotExpressible for the other policies,
+which must be enforced off-chain by Evaluate.
+
+Evaluate checks a signed spending transaction against the policy, and the Result explains which clauses are satisfied or missing.
+*/
+package policy
+
+import (
+	"bbclib"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotExpressible is returned by Apply when the policy cannot be expressed by the approvers of BBcEvent
+var ErrNotExpressible = errors.New("policy cannot be expressed by BBcEvent approvers")
+
+// Kind is the kind of a clause
+type Kind int
+
+// Kinds of clause
+const (
+	KindUser Kind = iota
+	KindAnd
+	KindOr
+	KindThreshold
+)
+
+/*
+Clause definition
+
+Clause is a node of the parsed policy. A user clause has Name and UserID, and the other clauses have Children.
+Threshold is the number of children required in a threshold clause.
+*/
+type (
+	Clause struct {
+		Kind      Kind
+		Name      string
+		UserID    []byte
+		Threshold int
+		Children  []*Clause
+	}
+
+	// Policy is a parsed approval policy
+	Policy struct {
+		Root *Clause
+	}
+)
+
+// Parse parses the policy text with the names of users
+func Parse(text string, users map[string][]byte) (*Policy, error) {
+	tokens, err := lex(text)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{tokens: tokens, users: users}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.unexpected(t, "\"and\", \"or\" or end of policy")
+	}
+	return &Policy{Root: root}, nil
+}
+
+// MustParse is like Parse but panics if the policy is invalid
+func MustParse(text string, users map[string][]byte) *Policy {
+	p, err := Parse(text, users)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the policy in the normalized text
+func (p *Policy) String() string {
+	return p.Root.String()
+}
+
+// String returns the clause in the normalized text
+func (c *Clause) String() string {
+	return c.format(false)
+}
+
+// format returns the clause in text (parenthesized if it is a part of an "and" clause)
+func (c *Clause) format(inAnd bool) string {
+	switch c.Kind {
+	case KindUser:
+		return c.Name
+	case KindAnd:
+		parts := make([]string, len(c.Children))
+		for i, child := range c.Children {
+			parts[i] = child.format(true)
+		}
+		return strings.Join(parts, " and ")
+	case KindOr:
+		parts := make([]string, len(c.Children))
+		for i, child := range c.Children {
+			parts[i] = child.format(false)
+		}
+		if inAnd {
+			return "(" + strings.Join(parts, " or ") + ")"
+		}
+		return strings.Join(parts, " or ")
+	case KindThreshold:
+		parts := make([]string, len(c.Children))
+		for i, child := range c.Children {
+			parts[i] = child.format(false)
+		}
+		return fmt.Sprintf("%d of (%s)", c.Threshold, strings.Join(parts, ", "))
+	}
+	return "?"
+}
+
+// Users returns all users in the policy (without duplication)
+func (p *Policy) Users() []*Clause {
+	var users []*Clause
+	var walk func(c *Clause)
+	walk = func(c *Clause) {
+		if c.Kind == KindUser {
+			for _, u := range users {
+				if bytes.Equal(u.UserID, c.UserID) {
+					return
+				}
+			}
+			users = append(users, c)
+		}
+		for _, child := range c.Children {
+			walk(child)
+		}
+	}
+	walk(p.Root)
+	return users
+}
+
+// EventApprovers returns the approver settings of BBcEvent equivalent to the policy
+// (ErrNotExpressible if the policy is not "mandatory approvers and N of option approvers", or a user appears more than once)
+func (p *Policy) EventApprovers() (mandatory [][]byte, option [][]byte, numerator int, err error) {
+	clauses := []*Clause{p.Root}
+	if p.Root.Kind == KindAnd {
+		clauses = p.Root.Children
+	}
+	seen := make(map[string]bool)
+	unique := func(c *Clause) error {
+		if seen[string(c.UserID)] {
+			return fmt.Errorf("%w: duplicate user %s", ErrNotExpressible, c)
+		}
+		seen[string(c.UserID)] = true
+		return nil
+	}
+	for _, c := range clauses {
+		switch c.Kind {
+		case KindUser:
+			if err := unique(c); err != nil {
+				return nil, nil, 0, err
+			}
+			mandatory = append(mandatory, c.UserID)
+		case KindThreshold:
+			if option != nil {
+				return nil, nil, 0, fmt.Errorf("%w: only one threshold clause is allowed", ErrNotExpressible)
+			}
+			for _, child := range c.Children {
+				if child.Kind != KindUser {
+					return nil, nil, 0, fmt.Errorf("%w: threshold clause must consist of users (%s)", ErrNotExpressible, c)
+				}
+				if err := unique(child); err != nil {
+					return nil, nil, 0, err
+				}
+				option = append(option, child.UserID)
+			}
+			numerator = c.Threshold
+		default:
+			return nil, nil, 0, fmt.Errorf("%w: %s", ErrNotExpressible, c)
+		}
+	}
+	return mandatory, option, numerator, nil
+}
+
+// Apply sets the approvers of the BBcEvent object according to the policy (the existing approvers are replaced)
+func (p *Policy) Apply(evt *bbclib.BBcEvent) error {
+	if evt == nil || evt.IdLengthConf == nil {
+		return errors.New("event with ID length configuration must be given")
+	}
+	mandatory, option, numerator, err := p.EventApprovers()
+	if err != nil {
+		return err
+	}
+	evt.MandatoryApprovers = nil
+	evt.OptionApprovers = nil
+	for i := range mandatory {
+		evt.AddMandatoryApprover(&mandatory[i])
+	}
+	evt.SetOptionParams(numerator, len(option))
+	for i := range option {
+		evt.AddOptionApprover(&option[i])
+	}
+	return nil
+}
+
+// FromEvent returns the policy equivalent to the approvers of the BBcEvent object (users are named by the names if given, or in hex)
+func FromEvent(evt *bbclib.BBcEvent, names map[string][]byte) (*Policy, error) {
+	user := func(id []byte) *Clause {
+		for name, uid := range names {
+			if bytes.Equal(uid, id) {
+				return &Clause{Kind: KindUser, Name: name, UserID: append([]byte{}, id...)}
+			}
+		}
+		return &Clause{Kind: KindUser, Name: fmt.Sprintf("0x%x", id), UserID: append([]byte{}, id...)}
+	}
+	var clauses []*Clause
+	for _, id := range evt.MandatoryApprovers {
+		clauses = append(clauses, user(id))
+	}
+	if evt.OptionApproverNumNumerator > 0 {
+		th := &Clause{Kind: KindThreshold, Threshold: int(evt.OptionApproverNumNumerator)}
+		for _, id := range evt.OptionApprovers {
+			th.Children = append(th.Children, user(id))
+		}
+		if th.Threshold > len(th.Children) {
+			return nil, errors.New("not enough option approvers in the event")
+		}
+		clauses = append(clauses, th)
+	}
+	switch len(clauses) {
+	case 0:
+		return nil, errors.New("no approver in the event")
+	case 1:
+		return &Policy{Root: clauses[0]}, nil
+	}
+	return &Policy{Root: &Clause{Kind: KindAnd, Children: clauses}}, nil
+}
@@ -0,0 +1,173 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"bbclib"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	keys := make(map[string]*bbclib.KeyPair)
+	publicKeys := make(bbclib.PublicKeyMap)
+	for name := range users {
+		keys[name], _ = bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+		publicKeys.Add(users[name], keys[name].Pubkey)
+	}
+	assetGroup := bbclib.GetIdentifier("asset_group", 32)
+
+	t.Run("apply to event", func(t *testing.T) {
+		p := MustParse("owner and 2 of (auditor1, auditor2, auditor3)", users)
+		txobj := bbclib.MakeTransaction(1, 0, false)
+		if err := p.Apply(txobj.Events[0]); err != nil {
+			t.Fatal(err)
+		}
+		evt := txobj.Events[0]
+		if len(evt.MandatoryApprovers) != 1 || len(evt.OptionApprovers) != 3 ||
+			evt.OptionApproverNumNumerator != 2 || evt.OptionApproverNumDenominator != 3 {
+			t.Fatal("invalid approvers")
+		}
+		p2, err := FromEvent(evt, users)
+		if err != nil || p2.String() != p.String() {
+			t.Fatalf("invalid policy from the event: %v", err)
+		}
+
+		for _, text := range []string{"owner or legal", "1 of (owner and legal, auditor1)", "1 of (owner) and 1 of (legal)"} {
+			if err := MustParse(text, users).Apply(evt); !errors.Is(err, ErrNotExpressible) {
+				t.Fatalf("%s: must not be expressible: %v", text, err)
+			}
+		}
+	})
+
+	t.Run("evaluate spending transaction", func(t *testing.T) {
+		p := MustParse("owner and 2 of (auditor1, auditor2, auditor3)", users)
+		owner := users["owner"]
+		txobj := bbclib.MakeTransaction(1, 0, false)
+		txobj.Events[0].SetAssetGroup(&assetGroup).CreateAsset(&owner, nil, "asset")
+		if err := p.Apply(txobj.Events[0]); err != nil {
+			t.Fatal(err)
+		}
+		txobj.AddWitness(&owner)
+		txobj.Sign(&owner, keys["owner"], false)
+
+		spend := bbclib.MakeTransaction(0, 0, false)
+		spend.CreateReference(&assetGroup, txobj, 0)
+		for _, name := range []string{"owner", "auditor2"} {
+			uid := users[name]
+			spend.Sign(&uid, keys[name], false)
+		}
+
+		result, err := p.Evaluate(spend, publicKeys.Resolve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Satisfied || result.Approved != 1 || !result.Children[0].Satisfied || result.Children[1].Approved != 1 {
+			t.Fatalf("invalid result:\n%s", result.Explain())
+		}
+		if missing := strings.Join(result.Missing(), ","); missing != "auditor1,auditor3" {
+			t.Fatalf("invalid missing users: %s", missing)
+		}
+		if !strings.Contains(result.Explain(), "[missing] 2 of (auditor1, auditor2, auditor3) (1 of 2 required) needs: auditor1, auditor3") {
+			t.Fatalf("invalid explanation:\n%s", result.Explain())
+		}
+
+		uid := users["auditor3"]
+		spend.Sign(&uid, keys["auditor3"], true)
+		result, err = p.Evaluate(spend, publicKeys.Resolve)
+		if err != nil || !result.Satisfied {
+			t.Fatalf("policy must be satisfied: %v", err)
+		}
+
+		// the users are looked up by user_id, even if they are written in hex
+		hexPolicy := MustParse(fmt.Sprintf("0x%x and 2 of (auditor1, auditor2, auditor3)", owner), users)
+		if result, err := hexPolicy.Evaluate(spend, publicKeys.Resolve); err != nil || !result.Satisfied {
+			t.Fatalf("policy with the user_id in hex must be satisfied: %v", err)
+		}
+		if _, err := p.Evaluate(spend, nil); err == nil {
+			t.Fatal("key resolver must be required")
+		}
+
+		spend.Signatures[0].Signature[0] ^= 0xff
+		if _, err := p.Evaluate(spend, publicKeys.Resolve); !errors.Is(err, bbclib.ErrInvalidSignature) {
+			t.Fatalf("invalid signature must be rejected: %v", err)
+		}
+	})
+
+	t.Run("evaluate users", func(t *testing.T) {
+		p := MustParse("owner and 2 of (auditor1, auditor2, auditor3) or legal", users)
+		if !p.EvaluateUsers([][]byte{users["legal"]}).Satisfied {
+			t.Fatal("legal officer alone must satisfy the policy")
+		}
+		if !p.EvaluateUsers([][]byte{users["owner"], users["auditor1"], users["auditor3"]}).Satisfied {
+			t.Fatal("owner and two auditors must satisfy the policy")
+		}
+		result := p.EvaluateUsers([][]byte{users["auditor1"], users["auditor2"]})
+		if result.Satisfied || !result.Children[0].Children[1].Satisfied {
+			t.Fatalf("invalid result:\n%s", result.Explain())
+		}
+		if missing := result.Missing(); len(missing) != 2 || missing[0] != "owner" || missing[1] != "legal" {
+			t.Fatalf("invalid missing users: %v", missing)
+		}
+		approved, _ := p.ApprovedUsers(bbclib.MakeTransaction(0, 0, false), make(bbclib.PublicKeyMap).Resolve)
+		if len(approved) != 0 || !bytes.Equal(p.Users()[0].UserID, users["owner"]) {
+			t.Fatal("no user must approve an unsigned transaction")
+		}
+	})
+
+	t.Run("duplicate users", func(t *testing.T) {
+		user := func(name string) *Clause {
+			return &Clause{Kind: KindUser, Name: name, UserID: users[name]}
+		}
+		alias := &Clause{Kind: KindUser, Name: fmt.Sprintf("0x%x", users["auditor1"]), UserID: users["auditor1"]}
+		threshold := &Policy{Root: &Clause{Kind: KindThreshold, Threshold: 2, Children: []*Clause{user("auditor1"), alias, user("auditor2")}}}
+		if threshold.EvaluateUsers([][]byte{users["auditor1"]}).Satisfied {
+			t.Fatal("a user must be counted once in a threshold clause")
+		}
+		if !threshold.EvaluateUsers([][]byte{users["auditor1"], users["auditor2"]}).Satisfied {
+			t.Fatal("two distinct users must satisfy the threshold clause")
+		}
+		nested, err := Parse("2 of (auditor1, auditor1 or auditor2, legal)", users)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := nested.EvaluateUsers([][]byte{users["auditor1"]}); result.Satisfied || result.Approved != 1 {
+			t.Fatalf("a user nested in another child must be counted once in a threshold clause:\n%s", result.Explain())
+		}
+		if !nested.EvaluateUsers([][]byte{users["auditor1"], users["auditor2"]}).Satisfied {
+			t.Fatal("two distinct users in the children must satisfy the threshold clause")
+		}
+		and := &Policy{Root: &Clause{Kind: KindAnd, Children: []*Clause{user("owner"), user("owner")}}}
+		if result := and.EvaluateUsers([][]byte{users["owner"]}); !result.Satisfied || result.Required != 1 {
+			t.Fatalf("a user must be required once in an and clause:\n%s", result.Explain())
+		}
+
+		evt := bbclib.MakeTransaction(1, 0, false).Events[0]
+		for _, p := range []*Policy{threshold, and, {Root: &Clause{Kind: KindAnd, Children: []*Clause{
+			user("owner"), {Kind: KindThreshold, Threshold: 1, Children: []*Clause{user("owner"), user("legal")}}}}}} {
+			if err := p.Apply(evt); !errors.Is(err, ErrNotExpressible) {
+				t.Fatalf("%s: duplicate approvers must not be set: %v", p, err)
+			}
+		}
+		if len(evt.MandatoryApprovers) != 0 || len(evt.OptionApprovers) != 0 {
+			t.Fatal("the event must not be changed")
+		}
+	})
+}
@@ -71,7 +71,29 @@ func (p *BBcReference) SetTransaction(txobj *BBcTransaction) {
 }
 
 // Add sets essential information to the BBcReference object
+// If the referred event does not exist, the BBcReference object is not linked to the referred transaction.
 func (p *BBcReference) Add(assetGroupID *[]byte, refTransaction *BBcTransaction, eventIdx int) {
+	_ = logError(p.add(assetGroupID, refTransaction, eventIdx), "failed to link BBcReference", LogField{"event_index", eventIdx})
+}
+
+// add sets essential information to the BBcReference object and returns the error if the referred event is invalid
+func (p *BBcReference) add(assetGroupID *[]byte, refTransaction *BBcTransaction, eventIdx int) error {
+	if refTransaction != nil {
+		idx := int(p.EventIndexInRef)
+		if eventIdx > -1 {
+			idx = eventIdx
+		}
+		if idx >= len(refTransaction.Events) || refTransaction.Events[idx] == nil {
+			return fmt.Errorf("no event (index=%d) in the referred transaction", idx)
+		}
+		if p.Transaction == nil {
+			return errors.New("transaction must be set")
+		}
+		ev := refTransaction.Events[idx]
+		if len(p.SigIndices) > 0 && len(p.SigIndices) != len(ev.MandatoryApprovers)+int(ev.OptionApproverNumNumerator) {
+			return errors.New("num of sig_indices does not match the approvers in the referred event")
+		}
+	}
 	if assetGroupID != nil {
 		p.AssetGroupID = make([]byte, p.IdLengthConf.AssetGroupIdLength)
 		copy(p.AssetGroupID, *assetGroupID)
@@ -110,16 +132,17 @@ func (p *BBcReference) Add(assetGroupID *[]byte, refTransaction *BBcTransaction,
 			}
 		}
 	}
+	return nil
 }
 
 // AddSignature sets the BBcSignature object in the object
 func (p *BBcReference) AddSignature(userID *[]byte, sig *BBcSignature) error {
-	uid := make([]byte, p.Transaction.IdLengthConf.UserIdLength)
-	copy(uid, *userID)
-
 	if p.Transaction == nil {
 		return errors.New("transaction must be set")
 	}
+	uid := make([]byte, p.Transaction.IdLengthConf.UserIdLength)
+	copy(uid, *userID)
+
 	for _, m := range p.RefEvent.MandatoryApprovers {
 		if reflect.DeepEqual(m, uid) {
 			p.Transaction.AddSignatureObj(&uid, sig)
@@ -128,6 +151,9 @@ func (p *BBcReference) AddSignature(userID *[]byte, sig *BBcSignature) error {
 	}
 	for _, o := range p.RefEvent.OptionApprovers {
 		if reflect.DeepEqual(o, uid) {
+			if len(p.sigIndicesOptions) == 0 {
+				return errors.New("no more signature slot for option approvers")
+			}
 			u := make([]byte, p.Transaction.IdLengthConf.UserIdLength)
 			copy(u, p.sigIndicesOptions[0])
 			p.sigIndicesOptions = p.sigIndicesOptions[1:]
@@ -142,12 +168,22 @@ func (p *BBcReference) AddSignature(userID *[]byte, sig *BBcSignature) error {
 func (p *BBcReference) Pack() ([]byte, error) {
 	buf := new(bytes.Buffer)
 
-	PutBigInt(buf, &p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength)
-	PutBigInt(buf, &p.TransactionID, p.IdLengthConf.TransactionIdLength)
-	Put2byte(buf, p.EventIndexInRef)
-	Put2byte(buf, uint16(len(p.SigIndices)))
+	if err := PutBigInt(buf, &p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength); err != nil {
+		return nil, err
+	}
+	if err := PutBigInt(buf, &p.TransactionID, p.IdLengthConf.TransactionIdLength); err != nil {
+		return nil, err
+	}
+	if err := Put2byte(buf, p.EventIndexInRef); err != nil {
+		return nil, err
+	}
+	if err := Put2byte(buf, uint16(len(p.SigIndices))); err != nil {
+		return nil, err
+	}
 	for i := 0; i < len(p.SigIndices); i++ {
-		Put2byte(buf, uint16(p.SigIndices[i]))
+		if err := Put2byte(buf, uint16(p.SigIndices[i])); err != nil {
+			return nil, err
+		}
 	}
 
 	return buf.Bytes(), nil
@@ -160,29 +196,29 @@ func (p *BBcReference) Unpack(dat *[]byte) error {
 	}
 
 	var err error
-	buf := bytes.NewBuffer(*dat)
+	d := newDecoder(*dat)
 
-	p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength, err = GetBigInt(buf)
+	p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength, err = d.getBigInt("asset_group_id")
 	if err != nil {
 		return err
 	}
 
-	p.TransactionID, p.IdLengthConf.TransactionIdLength, err = GetBigInt(buf)
+	p.TransactionID, p.IdLengthConf.TransactionIdLength, err = d.getBigInt("transaction_id")
 	if err != nil {
 		return err
 	}
 
-	p.EventIndexInRef, err = Get2byte(buf)
+	p.EventIndexInRef, err = d.get2byte("event_index_in_ref")
 	if err != nil {
 		return err
 	}
 
-	sigNum, err := Get2byte(buf)
+	sigNum, err := d.get2byte("sig_indices")
 	if err != nil {
 		return err
 	}
 	for i := 0; i < int(sigNum); i++ {
-		idx, err := Get2byte(buf)
+		idx, err := d.get2byte(fmt.Sprintf("sig_indices[%d]", i))
 		if err != nil {
 			return err
 		}
@@ -191,3 +227,49 @@ func (p *BBcReference) Unpack(dat *[]byte) error {
 
 	return nil
 }
+
+// Clone returns a deep copy of the BBcReference object
+// The links to the parent transaction and the referred transaction are kept as is.
+func (p *BBcReference) Clone() *BBcReference {
+	return p.clone(newCloneContext())
+}
+
+// clone returns a deep copy of the BBcReference object, sharing the ID length configuration in the cloneContext
+// RefTransaction is a past transaction that is not owned by this object, so it is not copied.
+func (p *BBcReference) clone(c *cloneContext) *BBcReference {
+	if p == nil {
+		return nil
+	}
+	obj := BBcReference{
+		IdLengthConf:      c.conf(p.IdLengthConf),
+		Version:           p.Version,
+		AssetGroupID:      cloneBytes(p.AssetGroupID),
+		TransactionID:     cloneBytes(p.TransactionID),
+		EventIndexInRef:   p.EventIndexInRef,
+		sigIndicesOptions: cloneBytesList(p.sigIndicesOptions),
+		Transaction:       p.Transaction,
+		RefTransaction:    p.RefTransaction,
+		RefEvent:          *p.RefEvent.clone(c),
+	}
+	if p.SigIndices != nil {
+		obj.SigIndices = append([]int{}, p.SigIndices...)
+	}
+	return &obj
+}
+
+// Equal returns true if the BBcReference objects have the same content to be packed
+func (p *BBcReference) Equal(q *BBcReference) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	if !bytes.Equal(p.AssetGroupID, q.AssetGroupID) || !bytes.Equal(p.TransactionID, q.TransactionID) ||
+		p.EventIndexInRef != q.EventIndexInRef || len(p.SigIndices) != len(q.SigIndices) {
+		return false
+	}
+	for i := range p.SigIndices {
+		if p.SigIndices[i] != q.SigIndices[i] {
+			return false
+		}
+	}
+	return true
+}
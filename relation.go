@@ -90,22 +90,15 @@ func (p *BBcRelation) SetVersion(version uint32) {
 // SetAssetGroup sets asset_group_id in the BBcRelation object
 func (p *BBcRelation) SetAssetGroup(assetGroupId *[]byte) *BBcRelation {
 	p.AssetGroupID = make([]byte, p.IdLengthConf.AssetGroupIdLength)
-	copy(p.AssetGroupID, (*assetGroupId)[:p.IdLengthConf.AssetGroupIdLength])
+	copy(p.AssetGroupID, *assetGroupId)
 	return p
 }
 
 // Add sets essential information (assetGroupID and BBcAsset object) to the BBcRelation object
 func (p *BBcRelation) CreateAsset(userId *[]byte, fileContent *[]byte, bodyContent interface{}) *BBcRelation {
-	obj := BBcAsset{Version: p.Version}
-	obj.SetIdLengthConf(p.IdLengthConf)
-	obj.Add(userId)
-	if fileContent != nil {
-		obj.AddFile(fileContent)
-	}
-	if bodyContent != nil {
-		obj.AddBody(bodyContent)
-	}
-	p.Asset = &obj
+	var err error
+	p.Asset, err = newAsset(p.Version, p.IdLengthConf, userId, fileContent, bodyContent)
+	_ = logError(err, "failed to set asset body in BBcRelation")
 	return p
 }
 
@@ -148,15 +141,21 @@ func (p *BBcRelation) Pack() ([]byte, error) {
 	}
 	buf := new(bytes.Buffer)
 
-	PutBigInt(buf, &p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength)
+	if err := PutBigInt(buf, &p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength); err != nil {
+		return nil, err
+	}
 
-	Put2byte(buf, uint16(len(p.Pointers)))
+	if err := Put2byte(buf, uint16(len(p.Pointers))); err != nil {
+		return nil, err
+	}
 	for _, p := range p.Pointers {
 		dat, er := p.Pack()
 		if er != nil {
 			return nil, er
 		}
-		Put2byte(buf, uint16(binary.Size(dat)))
+		if err := Put2byte(buf, uint16(binary.Size(dat))); err != nil {
+			return nil, err
+		}
 		if err := binary.Write(buf, binary.LittleEndian, dat); err != nil {
 			return nil, err
 		}
@@ -166,12 +165,16 @@ func (p *BBcRelation) Pack() ([]byte, error) {
 		if er != nil {
 			return nil, er
 		}
-		Put4byte(buf, uint32(binary.Size(ast)))
+		if err := Put4byte(buf, uint32(binary.Size(ast))); err != nil {
+			return nil, err
+		}
 		if err := binary.Write(buf, binary.LittleEndian, ast); err != nil {
 			return nil, err
 		}
 	} else {
-		Put4byte(buf, 0)
+		if err := Put4byte(buf, 0); err != nil {
+			return nil, err
+		}
 	}
 
 	if p.Version >= 2 {
@@ -180,12 +183,16 @@ func (p *BBcRelation) Pack() ([]byte, error) {
 			if er != nil {
 				return nil, er
 			}
-			Put4byte(buf, uint32(binary.Size(ast)))
+			if err := Put4byte(buf, uint32(binary.Size(ast))); err != nil {
+				return nil, err
+			}
 			if err := binary.Write(buf, binary.LittleEndian, ast); err != nil {
 				return nil, err
 			}
 		} else {
-			Put4byte(buf, 0)
+			if err := Put4byte(buf, 0); err != nil {
+				return nil, err
+			}
 		}
 
 		if p.AssetHash != nil {
@@ -193,12 +200,16 @@ func (p *BBcRelation) Pack() ([]byte, error) {
 			if er != nil {
 				return nil, er
 			}
-			Put4byte(buf, uint32(binary.Size(ast)))
+			if err := Put4byte(buf, uint32(binary.Size(ast))); err != nil {
+				return nil, err
+			}
 			if err := binary.Write(buf, binary.LittleEndian, ast); err != nil {
 				return nil, err
 			}
 		} else {
-			Put4byte(buf, 0)
+			if err := Put4byte(buf, 0); err != nil {
+				return nil, err
+			}
 		}
 	}
 	return buf.Bytes(), nil
@@ -211,71 +222,113 @@ func (p *BBcRelation) Unpack(dat *[]byte) error {
 	}
 
 	var err error
-	buf := bytes.NewBuffer(*dat)
+	d := newDecoder(*dat)
 
-	p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength, err = GetBigInt(buf)
+	p.AssetGroupID, p.IdLengthConf.AssetGroupIdLength, err = d.getBigInt("asset_group_id")
 	if err != nil {
 		return err
 	}
 
-	numPointers, err := Get2byte(buf)
+	numPointers, err := d.get2byte("pointers")
 	if err != nil {
 		return err
 	}
 	for i := 0; i < int(numPointers); i++ {
-		size, err2 := Get2byte(buf)
+		path := fmt.Sprintf("pointers[%d]", i)
+		size, err2 := d.get2byte(path)
 		if err2 != nil {
 			return err2
 		}
-		ptr, _, _ := GetBytes(buf, int(size))
 		pointer := BBcPointer{}
-		pointer.Unpack(&ptr)
+		if err2 = d.getObject(path, int(size), pointer.Unpack); err2 != nil {
+			return err2
+		}
 		p.Pointers = append(p.Pointers, &pointer)
 	}
 
-	assetSize, err := Get4byte(buf)
+	assetSize, err := d.get4byte("asset")
 	if err != nil {
 		return err
 	}
 	if assetSize > 0 {
-		ast, _, err := GetBytes(buf, int(assetSize))
-		if err != nil {
+		p.Asset = &BBcAsset{}
+		if err = d.getObject("asset", int(assetSize), p.Asset.Unpack); err != nil {
 			return err
 		}
-		p.Asset = &BBcAsset{}
-		p.Asset.Unpack(&ast)
 		UpdateIdLengthConfig(p.IdLengthConf, p.Asset.IdLengthConf)
 	}
 
 	if p.Version >= 2 {
-		assetSize, err := Get4byte(buf)
+		assetSize, err := d.get4byte("asset_raw")
 		if err != nil {
 			return err
 		}
 		if assetSize > 0 {
-			ast, _, err := GetBytes(buf, int(assetSize))
-			if err != nil {
+			p.AssetRaw = &BBcAssetRaw{}
+			if err = d.getObject("asset_raw", int(assetSize), p.AssetRaw.Unpack); err != nil {
 				return err
 			}
-			p.AssetRaw = &BBcAssetRaw{}
-			p.AssetRaw.Unpack(&ast)
 			UpdateIdLengthConfig(p.IdLengthConf, p.AssetRaw.IdLengthConf)
 		}
 
-		assetSize, err = Get4byte(buf)
+		assetSize, err = d.get4byte("asset_hash")
 		if err != nil {
 			return err
 		}
 		if assetSize > 0 {
-			ast, _, err := GetBytes(buf, int(assetSize))
-			if err != nil {
+			p.AssetHash = &BBcAssetHash{}
+			if err = d.getObject("asset_hash", int(assetSize), p.AssetHash.Unpack); err != nil {
 				return err
 			}
-			p.AssetHash = &BBcAssetHash{}
-			p.AssetHash.Unpack(&ast)
 			UpdateIdLengthConfig(p.IdLengthConf, p.AssetHash.IdLengthConf)
 		}
 	}
 
 	return nil
 }
+
+// Clone returns a deep copy of the BBcRelation object
+func (p *BBcRelation) Clone() *BBcRelation {
+	return p.clone(newCloneContext())
+}
+
+// clone returns a deep copy of the BBcRelation object, sharing the ID length configuration in the cloneContext
+func (p *BBcRelation) clone(c *cloneContext) *BBcRelation {
+	if p == nil {
+		return nil
+	}
+	obj := BBcRelation{
+		IdLengthConf: c.conf(p.IdLengthConf),
+		Version:      p.Version,
+		AssetGroupID: cloneBytes(p.AssetGroupID),
+		Asset:        p.Asset.clone(c),
+		AssetRaw:     p.AssetRaw.clone(c),
+		AssetHash:    p.AssetHash.clone(c),
+	}
+	for _, ptr := range p.Pointers {
+		obj.Pointers = append(obj.Pointers, ptr.clone(c))
+	}
+	return &obj
+}
+
+// Equal returns true if the BBcRelation objects have the same content to be packed
+func (p *BBcRelation) Equal(q *BBcRelation) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	if !bytes.Equal(p.AssetGroupID, q.AssetGroupID) || len(p.Pointers) != len(q.Pointers) {
+		return false
+	}
+	for i := range p.Pointers {
+		if !p.Pointers[i].Equal(q.Pointers[i]) {
+			return false
+		}
+	}
+	if !p.Asset.Equal(q.Asset) {
+		return false
+	}
+	if p.Version >= 2 || q.Version >= 2 {
+		return p.AssetRaw.Equal(q.AssetRaw) && p.AssetHash.Equal(q.AssetHash)
+	}
+	return true
+}
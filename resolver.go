@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned by TransactionMap and PublicKeyMap if the ID is unknown
+var ErrNotFound = errors.New("not found")
+
+type (
+	// KeyResolver returns the trusted public key of the user (an error if unknown)
+	// The public key in a BBcSignature is not trusted, because anyone can sign with their own key in the slot of another user.
+	KeyResolver func(userID []byte) ([]byte, error)
+
+	// TransactionMap is an in-memory set of transactions, and Resolve is usable as TransactionResolver
+	TransactionMap map[string]*BBcTransaction
+
+	// PublicKeyMap is an in-memory set of public keys of users, and Resolve is usable as KeyResolver
+	PublicKeyMap map[string][]byte
+
+	// SpentResolver returns the TransactionID of the transaction which has spent the output (the event at the index of the transaction),
+	// or nil if the output is unspent
+	SpentResolver func(transactionID []byte, eventIdx int) ([]byte, error)
+
+	// SpentMap is an in-memory index of the spent outputs, and Resolve is usable as SpentResolver
+	SpentMap map[string][]byte
+)
+
+// Add adds the transaction and returns it
+func (m TransactionMap) Add(txobj *BBcTransaction) *BBcTransaction {
+	m[hex.EncodeToString(txobj.TransactionID)] = txobj
+	return txobj
+}
+
+// Resolve returns the transaction of the TransactionID
+func (m TransactionMap) Resolve(transactionID []byte) (*BBcTransaction, error) {
+	if txobj, ok := m[hex.EncodeToString(transactionID)]; ok {
+		return txobj, nil
+	}
+	return nil, fmt.Errorf("transaction %x: %w", transactionID, ErrNotFound)
+}
+
+// Add sets the public key of the user
+func (m PublicKeyMap) Add(userID, publicKey []byte) {
+	m[hex.EncodeToString(userID)] = publicKey
+}
+
+// Resolve returns the public key of the user
+func (m PublicKeyMap) Resolve(userID []byte) ([]byte, error) {
+	if publicKey, ok := m[hex.EncodeToString(userID)]; ok {
+		return publicKey, nil
+	}
+	return nil, fmt.Errorf("user %x: %w", userID, ErrNotFound)
+}
+
+// Add records the outputs spent by the BBcReference objects in the transaction, and returns the transaction
+// An output keeps the first transaction which has spent it, so that a double spending does not replace it.
+func (m SpentMap) Add(txobj *BBcTransaction) *BBcTransaction {
+	for _, ref := range txobj.References {
+		key := spentKey(ref.TransactionID, int(ref.EventIndexInRef))
+		if _, ok := m[key]; !ok {
+			m[key] = append([]byte{}, txobj.TransactionID...)
+		}
+	}
+	return txobj
+}
+
+// Resolve returns the TransactionID of the transaction which has spent the output (nil if unspent)
+func (m SpentMap) Resolve(transactionID []byte, eventIdx int) ([]byte, error) {
+	return m[spentKey(transactionID, eventIdx)], nil
+}
+
+// spentKey returns the key of the output in SpentMap
+func spentKey(transactionID []byte, eventIdx int) string {
+	return fmt.Sprintf("%s:%d", hex.EncodeToString(transactionID), eventIdx)
+}
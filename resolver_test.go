@@ -0,0 +1,84 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestResolvers(t *testing.T) {
+	keypair, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+	other, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+	refTxObj := makeBaseTx(idLengthConfig)
+	txobj := makeFollowTX(idLengthConfig, &refTxObj)
+	idx := txobj.GetSigIndex(txtest_u6)
+	txobj.Sign(&txtest_u6, keypair, false)
+
+	t.Run("transaction map", func(t *testing.T) {
+		transactions := make(TransactionMap)
+		if transactions.Add(&refTxObj) != &refTxObj {
+			t.Fatal("added transaction must be returned")
+		}
+		if found, err := transactions.Resolve(refTxObj.TransactionID); err != nil || found != &refTxObj {
+			t.Fatalf("transaction must be resolved: %v", err)
+		}
+		if _, err := transactions.Resolve(txobj.TransactionID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("ErrNotFound must be returned: %v", err)
+		}
+	})
+
+	t.Run("spent map", func(t *testing.T) {
+		spent := make(SpentMap)
+		if spent.Add(&txobj) != &txobj {
+			t.Fatal("added transaction must be returned")
+		}
+		ref := txobj.References[0]
+		if spender, err := spent.Resolve(ref.TransactionID, int(ref.EventIndexInRef)); err != nil || !bytes.Equal(spender, txobj.TransactionID) {
+			t.Fatalf("spender must be resolved: %v", err)
+		}
+		double := txobj.Clone()
+		double.Timestamp++
+		double.Digest()
+		spent.Add(double)
+		if spender, _ := spent.Resolve(ref.TransactionID, int(ref.EventIndexInRef)); !bytes.Equal(spender, txobj.TransactionID) {
+			t.Fatal("first spender must be kept")
+		}
+		if spender, err := spent.Resolve(txobj.TransactionID, 0); err != nil || spender != nil {
+			t.Fatalf("unspent output must be resolved to nil: %v", err)
+		}
+	})
+
+	t.Run("verify signed by the user", func(t *testing.T) {
+		keys := make(PublicKeyMap)
+		keys.Add(txtest_u6, keypair.Pubkey)
+		keys.Add(txtest_u5, other.Pubkey)
+		if err := txobj.VerifySignedBy(idx, txtest_u6, keys.Resolve); err != nil {
+			t.Fatal(err)
+		}
+		if err := txobj.VerifySignedBy(idx, txtest_u5, keys.Resolve); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("signature of another user must be rejected: %v", err)
+		}
+		if err := txobj.VerifySignedBy(idx, txtest_u4, keys.Resolve); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("user without public key must be rejected: %v", err)
+		}
+		if err := txobj.VerifySignedBy(idx, txtest_u6, nil); err == nil {
+			t.Fatal("key resolver must be required")
+		}
+	})
+}
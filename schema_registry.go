@@ -0,0 +1,174 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+/*
+Asset body schemas
+
+SchemaRegistry holds a JSON Schema per AssetGroupID, and validates the bodies of BBcAsset and BBcAssetRaw objects in the asset group:
+
+  - AssetBodyType 0 (and BBcAssetRaw) is parsed as a JSON document
+  - the other types are decoded by the codec for AssetBodyType (MessagePack, JSON, CBOR or a registered codec) into a generic value
+  - an empty body is a violation (the schema describes the payload of the asset)
+
+Binary data in MessagePack/CBOR is accepted as a string if it is valid UTF-8. Protobuf bodies cannot be decoded without the message type,
+so that they are reported as violations in the asset groups with a schema.
+
+The violations have the path of the body and the JSON pointer in it, e.g., "events[0].asset.asset_body#/items/1/amount".
+The registry is checked in TransactionBuilder.Build (see TransactionBuilder.SetSchemaRegistry) and in SchemaRegistry.Verify,
+and can be registered in a RuleEngine by SchemaRegistry.Rule.
+*/
+type (
+	SchemaRegistry struct {
+		mutex   sync.RWMutex
+		schemas map[string]*JSONSchema
+	}
+)
+
+// RuleJSONSchema is the name of the rule of SchemaRegistry
+const RuleJSONSchema = "json_schema"
+
+// NewSchemaRegistry returns an empty registry
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{schemas: make(map[string]*JSONSchema)}
+}
+
+// Register compiles the JSON Schema and registers it for the asset group (an existing schema is replaced)
+func (r *SchemaRegistry) Register(assetGroupID []byte, schema []byte) error {
+	s, err := CompileJSONSchema(schema)
+	if err != nil {
+		return err
+	}
+	return r.RegisterSchema(assetGroupID, s)
+}
+
+// RegisterSchema registers the compiled schema for the asset group (an existing schema is replaced)
+func (r *SchemaRegistry) RegisterSchema(assetGroupID []byte, schema *JSONSchema) error {
+	if len(assetGroupID) == 0 {
+		return errors.New("asset_group_id must be given")
+	}
+	if schema == nil {
+		return errors.New("schema must not be nil")
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.schemas[hex.EncodeToString(assetGroupID)] = schema
+	return nil
+}
+
+// Unregister removes the schema of the asset group
+func (r *SchemaRegistry) Unregister(assetGroupID []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.schemas, hex.EncodeToString(assetGroupID))
+}
+
+// Schema returns the schema of the asset group (nil if not registered)
+func (r *SchemaRegistry) Schema(assetGroupID []byte) *JSONSchema {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.schemas[hex.EncodeToString(assetGroupID)]
+}
+
+// Rule returns the ValidationRule checking the asset bodies against the registry (to be registered globally)
+func (r *SchemaRegistry) Rule() ValidationRule {
+	return NewRule(RuleJSONSchema, r.violations)
+}
+
+// Validate checks the asset bodies in the transaction, and returns *ValidationError with all violations (nil if no violation)
+func (r *SchemaRegistry) Validate(txobj *BBcTransaction) error {
+	if txobj == nil {
+		return errors.New("transaction must be given")
+	}
+	ctx := ValidationContext{Transaction: txobj}
+	if violations := r.violations(&ctx); len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// Verify verifies all signatures in the transaction, and then checks the asset bodies by Validate
+func (r *SchemaRegistry) Verify(txobj *BBcTransaction) error {
+	if txobj == nil {
+		return errors.New("transaction must be given")
+	}
+	if result, idx := txobj.VerifyAll(); !result {
+		return fmt.Errorf("signatures[%d]: %w", idx, ErrInvalidSignature)
+	}
+	return r.Validate(txobj)
+}
+
+// violations checks the assets in the context against the schemas of their asset groups
+func (r *SchemaRegistry) violations(ctx *ValidationContext) []Violation {
+	var violations []Violation
+	for _, a := range ctx.Assets() {
+		schema := r.Schema(a.AssetGroupID)
+		if schema == nil {
+			continue
+		}
+		path := a.Path + ".asset_body"
+		var errs []*SchemaError
+		if a.AssetRaw != nil {
+			errs = validateRawBody(schema, a.AssetRaw.AssetBody)
+		} else {
+			errs = validateAssetBody(schema, a.Asset)
+		}
+		for _, e := range errs {
+			violations = append(violations, Violation{
+				Rule:         RuleJSONSchema,
+				AssetGroupID: a.AssetGroupID,
+				Path:         path + "#" + e.Pointer,
+				Message:      fmt.Sprintf("%s: %s", e.Keyword, e.Message),
+			})
+		}
+	}
+	return violations
+}
+
+// validateAssetBody decodes the body of BBcAsset by the codec for AssetBodyType and validates it
+func validateAssetBody(schema *JSONSchema, asset *BBcAsset) []*SchemaError {
+	if asset.AssetBodyType == AssetBodyTypeRaw {
+		return validateRawBody(schema, asset.AssetBody)
+	}
+	if len(asset.AssetBody) == 0 {
+		return []*SchemaError{{Keyword: "body", Message: "asset body is empty"}}
+	}
+	c, err := GetAssetBodyCodec(asset.AssetBodyType)
+	if err != nil {
+		return []*SchemaError{{Keyword: "body", Message: err.Error()}}
+	}
+	var val interface{}
+	if err := c.Decode(asset.AssetBody, &val); err != nil {
+		return []*SchemaError{{Keyword: "body", Message: fmt.Sprintf("cannot decode body of type %d: %v", asset.AssetBodyType, err)}}
+	}
+	return schema.Validate(val)
+}
+
+// validateRawBody parses the raw body as a JSON document and validates it
+func validateRawBody(schema *JSONSchema, body []byte) []*SchemaError {
+	if len(body) == 0 {
+		return []*SchemaError{{Keyword: "body", Message: "asset body is empty"}}
+	}
+	return schema.ValidateJSON(body)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSchemaRegistry(t *testing.T) {
+	orders := GetIdentifier("schema_orders", defaultIDLength)
+	free := GetIdentifier("schema_free", defaultIDLength)
+	keypair, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+	registry := NewSchemaRegistry()
+	if err := registry.Register(orders, []byte(testOrderSchema)); err != nil {
+		t.Fatal(err)
+	}
+
+	build := func(orderBody interface{}, rawBody string) (*BBcTransaction, error) {
+		asid := GetIdentifier("schema_raw_asset", defaultIDLength)
+		return NewTransactionBuilder(nil).
+			SetSchemaRegistry(registry).
+			AddEvent(&orders, func(e *EventBuilder) {
+				e.AddMandatoryApprover(&txtest_u1).CreateAsset(&txtest_u1, nil, orderBody)
+			}).
+			AddEvent(&free, func(e *EventBuilder) {
+				e.AddMandatoryApprover(&txtest_u1).CreateAsset(&txtest_u1, nil, "anything")
+			}).
+			AddRelation(&orders, func(r *RelationBuilder) {
+				r.CreateAssetRaw(&asid, rawBody)
+			}).
+			AddWitness(&txtest_u1).
+			Sign(&txtest_u1, keypair, false).
+			Build()
+	}
+	validOrder := map[string]interface{}{"order_id": "ORD-1", "items": []interface{}{map[string]interface{}{"sku": "a", "amount": 3}}}
+	validRaw := `{"order_id": "ORD-2", "items": [{"sku": "b", "amount": 1}]}`
+
+	t.Run("build and verify", func(t *testing.T) {
+		txobj, err := build(validOrder, validRaw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dat, _ := Serialize(txobj, FormatZlib)
+		recovered, err := Deserialize(dat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := registry.Verify(recovered); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("build fails with error paths", func(t *testing.T) {
+		invalid := map[string]interface{}{"order_id": "ORD-1", "items": []interface{}{map[string]interface{}{"sku": "a", "amount": "3"}}}
+		_, err := build(invalid, `{"order_id": "ORD-2"}`)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || len(verr.Violations) != 2 {
+			t.Fatalf("schema violations must be reported: %v", err)
+		}
+		if verr.Violations[0].Path != "events[0].asset.asset_body#/items/0/amount" || verr.Violations[0].Message != "type: expected integer, got string" {
+			t.Fatalf("unexpected violation: %v", verr.Violations[0])
+		}
+		if verr.Violations[1].Path != "relations[0].asset_raw.asset_body#" || verr.Violations[1].Rule != RuleJSONSchema {
+			t.Fatalf("unexpected violation: %v", verr.Violations[1])
+		}
+	})
+
+	t.Run("body types", func(t *testing.T) {
+		txobj := MakeTransaction(1, 0, true)
+		txobj.Events[0].SetAssetGroup(&orders).CreateAsset(&txtest_u1, nil, validOrder)
+		asset := txobj.Events[0].Asset
+		for bodyType, ok := range map[uint16]bool{AssetBodyTypeMsgpack: true, AssetBodyTypeJSON: true, AssetBodyTypeCBOR: true} {
+			if err := asset.AddBodyObjectWithType(bodyType, validOrder); err != nil {
+				t.Fatal(err)
+			}
+			if err := registry.Validate(txobj); (err == nil) != ok {
+				t.Fatalf("body type %d: %v", bodyType, err)
+			}
+		}
+		asset.AssetBody, asset.AssetBodySize, asset.AssetBodyType = []byte("not json"), 8, AssetBodyTypeRaw
+		if err := registry.Validate(txobj); err == nil {
+			t.Fatal("raw body which is not JSON must be reported")
+		}
+		asset.AssetBody, asset.AssetBodySize = nil, 0
+		if err := registry.Validate(txobj); err == nil {
+			t.Fatal("empty body must be reported")
+		}
+	})
+
+	t.Run("rule engine", func(t *testing.T) {
+		txobj, err := build(validOrder, validRaw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txobj.Events[0].Asset.AssetBody = []byte(`{}`)
+		txobj.Events[0].Asset.AssetBodyType = AssetBodyTypeJSON
+		engine := NewRuleEngine()
+		_ = engine.RegisterGlobal(registry.Rule())
+		err = engine.Validate(txobj, nil)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || len(verr.Violations) != 2 || verr.Violations[0].Rule != RuleJSONSchema {
+			t.Fatalf("unexpected violations: %v", err)
+		}
+		if err := registry.Verify(txobj); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("modified transaction must fail to verify: %v", err)
+		}
+	})
+
+	t.Run("registration", func(t *testing.T) {
+		r := NewSchemaRegistry()
+		if r.Register(nil, []byte(`{}`)) == nil || r.Register(free, []byte(`{"type": 1}`)) == nil {
+			t.Fatal("invalid registration must fail")
+		}
+		_ = r.Register(free, []byte(`{"type": "string"}`))
+		if r.Schema(free) == nil {
+			t.Fatal("schema must be registered")
+		}
+		r.Unregister(free)
+		if r.Schema(free) != nil {
+			t.Fatal("schema must be unregistered")
+		}
+	})
+}
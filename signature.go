@@ -18,7 +18,9 @@ package bbclib
 
 import (
 	"bytes"
+	"crypto/elliptic"
 	"encoding/binary"
+	"errors"
 	"fmt"
 )
 
@@ -80,6 +82,23 @@ func (p *BBcSignature) SetSignature(sig *[]byte) {
 	p.SignatureLen = uint32(len(p.Signature) * 8)
 }
 
+// CheckFormat returns an error if the object is not an ECDSA P-256 signature of 64 bytes (with a valid public key if included)
+// VerifyBBcSignature and KeyPair.Verify expect the signature in this format.
+func (p *BBcSignature) CheckFormat() error {
+	if p.KeyType != KeyTypeEcdsaP256v1 {
+		return fmt.Errorf("unsupported key type %d", p.KeyType)
+	}
+	if len(p.Signature) != 64 {
+		return fmt.Errorf("signature must be 64 bytes (%d bytes)", len(p.Signature))
+	}
+	if len(p.Pubkey) > 0 {
+		if x, _ := elliptic.Unmarshal(elliptic.P256(), p.Pubkey); x == nil {
+			return errors.New("invalid public key")
+		}
+	}
+	return nil
+}
+
 // Verify the TransactionID of the parent BBcTransaction object with the signature in the object
 func (p *BBcSignature) Verify(digest []byte) bool {
 	return VerifyBBcSignature(digest, p)
@@ -97,19 +116,25 @@ func (p *BBcSignature) VerifyWithPublicKey(digest []byte, publicKey []byte) bool
 func (p *BBcSignature) Pack() ([]byte, error) {
 	buf := new(bytes.Buffer)
 
-	Put4byte(buf, p.KeyType)
+	if err := Put4byte(buf, p.KeyType); err != nil {
+		return nil, err
+	}
 	if p.KeyType == KeyTypeNotInitialized {
 		return buf.Bytes(), nil
 	}
 
-	Put4byte(buf, p.PubkeyLen)
+	if err := Put4byte(buf, p.PubkeyLen); err != nil {
+		return nil, err
+	}
 	if p.PubkeyLen > 0 {
 		if err := binary.Write(buf, binary.LittleEndian, p.Pubkey); err != nil {
 			return nil, err
 		}
 	}
 
-	Put4byte(buf, p.SignatureLen)
+	if err := Put4byte(buf, p.SignatureLen); err != nil {
+		return nil, err
+	}
 	if err := binary.Write(buf, binary.LittleEndian, p.Signature); err != nil {
 		return nil, err
 	}
@@ -120,9 +145,9 @@ func (p *BBcSignature) Pack() ([]byte, error) {
 // Unpack the BBcSignature object to the binary data
 func (p *BBcSignature) Unpack(dat *[]byte) error {
 	var err error
-	buf := bytes.NewBuffer(*dat)
+	d := newDecoder(*dat)
 
-	keyType, err := Get4byte(buf)
+	keyType, err := d.get4byte("key_type")
 	if err != nil {
 		return err
 	}
@@ -131,23 +156,27 @@ func (p *BBcSignature) Unpack(dat *[]byte) error {
 	}
 	p.KeyType = uint32(keyType)
 
-	p.PubkeyLen, err = Get4byte(buf)
+	p.PubkeyLen, err = d.get4byte("pubkey")
 	if err != nil {
 		return err
 	}
 	if p.PubkeyLen > 0 {
-		p.Pubkey = make([]byte, int(p.PubkeyLen/8))
-		p.Pubkey, _, _ = GetBytes(buf, int(p.PubkeyLen/8))
+		p.Pubkey, err = d.getBytes("pubkey", int(p.PubkeyLen/8))
+		if err != nil {
+			return err
+		}
 	} else {
 		p.Pubkey = nil
 	}
 
-	p.SignatureLen, err = Get4byte(buf)
+	p.SignatureLen, err = d.get4byte("signature")
+	if err != nil {
+		return err
+	}
+	p.Signature, err = d.getBytes("signature", int(p.SignatureLen/8))
 	if err != nil {
 		return err
 	}
-	p.Signature = make([]byte, int(p.SignatureLen/8))
-	p.Signature, _, _ = GetBytes(buf, int(p.SignatureLen/8))
 
 	return nil
 }
@@ -158,3 +187,33 @@ func RecoverSignatureObject(dat *[]byte) *BBcSignature {
 	sig.Unpack(dat)
 	return &sig
 }
+
+// Clone returns a deep copy of the BBcSignature object
+func (p *BBcSignature) Clone() *BBcSignature {
+	if p == nil {
+		return nil
+	}
+	return &BBcSignature{
+		Version:      p.Version,
+		KeyType:      p.KeyType,
+		Pubkey:       cloneBytes(p.Pubkey),
+		PubkeyLen:    p.PubkeyLen,
+		Signature:    cloneBytes(p.Signature),
+		SignatureLen: p.SignatureLen,
+	}
+}
+
+// Equal returns true if the BBcSignature objects have the same content to be packed
+func (p *BBcSignature) Equal(q *BBcSignature) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	if p.KeyType != q.KeyType {
+		return false
+	}
+	if p.KeyType == KeyTypeNotInitialized {
+		return true
+	}
+	return p.PubkeyLen == q.PubkeyLen && bytes.Equal(p.Pubkey, q.Pubkey) &&
+		p.SignatureLen == q.SignatureLen && bytes.Equal(p.Signature, q.Signature)
+}
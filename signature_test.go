@@ -18,6 +18,7 @@ package bbclib
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 )
 
@@ -106,3 +107,49 @@ func TestSignaturePackUnpack(t *testing.T) {
 		}
 	})
 }
+
+func TestSignatureFormat(t *testing.T) {
+	keypair, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+	other, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+
+	t.Run("malformed signatures", func(t *testing.T) {
+		digest := GetRandomValue(32)
+		signature := keypair.Sign(digest)
+		short := signature[:3]
+		for name, sig := range map[string]*BBcSignature{
+			"short signature":  {KeyType: KeyTypeEcdsaP256v1, Pubkey: keypair.Pubkey, PubkeyLen: 520, Signature: short},
+			"unknown key type": {KeyType: 99, Pubkey: keypair.Pubkey, PubkeyLen: 520, Signature: signature},
+			"broken pubkey":    {KeyType: KeyTypeEcdsaP256v1, Pubkey: []byte{4, 1, 2}, PubkeyLen: 24, Signature: signature},
+		} {
+			if sig.CheckFormat() == nil {
+				t.Fatalf("%s must be rejected", name)
+			}
+			if VerifyBBcSignature(digest, sig) {
+				t.Fatalf("%s must not be verified", name)
+			}
+		}
+	})
+
+	t.Run("verify with the public key of the signer", func(t *testing.T) {
+		refTxObj := makeBaseTx(idLengthConfig)
+		txobj := makeFollowTX(idLengthConfig, &refTxObj)
+		if err := txobj.VerifySignatureAt(0, keypair.Pubkey); err == nil {
+			t.Fatal("signature by another key must be rejected")
+		}
+		idx := txobj.GetSigIndex(txtest_u6)
+		txobj.Sign(&txtest_u6, keypair, false)
+		if err := txobj.VerifySignatureAt(idx, keypair.Pubkey); err != nil {
+			t.Fatal(err)
+		}
+		if err := txobj.VerifySignatureAt(idx, other.Pubkey); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("wrong public key must be rejected: %v", err)
+		}
+		txobj.Sign(&txtest_u6, keypair, true)
+		if err := txobj.VerifySignatureAt(idx, keypair.Pubkey); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("signature without public key must be rejected: %v", err)
+		}
+		if err := txobj.VerifySignatureAt(len(txobj.Signatures), keypair.Pubkey); err == nil {
+			t.Fatal("empty slot must be rejected")
+		}
+	})
+}
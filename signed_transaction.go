@@ -0,0 +1,182 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+SignedTransaction definition
+
+SignedTransaction is an immutable view of a finalized (fully signed) transaction.
+It keeps only the packed data and the digests calculated when it is created, and every object returned by the accessors
+(e.g., Event, Transaction) is unpacked from the packed data on each call. So modifying the returned objects never affects the view,
+and no method modifies the view, i.e., a SignedTransaction can be shared between goroutines and caches without locking.
+
+To modify the transaction, take a copy by Transaction, modify it, and create a new SignedTransaction after signing it again.
+*/
+type SignedTransaction struct {
+	packed []byte
+	digest []byte
+	lazy   *LazyTransaction
+}
+
+// ErrNotFinalized is returned when a SignedTransaction is created from a transaction that is not finalized
+var ErrNotFinalized = errors.New("transaction is not finalized")
+
+// NewSignedTransaction creates the immutable view of the transaction
+// The transaction must have the up-to-date TransactionID (see BBcTransaction.IsDirty), and all signatures must be set and valid.
+// The given transaction object is not modified, and later modifications of it do not affect the view.
+func NewSignedTransaction(transaction *BBcTransaction) (*SignedTransaction, error) {
+	if transaction == nil {
+		return nil, errors.New("transaction must be given")
+	}
+	if transaction.IsDirty() {
+		return nil, fmt.Errorf("%w: transaction_id is stale (call Digest before creating the view)", ErrNotFinalized)
+	}
+	txobj := transaction.Clone()
+	for i, sig := range txobj.Signatures {
+		if sig == nil || sig.KeyType == KeyTypeNotInitialized {
+			return nil, fmt.Errorf("%w: signature[%d] is not set", ErrNotFinalized, i)
+		}
+	}
+	if result, idx := txobj.VerifyAll(); !result {
+		return nil, fmt.Errorf("%w (signature[%d])", ErrInvalidSignature, idx)
+	}
+
+	packed, err := txobj.AppendPack(nil)
+	if err != nil {
+		return nil, err
+	}
+	lazy, err := PeekPackedTransaction(packed)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedTransaction{packed: packed, digest: txobj.Digest(), lazy: lazy}, nil
+}
+
+// DeserializeSignedTransaction deserializes the data (with the header of Serialize) and creates the immutable view of the transaction
+func DeserializeSignedTransaction(dat []byte) (*SignedTransaction, error) {
+	txobj, err := Deserialize(dat)
+	if err != nil {
+		return nil, err
+	}
+	return NewSignedTransaction(txobj)
+}
+
+// TransactionID returns a copy of the TransactionID
+func (p *SignedTransaction) TransactionID() []byte {
+	return cloneBytes(p.lazy.TransactionID)
+}
+
+// TransactionBaseDigest returns a copy of the TransactionBaseDigest
+func (p *SignedTransaction) TransactionBaseDigest() []byte {
+	return cloneBytes(p.lazy.TransactionBaseDigest)
+}
+
+// Digest returns a copy of the digest (TransactionID before truncation) signed by the signers
+func (p *SignedTransaction) Digest() []byte {
+	return cloneBytes(p.digest)
+}
+
+// Version returns the version of the transaction
+func (p *SignedTransaction) Version() uint32 {
+	return p.lazy.Version
+}
+
+// Timestamp returns the timestamp of the transaction
+func (p *SignedTransaction) Timestamp() int64 {
+	return p.lazy.Timestamp
+}
+
+// Pack returns a copy of the packed data of the transaction
+func (p *SignedTransaction) Pack() []byte {
+	return cloneBytes(p.packed)
+}
+
+// Serialize returns the serialized data of the transaction (see Serialize for formatType)
+func (p *SignedTransaction) Serialize(formatType uint16) ([]byte, error) {
+	dat := append(make([]byte, 0, 2+len(p.packed)), byte(formatType), byte(formatType>>8))
+	if formatType == FormatPlain {
+		return append(dat, p.packed...), nil
+	} else if formatType == FormatZlib {
+		return append(dat, ZlibCompress(&p.packed)...), nil
+	}
+	return nil, errors.New("formatType not supported")
+}
+
+// AssetGroupIDs returns the asset_group_ids in the transaction (see LazyTransaction.AssetGroupIDs)
+func (p *SignedTransaction) AssetGroupIDs() ([][]byte, error) {
+	return p.lazy.AssetGroupIDs()
+}
+
+// NumEvents returns the number of BBcEvent objects
+func (p *SignedTransaction) NumEvents() int {
+	return len(p.lazy.EventSections)
+}
+
+// NumReferences returns the number of BBcReference objects
+func (p *SignedTransaction) NumReferences() int {
+	return len(p.lazy.ReferenceSections)
+}
+
+// NumRelations returns the number of BBcRelation objects
+func (p *SignedTransaction) NumRelations() int {
+	return len(p.lazy.RelationSections)
+}
+
+// NumSignatures returns the number of BBcSignature objects
+func (p *SignedTransaction) NumSignatures() int {
+	return len(p.lazy.SignatureSections)
+}
+
+// Event returns a copy of the BBcEvent object at the index
+func (p *SignedTransaction) Event(idx int) (*BBcEvent, error) {
+	return p.lazy.Event(idx)
+}
+
+// Reference returns a copy of the BBcReference object at the index (not linked to a transaction)
+func (p *SignedTransaction) Reference(idx int) (*BBcReference, error) {
+	return p.lazy.Reference(idx)
+}
+
+// Relation returns a copy of the BBcRelation object at the index
+func (p *SignedTransaction) Relation(idx int) (*BBcRelation, error) {
+	return p.lazy.Relation(idx)
+}
+
+// Witness returns a copy of the BBcWitness object (nil if the transaction has no witness)
+func (p *SignedTransaction) Witness() (*BBcWitness, error) {
+	return p.lazy.Witness()
+}
+
+// CrossRef returns a copy of the BBcCrossRef object (nil if the transaction has no cross_ref)
+func (p *SignedTransaction) CrossRef() (*BBcCrossRef, error) {
+	return p.lazy.CrossRef()
+}
+
+// Signature returns a copy of the BBcSignature object at the index
+func (p *SignedTransaction) Signature(idx int) (*BBcSignature, error) {
+	return p.lazy.Signature(idx)
+}
+
+// Transaction returns a modifiable copy of the transaction
+func (p *SignedTransaction) Transaction() (*BBcTransaction, error) {
+	return p.lazy.Transaction()
+}
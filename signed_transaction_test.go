@@ -0,0 +1,158 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestSignedTransaction(t *testing.T) {
+	refTxObj := makeBaseTx(idLengthConfig)
+	followTx := makeFollowTX(idLengthConfig, &refTxObj)
+	followTx.Digest()
+
+	t.Run("accessors", func(t *testing.T) {
+		view, err := NewSignedTransaction(&followTx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(view.TransactionID(), followTx.TransactionID) || !bytes.Equal(view.Digest(), followTx.Digest()) ||
+			!bytes.Equal(view.TransactionBaseDigest(), followTx.TransactionBaseDigest) {
+			t.Fatal("invalid digests")
+		}
+		if view.Version() != followTx.Version || view.Timestamp() != followTx.Timestamp {
+			t.Fatal("invalid header")
+		}
+		if view.NumEvents() != 0 || view.NumReferences() != 1 || view.NumRelations() != 1 || view.NumSignatures() != len(followTx.Signatures) {
+			t.Fatal("invalid number of objects")
+		}
+		packed, _ := followTx.Pack()
+		if !bytes.Equal(view.Pack(), packed) {
+			t.Fatal("invalid packed data")
+		}
+		dat, err := view.Serialize(FormatZlib)
+		if err != nil {
+			t.Fatal(err)
+		}
+		view2, err := DeserializeSignedTransaction(dat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(view2.Pack(), packed) {
+			t.Fatal("invalid serialized data")
+		}
+		txobj, err := view.Transaction()
+		if err != nil || !txobj.Equal(&followTx) {
+			t.Fatalf("invalid transaction: %v", err)
+		}
+	})
+
+	t.Run("modifications do not affect the view", func(t *testing.T) {
+		txobj := followTx.Clone()
+		view, err := NewSignedTransaction(txobj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txid := view.TransactionID()
+		packed := view.Pack()
+
+		txobj.Relations[0].Asset.AssetBody[0] ^= 0xff
+		txobj.Timestamp += 1
+		view.TransactionID()[0] ^= 0xff
+		view.Pack()[0] ^= 0xff
+		rtn, _ := view.Relation(0)
+		rtn.Asset.AssetBody[0] ^= 0xff
+		copied, _ := view.Transaction()
+		copied.Signatures[0].Signature[0] ^= 0xff
+		copied.Digest()
+
+		if !bytes.Equal(view.TransactionID(), txid) || !bytes.Equal(view.Pack(), packed) {
+			t.Fatal("view must not be modified")
+		}
+		rtn, _ = view.Relation(0)
+		if !rtn.Equal(followTx.Relations[0]) {
+			t.Fatal("relation in the view must not be modified")
+		}
+		obj, _ := view.Transaction()
+		if result, _ := obj.VerifyAll(); !result {
+			t.Fatal("transaction in the view must not be modified")
+		}
+	})
+
+	t.Run("not finalized", func(t *testing.T) {
+		txobj := followTx.Clone()
+		txobj.Relations[0].Asset.AssetBody[0] ^= 0xff
+		if _, err := NewSignedTransaction(txobj); !errors.Is(err, ErrNotFinalized) {
+			t.Fatalf("stale transaction must be rejected: %v", err)
+		}
+		txobj.Digest()
+		if _, err := NewSignedTransaction(txobj); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("invalid signature must be rejected: %v", err)
+		}
+
+		txobj = followTx.Clone()
+		txobj.Signatures[0] = &BBcSignature{}
+		if _, err := NewSignedTransaction(txobj); !errors.Is(err, ErrNotFinalized) {
+			t.Fatalf("empty signature must be rejected: %v", err)
+		}
+	})
+
+	t.Run("concurrent access", func(t *testing.T) {
+		view, err := NewSignedTransaction(&followTx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txid := view.TransactionID()
+		var wg sync.WaitGroup
+		errs := make(chan error, 16)
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					if !bytes.Equal(view.TransactionID(), txid) {
+						errs <- errors.New("invalid transaction_id")
+						return
+					}
+					if _, err := view.AssetGroupIDs(); err != nil {
+						errs <- err
+						return
+					}
+					txobj, err := view.Transaction()
+					if err != nil {
+						errs <- err
+						return
+					}
+					txobj.Timestamp += 1
+					txobj.Digest()
+					if _, err := view.Serialize(FormatPlain); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+	})
+}
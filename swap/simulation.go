@@ -0,0 +1,152 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package swap
+
+import (
+	"bbclib"
+	"bbclib/domain"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MaxClockSkew is the maximum time by which the timestamp of a transaction submitted to Simulation can differ from the clock
+const MaxClockSkew = time.Minute
+
+/*
+Simulation definition
+
+Simulation is an in-process network of domains for the exchange protocol (e.g., for tests).
+A domain accepts a transaction if it conforms to the profile of the domain (domain.Descriptor.Rule), all signatures are valid
+(bbclib.SignatureRule), the references are resolved in the domain and signed by the approvers (bbclib.ReferenceRule), the timestamp is within MaxClockSkew
+of the clock (bbclib.TimestampWindowRule) and the locks and claims are valid (Rule),
+and if the transaction does not spend an output (including a lock) which has already been spent in the domain.
+"Now" gives the clock of the network (time.Now if nil), and "Keys" gives the public keys of the users for verifying the signatures
+(all transactions with signatures are rejected if nil).
+*/
+type Simulation struct {
+	Registry *domain.Registry
+	Now      func() time.Time
+	Keys     bbclib.KeyResolver
+	mutex    sync.Mutex
+	engines  map[string]*bbclib.RuleEngine
+	spent    map[string]bool
+}
+
+// NewSimulation returns the simulation of the domains
+func NewSimulation(descriptors ...*domain.Descriptor) (*Simulation, error) {
+	s := &Simulation{Registry: domain.NewRegistry(), engines: make(map[string]*bbclib.RuleEngine), spent: make(map[string]bool)}
+	for _, desc := range descriptors {
+		if _, err := s.Registry.Register(desc); err != nil {
+			return nil, err
+		}
+		engine := bbclib.NewRuleEngine()
+		for _, rule := range []bbclib.ValidationRule{
+			desc.Rule(),
+			bbclib.SignatureRule(s.publicKey),
+			bbclib.ReferenceRule(s.publicKey),
+			bbclib.TimestampWindowRule(MaxClockSkew, MaxClockSkew, s.now),
+			Rule(s.publicKey, s.now),
+		} {
+			if err := engine.RegisterGlobal(rule); err != nil {
+				return nil, err
+			}
+		}
+		s.engines[desc.ID()] = engine
+	}
+	return s, nil
+}
+
+// now returns the time of the clock
+func (s *Simulation) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+// publicKey returns the public key of the user given by Keys
+func (s *Simulation) publicKey(userID []byte) ([]byte, error) {
+	if s.Keys == nil {
+		return nil, errors.New("no public keys in the simulation")
+	}
+	return s.Keys(userID)
+}
+
+// Submit validates the transaction and stores it in the domain
+func (s *Simulation) Submit(domainID []byte, txobj *bbclib.BBcTransaction) error {
+	d, err := s.Registry.Domain(domainID)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.engines[d.Descriptor.ID()].Validate(txobj, d.Store.Get); err != nil {
+		return err
+	}
+	spent := make(map[string]bool)
+	for _, ref := range txobj.References {
+		key := fmt.Sprintf("%s:%x:%d", d.Descriptor.ID(), ref.TransactionID, ref.EventIndexInRef)
+		if s.spent[key] || spent[key] {
+			if refTx, err := d.Store.Get(ref.TransactionID); err == nil {
+				if _, err := GetLock(refTx, int(ref.EventIndexInRef)); err == nil {
+					return fmt.Errorf("lock %x: %w", ref.TransactionID, ErrAlreadyClaimed)
+				}
+			}
+			return fmt.Errorf("output %x (event %d): %w", ref.TransactionID, ref.EventIndexInRef, ErrAlreadySpent)
+		}
+		spent[key] = true
+	}
+	if err := s.Registry.Submit(domainID, txobj); err != nil {
+		return err
+	}
+	for key := range spent {
+		s.spent[key] = true
+	}
+	return nil
+}
+
+// Transaction returns the transaction stored in the domain
+func (s *Simulation) Transaction(domainID, transactionID []byte) (*bbclib.BBcTransaction, error) {
+	d, err := s.Registry.Domain(domainID)
+	if err != nil {
+		return nil, err
+	}
+	return d.Store.Get(transactionID)
+}
+
+// FindClaim returns the claim of the lock stored in the domain (ErrNotClaimed if not found)
+// The counterparty of the exchange watches the domain by FindClaim to learn the preimage.
+func (s *Simulation) FindClaim(domainID []byte, lock *Lock) (*Claim, error) {
+	d, err := s.Registry.Domain(domainID)
+	if err != nil {
+		return nil, err
+	}
+	for _, txid := range d.Store.TransactionIDs() {
+		txobj, err := d.Store.Get(txid)
+		if err != nil {
+			continue
+		}
+		for _, c := range Claims(txobj) {
+			if c.Of(lock) {
+				return c, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("lock %x: %w", lock.Transaction.TransactionID, ErrNotClaimed)
+}
@@ -0,0 +1,337 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package swap provides the atomic exchange of assets between two BBc-1 domains without a trusted intermediary (hash time-locked exchange).
+
+A hash lock is a BBcEvent whose BBcAsset has the lock body (LockBody) in MessagePack format. The lock spends an asset of the sender
+(an event in the same asset group, e.g., a token output or an ownership record) by a BBcReference, and keeps its body until it is claimed.
+The lock is claimed by a transaction that spends it and creates an event with the locked asset body for the claimant:
+  - Release: the recipient discloses the preimage of the hash before the timeout
+  - Refund: the sender takes back the asset after the timeout
+
+The claimant is a witness of the claim transaction, and the preimage is in the claim body (ClaimBody) of a BBcRelation pointing to the lock.
+
+The exchange of asset a in domain X (owned by Alice) and asset b in domain Y (owned by Bob) runs as follows:
+ 1. Alice generates a preimage (NewPreimage), and locks a for Bob with its hash (HashLock) and timeout T1 in domain X.
+ 2. Bob checks the lock (Lock.Check), and locks b for Alice with the same hash and an earlier timeout T2 in domain Y.
+    The lock has BBcCrossRef to the lock in domain X.
+ 3. Alice checks the lock in domain Y, and releases b by disclosing the preimage before T2.
+ 4. Bob finds the preimage in the release in domain Y (GetClaim), and releases a before T1.
+    The release has BBcCrossRef to the release in domain Y.
+
+If a party stops, the locks are refunded after the timeouts. Since T2 is earlier than T1, Bob has T1-T2 to release a after Alice releases b.
+
+Rule (or Validate) checks the locks and the claims in a transaction. The domain must also reject the second claim of a lock
+and the spending of a locked output, as it rejects the double spending of any asset (see Simulation).
+*/
+package swap
+
+import (
+	"bbclib"
+	"bbclib/internal/hashlock"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// LockBodyType is the value of Type in the lock body
+	LockBodyType = hashlock.LockBodyType
+	// ClaimBodyType is the value of Type in the claim body
+	ClaimBodyType = hashlock.ClaimBodyType
+	// PreimageLength is the length of the preimage generated by NewPreimage
+	PreimageLength = 32
+)
+
+var (
+	// ErrNotLock is returned when an asset does not have the lock body
+	ErrNotLock = hashlock.ErrNotLock
+	// ErrNotClaim is returned when a transaction does not have the claim body
+	ErrNotClaim = hashlock.ErrNotClaim
+	// ErrInvalidPreimage is returned when the preimage does not match the hash lock
+	ErrInvalidPreimage = hashlock.ErrInvalidPreimage
+	// ErrAlreadyClaimed is returned when the lock has already been claimed
+	ErrAlreadyClaimed = errors.New("hash lock already claimed")
+	// ErrNotClaimed is returned when the lock has not been claimed
+	ErrNotClaimed = errors.New("hash lock not claimed")
+	// ErrAlreadySpent is returned by Simulation when the output has already been spent
+	ErrAlreadySpent = errors.New("output already spent")
+)
+
+type (
+	// LockBody is the asset body of a hash lock (Timeout is in microseconds, the same as the timestamp of the transaction)
+	LockBody = hashlock.LockBody
+
+	// ClaimBody is the asset body of a claim (no preimage for a refund)
+	ClaimBody = hashlock.ClaimBody
+
+	// Lock is a hash lock, i.e., a BBcEvent in a transaction
+	Lock struct {
+		Transaction   *bbclib.BBcTransaction
+		EventIndex    int
+		AssetGroupID  []byte
+		AssetID       []byte
+		HashLock      []byte
+		Sender        []byte
+		Recipient     []byte
+		Timeout       int64
+		AssetBodyType uint16
+		AssetBody     []byte
+	}
+
+	// Claim is a release or a refund of a hash lock, i.e., a BBcRelation in a transaction
+	Claim struct {
+		Transaction       *bbclib.BBcTransaction
+		RelationIndex     int
+		LockTransactionID []byte
+		LockAssetID       []byte
+		Claimant          []byte
+		Preimage          []byte
+	}
+)
+
+// NewPreimage returns a random preimage
+func NewPreimage() []byte {
+	return bbclib.GetRandomValue(PreimageLength)
+}
+
+// HashLock returns the hash of the preimage (SHA-256)
+func HashLock(preimage []byte) []byte {
+	digest := sha256.Sum256(preimage)
+	return digest[:]
+}
+
+// CrossRef returns the cross reference to the transaction in the domain (e.g., the counterparty transaction of the exchange)
+func CrossRef(domainID []byte, txobj *bbclib.BBcTransaction) *bbclib.BBcCrossRef {
+	return &bbclib.BBcCrossRef{DomainID: domainID, TransactionID: txobj.TransactionID}
+}
+
+// Micro returns the time in microseconds (the unit of the timestamp of the transaction and Timeout)
+func Micro(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Microsecond)
+}
+
+// GetLock returns the hash lock in the event of the transaction
+func GetLock(txobj *bbclib.BBcTransaction, eventIdx int) (*Lock, error) {
+	l, err := hashlock.GetLock(txobj, eventIdx)
+	if err != nil {
+		return nil, err
+	}
+	return &Lock{
+		Transaction:   l.Transaction,
+		EventIndex:    l.EventIndex,
+		AssetGroupID:  l.AssetGroupID,
+		AssetID:       l.AssetID,
+		HashLock:      l.Body.HashLock,
+		Sender:        l.Body.Sender,
+		Recipient:     l.Body.Recipient,
+		Timeout:       l.Body.Timeout,
+		AssetBodyType: l.Body.AssetBodyType,
+		AssetBody:     l.Body.AssetBody,
+	}, nil
+}
+
+// FindLock returns the first hash lock in the transaction
+func FindLock(txobj *bbclib.BBcTransaction) (*Lock, error) {
+	for i := range txobj.Events {
+		if lock, err := GetLock(txobj, i); err == nil {
+			return lock, nil
+		}
+	}
+	return nil, ErrNotLock
+}
+
+// Matches returns true if the preimage matches the hash lock
+func (l *Lock) Matches(preimage []byte) bool {
+	return bytes.Equal(HashLock(preimage), l.HashLock)
+}
+
+// Expired returns true if the lock can be refunded at the time
+func (l *Lock) Expired(now time.Time) bool {
+	return Micro(now) >= l.Timeout
+}
+
+// Check checks the lock created by the counterparty before locking the asset in exchange (or releasing it):
+// the locks in the transaction are valid, and the lock has the hash lock, the recipient and the timeout not earlier than minTimeout
+// The locked output is resolved by resolve (in the domain of the lock), and the signature of the sender is verified with the public key given by keys.
+func (l *Lock) Check(hashLock, recipient []byte, minTimeout time.Time, resolve bbclib.TransactionResolver, keys bbclib.KeyResolver) error {
+	if violations := lockViolations(l.Transaction, resolve, keys); len(violations) > 0 {
+		return &bbclib.ValidationError{Violations: violations}
+	}
+	if !bytes.Equal(l.HashLock, hashLock) {
+		return errors.New("hash lock differs")
+	}
+	if !bytes.Equal(l.Recipient, normalizeID(recipient, len(l.Recipient))) {
+		return fmt.Errorf("recipient is %x", l.Recipient)
+	}
+	if l.Timeout < Micro(minTimeout) {
+		return fmt.Errorf("timeout %d is earlier than %d", l.Timeout, Micro(minTimeout))
+	}
+	return nil
+}
+
+// GetClaim returns the claim in the relation of the transaction
+func GetClaim(txobj *bbclib.BBcTransaction, relationIdx int) (*Claim, error) {
+	c, err := hashlock.GetClaim(txobj, relationIdx)
+	if err != nil {
+		return nil, err
+	}
+	return &Claim{
+		Transaction:       c.Transaction,
+		RelationIndex:     c.RelationIndex,
+		LockTransactionID: c.LockTransactionID,
+		LockAssetID:       c.LockAssetID,
+		Claimant:          c.Claimant,
+		Preimage:          c.Body.Preimage,
+	}, nil
+}
+
+// Claims returns all claims in the transaction
+func Claims(txobj *bbclib.BBcTransaction) []*Claim {
+	var claims []*Claim
+	for i := range txobj.Relations {
+		if c, err := GetClaim(txobj, i); err == nil {
+			claims = append(claims, c)
+		}
+	}
+	return claims
+}
+
+// IsRelease returns true if the claim is a release (with the preimage)
+func (c *Claim) IsRelease() bool {
+	return len(c.Preimage) > 0
+}
+
+// Of returns true if the claim is of the lock
+func (c *Claim) Of(lock *Lock) bool {
+	return bytes.Equal(c.LockTransactionID, lock.Transaction.TransactionID) && bytes.Equal(c.LockAssetID, lock.AssetID)
+}
+
+// CreateLock returns a builder of the transaction locking the asset in the event of the input transaction for the recipient
+// The sender is the owner (user_id) of the asset, and must sign the transaction. counterparty can be nil.
+func CreateLock(profile *bbclib.IdLengthProfile, input *bbclib.BBcTransaction, eventIdx int, recipient, hashLock []byte,
+	timeout time.Time, counterparty *bbclib.BBcCrossRef) (*bbclib.TransactionBuilder, error) {
+	if input == nil || eventIdx < 0 || eventIdx >= len(input.Events) || input.Events[eventIdx] == nil {
+		return nil, fmt.Errorf("no event (index=%d) in the input", eventIdx)
+	}
+	evt := input.Events[eventIdx]
+	if evt.Asset == nil || len(evt.Asset.UserID) == 0 {
+		return nil, errors.New("input event must have the asset with user_id")
+	}
+	if len(recipient) == 0 {
+		return nil, errors.New("recipient must be given")
+	}
+	if len(hashLock) != sha256.Size {
+		return nil, fmt.Errorf("hash lock must be %d bytes", sha256.Size)
+	}
+	if profile == nil {
+		profile = bbclib.DefaultIdLengthProfile()
+	}
+	sender := evt.Asset.UserID
+	assetGroupID := evt.AssetGroupID
+	body := LockBody{
+		Type:          LockBodyType,
+		HashLock:      hashLock,
+		Sender:        sender,
+		Recipient:     normalizeID(recipient, profile.Config().UserIdLength),
+		Timeout:       Micro(timeout),
+		AssetBodyType: evt.Asset.AssetBodyType,
+		AssetBody:     evt.Asset.AssetBody,
+	}
+	b := bbclib.NewTransactionBuilder(profile)
+	b.CreateReference(&assetGroupID, input, eventIdx)
+	b.AddEvent(&assetGroupID, func(e *bbclib.EventBuilder) {
+		e.AddReferenceIndex(0).CreateAsset(&sender, nil, &body)
+	})
+	b.AddWitness(&sender)
+	if err := setCrossRef(b, profile, counterparty); err != nil {
+		return nil, err
+	}
+	return b, b.Err()
+}
+
+// Release returns a builder of the transaction releasing the locked asset to the recipient with the preimage
+// The recipient must sign the transaction. counterparty can be nil.
+func Release(profile *bbclib.IdLengthProfile, lock *Lock, preimage []byte, counterparty *bbclib.BBcCrossRef) (*bbclib.TransactionBuilder, error) {
+	if lock == nil || lock.Transaction == nil {
+		return nil, errors.New("lock must be given")
+	}
+	if !lock.Matches(preimage) {
+		return nil, ErrInvalidPreimage
+	}
+	return claim(profile, lock, lock.Recipient, preimage, counterparty)
+}
+
+// Refund returns a builder of the transaction returning the locked asset to the sender after the timeout
+// The sender must sign the transaction, and the timestamp of the transaction must not be earlier than the timeout.
+func Refund(profile *bbclib.IdLengthProfile, lock *Lock) (*bbclib.TransactionBuilder, error) {
+	if lock == nil || lock.Transaction == nil {
+		return nil, errors.New("lock must be given")
+	}
+	return claim(profile, lock, lock.Sender, nil, nil)
+}
+
+// claim returns a builder of the transaction claiming the lock for the claimant
+func claim(profile *bbclib.IdLengthProfile, lock *Lock, claimant, preimage []byte, counterparty *bbclib.BBcCrossRef) (*bbclib.TransactionBuilder, error) {
+	if profile == nil {
+		profile = bbclib.DefaultIdLengthProfile()
+	}
+	assetGroupID := lock.AssetGroupID
+	lockTxID := lock.Transaction.TransactionID
+	lockAssetID := lock.AssetID
+	body := ClaimBody{Type: ClaimBodyType, Preimage: preimage}
+	b := bbclib.NewTransactionBuilder(profile)
+	b.CreateReference(&assetGroupID, lock.Transaction, lock.EventIndex)
+	b.AddEvent(&assetGroupID, func(e *bbclib.EventBuilder) {
+		e.AddReferenceIndex(0).AddMandatoryApprover(&claimant).CreateAsset(&claimant, nil, append([]byte{}, lock.AssetBody...))
+		if asset := e.Event().Asset; asset != nil {
+			asset.AssetBodyType = lock.AssetBodyType
+		}
+	})
+	b.AddRelation(&assetGroupID, func(r *bbclib.RelationBuilder) {
+		r.CreatePointer(&lockTxID, &lockAssetID).CreateAsset(&claimant, nil, &body)
+	})
+	b.AddWitness(&claimant)
+	if err := setCrossRef(b, profile, counterparty); err != nil {
+		return nil, err
+	}
+	return b, b.Err()
+}
+
+// setCrossRef sets the cross reference in the transaction (the TransactionID is truncated to the length in the profile)
+func setCrossRef(b *bbclib.TransactionBuilder, profile *bbclib.IdLengthProfile, xref *bbclib.BBcCrossRef) error {
+	if xref == nil {
+		return nil
+	}
+	if length := profile.Config().TransactionIdLength; len(xref.TransactionID) < length {
+		return fmt.Errorf("cross_ref: transaction_id of %d bytes cannot be referred from the domain of %d-byte transaction_id",
+			len(xref.TransactionID), length)
+	}
+	domainID := xref.DomainID
+	transactionID := xref.TransactionID
+	b.CreateCrossRef(&domainID, &transactionID)
+	return nil
+}
+
+// normalizeID returns the ID in the length (truncated or padded with zeros, as the IDs in the transaction)
+func normalizeID(id []byte, length int) []byte {
+	dat := make([]byte, length)
+	copy(dat, id)
+	return dat
+}
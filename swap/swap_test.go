@@ -0,0 +1,435 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package swap
+
+import (
+	"bbclib"
+	"bbclib/domain"
+	"bbclib/ownership"
+	"bbclib/token"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	alice      = bbclib.GetIdentifier("alice", 32)
+	bob        = bbclib.GetIdentifier("bob", 32)
+	issuer     = bbclib.GetIdentifier("issuer", 32)
+	tokenGroup = bbclib.GetIdentifier("token_group", 32)
+	certGroup  = bbclib.GetIdentifier("certificate_group", 32)
+)
+
+// testNetwork is the simulation of the token domain and the certificate domain with the assets of Alice and Bob
+type testNetwork struct {
+	*Simulation
+	clock       time.Time
+	keys        map[string]*bbclib.KeyPair
+	publicKeys  bbclib.PublicKeyMap
+	tokenDomain []byte
+	certDomain  []byte
+	aliceToken  *bbclib.BBcTransaction
+	bobCert     *bbclib.BBcTransaction
+}
+
+func newTestNetwork(t *testing.T) *testNetwork {
+	n := &testNetwork{clock: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), keys: map[string]*bbclib.KeyPair{}, publicKeys: bbclib.PublicKeyMap{}}
+	for _, id := range [][]byte{alice, bob, issuer} {
+		n.keys[string(id)], _ = bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+		n.publicKeys.Add(id, n.keys[string(id)].Pubkey)
+	}
+	tokenDomain := domain.NewDescriptor("token_domain", nil)
+	certDomain := domain.NewDescriptor("certificate_domain", nil)
+	sim, err := NewSimulation(tokenDomain, certDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Now = func() time.Time { return n.clock }
+	sim.Keys = n.publicKeys.Resolve
+	n.Simulation, n.tokenDomain, n.certDomain = sim, tokenDomain.DomainID, certDomain.DomainID
+
+	b, err := token.Mint(nil, tokenGroup, issuer, token.Output{Owner: alice, Amount: 100})
+	n.aliceToken = n.submit(t, n.tokenDomain, b, err, issuer)
+	b, err = ownership.Register(nil, certGroup, nil, bob, issuer, map[string]string{"name": "certificate"})
+	n.bobCert = n.submit(t, n.certDomain, b, err, issuer)
+	return n
+}
+
+// resolver returns the resolver of the transactions in the domain
+func (n *testNetwork) resolver(domainID []byte) bbclib.TransactionResolver {
+	return func(transactionID []byte) (*bbclib.BBcTransaction, error) {
+		return n.Transaction(domainID, transactionID)
+	}
+}
+
+// spent returns the resolver of the outputs spent by the transactions in the domain
+func (n *testNetwork) spent(t *testing.T, domainID []byte) bbclib.SpentResolver {
+	t.Helper()
+	d, err := n.Registry.Domain(domainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spent := make(bbclib.SpentMap)
+	for _, txid := range d.Store.TransactionIDs() {
+		txobj, err := d.Store.Get(txid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spent.Add(txobj)
+	}
+	return spent.Resolve
+}
+
+// build signs and builds the transaction at the time of the clock
+func (n *testNetwork) build(t *testing.T, b *bbclib.TransactionBuilder, err error, signer []byte) *bbclib.BBcTransaction {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txobj, err := b.SetTimestamp(Micro(n.clock)).Sign(&signer, n.keys[string(signer)], false).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return txobj
+}
+
+// submit builds the transaction and submits it to the domain
+func (n *testNetwork) submit(t *testing.T, domainID []byte, b *bbclib.TransactionBuilder, err error, signer []byte) *bbclib.BBcTransaction {
+	t.Helper()
+	txobj := n.build(t, b, err, signer)
+	if err := n.Submit(domainID, txobj); err != nil {
+		t.Fatal(err)
+	}
+	return txobj
+}
+
+func TestExchange(t *testing.T) {
+	t.Run("release", func(t *testing.T) {
+		n := newTestNetwork(t)
+		t1 := n.clock.Add(2 * time.Hour)
+		t2 := n.clock.Add(time.Hour)
+
+		// 1. Alice locks the token for Bob
+		preimage := NewPreimage()
+		b, err := CreateLock(nil, n.aliceToken, 0, bob, HashLock(preimage), t1, nil)
+		lockX := n.submit(t, n.tokenDomain, b, err, alice)
+
+		// 2. Bob checks the lock, and locks the certificate for Alice
+		n.clock = n.clock.Add(time.Minute)
+		lock, err := FindLock(lockX)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := lock.Check(HashLock(preimage), bob, t2.Add(30*time.Minute), n.resolver(n.tokenDomain), n.publicKeys.Resolve); err != nil {
+			t.Fatal(err)
+		}
+		if err := lock.Check(HashLock(preimage), bob, t1.Add(time.Minute), n.resolver(n.tokenDomain), n.publicKeys.Resolve); err == nil {
+			t.Fatal("lock with too early timeout must be rejected")
+		}
+		if err := lock.Check(HashLock(preimage), alice, t2, n.resolver(n.tokenDomain), n.publicKeys.Resolve); err == nil {
+			t.Fatal("lock for another recipient must be rejected")
+		}
+		b, err = CreateLock(nil, n.bobCert, 0, alice, lock.HashLock, t2, CrossRef(n.tokenDomain, lockX))
+		lockY := n.submit(t, n.certDomain, b, err, bob)
+		if _, err := n.Registry.ResolveCrossRef(lockY.Crossref); err != nil {
+			t.Fatal(err)
+		}
+
+		// 3. Alice releases the certificate by disclosing the preimage
+		n.clock = n.clock.Add(time.Minute)
+		certLock, _ := FindLock(lockY)
+		if err := certLock.Check(HashLock(preimage), alice, n.clock, n.resolver(n.certDomain), n.publicKeys.Resolve); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Release(nil, certLock, NewPreimage(), nil); !errors.Is(err, ErrInvalidPreimage) {
+			t.Fatalf("wrong preimage must be rejected: %v", err)
+		}
+		if _, err := n.FindClaim(n.certDomain, certLock); !errors.Is(err, ErrNotClaimed) {
+			t.Fatalf("lock must not be claimed yet: %v", err)
+		}
+		b, err = Release(nil, certLock, preimage, CrossRef(n.tokenDomain, lockX))
+		releaseY := n.submit(t, n.certDomain, b, err, alice)
+
+		// 4. Bob learns the preimage in the certificate domain, and releases the token
+		n.clock = n.clock.Add(time.Minute)
+		claim, err := n.FindClaim(n.certDomain, certLock)
+		if err != nil || !claim.IsRelease() || !bytes.Equal(claim.Transaction.TransactionID, releaseY.TransactionID) {
+			t.Fatalf("release must be found: %v", err)
+		}
+		b, err = Release(nil, lock, claim.Preimage, CrossRef(n.certDomain, releaseY))
+		releaseX := n.submit(t, n.tokenDomain, b, err, bob)
+
+		// the assets are exchanged
+		utxo, err := token.GetUTXO(releaseX, 0)
+		if err != nil || !bytes.Equal(utxo.Owner, bob) || utxo.Amount != 100 {
+			t.Fatalf("token must be owned by Bob: %v", err)
+		}
+		record, err := ownership.GetRecord(releaseY, 0)
+		if err != nil || !bytes.Equal(record.Owner, alice) || record.Metadata["name"] != "certificate" {
+			t.Fatalf("certificate must be owned by Alice: %v", err)
+		}
+		b, err = token.Transfer(nil, []*token.UTXO{utxo}, []token.Output{{Owner: alice, Amount: 10}}, nil)
+		n.build(t, b, err, bob)
+
+		// the token moves through the lock, and the history of the certificate follows the lock
+		for _, txobj := range []*bbclib.BBcTransaction{lockX, releaseX} {
+			if _, err := token.ValidateBalance(txobj, n.resolver(n.tokenDomain), n.publicKeys.Resolve); err != nil {
+				t.Fatalf("lock and release must be balanced: %v", err)
+			}
+		}
+		owner, err := ownership.CurrentOwner(releaseY, record.ItemID, [][]byte{issuer}, n.resolver(n.certDomain), n.spent(t, n.certDomain), n.publicKeys.Resolve)
+		if err != nil || !bytes.Equal(owner, alice) {
+			t.Fatalf("certificate must be owned by Alice: %v", err)
+		}
+		history, err := ownership.History(releaseY, record.ItemID, [][]byte{issuer}, n.resolver(n.certDomain), n.spent(t, n.certDomain), n.publicKeys.Resolve)
+		if err != nil || len(history) != 2 || !bytes.Equal(history[0].Transaction.TransactionID, n.bobCert.TransactionID) {
+			t.Fatalf("history must lead to the registration: %v", err)
+		}
+		if _, err := ownership.CurrentOwner(n.bobCert, record.ItemID, [][]byte{issuer}, n.resolver(n.certDomain), n.spent(t, n.certDomain), n.publicKeys.Resolve); !errors.Is(err, ownership.ErrTransferred) {
+			t.Fatalf("locked certificate must not be owned by Bob: %v", err)
+		}
+
+		// the locks cannot be claimed again
+		n.clock = t1
+		b, err = Refund(nil, lock)
+		refund := n.build(t, b, err, alice)
+		if err := n.Submit(n.tokenDomain, refund); !errors.Is(err, ErrAlreadyClaimed) {
+			t.Fatalf("claimed lock must not be refunded: %v", err)
+		}
+	})
+
+	t.Run("refund", func(t *testing.T) {
+		n := newTestNetwork(t)
+		preimage := NewPreimage()
+		timeout := n.clock.Add(time.Hour)
+		b, err := CreateLock(nil, n.aliceToken, 0, bob, HashLock(preimage), timeout, nil)
+		lock, _ := FindLock(n.submit(t, n.tokenDomain, b, err, alice))
+
+		b, err = Refund(nil, lock)
+		refund := n.build(t, b, err, alice)
+		var verr *bbclib.ValidationError
+		if err := n.Submit(n.tokenDomain, refund); !errors.As(err, &verr) {
+			t.Fatalf("refund before the timeout must be rejected: %v", err)
+		}
+
+		// the refund with the timestamp in the future is rejected by the clock of the domain
+		b, _ = Refund(nil, lock)
+		b.SetTimestamp(Micro(timeout))
+		early, _ := b.Sign(&alice, n.keys[string(alice)], false).Build()
+		if err := n.Submit(n.tokenDomain, early); !errors.As(err, &verr) {
+			t.Fatalf("refund before the timeout must be rejected: %v", err)
+		}
+
+		n.clock = timeout
+		b, err = Release(nil, lock, preimage, nil)
+		release := n.build(t, b, err, bob)
+		if err := n.Submit(n.tokenDomain, release); !errors.As(err, &verr) {
+			t.Fatalf("release after the timeout must be rejected: %v", err)
+		}
+
+		// the release after the timeout is rejected by the clock even if the timestamp is backdated
+		b, _ = Release(nil, lock, preimage, nil)
+		b.SetTimestamp(Micro(timeout.Add(-MaxClockSkew / 2)))
+		late, _ := b.Sign(&bob, n.keys[string(bob)], false).Build()
+		if err := n.Submit(n.tokenDomain, late); !errors.As(err, &verr) {
+			t.Fatalf("release after the timeout must be rejected: %v", err)
+		}
+		b, _ = Release(nil, lock, preimage, nil)
+		b.SetTimestamp(Micro(timeout.Add(-10 * time.Minute)))
+		late, _ = b.Sign(&bob, n.keys[string(bob)], false).Build()
+		resolve := n.resolver(n.tokenDomain)
+		if err := Validate(late, resolve, n.publicKeys.Resolve, n.clock); !errors.As(err, &verr) {
+			t.Fatalf("release after the timeout must be rejected: %v", err)
+		}
+		if err := n.Submit(n.tokenDomain, late); !errors.As(err, &verr) {
+			t.Fatalf("transaction older than MaxClockSkew must be rejected: %v", err)
+		}
+		b, err = Refund(nil, lock)
+		refund = n.submit(t, n.tokenDomain, b, err, alice)
+		if utxo, err := token.GetUTXO(refund, 0); err != nil || !bytes.Equal(utxo.Owner, alice) || utxo.Amount != 100 {
+			t.Fatalf("token must be returned to Alice: %v", err)
+		}
+		claim, err := n.FindClaim(n.tokenDomain, lock)
+		if err != nil || claim.IsRelease() || !bytes.Equal(claim.Claimant, alice) {
+			t.Fatalf("refund must be found: %v", err)
+		}
+		if _, err := token.ValidateBalance(refund, resolve, n.publicKeys.Resolve); err != nil {
+			t.Fatalf("refund must be balanced: %v", err)
+		}
+
+		// the certificate is refunded to Bob
+		b, err = CreateLock(nil, n.bobCert, 0, alice, HashLock(preimage), n.clock.Add(time.Hour), nil)
+		certLock, _ := FindLock(n.submit(t, n.certDomain, b, err, bob))
+		n.clock = n.clock.Add(time.Hour)
+		b, err = Refund(nil, certLock)
+		certRefund := n.submit(t, n.certDomain, b, err, bob)
+		record, _ := ownership.GetRecord(n.bobCert, 0)
+		owner, err := ownership.CurrentOwner(certRefund, record.ItemID, [][]byte{issuer}, n.resolver(n.certDomain), n.spent(t, n.certDomain), n.publicKeys.Resolve)
+		if err != nil || !bytes.Equal(owner, bob) {
+			t.Fatalf("certificate must be returned to Bob: %v", err)
+		}
+	})
+
+	t.Run("invalid claims", func(t *testing.T) {
+		n := newTestNetwork(t)
+		preimage := NewPreimage()
+		b, err := CreateLock(nil, n.aliceToken, 0, bob, HashLock(preimage), n.clock.Add(time.Hour), nil)
+		lockTx := n.submit(t, n.tokenDomain, b, err, alice)
+		lock, _ := FindLock(lockTx)
+		resolve := n.resolver(n.tokenDomain)
+
+		// an extra output copies the locked asset
+		b, err = Release(nil, lock, preimage, nil)
+		b.AddEvent(&tokenGroup, func(e *bbclib.EventBuilder) {
+			e.AddReferenceIndex(0).AddMandatoryApprover(&bob).CreateAsset(&bob, nil, "copy")
+		})
+		if err := Validate(n.build(t, b, err, bob), resolve, n.publicKeys.Resolve, n.clock); err == nil {
+			t.Fatal("lock spent by two events must be rejected")
+		}
+
+		// the lock is spent without the claim
+		b = bbclib.NewTransactionBuilder(nil).CreateReference(&tokenGroup, lockTx, 0).
+			AddEvent(&tokenGroup, func(e *bbclib.EventBuilder) {
+				e.AddReferenceIndex(0).AddMandatoryApprover(&bob).CreateAsset(&bob, nil, lock.AssetBody)
+			})
+		if err := Validate(n.build(t, b, nil, bob), resolve, n.publicKeys.Resolve, n.clock); err == nil {
+			t.Fatal("lock spent without the claim must be rejected")
+		}
+
+		// the release is claimed by the sender
+		b, err = claim(nil, lock, alice, preimage, nil)
+		if err := Validate(n.build(t, b, err, alice), resolve, n.publicKeys.Resolve, n.clock); err == nil {
+			t.Fatal("release by the sender must be rejected")
+		}
+
+		// the lock without the signature of the sender
+		b = bbclib.NewTransactionBuilder(nil).AddEvent(&tokenGroup, func(e *bbclib.EventBuilder) {
+			e.CreateAsset(&alice, nil, &LockBody{Type: LockBodyType, HashLock: lock.HashLock, Sender: alice, Recipient: bob, Timeout: lock.Timeout})
+		})
+		forged := n.build(t, b, nil, bob)
+		if err := Validate(forged, nil, n.publicKeys.Resolve, n.clock); err == nil {
+			t.Fatal("lock without the signature of the sender must be rejected")
+		}
+		forgedLock, _ := FindLock(forged)
+		if err := forgedLock.Check(lock.HashLock, bob, n.clock, resolve, n.publicKeys.Resolve); err == nil {
+			t.Fatal("forged lock must not pass the check")
+		}
+
+		// the lock of a token without the reference to it
+		if err := forgedLock.Check(lock.HashLock, bob, n.clock, resolve, n.publicKeys.Resolve); !strings.Contains(err.Error(), "exactly one output") {
+			t.Fatalf("lock without the locked output must be rejected: %v", err)
+		}
+
+		if _, err := CreateLock(nil, n.aliceToken, 0, bob, []byte("short"), n.clock, nil); err == nil {
+			t.Fatal("hash lock must be 32 bytes")
+		}
+		profile, _ := bbclib.NewIdLengthProfile(&bbclib.BBcIdConfig{TransactionIdLength: 8})
+		short := &bbclib.BBcCrossRef{DomainID: n.certDomain, TransactionID: make([]byte, 8)}
+		if _, err := CreateLock(nil, n.aliceToken, 0, bob, lock.HashLock, n.clock, short); err == nil {
+			t.Fatal("cross_ref with a shorter transaction_id must be rejected")
+		}
+		if _, err := CreateLock(profile, n.aliceToken, 0, bob, lock.HashLock, n.clock, CrossRef(n.certDomain, n.bobCert)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("forged locks", func(t *testing.T) {
+		n := newTestNetwork(t)
+		mallory, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+		hashLock := HashLock(NewPreimage())
+		timeout := n.clock.Add(time.Hour)
+		resolve := n.resolver(n.tokenDomain)
+		var verr *bbclib.ValidationError
+
+		// mallory signs the lock of Alice's token in the name of Alice
+		b, err := CreateLock(nil, n.aliceToken, 0, bob, hashLock, timeout, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forged, err := b.SetTimestamp(Micro(n.clock)).Sign(&alice, mallory, false).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Validate(forged, resolve, n.publicKeys.Resolve, n.clock); !errors.As(err, &verr) {
+			t.Fatalf("lock signed with a wrong key must be rejected: %v", err)
+		}
+		lock, _ := FindLock(forged)
+		if err := lock.Check(hashLock, bob, timeout, resolve, n.publicKeys.Resolve); err == nil {
+			t.Fatal("lock signed with a wrong key must not pass the check")
+		}
+		if err := n.Submit(n.tokenDomain, forged); !errors.As(err, &verr) {
+			t.Fatalf("lock signed with a wrong key must not be accepted: %v", err)
+		}
+
+		// Alice locks an invented asset body with the reference to her token
+		assetGroupID := tokenGroup
+		b = bbclib.NewTransactionBuilder(nil).CreateReference(&assetGroupID, n.aliceToken, 0).
+			AddEvent(&assetGroupID, func(e *bbclib.EventBuilder) {
+				e.AddReferenceIndex(0).CreateAsset(&alice, nil, &LockBody{Type: LockBodyType, HashLock: hashLock, Sender: alice, Recipient: bob,
+					Timeout: Micro(timeout), AssetBodyType: bbclib.AssetBodyTypeRaw, AssetBody: []byte("1000000 tokens")})
+			}).
+			AddWitness(&alice)
+		invented := n.build(t, b, nil, alice)
+		lock, _ = FindLock(invented)
+		if err := lock.Check(hashLock, bob, timeout, resolve, n.publicKeys.Resolve); err == nil || !strings.Contains(err.Error(), "asset body") {
+			t.Fatalf("lock with an invented asset body must not pass the check: %v", err)
+		}
+		if err := n.Submit(n.tokenDomain, invented); !errors.As(err, &verr) {
+			t.Fatalf("lock with an invented asset body must not be accepted: %v", err)
+		}
+
+		// the resolver does not give the locked output
+		b, err = CreateLock(nil, n.aliceToken, 0, bob, hashLock, timeout, nil)
+		valid := n.build(t, b, err, alice)
+		b, err = token.Mint(nil, tokenGroup, issuer, token.Output{Owner: alice, Amount: 100}, token.Output{Owner: bob, Amount: 1})
+		otherToken := n.build(t, b, err, issuer)
+		tampered := n.aliceToken.Clone()
+		tampered.Events[0].Asset.AssetBody = []byte("modified")
+		for name, resolve := range map[string]bbclib.TransactionResolver{
+			"nil transaction":     func([]byte) (*bbclib.BBcTransaction, error) { return nil, nil },
+			"another transaction": func([]byte) (*bbclib.BBcTransaction, error) { return otherToken, nil },
+			"stale transaction":   func([]byte) (*bbclib.BBcTransaction, error) { return tampered, nil },
+		} {
+			if err := Validate(valid, resolve, n.publicKeys.Resolve, n.clock); !errors.As(err, &verr) {
+				t.Fatalf("%s: lock must be rejected: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("locked output cannot be spent again", func(t *testing.T) {
+		n := newTestNetwork(t)
+		b, err := CreateLock(nil, n.aliceToken, 0, bob, HashLock(NewPreimage()), n.clock.Add(time.Hour), nil)
+		n.submit(t, n.tokenDomain, b, err, alice)
+
+		// lock twice
+		b, err = CreateLock(nil, n.aliceToken, 0, issuer, HashLock(NewPreimage()), n.clock.Add(time.Hour), nil)
+		if err := n.Submit(n.tokenDomain, n.build(t, b, err, alice)); !errors.Is(err, ErrAlreadySpent) {
+			t.Fatalf("output must not be locked twice: %v", err)
+		}
+
+		// transfer after lock
+		utxo, err := token.GetUTXO(n.aliceToken, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err = token.Transfer(nil, []*token.UTXO{utxo}, []token.Output{{Owner: bob, Amount: 100}}, nil)
+		if err := n.Submit(n.tokenDomain, n.build(t, b, err, alice)); !errors.Is(err, ErrAlreadySpent) {
+			t.Fatalf("locked output must not be transferred: %v", err)
+		}
+	})
+}
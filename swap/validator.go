@@ -0,0 +1,182 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package swap
+
+import (
+	"bbclib"
+	"bbclib/internal/hashlock"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RuleHashLock is the name of the rule returned by Rule
+const RuleHashLock = hashlock.Rule
+
+// violation returns the violation of RuleHashLock at the path
+func violation(path, format string, args ...interface{}) bbclib.Violation {
+	return hashlock.Violation(path, format, args...)
+}
+
+// Rule returns the validation rule which checks the locks and the claims in transactions (see Validate)
+// now is time.Now if nil.
+func Rule(keys bbclib.KeyResolver, now func() time.Time) bbclib.ValidationRule {
+	if now == nil {
+		now = time.Now
+	}
+	return bbclib.NewRule(RuleHashLock, func(ctx *bbclib.ValidationContext) []bbclib.Violation {
+		return violations(ctx.Transaction, ctx.Resolve, keys, now())
+	})
+}
+
+// Validate checks the locks created in the transaction and the claims of the locks referred by the transaction,
+// and returns *bbclib.ValidationError with all violations (nil if valid)
+// The signatures of the senders and the claimants are verified with their public keys given by keys.
+// The checks of a lock are:
+//   - the lock has the hash lock of SHA-256, the recipient and the timeout later than the timestamp of the transaction
+//   - the sender is the owner (user_id) of the lock, and has signed the transaction as a witness
+//   - the lock event refers to exactly one output, which is in the asset group of the lock, owned by the sender and has the locked asset body
+//   - the lock event has no approvers (the claim is authorized by the signature of the claimant)
+//
+// The checks of a claim are:
+//   - a release has the preimage of the hash lock and the timestamp and now earlier than the timeout, and is signed by the recipient
+//   - a refund has the timestamp and now not earlier than the timeout, and is signed by the sender
+//   - the lock is spent by only one event, which has the locked asset body for the claimant (the owner and the only mandatory approver)
+func Validate(txobj *bbclib.BBcTransaction, resolve bbclib.TransactionResolver, keys bbclib.KeyResolver, now time.Time) error {
+	if txobj == nil {
+		return errors.New("transaction must be given")
+	}
+	if resolve == nil {
+		resolve = func(transactionID []byte) (*bbclib.BBcTransaction, error) { return nil, bbclib.ErrNoResolver }
+	}
+	if v := violations(txobj, resolve, keys, now); len(v) > 0 {
+		return &bbclib.ValidationError{Violations: v}
+	}
+	return nil
+}
+
+// violations returns the violations of the locks and the claims in the transaction
+// The references which cannot be resolved are reported only if the transaction has claims (see also bbclib.ReferenceRule).
+func violations(txobj *bbclib.BBcTransaction, resolve bbclib.TransactionResolver, keys bbclib.KeyResolver, now time.Time) []bbclib.Violation {
+	v := lockViolations(txobj, resolve, keys)
+	_, err := FindLock(txobj)
+	involved := err == nil
+	claims := Claims(txobj)
+	for i, ref := range txobj.References {
+		if ref == nil {
+			continue
+		}
+		refTx, err := resolve(ref.TransactionID)
+		if err != nil {
+			if len(claims) > 0 {
+				v = append(v, violation(fmt.Sprintf("references[%d].transaction_id", i), "cannot resolve %x: %v", ref.TransactionID, err))
+			}
+			continue
+		}
+		if refTx == nil || !bytes.Equal(refTx.TransactionID, ref.TransactionID) || refTx.IsDirty() {
+			if len(claims) > 0 {
+				v = append(v, violation(fmt.Sprintf("references[%d].transaction_id", i), "referred transaction %x not found", ref.TransactionID))
+			}
+			continue
+		}
+		lock, err := hashlock.GetLock(refTx, int(ref.EventIndexInRef))
+		if err != nil {
+			continue
+		}
+		involved = true
+		v = append(v, hashlock.ClaimViolations(txobj, i, lock, keys, Micro(now))...)
+	}
+	if involved {
+		if result, idx := txobj.VerifyAll(); !result {
+			v = append(v, violation(fmt.Sprintf("signatures[%d]", idx), "%v", bbclib.ErrInvalidSignature))
+		}
+	}
+	return v
+}
+
+// lockViolations returns the violations of the locks created in the transaction
+func lockViolations(txobj *bbclib.BBcTransaction, resolve bbclib.TransactionResolver, keys bbclib.KeyResolver) []bbclib.Violation {
+	var v []bbclib.Violation
+	for i, evt := range txobj.Events {
+		lock, err := GetLock(txobj, i)
+		if err != nil {
+			continue
+		}
+		path := fmt.Sprintf("events[%d]", i)
+		if len(lock.HashLock) != sha256.Size {
+			v = append(v, violation(path+".asset", "hash lock must be %d bytes", sha256.Size))
+		}
+		if len(lock.Recipient) == 0 {
+			v = append(v, violation(path+".asset", "recipient must be given"))
+		}
+		if lock.Timeout <= txobj.Timestamp {
+			v = append(v, violation(path+".asset", "timeout %d must be later than the timestamp %d", lock.Timeout, txobj.Timestamp))
+		}
+		if len(lock.Sender) == 0 || !bytes.Equal(evt.Asset.UserID, lock.Sender) {
+			v = append(v, violation(path+".asset.user_id", "owner of the lock must be the sender"))
+		} else if err := hashlock.SignedBy(txobj, lock.Sender, keys); err != nil {
+			v = append(v, violation(path, "lock must be signed by the sender %x: %v", lock.Sender, err))
+		}
+		if len(evt.MandatoryApprovers) > 0 || len(evt.OptionApprovers) > 0 {
+			v = append(v, violation(path, "lock must not have approvers"))
+		}
+		if len(evt.ReferenceIndices) != 1 {
+			v = append(v, violation(path+".reference_indices", "lock must refer to exactly one output (%d references)", len(evt.ReferenceIndices)))
+		} else {
+			v = append(v, lockedOutputViolations(txobj, evt.ReferenceIndices[0], lock, resolve)...)
+		}
+	}
+	return v
+}
+
+// lockedOutputViolations returns the violations of the output locked by the reference at the index
+// The output must be an event in the asset group of the lock, owned by the sender, and have the asset body kept in the lock.
+func lockedOutputViolations(txobj *bbclib.BBcTransaction, refIdx int, lock *Lock, resolve bbclib.TransactionResolver) []bbclib.Violation {
+	path := fmt.Sprintf("references[%d]", refIdx)
+	if refIdx < 0 || refIdx >= len(txobj.References) || txobj.References[refIdx] == nil {
+		return []bbclib.Violation{violation(path, "no reference to the locked output")}
+	}
+	ref := txobj.References[refIdx]
+	if resolve == nil {
+		return []bbclib.Violation{violation(path+".transaction_id", "cannot resolve %x: %v", ref.TransactionID, bbclib.ErrNoResolver)}
+	}
+	refTx, err := resolve(ref.TransactionID)
+	if err != nil {
+		return []bbclib.Violation{violation(path+".transaction_id", "cannot resolve %x: %v", ref.TransactionID, err)}
+	}
+	if refTx == nil || !bytes.Equal(refTx.TransactionID, ref.TransactionID) {
+		return []bbclib.Violation{violation(path+".transaction_id", "referred transaction %x not found", ref.TransactionID)}
+	}
+	if refTx.IsDirty() {
+		return []bbclib.Violation{violation(path+".transaction_id", "transaction_id of the referred transaction %x does not match its content", ref.TransactionID)}
+	}
+	if int(ref.EventIndexInRef) >= len(refTx.Events) || refTx.Events[ref.EventIndexInRef] == nil {
+		return []bbclib.Violation{violation(path+".event_index_in_ref", "no event %d in transaction %x", ref.EventIndexInRef, ref.TransactionID)}
+	}
+	output := refTx.Events[ref.EventIndexInRef]
+	switch {
+	case !bytes.Equal(ref.AssetGroupID, lock.AssetGroupID) || !bytes.Equal(output.AssetGroupID, lock.AssetGroupID):
+		return []bbclib.Violation{violation(path+".asset_group_id", "locked output must be in the asset group of the lock")}
+	case output.Asset == nil || !bytes.Equal(output.Asset.UserID, lock.Sender):
+		return []bbclib.Violation{violation(path, "locked output must be owned by the sender %x", lock.Sender)}
+	case output.Asset.AssetBodyType != lock.AssetBodyType || !bytes.Equal(output.Asset.AssetBody, lock.AssetBody):
+		return []bbclib.Violation{violation(path, "lock must have the asset body of the locked output")}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package token provides fungible tokens on the UTXO model of BBc-1.
+
+A token output (UTXO) is a BBcEvent whose BBcAsset has the token body (Body) in MessagePack format.
+The owner of the output is the user_id of the asset, and is also the mandatory approver of the event,
+so that the output can be spent only with the signature of the owner.
+The AssetGroupID of the event identifies the kind of token.
+
+A transaction spends outputs by BBcReference objects to the events, and creates new outputs as BBcEvent objects.
+Mint, Transfer, Split and Merge return a TransactionBuilder, so that the signers are registered by TransactionBuilder.Sign
+(the issuer for Mint, the owners of the inputs for the others) before building the transaction.
+*/
+package token
+
+import (
+	"bbclib"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// BodyType is the value of Type in the token body
+const BodyType = "bbc1-token"
+
+var (
+	// ErrNotToken is returned when an asset does not have the token body
+	ErrNotToken = errors.New("not a token asset")
+	// ErrInsufficientBalance is returned when the inputs are not enough for the outputs
+	ErrInsufficientBalance = errors.New("insufficient balance")
+)
+
+type (
+	// Body is the asset body of a token output
+	Body struct {
+		Type   string `codec:"type"`
+		Amount uint64 `codec:"amount"`
+		Memo   string `codec:"memo,omitempty"`
+	}
+
+	// Output is a token output to be created in a transaction
+	Output struct {
+		Owner  []byte
+		Amount uint64
+		Memo   string
+	}
+
+	// UTXO is an unspent token output, i.e., a BBcEvent in a transaction
+	UTXO struct {
+		Transaction  *bbclib.BBcTransaction
+		EventIndex   int
+		AssetGroupID []byte
+		Owner        []byte
+		Amount       uint64
+	}
+)
+
+// NewBody returns the token body with the amount
+func NewBody(amount uint64, memo string) Body {
+	return Body{Type: BodyType, Amount: amount, Memo: memo}
+}
+
+// DecodeBody decodes the token body in the asset (ErrNotToken if the asset is not a token)
+func DecodeBody(asset *bbclib.BBcAsset) (*Body, error) {
+	if asset == nil || asset.AssetBodyType != bbclib.AssetBodyTypeMsgpack {
+		return nil, ErrNotToken
+	}
+	var body Body
+	if err := asset.DecodeBody(&body); err != nil || body.Type != BodyType {
+		return nil, ErrNotToken
+	}
+	return &body, nil
+}
+
+// GetUTXO returns the token output in the event of the transaction
+func GetUTXO(txobj *bbclib.BBcTransaction, eventIdx int) (*UTXO, error) {
+	if txobj == nil || eventIdx < 0 || eventIdx >= len(txobj.Events) {
+		return nil, fmt.Errorf("no event (index=%d)", eventIdx)
+	}
+	evt := txobj.Events[eventIdx]
+	body, err := DecodeBody(evt.Asset)
+	if err != nil {
+		return nil, fmt.Errorf("events[%d]: %w", eventIdx, err)
+	}
+	return &UTXO{
+		Transaction:  txobj,
+		EventIndex:   eventIdx,
+		AssetGroupID: evt.AssetGroupID,
+		Owner:        evt.Asset.UserID,
+		Amount:       body.Amount,
+	}, nil
+}
+
+// Outputs returns all token outputs created in the transaction
+func Outputs(txobj *bbclib.BBcTransaction) []*UTXO {
+	var utxos []*UTXO
+	for i := range txobj.Events {
+		if u, err := GetUTXO(txobj, i); err == nil {
+			utxos = append(utxos, u)
+		}
+	}
+	return utxos
+}
+
+// Key returns the identifier of the output (TransactionID and event index)
+func (u *UTXO) Key() string {
+	return outputKey(u.Transaction.TransactionID, u.EventIndex)
+}
+
+// outputKey returns the identifier of the output
+func outputKey(transactionID []byte, eventIdx int) string {
+	return fmt.Sprintf("%s:%d", hex.EncodeToString(transactionID), eventIdx)
+}
+
+// Mint returns a builder of the transaction issuing new tokens (the issuer is a witness, and must sign it)
+func Mint(profile *bbclib.IdLengthProfile, assetGroupID, issuer []byte, outputs ...Output) (*bbclib.TransactionBuilder, error) {
+	if len(issuer) == 0 {
+		return nil, errors.New("issuer must be given")
+	}
+	if _, err := sumOutputs(outputs); err != nil {
+		return nil, err
+	}
+	b := bbclib.NewTransactionBuilder(profile)
+	addOutputs(b, assetGroupID, outputs, 0)
+	b.AddWitness(&issuer)
+	return b, b.Err()
+}
+
+// Transfer returns a builder of the transaction sending tokens to the outputs
+// The inputs must be in the same asset group. The rest of the inputs is sent back to changeOwner (the owner of the first input if nil).
+func Transfer(profile *bbclib.IdLengthProfile, inputs []*UTXO, outputs []Output, changeOwner []byte) (*bbclib.TransactionBuilder, error) {
+	in, err := sumInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	out, err := sumOutputs(outputs)
+	if err != nil {
+		return nil, err
+	}
+	if in < out {
+		return nil, fmt.Errorf("%w: inputs %d < outputs %d", ErrInsufficientBalance, in, out)
+	}
+	if in > out {
+		if changeOwner == nil {
+			changeOwner = inputs[0].Owner
+		}
+		outputs = append(append([]Output{}, outputs...), Output{Owner: changeOwner, Amount: in - out})
+	}
+	return spend(profile, inputs, outputs)
+}
+
+// Split returns a builder of the transaction splitting the output into the amounts (owned by the same owner)
+func Split(profile *bbclib.IdLengthProfile, input *UTXO, amounts ...uint64) (*bbclib.TransactionBuilder, error) {
+	if input == nil {
+		return nil, errors.New("input must be given")
+	}
+	outputs := make([]Output, len(amounts))
+	for i, amount := range amounts {
+		outputs[i] = Output{Owner: input.Owner, Amount: amount}
+	}
+	out, err := sumOutputs(outputs)
+	if err != nil {
+		return nil, err
+	}
+	if out != input.Amount {
+		return nil, fmt.Errorf("sum of the amounts (%d) must be equal to the input (%d)", out, input.Amount)
+	}
+	return spend(profile, []*UTXO{input}, outputs)
+}
+
+// Merge returns a builder of the transaction merging the outputs of the same owner into one output
+func Merge(profile *bbclib.IdLengthProfile, inputs ...*UTXO) (*bbclib.TransactionBuilder, error) {
+	in, err := sumInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range inputs[1:] {
+		if !bytes.Equal(u.Owner, inputs[0].Owner) {
+			return nil, errors.New("inputs must be owned by the same owner")
+		}
+	}
+	return spend(profile, inputs, []Output{{Owner: inputs[0].Owner, Amount: in}})
+}
+
+// spend returns a builder of the transaction spending the inputs and creating the outputs
+func spend(profile *bbclib.IdLengthProfile, inputs []*UTXO, outputs []Output) (*bbclib.TransactionBuilder, error) {
+	b := bbclib.NewTransactionBuilder(profile)
+	assetGroupID := inputs[0].AssetGroupID
+	for _, u := range inputs {
+		b.CreateReference(&assetGroupID, u.Transaction, u.EventIndex)
+	}
+	addOutputs(b, assetGroupID, outputs, len(inputs))
+	return b, b.Err()
+}
+
+// addOutputs adds the events of the outputs (with the reference indices to the inputs)
+func addOutputs(b *bbclib.TransactionBuilder, assetGroupID []byte, outputs []Output, numInputs int) {
+	for _, o := range outputs {
+		owner := o.Owner
+		body := NewBody(o.Amount, o.Memo)
+		b.AddEvent(&assetGroupID, func(e *bbclib.EventBuilder) {
+			for i := 0; i < numInputs; i++ {
+				e.AddReferenceIndex(i)
+			}
+			e.AddMandatoryApprover(&owner).CreateAsset(&owner, nil, &body)
+		})
+	}
+}
+
+// sumInputs returns the total amount of the inputs, which must be in the same asset group and must not be duplicated
+func sumInputs(inputs []*UTXO) (uint64, error) {
+	if len(inputs) == 0 {
+		return 0, errors.New("inputs must be given")
+	}
+	var sum uint64
+	seen := make(map[string]bool)
+	for i, u := range inputs {
+		if u == nil || u.Transaction == nil {
+			return 0, fmt.Errorf("inputs[%d]: transaction must be given", i)
+		}
+		if !bytes.Equal(u.AssetGroupID, inputs[0].AssetGroupID) {
+			return 0, fmt.Errorf("inputs[%d]: asset_group_id differs", i)
+		}
+		if seen[u.Key()] {
+			return 0, fmt.Errorf("inputs[%d]: duplicated input", i)
+		}
+		seen[u.Key()] = true
+		if sum > math.MaxUint64-u.Amount {
+			return 0, errors.New("overflow in the sum of inputs")
+		}
+		sum += u.Amount
+	}
+	return sum, nil
+}
+
+// sumOutputs returns the total amount of the outputs
+func sumOutputs(outputs []Output) (uint64, error) {
+	if len(outputs) == 0 {
+		return 0, errors.New("outputs must be given")
+	}
+	var sum uint64
+	for i, o := range outputs {
+		if len(o.Owner) == 0 {
+			return 0, fmt.Errorf("outputs[%d]: owner must be given", i)
+		}
+		if o.Amount == 0 {
+			return 0, fmt.Errorf("outputs[%d]: amount must be positive", i)
+		}
+		if sum > math.MaxUint64-o.Amount {
+			return 0, errors.New("overflow in the sum of outputs")
+		}
+		sum += o.Amount
+	}
+	return sum, nil
+}
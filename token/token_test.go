@@ -0,0 +1,265 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"bbclib"
+	"bbclib/internal/hashlock"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+var (
+	issuer     = bbclib.GetIdentifier("issuer", 32)
+	alice      = bbclib.GetIdentifier("alice", 32)
+	bob        = bbclib.GetIdentifier("bob", 32)
+	tokenGroup = bbclib.GetIdentifier("token_group", 32)
+)
+
+func build(t *testing.T, b *bbclib.TransactionBuilder, err error, signers map[string]*bbclib.KeyPair) *bbclib.BBcTransaction {
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uid, keypair := range signers {
+		id, _ := hex.DecodeString(uid)
+		b.Sign(&id, keypair, false)
+	}
+	txobj, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return txobj
+}
+
+func TestToken(t *testing.T) {
+	keys := make(map[string]*bbclib.KeyPair)
+	for _, uid := range [][]byte{issuer, alice, bob} {
+		keys[hex.EncodeToString(uid)], _ = bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	}
+	signer := func(uid []byte) map[string]*bbclib.KeyPair {
+		return map[string]*bbclib.KeyPair{hex.EncodeToString(uid): keys[hex.EncodeToString(uid)]}
+	}
+	publicKeys := make(bbclib.PublicKeyMap)
+	for uid, keypair := range keys {
+		id, _ := hex.DecodeString(uid)
+		publicKeys.Add(id, keypair.Pubkey)
+	}
+	publicKey := publicKeys.Resolve
+	store := make(bbclib.TransactionMap)
+	add := store.Add
+
+	b, err := Mint(nil, tokenGroup, issuer, Output{Owner: alice, Amount: 100}, Output{Owner: alice, Amount: 50, Memo: "bonus"})
+	mintTx := add(build(t, b, err, signer(issuer)))
+
+	t.Run("mint", func(t *testing.T) {
+		balances, err := ValidateMint(mintTx, issuer, store.Resolve, publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(balances) != 1 || balances[0].Inputs != 0 || balances[0].Outputs != 150 {
+			t.Fatalf("invalid balances: %+v", balances)
+		}
+		if _, err := ValidateMint(mintTx, bob, store.Resolve, publicKey); err == nil {
+			t.Fatal("mint must be signed by the issuer")
+		}
+		if _, err := ValidateBalance(mintTx, store.Resolve, publicKey); !errors.Is(err, ErrUnbalanced) {
+			t.Fatalf("mint is not a balanced transfer: %v", err)
+		}
+		body, err := DecodeBody(mintTx.Events[1].Asset)
+		if err != nil || body.Amount != 50 || body.Memo != "bonus" {
+			t.Fatalf("invalid body: %+v, %v", body, err)
+		}
+	})
+
+	u0, _ := GetUTXO(mintTx, 0)
+	u1, _ := GetUTXO(mintTx, 1)
+
+	t.Run("transfer with change", func(t *testing.T) {
+		b, err := Transfer(nil, []*UTXO{u0}, []Output{{Owner: bob, Amount: 30}}, nil)
+		txobj := build(t, b, err, signer(alice))
+		balances, err := ValidateBalance(txobj, store.Resolve, publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balances[0].Inputs != 100 || balances[0].Outputs != 100 {
+			t.Fatalf("invalid balances: %+v", balances)
+		}
+		outputs := Outputs(txobj)
+		if len(outputs) != 2 || outputs[1].Amount != 70 || string(outputs[1].Owner) != string(alice) {
+			t.Fatal("change output must be created")
+		}
+		if _, err := Transfer(nil, []*UTXO{u0}, []Output{{Owner: bob, Amount: 101}}, nil); !errors.Is(err, ErrInsufficientBalance) {
+			t.Fatalf("insufficient balance must be rejected: %v", err)
+		}
+		if _, err := Transfer(nil, []*UTXO{u0, u0}, []Output{{Owner: bob, Amount: 10}}, nil); err == nil {
+			t.Fatal("duplicated input must be rejected")
+		}
+	})
+
+	t.Run("split and merge", func(t *testing.T) {
+		b, err := Split(nil, u0, 10, 20, 70)
+		splitTx := add(build(t, b, err, signer(alice)))
+		if _, err := ValidateBalance(splitTx, store.Resolve, publicKey); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Split(nil, u0, 10, 20); err == nil {
+			t.Fatal("split must keep the amount")
+		}
+
+		outputs := Outputs(splitTx)
+		b, err = Merge(nil, append(outputs, u1)...)
+		mergeTx := build(t, b, err, signer(alice))
+		balances, err := ValidateBalance(mergeTx, store.Resolve, publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mergeTx.Events) != 1 || balances[0].Outputs != 150 {
+			t.Fatalf("invalid merge: %+v", balances)
+		}
+	})
+
+	t.Run("invalid transactions", func(t *testing.T) {
+		// an output more than the input
+		b := bbclib.NewTransactionBuilder(nil)
+		b.CreateReference(&tokenGroup, mintTx, 0)
+		body := NewBody(200, "")
+		b.AddEvent(&tokenGroup, func(e *bbclib.EventBuilder) {
+			e.AddReferenceIndex(0).AddMandatoryApprover(&bob).CreateAsset(&bob, nil, &body)
+		})
+		txobj := build(t, b, nil, signer(alice))
+		if _, err := ValidateBalance(txobj, store.Resolve, publicKey); !errors.Is(err, ErrUnbalanced) {
+			t.Fatalf("unbalanced transaction must be rejected: %v", err)
+		}
+
+		// an output which can be spent by anyone
+		b = bbclib.NewTransactionBuilder(nil)
+		b.CreateReference(&tokenGroup, mintTx, 0)
+		body = NewBody(100, "")
+		b.AddEvent(&tokenGroup, func(e *bbclib.EventBuilder) {
+			e.AddReferenceIndex(0).CreateAsset(&bob, nil, &body)
+		})
+		txobj = build(t, b, nil, signer(alice))
+		if _, err := ValidateBalance(txobj, store.Resolve, publicKey); err == nil {
+			t.Fatal("owner must be a mandatory approver")
+		}
+
+		// not signed by the owner of the input
+		b, err := Transfer(nil, []*UTXO{u0}, []Output{{Owner: bob, Amount: 100}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		draft, err := b.BuildDraft()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ValidateBalance(draft, store.Resolve, publicKey); err == nil {
+			t.Fatal("input must be signed by the owner")
+		}
+
+		// signed with a key which is not of the owner of the input
+		mallory, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+		b, err = Transfer(nil, []*UTXO{u0}, []Output{{Owner: bob, Amount: 100}}, nil)
+		forged := build(t, b, err, map[string]*bbclib.KeyPair{hex.EncodeToString(alice): mallory})
+		if _, err := ValidateBalance(forged, store.Resolve, publicKey); !errors.Is(err, bbclib.ErrInvalidSignature) {
+			t.Fatalf("signature with a wrong key must be rejected: %v", err)
+		}
+		b, err = Mint(nil, tokenGroup, issuer, Output{Owner: bob, Amount: 1000})
+		forged = build(t, b, err, map[string]*bbclib.KeyPair{hex.EncodeToString(issuer): mallory})
+		if _, err := ValidateMint(forged, issuer, store.Resolve, publicKey); !errors.Is(err, bbclib.ErrInvalidSignature) {
+			t.Fatalf("mint signed with a wrong key must be rejected: %v", err)
+		}
+
+		// signed without the public key
+		b, err = Transfer(nil, []*UTXO{u0}, []Output{{Owner: bob, Amount: 100}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		noPubkey, err := b.Sign(&alice, keys[hex.EncodeToString(alice)], true).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ValidateBalance(noPubkey, store.Resolve, publicKey); !errors.Is(err, bbclib.ErrInvalidSignature) {
+			t.Fatalf("signature without public key must be rejected: %v", err)
+		}
+		b, err = Transfer(nil, []*UTXO{u0}, []Output{{Owner: bob, Amount: 100}}, nil)
+		valid := build(t, b, err, signer(alice))
+		unknownKey := func(uid []byte) ([]byte, error) { return nil, errors.New("unknown user") }
+		if _, err := ValidateBalance(valid, store.Resolve, unknownKey); err == nil {
+			t.Fatal("owner without public key must be rejected")
+		}
+
+		// an input whose content differs from its transaction_id
+		tampered := mintTx.Clone()
+		tamperedBody := NewBody(100, "tampered")
+		if err := tampered.Events[0].Asset.AddBodyObject(&tamperedBody); err != nil {
+			t.Fatal(err)
+		}
+		tamperedStore := make(bbclib.TransactionMap)
+		tamperedStore.Add(tampered)
+		if _, err := ValidateBalance(valid, tamperedStore.Resolve, publicKey); err == nil {
+			t.Fatal("input whose content differs from the transaction_id must be rejected")
+		}
+
+		// unknown input
+		if _, err := ValidateBalance(txobj, make(bbclib.TransactionMap).Resolve, publicKey); err == nil {
+			t.Fatal("unknown input must be rejected")
+		}
+	})
+
+	t.Run("hash lock", func(t *testing.T) {
+		// alice locks her output for bob (see package swap)
+		preimage := []byte("preimage")
+		hash := sha256.Sum256(preimage)
+		timeout := int64(1000000)
+		input := mintTx.Events[0].Asset
+		body := hashlock.LockBody{Type: hashlock.LockBodyType, HashLock: hash[:], Sender: alice, Recipient: bob, Timeout: timeout,
+			AssetBodyType: input.AssetBodyType, AssetBody: input.AssetBody}
+		b := bbclib.NewTransactionBuilder(nil).SetTimestamp(timeout-100).CreateReference(&tokenGroup, mintTx, 0).
+			AddEvent(&tokenGroup, func(e *bbclib.EventBuilder) { e.AddReferenceIndex(0).CreateAsset(&alice, nil, &body) }).
+			AddWitness(&alice)
+		lockTx := add(build(t, b, nil, signer(alice)))
+		if balances, err := ValidateBalance(lockTx, store.Resolve, publicKey); err != nil || balances[0].Outputs != 100 {
+			t.Fatalf("lock must be an output of the locked amount: %v", err)
+		}
+		claim := func(claimant, preimage []byte) *bbclib.BBcTransaction {
+			lockTxID, lockAssetID := lockTx.TransactionID, lockTx.Events[0].Asset.AssetID
+			b := bbclib.NewTransactionBuilder(nil).SetTimestamp(timeout-1).CreateReference(&tokenGroup, lockTx, 0).
+				AddEvent(&tokenGroup, func(e *bbclib.EventBuilder) {
+					e.AddReferenceIndex(0).AddMandatoryApprover(&claimant).CreateAsset(&claimant, nil, append([]byte{}, body.AssetBody...))
+					e.Event().Asset.AssetBodyType = body.AssetBodyType
+				}).
+				AddRelation(&tokenGroup, func(r *bbclib.RelationBuilder) {
+					r.CreatePointer(&lockTxID, &lockAssetID).CreateAsset(&claimant, nil, &hashlock.ClaimBody{Type: hashlock.ClaimBodyType, Preimage: preimage})
+				}).
+				AddWitness(&claimant)
+			return build(t, b, nil, signer(claimant))
+		}
+
+		var verr *bbclib.ValidationError
+		if _, err := ValidateBalance(claim(bob, []byte("wrong")), store.Resolve, publicKey); !errors.As(err, &verr) {
+			t.Fatalf("release with a wrong preimage must be rejected: %v", err)
+		}
+		if _, err := ValidateBalance(claim(alice, nil), store.Resolve, publicKey); !errors.As(err, &verr) {
+			t.Fatalf("refund before the timeout must be rejected: %v", err)
+		}
+		if balances, err := ValidateBalance(claim(bob, preimage), store.Resolve, publicKey); err != nil || balances[0].Inputs != 100 {
+			t.Fatalf("release must spend the locked amount: %v", err)
+		}
+	})
+}
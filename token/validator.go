@@ -0,0 +1,216 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"bbclib"
+	"bbclib/internal/hashlock"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrUnbalanced is returned when the inputs and the outputs of an asset group differ in amount
+var ErrUnbalanced = errors.New("inputs and outputs are not balanced")
+
+type (
+	// Balance is the total amounts of the inputs and the outputs of an asset group in a transaction
+	Balance struct {
+		AssetGroupID []byte
+		Inputs       uint64
+		Outputs      uint64
+	}
+)
+
+// ValidateBalance checks the token transfer transaction, and returns the balances per AssetGroupID
+// The inputs (the events referred by BBcReference objects) are resolved by resolve, and the public keys of the owners by keys. The checks are:
+//   - all signatures in the transaction are valid, and the owners of the token inputs have signed with their public keys
+//   - each token input is spent once, and its asset group is the same as that of the BBcReference
+//   - the TransactionID of each referred transaction is up to date for its content (see BBcTransaction.IsDirty)
+//   - each token output can be spent only by its owner (the owner is a mandatory approver)
+//   - the total amount of the inputs equals that of the outputs in each asset group (ErrUnbalanced)
+//
+// A hash lock of package swap keeping a token body counts as an output of the amount, and its claim spends the amount as an input.
+// The claim is checked as swap.Validate does (the preimage or the timeout, and the signature of the claimant) at the timestamp of the transaction.
+// The lock itself and the clock of the domain are not checked here, so the domain must also run swap.Validate (or swap.Rule).
+func ValidateBalance(txobj *bbclib.BBcTransaction, resolve bbclib.TransactionResolver, keys bbclib.KeyResolver) ([]Balance, error) {
+	if txobj == nil || resolve == nil || keys == nil {
+		return nil, errors.New("transaction and resolvers must be given")
+	}
+	balances, err := collectBalances(txobj, resolve, keys)
+	if err != nil {
+		return balances, err
+	}
+	for _, b := range balances {
+		if b.Inputs != b.Outputs {
+			return balances, fmt.Errorf("%w: asset_group_id=%x (inputs %d, outputs %d)", ErrUnbalanced, b.AssetGroupID, b.Inputs, b.Outputs)
+		}
+	}
+	return balances, nil
+}
+
+// ValidateMint checks the transaction issuing new tokens
+// The transaction must have no token input, and must be signed by the issuer as a witness with the public key given by keys.
+func ValidateMint(txobj *bbclib.BBcTransaction, issuer []byte, resolve bbclib.TransactionResolver, keys bbclib.KeyResolver) ([]Balance, error) {
+	if txobj == nil || resolve == nil || keys == nil {
+		return nil, errors.New("transaction and resolvers must be given")
+	}
+	balances, err := collectBalances(txobj, resolve, keys)
+	if err != nil {
+		return balances, err
+	}
+	for _, b := range balances {
+		if b.Inputs != 0 {
+			return balances, fmt.Errorf("mint transaction must not spend tokens: asset_group_id=%x", b.AssetGroupID)
+		}
+	}
+	if txobj.Witness == nil {
+		return balances, errors.New("issuer must be a witness of mint transaction")
+	}
+	for i, uid := range txobj.Witness.UserIDs {
+		if !bytes.Equal(uid, issuer) || i >= len(txobj.Witness.SigIndices) {
+			continue
+		}
+		if err := txobj.VerifySignedBy(txobj.Witness.SigIndices[i], issuer, keys); err != nil {
+			return balances, fmt.Errorf("mint transaction must be signed by the issuer: %w", err)
+		}
+		return balances, nil
+	}
+	return balances, errors.New("mint transaction must be signed by the issuer")
+}
+
+// collectBalances checks the signatures, the inputs and the outputs of the transaction, and sums up the amounts per AssetGroupID
+func collectBalances(txobj *bbclib.BBcTransaction, resolve bbclib.TransactionResolver, keys bbclib.KeyResolver) ([]Balance, error) {
+	var balances []Balance
+	add := func(assetGroupID []byte, input, output uint64) error {
+		idx := -1
+		for i := range balances {
+			if bytes.Equal(balances[i].AssetGroupID, assetGroupID) {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			balances = append(balances, Balance{AssetGroupID: assetGroupID})
+			idx = len(balances) - 1
+		}
+		b := &balances[idx]
+		if b.Inputs > math.MaxUint64-input || b.Outputs > math.MaxUint64-output {
+			return fmt.Errorf("overflow in the amounts: asset_group_id=%x", assetGroupID)
+		}
+		b.Inputs += input
+		b.Outputs += output
+		return nil
+	}
+
+	if result, idx := txobj.VerifyAll(); !result {
+		return nil, fmt.Errorf("signatures[%d]: %w", idx, bbclib.ErrInvalidSignature)
+	}
+
+	spent := make(map[string]bool)
+	for i, ref := range txobj.References {
+		refTx, err := resolve(ref.TransactionID)
+		if err != nil {
+			return nil, fmt.Errorf("references[%d]: %w", i, err)
+		}
+		if refTx == nil || !bytes.Equal(refTx.TransactionID, ref.TransactionID) {
+			return nil, fmt.Errorf("references[%d]: referred transaction not found", i)
+		}
+		if refTx.IsDirty() {
+			return nil, fmt.Errorf("references[%d]: transaction_id of the referred transaction does not match its content", i)
+		}
+		u, err := GetUTXO(refTx, int(ref.EventIndexInRef))
+		var lock *hashlock.Lock
+		if errors.Is(err, ErrNotToken) {
+			u, lock, err = getLocked(refTx, int(ref.EventIndexInRef))
+		}
+		if errors.Is(err, ErrNotToken) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("references[%d]: %w", i, err)
+		}
+		if lock != nil {
+			if v := hashlock.ClaimViolations(txobj, i, lock, keys, txobj.Timestamp); len(v) > 0 {
+				return nil, fmt.Errorf("references[%d]: invalid claim of the lock: %w", i, &bbclib.ValidationError{Violations: v})
+			}
+		}
+		if !bytes.Equal(ref.AssetGroupID, u.AssetGroupID) {
+			return nil, fmt.Errorf("references[%d]: asset_group_id differs from the input", i)
+		}
+		if spent[u.Key()] {
+			return nil, fmt.Errorf("references[%d]: input is spent twice", i)
+		}
+		spent[u.Key()] = true
+		approvers := refTx.Events[ref.EventIndexInRef].MandatoryApprovers
+		if len(ref.SigIndices) < len(approvers) {
+			return nil, fmt.Errorf("references[%d]: not signed by the owner of the input", i)
+		}
+		for j, approver := range approvers {
+			if err := txobj.VerifySignedBy(ref.SigIndices[j], approver, keys); err != nil {
+				return nil, fmt.Errorf("references[%d]: not signed by the owner of the input: %w", i, err)
+			}
+		}
+		if err := add(u.AssetGroupID, u.Amount, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, u := range Outputs(txobj) {
+		evt := txobj.Events[u.EventIndex]
+		found := false
+		for _, uid := range evt.MandatoryApprovers {
+			found = found || bytes.Equal(uid, u.Owner)
+		}
+		if !found {
+			return nil, fmt.Errorf("events[%d]: owner must be a mandatory approver", u.EventIndex)
+		}
+		if err := add(u.AssetGroupID, 0, u.Amount); err != nil {
+			return nil, err
+		}
+	}
+	for i := range txobj.Events {
+		u, _, err := getLocked(txobj, i)
+		if err != nil {
+			continue
+		}
+		if err := add(u.AssetGroupID, 0, u.Amount); err != nil {
+			return nil, err
+		}
+	}
+	return balances, nil
+}
+
+// getLocked returns the token output locked by the hash lock in the event of the transaction, and the lock (ErrNotToken if the event is not a lock of a token)
+// The output has no owner, and its amount is that of the token body kept in the lock.
+func getLocked(txobj *bbclib.BBcTransaction, eventIdx int) (*UTXO, *hashlock.Lock, error) {
+	lock, err := hashlock.GetLock(txobj, eventIdx)
+	if errors.Is(err, hashlock.ErrNotLock) {
+		return nil, nil, ErrNotToken
+	} else if err != nil {
+		return nil, nil, err
+	}
+	body, err := DecodeBody(lock.LockedAsset())
+	if err != nil {
+		return nil, nil, err
+	}
+	return &UTXO{
+		Transaction:  txobj,
+		EventIndex:   eventIdx,
+		AssetGroupID: lock.AssetGroupID,
+		Amount:       body.Amount,
+	}, lock, nil
+}
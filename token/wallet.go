@@ -0,0 +1,123 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"bbclib"
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+/*
+Wallet definition
+
+Wallet is the UTXO view of a user. It collects the token outputs owned by the user from the transactions given by AddTransaction,
+and removes the outputs spent by BBcReference objects in them. The transactions can be given in any order.
+*/
+type Wallet struct {
+	mutex   sync.RWMutex
+	owner   []byte
+	outputs []*UTXO
+	known   map[string]bool
+	spent   map[string]bool
+}
+
+// NewWallet returns an empty wallet of the owner
+func NewWallet(owner []byte) *Wallet {
+	return &Wallet{owner: append([]byte{}, owner...), known: make(map[string]bool), spent: make(map[string]bool)}
+}
+
+// Owner returns the user_id of the owner
+func (w *Wallet) Owner() []byte {
+	return append([]byte{}, w.owner...)
+}
+
+// AddTransaction updates the wallet with the token outputs and the inputs in the transaction
+func (w *Wallet) AddTransaction(txobj *bbclib.BBcTransaction) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, ref := range txobj.References {
+		w.spent[outputKey(ref.TransactionID, int(ref.EventIndexInRef))] = true
+	}
+	for _, u := range Outputs(txobj) {
+		if bytes.Equal(u.Owner, w.owner) && !w.known[u.Key()] {
+			w.known[u.Key()] = true
+			w.outputs = append(w.outputs, u)
+		}
+	}
+}
+
+// UTXOs returns the unspent outputs in the asset group
+func (w *Wallet) UTXOs(assetGroupID []byte) []*UTXO {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	var utxos []*UTXO
+	for _, u := range w.outputs {
+		if !w.spent[u.Key()] && bytes.Equal(u.AssetGroupID, assetGroupID) {
+			utxos = append(utxos, u)
+		}
+	}
+	return utxos
+}
+
+// Balance returns the total amount of the unspent outputs in the asset group
+func (w *Wallet) Balance(assetGroupID []byte) (uint64, error) {
+	var sum uint64
+	for _, u := range w.UTXOs(assetGroupID) {
+		if sum > math.MaxUint64-u.Amount {
+			return 0, fmt.Errorf("overflow in the balance: asset_group_id=%x", assetGroupID)
+		}
+		sum += u.Amount
+	}
+	return sum, nil
+}
+
+// Select returns the unspent outputs (larger amount first) whose total amount is equal to or more than the amount
+func (w *Wallet) Select(assetGroupID []byte, amount uint64) ([]*UTXO, error) {
+	utxos := w.UTXOs(assetGroupID)
+	sort.SliceStable(utxos, func(i, j int) bool {
+		return utxos[i].Amount > utxos[j].Amount
+	})
+	var sum uint64
+	for i, u := range utxos {
+		if sum > math.MaxUint64-u.Amount {
+			return nil, fmt.Errorf("overflow in the balance: asset_group_id=%x", assetGroupID)
+		}
+		sum += u.Amount
+		if sum >= amount {
+			return utxos[:i+1], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: balance %d < %d", ErrInsufficientBalance, sum, amount)
+}
+
+// Transfer returns a builder of the transaction sending tokens in the asset group from the wallet (the change is sent back to the owner)
+// The owner must sign the transaction by TransactionBuilder.Sign.
+func (w *Wallet) Transfer(profile *bbclib.IdLengthProfile, assetGroupID []byte, outputs ...Output) (*bbclib.TransactionBuilder, error) {
+	total, err := sumOutputs(outputs)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := w.Select(assetGroupID, total)
+	if err != nil {
+		return nil, err
+	}
+	return Transfer(profile, inputs, outputs, w.owner)
+}
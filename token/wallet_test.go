@@ -0,0 +1,111 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"bbclib"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestWallet(t *testing.T) {
+	issuerKey, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	aliceKey, _ := bbclib.GenerateKeypair(bbclib.KeyTypeEcdsaP256v1, bbclib.DefaultCompressionMode)
+	otherGroup := bbclib.GetIdentifier("other_group", 32)
+
+	b, err := Mint(nil, tokenGroup, issuer, Output{Owner: alice, Amount: 10}, Output{Owner: alice, Amount: 40}, Output{Owner: bob, Amount: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mintTx, err := b.Sign(&issuer, issuerKey, false).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = Mint(nil, otherGroup, issuer, Output{Owner: alice, Amount: 7})
+	otherTx, _ := b.Sign(&issuer, issuerKey, false).Build()
+
+	wallet := NewWallet(alice)
+	wallet.AddTransaction(mintTx)
+	wallet.AddTransaction(otherTx)
+
+	t.Run("balance", func(t *testing.T) {
+		balance, err := wallet.Balance(tokenGroup)
+		other, err2 := wallet.Balance(otherGroup)
+		if err != nil || err2 != nil || balance != 50 || other != 7 || len(wallet.UTXOs(tokenGroup)) != 2 {
+			t.Fatalf("invalid balance: %d, %d (%v, %v)", balance, other, err, err2)
+		}
+		utxos, err := wallet.Select(tokenGroup, 30)
+		if err != nil || len(utxos) != 1 || utxos[0].Amount != 40 {
+			t.Fatalf("larger output must be selected first: %v", err)
+		}
+		if _, err := wallet.Select(tokenGroup, 51); !errors.Is(err, ErrInsufficientBalance) {
+			t.Fatalf("insufficient balance must be rejected: %v", err)
+		}
+	})
+
+	t.Run("transfer", func(t *testing.T) {
+		b, err := wallet.Transfer(nil, tokenGroup, Output{Owner: bob, Amount: 45})
+		if err != nil {
+			t.Fatal(err)
+		}
+		txobj, err := b.Sign(&alice, aliceKey, false).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the transactions can be given in any order
+		wallet2 := NewWallet(alice)
+		wallet2.AddTransaction(txobj)
+		wallet2.AddTransaction(mintTx)
+		wallet.AddTransaction(txobj)
+		wallet.AddTransaction(txobj)
+		for _, w := range []*Wallet{wallet, wallet2} {
+			utxos := w.UTXOs(tokenGroup)
+			if balance, err := w.Balance(tokenGroup); err != nil || balance != 5 || len(utxos) != 1 || utxos[0].Transaction != txobj {
+				t.Fatalf("invalid balance after transfer: %d, %v", balance, err)
+			}
+		}
+
+		bobWallet := NewWallet(bob)
+		bobWallet.AddTransaction(mintTx)
+		bobWallet.AddTransaction(txobj)
+		if balance, err := bobWallet.Balance(tokenGroup); err != nil || balance != 50 {
+			t.Fatalf("invalid balance of the receiver: %d, %v", balance, err)
+		}
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		b, _ := Mint(nil, otherGroup, issuer, Output{Owner: alice, Amount: math.MaxUint64})
+		hugeTx, _ := b.Sign(&issuer, issuerKey, false).Build()
+		w := NewWallet(alice)
+		w.AddTransaction(otherTx)
+		w.AddTransaction(hugeTx)
+		if _, err := w.Balance(otherGroup); err == nil {
+			t.Fatal("overflow in the balance must be detected")
+		}
+
+		b, _ = Mint(nil, otherGroup, issuer, Output{Owner: alice, Amount: math.MaxUint64 - 1})
+		largeTx, _ := b.Sign(&issuer, issuerKey, false).Build()
+		w = NewWallet(alice)
+		w.AddTransaction(otherTx)
+		w.AddTransaction(largeTx)
+		if _, err := w.Select(otherGroup, math.MaxUint64); err == nil || errors.Is(err, ErrInsufficientBalance) {
+			t.Fatalf("overflow in the selection must be detected: %v", err)
+		}
+	})
+}
@@ -23,7 +23,6 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"time"
 )
 
 /*
@@ -32,7 +31,7 @@ BBcTransaction definition
 BBcTransaction is just a container of various objects.
 
 Events, References, Relations and Signatures are list of BBcEvent, BBcReference, BBcRelation and BBcSignature objects, respectively.
-"digestCalculating", "TransactionBaseDigest", "TransactionData" and "SigIndexedUsers" are not included in the packed data. They are internal use only.
+"TransactionBaseDigest", "TransactionData" and "SigIndexedUsers" are not included in the packed data. They are internal use only.
 
 Calculating TransactionID
 
@@ -49,10 +48,26 @@ By presenting TransactionBaseDigest (see below) to an outer-domain, the domain u
   * Pack BBcCrossRef object to get packed data by packCrossRef()
   * Concatenate TransactionBaseDigest and the packed BBcCrossRef
   * Calculate SHA256 digest of the concatenated data. This value is TransactionID
+
+Digest cache
+
+The digests are cached together with the packed data from version to BBcCrossRef used for the calculation.
+Digest, Pack and VerifyAll pack this part again (without reflection) and re-calculate the digests only if the packed data has changed,
+so that modifications of any field, including direct modifications of the fields of child objects, invalidate the cache.
+Pack (and Serialize) always updates TransactionID and TransactionBaseDigest, so that a stale TransactionID is never serialized, and
+Sign always signs the digest of the current content. IsDirty reports whether TransactionID is stale.
+
+Since Digest and Pack update the cache and the fields above, a BBcTransaction object must not be used by multiple goroutines concurrently.
+Use SignedTransaction to share a finalized transaction.
+
+Timestamp
+
+NewTransaction, MakeTransaction and TransactionBuilder set the current time to "Timestamp".
+Digest, Pack and Serialize do not change the content of the transaction, so a transaction created as a struct literal keeps the timestamp of 0.
 */
 type (
 	BBcTransaction struct {
-		digestCalculating     bool
+		digestCache           digestCache
 		IdLengthConf          BBcIdConfig
 		TransactionID         []byte
 		TransactionBaseDigest []byte
@@ -70,6 +85,14 @@ type (
 	}
 )
 
+// digestCache keeps the digests and the packed data (from version to BBcCrossRef) used for the calculation
+type digestCache struct {
+	valid      bool
+	packed     []byte
+	baseDigest [sha256.Size]byte
+	digest     [sha256.Size]byte
+}
+
 // Stringer outputs the content of the object
 func (p *BBcTransaction) Stringer() string {
 	var ret string
@@ -77,7 +100,7 @@ func (p *BBcTransaction) Stringer() string {
 	ret += fmt.Sprintf("* transaction_id: %x\n", p.TransactionID)
 	ret += fmt.Sprintf("version: %d\n", p.Version)
 	ret += fmt.Sprintf("timestamp: %d\n", p.Timestamp)
-	if p.Version != 0 {
+	if hasIdLengthHeader(p.Version) {
 		ret += fmt.Sprintf("transaction_id_length: %d\n", p.IdLengthConf.TransactionIdLength)
 	}
 
@@ -159,11 +182,19 @@ func (p *BBcTransaction) AddRelation(assetGroupId *[]byte) *BBcTransaction {
 
 // AddReference adds the BBcReference object in the transaction object
 func (p *BBcTransaction) CreateReference(assetGroupID *[]byte, refTransaction *BBcTransaction, eventIdx int) *BBcTransaction {
+	_ = logError(p.createReference(assetGroupID, refTransaction, eventIdx), "failed to create BBcReference", LogField{"event_index", eventIdx})
+	return p
+}
+
+// createReference adds the BBcReference object in the transaction object and returns the error if the reference is invalid
+func (p *BBcTransaction) createReference(assetGroupID *[]byte, refTransaction *BBcTransaction, eventIdx int) error {
 	obj := BBcReference{Version: p.Version, Transaction: p}
 	obj.SetIdLengthConf(&p.IdLengthConf)
-	obj.Add(assetGroupID, refTransaction, eventIdx)
+	if err := obj.add(assetGroupID, refTransaction, eventIdx); err != nil {
+		return err
+	}
 	p.References = append(p.References, &obj)
-	return p
+	return nil
 }
 
 
@@ -178,47 +209,76 @@ func (p *BBcTransaction) CreateCrossRef(domainId, transactionId *[]byte) *BBcTra
 
 // AddWitness sets the BBcWitness object in the transaction object
 func (p *BBcTransaction) AddWitness(userId *[]byte) *BBcTransaction {
+	_ = logError(p.addWitness(userId), "failed to add witness")
+	return p
+}
+
+// addWitness sets the BBcWitness object in the transaction object and returns the error in adding the user
+func (p *BBcTransaction) addWitness(userId *[]byte) error {
+	if userId == nil {
+		return errors.New("user_id must be given")
+	}
 	if p.Witness == nil {
 		obj := BBcWitness{Version: p.Version}
 		obj.SetIdLengthConf(&p.IdLengthConf)
 		obj.Transaction = p
 		p.Witness = &obj
 	}
-	_ = p.Witness.AddWitness(userId)
-	return p
+	return p.Witness.AddWitness(userId)
 }
 
 
 // AddSignature adds the BBcSignature object for the specified userID in the transaction object
+// If signing fails, no signature is added. Use TransactionBuilder to get the error.
 func (p *BBcTransaction) Sign(userId *[]byte, keyPair *KeyPair, noPubkey bool) *BBcTransaction {
+	if err := p.sign(userId, keyPair, noPubkey); err != nil {
+		var uid []byte
+		if userId != nil {
+			uid = *userId
+		}
+		_ = logError(err, "failed to sign transaction", LogField{"user_id", uid})
+	}
+	return p
+}
+
+// sign adds the BBcSignature object for the specified userID in the transaction object and returns the error in signing
+func (p *BBcTransaction) sign(userId *[]byte, keyPair *KeyPair, noPubkey bool) error {
+	if userId == nil {
+		return errors.New("user_id must be given")
+	}
+	if keyPair == nil {
+		return errors.New("key pair must be given")
+	}
+	signature, err := p.doSign(keyPair)
+	if err != nil {
+		return err
+	}
 	obj := BBcSignature{Version: p.Version}
 	if noPubkey {
 		obj.SetPublicKeyInfo(uint32(keyPair.CurveType))
 	} else {
 		obj.SetPublicKeyByKeypair(keyPair)
 	}
-	signature, _ := p.doSign(keyPair)
-	obj.Signature = signature
-	obj.SignatureLen = uint32(len(signature)*8)
+	obj.SetSignature(&signature)
 
 	uid := make([]byte, int(p.IdLengthConf.UserIdLength))
 	copy(uid, *userId)
 	for i := range p.SigIndexedUsers {
 		if reflect.DeepEqual(p.SigIndexedUsers[i], uid) {
 			p.Signatures[i] = &obj
-			return p
+			return nil
 		}
 	}
 	if p.References != nil {
 		for i := range p.References {
 			if err := p.References[i].AddSignature(userId, &obj); err == nil {
-				return p
+				return nil
 			}
 		}
 	}
 	p.SigIndexedUsers = append(p.SigIndexedUsers, uid)
 	p.Signatures = append(p.Signatures, &obj)
-	return p
+	return nil
 }
 
 // AddSignature adds the BBcSignature object for the specified userID in the transaction object
@@ -271,7 +331,13 @@ func (p *BBcTransaction) SetSigIndex(userID []byte, idx int) {
 
 // Sign TransactionID using private key in the given keypair
 func (p *BBcTransaction) doSign(keypair *KeyPair) ([]byte, error) {
+	if keypair.PrivateKeyStructure == nil {
+		return nil, errors.New("private key is not set")
+	}
 	digest := p.Digest()
+	if digest == nil {
+		return nil, errors.New("fail to calculate transaction_id")
+	}
 	signature := keypair.Sign(digest)
 	if signature == nil {
 		return nil, errors.New("fail to sign")
@@ -293,36 +359,109 @@ func (p *BBcTransaction) VerifyAll() (bool, int) {
 	return true, -1
 }
 
-// Digest calculates TransactionID of the BBcTransaction object
-func (p *BBcTransaction) Digest() []byte {
-	p.digestCalculating = true
-	if p.TransactionID == nil {
-		p.TransactionID = make([]byte, p.TransactionIdLength)
+// VerifySignatureAt verifies the signature at the index with the public key of the expected signer
+// The signature must include its public key (BBcSignature.CheckFormat), which is not trusted: it is verified with the given public key.
+func (p *BBcTransaction) VerifySignatureAt(idx int, publicKey []byte) error {
+	if idx < 0 || idx >= len(p.Signatures) || p.Signatures[idx] == nil || p.Signatures[idx].KeyType == KeyTypeNotInitialized {
+		return fmt.Errorf("signatures[%d]: not signed", idx)
 	}
-	buf := new(bytes.Buffer)
+	sig := p.Signatures[idx]
+	if err := sig.CheckFormat(); err != nil {
+		return fmt.Errorf("signatures[%d]: %w: %v", idx, ErrInvalidSignature, err)
+	}
+	if len(sig.Pubkey) == 0 {
+		return fmt.Errorf("signatures[%d]: %w: public key must be included", idx, ErrInvalidSignature)
+	}
+	if len(publicKey) == 0 {
+		return fmt.Errorf("signatures[%d]: public key of the signer must be given", idx)
+	}
+	digest := p.Digest()
+	if digest == nil || !sig.Clone().VerifyWithPublicKey(digest, publicKey) {
+		return fmt.Errorf("signatures[%d]: %w", idx, ErrInvalidSignature)
+	}
+	return nil
+}
 
-	err := p.packBase(buf)
+// VerifySignedBy verifies the signature at the index with the public key of the user given by keys
+func (p *BBcTransaction) VerifySignedBy(idx int, userID []byte, keys KeyResolver) error {
+	if keys == nil {
+		return errors.New("key resolver must be given")
+	}
+	publicKey, err := keys(userID)
 	if err != nil {
-		p.digestCalculating = false
-		return nil
+		return fmt.Errorf("public key of %x: %w", userID, err)
 	}
+	return p.VerifySignatureAt(idx, publicKey)
+}
 
-	buf = new(bytes.Buffer)
-	if err = binary.Write(buf, binary.LittleEndian, p.TransactionBaseDigest); err != nil {
-		p.digestCalculating = false
+// Digest calculates TransactionID of the BBcTransaction object
+// It sets TransactionID and TransactionBaseDigest and updates the digest cache, but does not change the content (including Timestamp).
+// The cached digest is returned if the content of the transaction has not been changed since the last calculation.
+func (p *BBcTransaction) Digest() []byte {
+	b := GetPackBuffer()
+	defer b.Release()
+	packed, baseSize, err := p.packDigestTarget(b.packed[:0])
+	b.packed = packed
+	if err != nil {
+		_ = logError(err, "failed to pack BBcTransaction for digest")
 		return nil
 	}
+	p.updateDigest(packed, baseSize)
+	return append([]byte{}, p.digestCache.digest[:]...)
+}
 
-	err = p.packCrossRef(buf)
+// IsDirty returns true if TransactionID and TransactionBaseDigest have not been calculated for the current content of the transaction
+// Digest or Pack updates them.
+func (p *BBcTransaction) IsDirty() bool {
+	c := &p.digestCache
+	if !c.valid || p.TransactionIdLength > sha256.Size {
+		return true
+	}
+	b := GetPackBuffer()
+	defer b.Release()
+	packed, _, err := p.packDigestTarget(b.packed[:0])
+	b.packed = packed
 	if err != nil {
-		p.digestCalculating = false
-		return nil
+		return true
 	}
+	return !bytes.Equal(c.packed, packed) ||
+		!bytes.Equal(p.TransactionID, c.digest[:p.TransactionIdLength]) ||
+		!bytes.Equal(p.TransactionBaseDigest, c.baseDigest[:])
+}
 
-	digest := sha256.Sum256(buf.Bytes())
-	p.TransactionID = digest[:p.TransactionIdLength]
-	p.digestCalculating = false
-	return digest[:]
+// packDigestTarget appends the packed data from version to BBcCrossRef to dst, and returns it with the size of the base part (from version to witness)
+func (p *BBcTransaction) packDigestTarget(dst []byte) ([]byte, int, error) {
+	e := encoder{buf: dst}
+	start := len(e.buf)
+	if err := p.encodeBase(&e); err != nil {
+		return e.buf, 0, err
+	}
+	baseSize := len(e.buf) - start
+	if err := p.encodeCrossRef(&e); err != nil {
+		return e.buf, 0, err
+	}
+	return e.buf, baseSize, nil
+}
+
+// updateDigest re-calculates the digests if the packed data (from version to BBcCrossRef) differs from the cached one,
+// and sets TransactionID and TransactionBaseDigest if they are stale
+func (p *BBcTransaction) updateDigest(packed []byte, baseSize int) {
+	c := &p.digestCache
+	if !c.valid || !bytes.Equal(c.packed, packed) {
+		c.packed = append(c.packed[:0], packed...)
+		c.baseDigest = sha256.Sum256(packed[:baseSize])
+		h := sha256.New()
+		h.Write(c.baseDigest[:])
+		h.Write(packed[baseSize:])
+		h.Sum(c.digest[:0])
+		c.valid = true
+	}
+	if !bytes.Equal(p.TransactionBaseDigest, c.baseDigest[:]) {
+		p.TransactionBaseDigest = append([]byte{}, c.baseDigest[:]...)
+	}
+	if !bytes.Equal(p.TransactionID, c.digest[:p.TransactionIdLength]) {
+		p.TransactionID = append([]byte{}, c.digest[:p.TransactionIdLength]...)
+	}
 }
 
 // packCrossRef packs only BBcCrossRef object in binary data
@@ -332,57 +471,80 @@ func (p *BBcTransaction) packCrossRef(buf *bytes.Buffer) error {
 		if err != nil {
 			return err
 		}
-		Put2byte(buf, 1)
-		Put4byte(buf, uint32(binary.Size(dat)))
+		if err := Put2byte(buf, 1); err != nil {
+			return err
+		}
+		if err := Put4byte(buf, uint32(binary.Size(dat))); err != nil {
+			return err
+		}
 		if err := binary.Write(buf, binary.LittleEndian, dat); err != nil {
 			return err
 		}
 	} else {
-		Put2byte(buf, 0)
+		if err := Put2byte(buf, 0); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 // packBase packs the base part of BBcTransaction object in binary data (from version to witness)
 func (p *BBcTransaction) packBase(buf *bytes.Buffer) error {
-	Put4byte(buf, p.Version)
-	if p.Timestamp == 0 {
-		p.Timestamp = time.Now().UnixNano() / int64(time.Microsecond)
+	if err := Put4byte(buf, p.Version); err != nil {
+		return err
+	}
+	if err := Put8byte(buf, p.Timestamp); err != nil {
+		return err
+	}
+	if hasIdLengthHeader(p.Version) {
+		if err := Put2byte(buf, uint16(p.TransactionIdLength)); err != nil {
+			return err
+		}
 	}
-	Put8byte(buf, p.Timestamp)
-	Put2byte(buf, uint16(p.TransactionIdLength))
 
-	Put2byte(buf, uint16(len(p.Events)))
+	if err := Put2byte(buf, uint16(len(p.Events))); err != nil {
+		return err
+	}
 	for _, obj := range p.Events {
 		dat, err := obj.Pack()
 		if err != nil {
 			return err
 		}
-		Put4byte(buf, uint32(binary.Size(dat)))
+		if err := Put4byte(buf, uint32(binary.Size(dat))); err != nil {
+			return err
+		}
 		if err := binary.Write(buf, binary.LittleEndian, dat); err != nil {
 			return err
 		}
 	}
 
-	Put2byte(buf, uint16(len(p.References)))
+	if err := Put2byte(buf, uint16(len(p.References))); err != nil {
+		return err
+	}
 	for _, obj := range p.References {
 		dat, err := obj.Pack()
 		if err != nil {
 			return err
 		}
-		Put4byte(buf, uint32(binary.Size(dat)))
+		if err := Put4byte(buf, uint32(binary.Size(dat))); err != nil {
+			return err
+		}
 		if err := binary.Write(buf, binary.LittleEndian, dat); err != nil {
 			return err
 		}
 	}
 
-	Put2byte(buf, uint16(len(p.Relations)))
+	if err := Put2byte(buf, uint16(len(p.Relations))); err != nil {
+		return err
+	}
 	for _, obj := range p.Relations {
 		dat, err := obj.Pack()
 		if err != nil {
 			return err
 		}
-		Put4byte(buf, uint32(binary.Size(dat)))
+		if err := Put4byte(buf, uint32(binary.Size(dat))); err != nil {
+			return err
+		}
 		if err := binary.Write(buf, binary.LittleEndian, dat); err != nil {
 			return err
 		}
@@ -393,29 +555,28 @@ func (p *BBcTransaction) packBase(buf *bytes.Buffer) error {
 		if err != nil {
 			return err
 		}
-		Put2byte(buf, 1)
-		Put4byte(buf, uint32(binary.Size(dat)))
+		if err := Put2byte(buf, 1); err != nil {
+			return err
+		}
+		if err := Put4byte(buf, uint32(binary.Size(dat))); err != nil {
+			return err
+		}
 		if err := binary.Write(buf, binary.LittleEndian, dat); err != nil {
 			return err
 		}
 	} else {
-		Put2byte(buf, 0)
+		if err := Put2byte(buf, 0); err != nil {
+			return err
+		}
 	}
 
-	digest := sha256.Sum256(buf.Bytes())
-	p.TransactionBaseDigest = digest[:]
-
 	return nil
 }
 
 // Pack BBcTransaction object in binary data
 func (p *BBcTransaction) Pack() ([]byte, error) {
-	if !p.digestCalculating && p.TransactionID == nil {
-		p.Digest()
-	}
-
-	if p.Version == 0 {
-		return nil, errors.New("not support version=0 transaction")
+	if err := p.checkVersion(); err != nil {
+		return nil, err
 	}
 
 	buf := new(bytes.Buffer)
@@ -423,18 +584,24 @@ func (p *BBcTransaction) Pack() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	baseSize := buf.Len()
 	err = p.packCrossRef(buf)
 	if err != nil {
 		return nil, err
 	}
+	p.updateDigest(buf.Bytes(), baseSize)
 
-	Put2byte(buf, uint16(len(p.Signatures)))
+	if err := Put2byte(buf, uint16(len(p.Signatures))); err != nil {
+		return nil, err
+	}
 	for _, obj := range p.Signatures {
 		dat, err := obj.Pack()
 		if err != nil {
 			return nil, err
 		}
-		Put4byte(buf, uint32(binary.Size(dat)))
+		if err := Put4byte(buf, uint32(binary.Size(dat))); err != nil {
+			return nil, err
+		}
 		if err := binary.Write(buf, binary.LittleEndian, dat); err != nil {
 			return nil, err
 		}
@@ -445,21 +612,26 @@ func (p *BBcTransaction) Pack() ([]byte, error) {
 }
 
 // unpackHeader unpacks the header part of the binary data
-func (p *BBcTransaction) unpackHeader(buf *bytes.Buffer) error {
+func (p *BBcTransaction) unpackHeader(d *decoder) error {
 	var err error
-	p.Version, err = Get4byte(buf)
+	p.Version, err = d.get4byte("version")
 	if err != nil {
 		return err
 	}
 
-	p.Timestamp, err = Get8byte(buf)
+	p.Timestamp, err = d.get8byte("timestamp")
 	if err != nil {
 		return err
 	}
 
-	idLen, err := Get2byte(buf)
-	if err != nil {
-		return err
+	idLen := uint16(legacyIDLength)
+	if hasIdLengthHeader(p.Version) {
+		if idLen, err = d.get2byte("transaction_id_length"); err != nil {
+			return err
+		}
+		if idLen == 0 || idLen > sha256.Size {
+			return &DecodeError{Path: "transaction_id_length", Offset: d.offset() - 2, Err: fmt.Errorf("invalid length %d", idLen)}
+		}
 	}
 	p.IdLengthConf.TransactionIdLength = int(idLen)
 	p.TransactionIdLength = int(idLen)
@@ -467,22 +639,21 @@ func (p *BBcTransaction) unpackHeader(buf *bytes.Buffer) error {
 }
 
 // unpackEvent unpacks the events part of the binary data
-func (p *BBcTransaction) unpackEvent(buf *bytes.Buffer) error {
-	num, err := Get2byte(buf)
+func (p *BBcTransaction) unpackEvent(d *decoder) error {
+	num, err := d.get2byte("events")
 	if err != nil {
 		return err
 	}
 	for i := 0; i < int(num); i++ {
-		size, err2 := Get4byte(buf)
+		path := fmt.Sprintf("events[%d]", i)
+		size, err2 := d.get4byte(path)
 		if err2 != nil {
 			return err2
 		}
-		data, _, err2 := GetBytes(buf, int(size))
-		if err2 != nil {
+		obj := BBcEvent{}
+		if err2 = d.getObject(path, int(size), obj.Unpack); err2 != nil {
 			return err2
 		}
-		obj := BBcEvent{}
-		obj.Unpack(&data)
 		UpdateIdLengthConfig(&p.IdLengthConf, obj.IdLengthConf)
 		p.Events = append(p.Events, &obj)
 	}
@@ -490,23 +661,22 @@ func (p *BBcTransaction) unpackEvent(buf *bytes.Buffer) error {
 }
 
 // unpackReference unpacks the references part of the binary data
-func (p *BBcTransaction) unpackReference(buf *bytes.Buffer) error {
-	num, err := Get2byte(buf)
+func (p *BBcTransaction) unpackReference(d *decoder) error {
+	num, err := d.get2byte("references")
 	if err != nil {
 		return err
 	}
 	for i := 0; i < int(num); i++ {
-		size, err2 := Get4byte(buf)
-		if err2 != nil {
-			return err2
-		}
-		data, _, err2 := GetBytes(buf, int(size))
+		path := fmt.Sprintf("references[%d]", i)
+		size, err2 := d.get4byte(path)
 		if err2 != nil {
 			return err2
 		}
 		obj := BBcReference{}
 		obj.SetTransaction(p)
-		obj.Unpack(&data)
+		if err2 = d.getObject(path, int(size), obj.Unpack); err2 != nil {
+			return err2
+		}
 		UpdateIdLengthConfig(&p.IdLengthConf, obj.IdLengthConf)
 		p.References = append(p.References, &obj)
 	}
@@ -514,19 +684,21 @@ func (p *BBcTransaction) unpackReference(buf *bytes.Buffer) error {
 }
 
 // unpackRelation unpacks the relations part of the binary data
-func (p *BBcTransaction) unpackRelation(buf *bytes.Buffer) error {
-	num, err := Get2byte(buf)
+func (p *BBcTransaction) unpackRelation(d *decoder) error {
+	num, err := d.get2byte("relations")
 	if err != nil {
 		return err
 	}
 	for i := 0; i < int(num); i++ {
-		size, err2 := Get4byte(buf)
+		path := fmt.Sprintf("relations[%d]", i)
+		size, err2 := d.get4byte(path)
 		if err2 != nil {
 			return err2
 		}
-		data, _, _ := GetBytes(buf, int(size))
 		obj := BBcRelation{Version: p.Version}
-		obj.Unpack(&data)
+		if err2 = d.getObject(path, int(size), obj.Unpack); err2 != nil {
+			return err2
+		}
 		UpdateIdLengthConfig(&p.IdLengthConf, obj.IdLengthConf)
 		p.Relations = append(p.Relations, &obj)
 	}
@@ -534,101 +706,177 @@ func (p *BBcTransaction) unpackRelation(buf *bytes.Buffer) error {
 }
 
 // unpackWitness unpacks the witness part of the binary data
-func (p *BBcTransaction) unpackWitness(buf *bytes.Buffer) error {
-	num, err := Get2byte(buf)
+func (p *BBcTransaction) unpackWitness(d *decoder) error {
+	num, err := d.get2byte("witness")
 	if err != nil {
 		return err
 	}
 	if num > 0 {
-		size, err2 := Get4byte(buf)
+		size, err2 := d.get4byte("witness")
 		if err2 != nil {
 			return err2
 		}
-		data, _, _ := GetBytes(buf, int(size))
 		p.Witness = &BBcWitness{}
 		p.Witness.SetIdLengthConf(&p.IdLengthConf)
 		p.Witness.SetTransaction(p)
-		p.Witness.Unpack(&data)
+		if err2 = d.getObject("witness", int(size), p.Witness.Unpack); err2 != nil {
+			return err2
+		}
 	}
 	return nil
 }
 
 // unpackCrossRef unpacks the crossref part of the binary data
-func (p *BBcTransaction) unpackCrossRef(buf *bytes.Buffer) error {
-	num, err := Get2byte(buf)
+func (p *BBcTransaction) unpackCrossRef(d *decoder) error {
+	num, err := d.get2byte("cross_ref")
 	if err != nil {
 		return err
 	}
 	if num > 0 {
-		size, err2 := Get4byte(buf)
-		if err2 != nil {
-			return err2
-		}
-		dat, _, err2 := GetBytes(buf, int(size))
+		size, err2 := d.get4byte("cross_ref")
 		if err2 != nil {
 			return err2
 		}
 		p.Crossref = &BBcCrossRef{}
 		p.Crossref.SetIdLengthConf(&p.IdLengthConf)
-		p.Crossref.Unpack(&dat)
+		if err2 = d.getObject("cross_ref", int(size), p.Crossref.Unpack); err2 != nil {
+			return err2
+		}
 	}
 	return nil
 }
 
 // unpackSignature unpacks the signatures part of the binary data
-func (p *BBcTransaction) unpackSignature(buf *bytes.Buffer) error {
-	num, err := Get2byte(buf)
+func (p *BBcTransaction) unpackSignature(d *decoder) error {
+	num, err := d.get2byte("signatures")
 	if err != nil {
 		return err
 	}
 	for i := 0; i < int(num); i++ {
-		size, err2 := Get4byte(buf)
+		path := fmt.Sprintf("signatures[%d]", i)
+		size, err2 := d.get4byte(path)
 		if err2 != nil {
 			return err2
 		}
-		data, _, err2 := GetBytes(buf, int(size))
-		if err2 != nil {
+		obj := BBcSignature{}
+		if err2 = d.getObject(path, int(size), obj.Unpack); err2 != nil {
 			return err2
 		}
-		obj := BBcSignature{}
-		obj.Unpack(&data)
 		p.Signatures = append(p.Signatures, &obj)
 	}
 	return nil
 }
 
 // Unpack binary data to BBcTransaction object
+// If the data is broken, *DecodeError is returned with the path and offset of the field.
 func (p *BBcTransaction) Unpack(dat *[]byte) error {
-	buf := bytes.NewBuffer(*dat)
+	d := newDecoder(*dat)
 
-	if err := p.unpackHeader(buf); err != nil {
+	if err := p.unpackHeader(d); err != nil {
 		return err
 	}
 
-	if err := p.unpackEvent(buf); err != nil {
+	if err := p.unpackEvent(d); err != nil {
 		return err
 	}
 
-	if err := p.unpackReference(buf); err != nil {
+	if err := p.unpackReference(d); err != nil {
 		return err
 	}
 
-	if err := p.unpackRelation(buf); err != nil {
+	if err := p.unpackRelation(d); err != nil {
 		return err
 	}
 
-	if err := p.unpackWitness(buf); err != nil {
+	if err := p.unpackWitness(d); err != nil {
 		return err
 	}
 
-	if err := p.unpackCrossRef(buf); err != nil {
+	if err := p.unpackCrossRef(d); err != nil {
 		return err
 	}
 
-	if err := p.unpackSignature(buf); err != nil {
+	if err := p.unpackSignature(d); err != nil {
 		return err
 	}
 
 	p.Digest()
 	return nil
 }
+
+// Clone returns a deep copy of the BBcTransaction object
+// The back-pointers in BBcWitness and BBcReference objects are re-linked to the cloned transaction,
+// so that the clone can be modified and signed independently of the original.
+func (p *BBcTransaction) Clone() *BBcTransaction {
+	c := newCloneContext()
+	obj := BBcTransaction{
+		IdLengthConf:          p.IdLengthConf,
+		TransactionID:         cloneBytes(p.TransactionID),
+		TransactionBaseDigest: cloneBytes(p.TransactionBaseDigest),
+		TransactionData:       cloneBytes(p.TransactionData),
+		SigIndexedUsers:       cloneBytesList(p.SigIndexedUsers),
+		Version:               p.Version,
+		Timestamp:             p.Timestamp,
+		TransactionIdLength:   p.TransactionIdLength,
+	}
+	obj.digestCache = p.digestCache
+	obj.digestCache.packed = cloneBytes(p.digestCache.packed)
+	c.confs[&p.IdLengthConf] = &obj.IdLengthConf
+
+	for _, evt := range p.Events {
+		obj.Events = append(obj.Events, evt.clone(c))
+	}
+	for _, ref := range p.References {
+		r := ref.clone(c)
+		r.Transaction = &obj
+		obj.References = append(obj.References, r)
+	}
+	for _, rtn := range p.Relations {
+		obj.Relations = append(obj.Relations, rtn.clone(c))
+	}
+	obj.Witness = p.Witness.clone(c)
+	if obj.Witness != nil {
+		obj.Witness.Transaction = &obj
+	}
+	obj.Crossref = p.Crossref.clone(c)
+	for _, sig := range p.Signatures {
+		obj.Signatures = append(obj.Signatures, sig.Clone())
+	}
+	return &obj
+}
+
+// Equal returns true if the BBcTransaction objects have the same content to be packed
+// Internal values (e.g., TransactionData) and back-pointers are not compared.
+func (p *BBcTransaction) Equal(q *BBcTransaction) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	if p.Version != q.Version || p.Timestamp != q.Timestamp || p.TransactionIdLength != q.TransactionIdLength {
+		return false
+	}
+	if len(p.Events) != len(q.Events) || len(p.References) != len(q.References) ||
+		len(p.Relations) != len(q.Relations) || len(p.Signatures) != len(q.Signatures) {
+		return false
+	}
+	for i := range p.Events {
+		if !p.Events[i].Equal(q.Events[i]) {
+			return false
+		}
+	}
+	for i := range p.References {
+		if !p.References[i].Equal(q.References[i]) {
+			return false
+		}
+	}
+	for i := range p.Relations {
+		if !p.Relations[i].Equal(q.Relations[i]) {
+			return false
+		}
+	}
+	for i := range p.Signatures {
+		if !p.Signatures[i].Equal(q.Signatures[i]) {
+			return false
+		}
+	}
+	return p.Witness.Equal(q.Witness) && p.Crossref.Equal(q.Crossref)
+}
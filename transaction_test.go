@@ -569,3 +569,177 @@ func TestTransactionWithAssetRawAndAssetHash(t *testing.T) {
 		}
 	})
 }
+
+func TestTransactionCloneAndEqual(t *testing.T) {
+	txobj := makeBaseTx(idLengthConfig)
+	keypair, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+	assetgroup := GetIdentifier("asset_group_id1,,,,,,,", defaultIDLength)
+	txid1 := GetIdentifier("0123456789abcdef0123456789abcdef", defaultIDLength)
+	asid1 := GetIdentifier("123456789abcdef0123456789abcdef0", defaultIDLength)
+
+	txobj2 := BBcTransaction{Version: 2, Timestamp: time.Now().UnixNano()}
+	txobj2.SetIdLengthConf(&idLengthConfig)
+	txobj2.AddEvent(&assetgroup, nil).AddRelation(&assetgroup)
+	txobj2.Events[0].AddMandatoryApprover(&txtest_u5).CreateAsset(&txtest_u5, nil, map[string]int{"amount": 10})
+	txobj2.Relations[0].CreatePointer(&txid1, &asid1).CreateAsset(&txtest_u1, nil, "testString12345XXX")
+	txobj2.CreateReference(&assetgroup, &txobj, 0)
+	txobj2.AddWitness(&txtest_u5).AddWitness(&txtest_u6)
+	txobj2.Sign(&txtest_u1, keypair, false)
+	txobj2.Sign(&txtest_u2, keypair, false)
+	txobj2.Sign(&txtest_u4, keypair, false)
+
+	t.Run("clone and compare", func(t *testing.T) {
+		cloned := txobj2.Clone()
+		if !cloned.Equal(&txobj2) || !txobj2.Equal(cloned) {
+			t.Fatal("cloned transaction must be equal to the original")
+		}
+		if bytes.Compare(cloned.Digest(), txobj2.Digest()) != 0 {
+			t.Fatal("transaction_id mismatch")
+		}
+		if cloned.Witness.Transaction != cloned || cloned.References[0].Transaction != cloned {
+			t.Fatal("back-pointers are not re-linked")
+		}
+		if cloned.References[0].RefTransaction != &txobj {
+			t.Fatal("referred transaction must be kept")
+		}
+		if cloned.Relations[0].IdLengthConf != &cloned.IdLengthConf || cloned.Relations[0].Pointers[0].IdLengthConf != &cloned.IdLengthConf {
+			t.Fatal("ID length configuration must be shared in the cloned transaction")
+		}
+	})
+
+	t.Run("modify cloned transaction", func(t *testing.T) {
+		cloned := txobj2.Clone()
+		cloned.Relations[0].Asset.AssetBody[0] ^= 0xff
+		cloned.Relations[0].Pointers[0].TransactionID[0] ^= 0xff
+		cloned.Signatures[0].Signature[0] ^= 0xff
+		if cloned.Equal(&txobj2) {
+			t.Fatal("modified transaction must not be equal to the original")
+		}
+		if result, _ := txobj2.VerifyAll(); !result {
+			t.Fatal("original transaction must not be affected")
+		}
+	})
+
+	t.Run("sign cloned transaction", func(t *testing.T) {
+		cloned := txobj2.Clone()
+		cloned.Timestamp += 1
+		cloned.TransactionID = nil
+		cloned.Sign(&txtest_u5, keypair, false)
+		cloned.Sign(&txtest_u6, keypair, false)
+
+		sigNum := len(txobj2.Signatures)
+		if len(cloned.Signatures) != sigNum || bytes.Compare(cloned.Digest(), txobj2.Digest()) == 0 {
+			t.Fatal("cloned transaction is not independent")
+		}
+		if cloned.Signatures[cloned.Witness.SigIndices[0]].Signature == nil {
+			t.Fatal("signature is not set in the cloned transaction")
+		}
+		if txobj2.Signatures[txobj2.Witness.SigIndices[0]].Signature != nil {
+			t.Fatal("original transaction must not be signed")
+		}
+	})
+}
+
+func TestTransactionDigestCache(t *testing.T) {
+	refTxObj := makeBaseTx(idLengthConfig)
+	keypair, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+
+	t.Run("cached digest", func(t *testing.T) {
+		txobj := makeFollowTX(idLengthConfig, &refTxObj)
+		digest := txobj.Digest()
+		if txobj.IsDirty() {
+			t.Fatal("transaction must not be dirty after Digest")
+		}
+		if !bytes.Equal(txobj.Digest(), digest) || !bytes.Equal(txobj.TransactionID, digest[:txobj.TransactionIdLength]) {
+			t.Fatal("digest must not be changed")
+		}
+		txobj.Digest()[0] ^= 0xff
+		if !bytes.Equal(txobj.Digest(), digest) {
+			t.Fatal("cached digest must not be modified by the caller")
+		}
+		txobj.Sign(&txtest_u2, keypair, false)
+		if txobj.IsDirty() || !bytes.Equal(txobj.Digest(), digest) {
+			t.Fatal("signatures must not affect the digest")
+		}
+	})
+
+	t.Run("modification of child objects", func(t *testing.T) {
+		txobj := makeFollowTX(idLengthConfig, &refTxObj)
+		digest := txobj.Digest()
+		txid := txobj.TransactionID
+
+		txobj.Relations[0].Asset.AssetBody[0] ^= 0xff
+		if !txobj.IsDirty() {
+			t.Fatal("transaction must be dirty after modification")
+		}
+		if !bytes.Equal(txobj.TransactionID, txid) {
+			t.Fatal("IsDirty must not update TransactionID")
+		}
+		if bytes.Equal(txobj.Digest(), digest) || bytes.Equal(txobj.TransactionID, txid) {
+			t.Fatal("digest must be re-calculated")
+		}
+		if result, _ := txobj.VerifyAll(); result {
+			t.Fatal("old signatures must not be valid for the modified transaction")
+		}
+
+		txobj.Relations[0].Asset.AssetBody[0] ^= 0xff
+		if !bytes.Equal(txobj.Digest(), digest) {
+			t.Fatal("digest must be the same as the original")
+		}
+		if result, _ := txobj.VerifyAll(); !result {
+			t.Fatal("signatures must be valid for the original content")
+		}
+	})
+
+	t.Run("digest does not modify the transaction", func(t *testing.T) {
+		txobj := makeFollowTX(idLengthConfig, &refTxObj)
+		txobj.Timestamp = 0
+		digest := txobj.Digest()
+		if txobj.Timestamp != 0 {
+			t.Fatal("Digest must not set the timestamp")
+		}
+		if _, err := txobj.Pack(); err != nil || txobj.Timestamp != 0 || !bytes.Equal(txobj.Digest(), digest) {
+			t.Fatalf("Pack must not set the timestamp: %v", err)
+		}
+	})
+
+	t.Run("stale transaction_id", func(t *testing.T) {
+		txobj := makeFollowTX(idLengthConfig, &refTxObj)
+		txobj.Digest()
+		txid := append([]byte{}, txobj.TransactionID...)
+
+		txobj.Timestamp += 1
+		txobj.AddWitness(&txtest_u6)
+		if !txobj.IsDirty() {
+			t.Fatal("transaction must be dirty after modification")
+		}
+		dat, err := Serialize(&txobj, FormatZlib)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txobj.IsDirty() || bytes.Equal(txobj.TransactionID, txid) {
+			t.Fatal("TransactionID must be updated in serialization")
+		}
+		obj, _ := Deserialize(dat)
+		if !bytes.Equal(obj.TransactionID, txobj.TransactionID) {
+			t.Fatal("serialized transaction_id is stale")
+		}
+
+		txobj.TransactionID = txid
+		if !txobj.IsDirty() {
+			t.Fatal("modified TransactionID must be detected")
+		}
+		if _, err := txobj.AppendPack(nil); err != nil || txobj.IsDirty() {
+			t.Fatalf("TransactionID must be updated in AppendPack: %v", err)
+		}
+	})
+}
+
+func BenchmarkTransactionDigest(b *testing.B) {
+	refTxObj := makeBaseTx(idLengthConfig)
+	txobj := makeFollowTX(idLengthConfig, &refTxObj)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		txobj.Digest()
+	}
+}
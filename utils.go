@@ -21,6 +21,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"time"
 )
@@ -42,6 +43,7 @@ func GetRandomValue(length int) []byte {
 	val := make([]byte, length)
 	_, err := rand.Read(val)
 	if err != nil {
+		logf(LogLevelError, "failed to generate random value", LogField{"error", err})
 		for i := range val {
 			val[i] = 0x00
 		}
@@ -50,10 +52,8 @@ func GetRandomValue(length int) []byte {
 }
 
 // Put2byte sets uint16 in the buffer for packing
-func Put2byte(buf *bytes.Buffer, val uint16) {
-	if err := binary.Write(buf, binary.LittleEndian, val); err != nil {
-		fmt.Println("Error: Put2Byte")
-	}
+func Put2byte(buf *bytes.Buffer, val uint16) error {
+	return binary.Write(buf, binary.LittleEndian, val)
 }
 
 // Get2byte returns a uint16 value from the buffer
@@ -66,10 +66,8 @@ func Get2byte(buf *bytes.Buffer) (uint16, error) {
 }
 
 // Put4byte sets a uint32 in the buffer for packing
-func Put4byte(buf *bytes.Buffer, val uint32) {
-	if err := binary.Write(buf, binary.LittleEndian, val); err != nil {
-		fmt.Println("Error: Put4Byte")
-	}
+func Put4byte(buf *bytes.Buffer, val uint32) error {
+	return binary.Write(buf, binary.LittleEndian, val)
 }
 
 // Get4byte returns a uint32 value from the buffer
@@ -82,10 +80,8 @@ func Get4byte(buf *bytes.Buffer) (uint32, error) {
 }
 
 // Put8byte sets a int64 in the buffer for packing
-func Put8byte(buf *bytes.Buffer, val int64) {
-	if err := binary.Write(buf, binary.LittleEndian, val); err != nil {
-		fmt.Println("Error: Put8byte")
-	}
+func Put8byte(buf *bytes.Buffer, val int64) error {
+	return binary.Write(buf, binary.LittleEndian, val)
 }
 
 // Get8byte returns a int64 value from the buffer
@@ -98,11 +94,18 @@ func Get8byte(buf *bytes.Buffer) (int64, error) {
 }
 
 // PutBigInt sets a ID data in the buffer for packing
-func PutBigInt(buf *bytes.Buffer, val *[]byte, length int) {
-	Put2byte(buf, uint16(length))
-	if err := binary.Write(buf, binary.LittleEndian, val); err != nil {
-		fmt.Println("Error: PutBigInt")
+// The length must be equal to the length of the ID data, otherwise the packed data is broken.
+func PutBigInt(buf *bytes.Buffer, val *[]byte, length int) error {
+	if val == nil {
+		return errors.New("ID data must be given")
+	}
+	if len(*val) != length || length > 0xFFFF {
+		return fmt.Errorf("invalid ID length (data=%d, length=%d)", len(*val), length)
 	}
+	if err := Put2byte(buf, uint16(length)); err != nil {
+		return err
+	}
+	return binary.Write(buf, binary.LittleEndian, *val)
 }
 
 // GetBigInt returns a ID data from the buffer
@@ -122,3 +125,61 @@ func GetBytes(buf *bytes.Buffer, length int) ([]byte, int, error) {
 	}
 	return val, length, nil
 }
+
+// cloneBytes returns a copy of the given byte slice (nil is kept nil)
+func cloneBytes(val []byte) []byte {
+	if val == nil {
+		return nil
+	}
+	ret := make([]byte, len(val))
+	copy(ret, val)
+	return ret
+}
+
+// cloneBytesList returns a deep copy of the given list of byte slices
+func cloneBytesList(vals [][]byte) [][]byte {
+	if vals == nil {
+		return nil
+	}
+	ret := make([][]byte, len(vals))
+	for i := range vals {
+		ret[i] = cloneBytes(vals[i])
+	}
+	return ret
+}
+
+// equalBytesList compares two lists of byte slices
+func equalBytesList(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// cloneContext keeps the mapping between original and cloned ID length configurations so that shared configuration is also shared in the clone
+type cloneContext struct {
+	confs map[*BBcIdConfig]*BBcIdConfig
+}
+
+// newCloneContext returns an empty cloneContext
+func newCloneContext() *cloneContext {
+	return &cloneContext{confs: make(map[*BBcIdConfig]*BBcIdConfig)}
+}
+
+// conf returns the cloned ID length configuration (the same original gives the same clone)
+func (c *cloneContext) conf(conf *BBcIdConfig) *BBcIdConfig {
+	if conf == nil {
+		return nil
+	}
+	if ret, ok := c.confs[conf]; ok {
+		return ret
+	}
+	ret := *conf
+	c.confs[conf] = &ret
+	return &ret
+}
@@ -0,0 +1,309 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+/*
+Validation rules
+
+Business rules of transactions (e.g., body schema, allowed pointer targets, timestamp windows) are ValidationRules registered in a RuleEngine.
+A rule registered globally runs once for each transaction, and a rule registered for an AssetGroupID runs if the transaction has
+BBcEvent, BBcReference or BBcRelation objects of the asset group. The objects of the asset group are given by ValidationContext.
+
+A rule reports the problems as Violations with the path of the object (e.g., "relations[0].pointers[1]"),
+and RuleEngine.Validate returns all violations of all rules in *ValidationError.
+The referred transactions (BBcReference and BBcPointer) are resolved by TransactionResolver.
+*/
+
+type (
+	// TransactionResolver returns the transaction of the TransactionID (an error if not found)
+	TransactionResolver func(transactionID []byte) (*BBcTransaction, error)
+
+	// ValidationRule is a business rule checked against a transaction
+	ValidationRule interface {
+		Name() string
+		Validate(ctx *ValidationContext) []Violation
+	}
+
+	// Violation is a problem reported by a rule
+	Violation struct {
+		Rule         string
+		AssetGroupID []byte
+		Path         string
+		Message      string
+	}
+
+	// ValidationError is returned by RuleEngine.Validate, and includes all violations
+	ValidationError struct {
+		Violations []Violation
+	}
+
+	// RuleEngine holds the rules registered globally and per AssetGroupID
+	RuleEngine struct {
+		mutex       sync.RWMutex
+		globalRules []ValidationRule
+		groupRules  []groupRule
+	}
+
+	groupRule struct {
+		assetGroupID []byte
+		rule         ValidationRule
+	}
+
+	// ValidationContext is given to a rule with the transaction, the asset group (nil for a global rule) and the resolver
+	ValidationContext struct {
+		Transaction  *BBcTransaction
+		AssetGroupID []byte
+		resolver     TransactionResolver
+		resolved     map[string]*BBcTransaction
+	}
+
+	// ContextAsset is an asset in the transaction with its path
+	ContextAsset struct {
+		Path         string
+		AssetGroupID []byte
+		Asset        *BBcAsset
+		AssetRaw     *BBcAssetRaw
+	}
+
+	ruleFunc struct {
+		name string
+		fn   func(ctx *ValidationContext) []Violation
+	}
+)
+
+// ErrNoResolver is returned by ValidationContext.Resolve if no resolver is given
+var ErrNoResolver = errors.New("no transaction resolver")
+
+// String returns the violation in text
+func (v Violation) String() string {
+	msg := v.Message
+	if v.Path != "" {
+		msg = v.Path + ": " + msg
+	}
+	if v.AssetGroupID != nil {
+		return fmt.Sprintf("[%s] asset_group_id=%x: %s", v.Rule, v.AssetGroupID, msg)
+	}
+	return fmt.Sprintf("[%s] %s", v.Rule, msg)
+}
+
+// Error returns all violations
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.String()
+	}
+	return fmt.Sprintf("transaction validation failed: %s", strings.Join(msgs, "; "))
+}
+
+// NewRule returns a ValidationRule with the name and the function
+func NewRule(name string, fn func(ctx *ValidationContext) []Violation) ValidationRule {
+	return &ruleFunc{name: name, fn: fn}
+}
+
+// Name returns the name of the rule
+func (r *ruleFunc) Name() string {
+	return r.name
+}
+
+// Validate runs the function of the rule
+func (r *ruleFunc) Validate(ctx *ValidationContext) []Violation {
+	return r.fn(ctx)
+}
+
+// NewRuleEngine returns an empty rule engine
+func NewRuleEngine() *RuleEngine {
+	return &RuleEngine{}
+}
+
+// RegisterGlobal registers the rule for all transactions
+func (e *RuleEngine) RegisterGlobal(rule ValidationRule) error {
+	if rule == nil {
+		return errors.New("rule must not be nil")
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.globalRules = append(e.globalRules, rule)
+	return nil
+}
+
+// Register registers the rule for the asset group
+func (e *RuleEngine) Register(assetGroupID []byte, rule ValidationRule) error {
+	if len(assetGroupID) == 0 {
+		return errors.New("asset_group_id must be given")
+	}
+	if rule == nil {
+		return errors.New("rule must not be nil")
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.groupRules = append(e.groupRules, groupRule{assetGroupID: cloneBytes(assetGroupID), rule: rule})
+	return nil
+}
+
+// Validate runs the rules for the transaction and returns *ValidationError with all violations (nil if no violation)
+// resolver can be nil if no rule resolves the referred transactions.
+func (e *RuleEngine) Validate(txobj *BBcTransaction, resolver TransactionResolver) error {
+	if txobj == nil {
+		return errors.New("transaction must be given")
+	}
+	e.mutex.RLock()
+	globalRules := append([]ValidationRule{}, e.globalRules...)
+	groupRules := append([]groupRule{}, e.groupRules...)
+	e.mutex.RUnlock()
+
+	resolved := make(map[string]*BBcTransaction)
+	var violations []Violation
+	run := func(rule ValidationRule, assetGroupID []byte) {
+		ctx := ValidationContext{Transaction: txobj, AssetGroupID: assetGroupID, resolver: resolver, resolved: resolved}
+		for _, v := range rule.Validate(&ctx) {
+			if v.Rule == "" {
+				v.Rule = rule.Name()
+			}
+			if v.AssetGroupID == nil {
+				v.AssetGroupID = assetGroupID
+			}
+			violations = append(violations, v)
+		}
+	}
+
+	for _, rule := range globalRules {
+		run(rule, nil)
+	}
+	groups := txobj.assetGroupIDs()
+	for _, r := range groupRules {
+		if containsID(groups, r.assetGroupID) {
+			run(r.rule, r.assetGroupID)
+		}
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// assetGroupIDs returns the asset_group_ids of BBcEvent, BBcReference and BBcRelation objects in the transaction
+func (p *BBcTransaction) assetGroupIDs() [][]byte {
+	var ids [][]byte
+	add := func(id []byte) {
+		if len(id) > 0 && !containsID(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	for _, obj := range p.Events {
+		add(obj.AssetGroupID)
+	}
+	for _, obj := range p.References {
+		add(obj.AssetGroupID)
+	}
+	for _, obj := range p.Relations {
+		add(obj.AssetGroupID)
+	}
+	return ids
+}
+
+// Violation returns a violation at the path with the formatted message
+func (c *ValidationContext) Violation(path, format string, args ...interface{}) Violation {
+	return Violation{Path: path, Message: fmt.Sprintf(format, args...)}
+}
+
+// inGroup returns true if the asset_group_id is in the asset group of the context (always true for a global rule)
+func (c *ValidationContext) inGroup(assetGroupID []byte) bool {
+	return c.AssetGroupID == nil || bytes.Equal(c.AssetGroupID, assetGroupID)
+}
+
+// Events returns the indices of BBcEvent objects in the asset group
+func (c *ValidationContext) Events() []int {
+	var indices []int
+	for i, obj := range c.Transaction.Events {
+		if obj != nil && c.inGroup(obj.AssetGroupID) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// References returns the indices of BBcReference objects in the asset group
+func (c *ValidationContext) References() []int {
+	var indices []int
+	for i, obj := range c.Transaction.References {
+		if obj != nil && c.inGroup(obj.AssetGroupID) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// Relations returns the indices of BBcRelation objects in the asset group
+func (c *ValidationContext) Relations() []int {
+	var indices []int
+	for i, obj := range c.Transaction.Relations {
+		if obj != nil && c.inGroup(obj.AssetGroupID) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// Assets returns BBcAsset and BBcAssetRaw objects in BBcEvent and BBcRelation objects of the asset group
+func (c *ValidationContext) Assets() []ContextAsset {
+	var assets []ContextAsset
+	for _, i := range c.Events() {
+		evt := c.Transaction.Events[i]
+		if evt.Asset != nil {
+			assets = append(assets, ContextAsset{Path: fmt.Sprintf("events[%d].asset", i), AssetGroupID: evt.AssetGroupID, Asset: evt.Asset})
+		}
+	}
+	for _, i := range c.Relations() {
+		rtn := c.Transaction.Relations[i]
+		if rtn.Asset != nil {
+			assets = append(assets, ContextAsset{Path: fmt.Sprintf("relations[%d].asset", i), AssetGroupID: rtn.AssetGroupID, Asset: rtn.Asset})
+		}
+		if rtn.AssetRaw != nil {
+			assets = append(assets, ContextAsset{Path: fmt.Sprintf("relations[%d].asset_raw", i), AssetGroupID: rtn.AssetGroupID, AssetRaw: rtn.AssetRaw})
+		}
+	}
+	return assets
+}
+
+// Resolve returns the transaction of the TransactionID by the resolver (the result is shared by the rules in a validation)
+func (c *ValidationContext) Resolve(transactionID []byte) (*BBcTransaction, error) {
+	key := hex.EncodeToString(transactionID)
+	if txobj, ok := c.resolved[key]; ok {
+		return txobj, nil
+	}
+	if c.resolver == nil {
+		return nil, ErrNoResolver
+	}
+	txobj, err := c.resolver(transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if txobj == nil {
+		return nil, fmt.Errorf("transaction %x not found", transactionID)
+	}
+	c.resolved[key] = txobj
+	return txobj, nil
+}
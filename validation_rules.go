@@ -0,0 +1,326 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Names of the built-in rules
+const (
+	RuleBodyType        = "body_type"
+	RuleBodySchema      = "body_schema"
+	RulePointerTarget   = "pointer_target"
+	RuleReference       = "reference"
+	RuleCausalOrder     = "causal_order"
+	RuleTimestampWindow = "timestamp_window"
+	RuleSignatures      = "signatures"
+)
+
+// BodyTypeRule returns the rule that the asset bodies are in one of the types (BBcAssetRaw is AssetBodyTypeRaw)
+func BodyTypeRule(bodyTypes ...uint16) ValidationRule {
+	return NewRule(RuleBodyType, func(ctx *ValidationContext) []Violation {
+		var violations []Violation
+		for _, a := range ctx.Assets() {
+			bodyType := uint16(AssetBodyTypeRaw)
+			if a.Asset != nil {
+				bodyType = a.Asset.AssetBodyType
+			}
+			allowed := false
+			for _, t := range bodyTypes {
+				allowed = allowed || t == bodyType
+			}
+			if !allowed {
+				violations = append(violations, ctx.Violation(a.Path+".asset_body_type", "body type %d is not allowed", bodyType))
+			}
+		}
+		return violations
+	})
+}
+
+// BodySchemaRule returns the rule that the asset bodies are decoded into the object made by newObject,
+// and that check (if not nil) accepts the decoded object
+// The body of BBcAssetRaw is decoded as a raw body, so that newObject must return *string or *[]byte to accept it.
+func BodySchemaRule(newObject func() interface{}, check func(obj interface{}) error) ValidationRule {
+	return NewRule(RuleBodySchema, func(ctx *ValidationContext) []Violation {
+		var violations []Violation
+		for _, a := range ctx.Assets() {
+			asset := a.Asset
+			if a.AssetRaw != nil {
+				asset = &BBcAsset{AssetBodyType: AssetBodyTypeRaw, AssetBody: a.AssetRaw.AssetBody}
+			}
+			if asset.AssetBodySize == 0 && len(asset.AssetBody) == 0 {
+				violations = append(violations, ctx.Violation(a.Path+".asset_body", "no asset body"))
+				continue
+			}
+			obj := newObject()
+			if err := asset.DecodeBody(obj); err != nil {
+				violations = append(violations, ctx.Violation(a.Path+".asset_body", "cannot decode: %v", err))
+				continue
+			}
+			if check == nil {
+				continue
+			}
+			if err := check(obj); err != nil {
+				violations = append(violations, ctx.Violation(a.Path+".asset_body", "%v", err))
+			}
+		}
+		return violations
+	})
+}
+
+// PointerTargetRule returns the rule that the BBcPointer objects in the asset group point to existing transactions (and assets)
+// If allowedGroups are given, the pointed asset (or any object of the pointed transaction if AssetID is not given) must be in them.
+func PointerTargetRule(allowedGroups ...[]byte) ValidationRule {
+	return NewRule(RulePointerTarget, func(ctx *ValidationContext) []Violation {
+		var violations []Violation
+		for _, i := range ctx.Relations() {
+			for j, ptr := range ctx.Transaction.Relations[i].Pointers {
+				path := fmt.Sprintf("relations[%d].pointers[%d]", i, j)
+				if ptr == nil {
+					violations = append(violations, ctx.Violation(path, "nil pointer"))
+					continue
+				}
+				target, err := ctx.Resolve(ptr.TransactionID)
+				if err != nil {
+					violations = append(violations, ctx.Violation(path+".transaction_id", "cannot resolve %x: %v", ptr.TransactionID, err))
+					continue
+				}
+				var groups [][]byte
+				if ptr.AssetID != nil {
+					group, ok := findAssetGroup(target, ptr.AssetID)
+					if !ok {
+						violations = append(violations, ctx.Violation(path+".asset_id", "asset %x not found in transaction %x", ptr.AssetID, ptr.TransactionID))
+						continue
+					}
+					groups = [][]byte{group}
+				} else {
+					groups = target.assetGroupIDs()
+				}
+				if len(allowedGroups) > 0 && !anyContained(allowedGroups, groups) {
+					violations = append(violations, ctx.Violation(path, "target is not in the allowed asset groups"))
+				}
+			}
+		}
+		return violations
+	})
+}
+
+// ReferenceRule returns the rule that the BBcReference objects in the asset group refer to BBcEvent objects in the same asset group,
+// and that the approvers of the referred events have signed the transaction in the signature slots (SigIndices) of the references
+// Each slot for the option approvers must be signed by a distinct option approver. If keys is not nil, the signatures are verified
+// with the public keys of the approvers given by keys. Otherwise, only the signatures themselves are verified (with the public keys
+// in them), so that the signers are not authenticated.
+func ReferenceRule(keys KeyResolver) ValidationRule {
+	return NewRule(RuleReference, func(ctx *ValidationContext) []Violation {
+		var violations []Violation
+		for _, i := range ctx.References() {
+			ref := ctx.Transaction.References[i]
+			path := fmt.Sprintf("references[%d]", i)
+			target, err := ctx.Resolve(ref.TransactionID)
+			if err != nil {
+				violations = append(violations, ctx.Violation(path+".transaction_id", "cannot resolve %x: %v", ref.TransactionID, err))
+				continue
+			}
+			if int(ref.EventIndexInRef) >= len(target.Events) {
+				violations = append(violations, ctx.Violation(path+".event_index_in_ref", "no event %d in transaction %x", ref.EventIndexInRef, ref.TransactionID))
+				continue
+			}
+			evt := target.Events[ref.EventIndexInRef]
+			if !bytes.Equal(evt.AssetGroupID, ref.AssetGroupID) {
+				violations = append(violations, ctx.Violation(path+".asset_group_id", "referred event is in asset group %x", evt.AssetGroupID))
+			}
+			violations = append(violations, approvalViolations(ctx, path, ref, evt, keys)...)
+		}
+		return violations
+	})
+}
+
+// approvalViolations checks that the approvers of the referred event have signed in the signature slots of the reference
+func approvalViolations(ctx *ValidationContext, path string, ref *BBcReference, evt *BBcEvent, keys KeyResolver) []Violation {
+	txobj := ctx.Transaction
+	mandatory := len(evt.MandatoryApprovers)
+	if len(ref.SigIndices) != mandatory+int(evt.OptionApproverNumNumerator) {
+		return []Violation{ctx.Violation(path+".sig_indices", "%d slots for %d mandatory and %d option approvers",
+			len(ref.SigIndices), mandatory, evt.OptionApproverNumNumerator)}
+	}
+	var violations []Violation
+	used := make(map[int]bool)
+	var options [][]byte
+	for j, idx := range ref.SigIndices {
+		slot := fmt.Sprintf("%s.sig_indices[%d]", path, j)
+		if used[idx] {
+			violations = append(violations, ctx.Violation(slot, "signatures[%d] is used for another approver", idx))
+			continue
+		}
+		used[idx] = true
+		if j < mandatory {
+			if err := signedBy(txobj, idx, evt.MandatoryApprovers[j], keys); err != nil {
+				violations = append(violations, ctx.Violation(slot, "not signed by the approver %x: %v", evt.MandatoryApprovers[j], err))
+			}
+			continue
+		}
+		signer, err := optionApprover(txobj, idx, evt.OptionApprovers, options, keys)
+		if err != nil {
+			violations = append(violations, ctx.Violation(slot, "not signed by an option approver: %v", err))
+			continue
+		}
+		options = append(options, signer)
+	}
+	return violations
+}
+
+// optionApprover returns the option approver (not in signed) who made the signature at the index
+// If keys is nil, the signature is verified with the public key in it, and the signer is unknown (nil).
+func optionApprover(txobj *BBcTransaction, idx int, approvers, signed [][]byte, keys KeyResolver) ([]byte, error) {
+	if keys == nil {
+		return nil, signedBy(txobj, idx, nil, nil)
+	}
+	err := fmt.Errorf("signatures[%d]: %w", idx, ErrNotSigner)
+	for _, uid := range approvers {
+		if containsID(signed, uid) {
+			continue
+		}
+		if err = txobj.VerifySignedBy(idx, uid, keys); err == nil {
+			return uid, nil
+		}
+	}
+	return nil, err
+}
+
+// signedBy verifies the signature at the index, made by the user with the public key given by keys
+// If keys is nil, the signature is verified with the public key in it.
+func signedBy(txobj *BBcTransaction, idx int, userID []byte, keys KeyResolver) error {
+	if keys != nil {
+		return txobj.VerifySignedBy(idx, userID, keys)
+	}
+	if idx < 0 || idx >= len(txobj.Signatures) || txobj.Signatures[idx] == nil {
+		return fmt.Errorf("signatures[%d]: not signed", idx)
+	}
+	return txobj.VerifySignatureAt(idx, txobj.Signatures[idx].Pubkey)
+}
+
+// CausalOrderRule returns the rule that the transactions referred by BBcReference and BBcPointer objects in the asset group
+// are not newer than the transaction (the timestamps are compared)
+// The transactions that cannot be resolved are ignored (see ReferenceRule and PointerTargetRule).
+func CausalOrderRule() ValidationRule {
+	return NewRule(RuleCausalOrder, func(ctx *ValidationContext) []Violation {
+		var violations []Violation
+		check := func(path string, transactionID []byte) {
+			target, err := ctx.Resolve(transactionID)
+			if err != nil {
+				return
+			}
+			if target.Timestamp > ctx.Transaction.Timestamp {
+				violations = append(violations, ctx.Violation(path, "referred transaction %x is newer (timestamp %d > %d)", transactionID, target.Timestamp, ctx.Transaction.Timestamp))
+			}
+		}
+		for _, i := range ctx.References() {
+			check(fmt.Sprintf("references[%d]", i), ctx.Transaction.References[i].TransactionID)
+		}
+		for _, i := range ctx.Relations() {
+			for j, ptr := range ctx.Transaction.Relations[i].Pointers {
+				if ptr != nil {
+					check(fmt.Sprintf("relations[%d].pointers[%d]", i, j), ptr.TransactionID)
+				}
+			}
+		}
+		return violations
+	})
+}
+
+// TimestampWindowRule returns the rule that the timestamp of the transaction is within [now-maxPast, now+maxFuture]
+// A zero duration disables the bound. now is time.Now if nil.
+func TimestampWindowRule(maxPast, maxFuture time.Duration, now func() time.Time) ValidationRule {
+	if now == nil {
+		now = time.Now
+	}
+	return NewRule(RuleTimestampWindow, func(ctx *ValidationContext) []Violation {
+		current := now().UnixNano() / int64(time.Microsecond)
+		ts := ctx.Transaction.Timestamp
+		if maxPast > 0 && ts < current-int64(maxPast/time.Microsecond) {
+			return []Violation{ctx.Violation("timestamp", "%d is older than %v", ts, maxPast)}
+		}
+		if maxFuture > 0 && ts > current+int64(maxFuture/time.Microsecond) {
+			return []Violation{ctx.Violation("timestamp", "%d is later than %v in the future", ts, maxFuture)}
+		}
+		return nil
+	})
+}
+
+// SignatureRule returns the rule that all signature slots are filled with valid signatures
+// If keys is not nil, the signatures of the witnesses are also verified with the public keys of the users given by keys
+// (the signatures of the approvers are checked by ReferenceRule).
+func SignatureRule(keys KeyResolver) ValidationRule {
+	return NewRule(RuleSignatures, func(ctx *ValidationContext) []Violation {
+		var violations []Violation
+		for i, sig := range ctx.Transaction.Signatures {
+			if sig == nil || sig.KeyType == KeyTypeNotInitialized {
+				violations = append(violations, ctx.Violation(fmt.Sprintf("signatures[%d]", i), "not signed"))
+			}
+		}
+		if result, idx := ctx.Transaction.VerifyAll(); !result {
+			violations = append(violations, ctx.Violation(fmt.Sprintf("signatures[%d]", idx), "%v", ErrInvalidSignature))
+		}
+		if keys == nil || ctx.Transaction.Witness == nil {
+			return violations
+		}
+		witness := ctx.Transaction.Witness
+		for i, uid := range witness.UserIDs {
+			if i >= len(witness.SigIndices) {
+				break
+			}
+			if err := ctx.Transaction.VerifySignedBy(witness.SigIndices[i], uid, keys); err != nil {
+				violations = append(violations, ctx.Violation(fmt.Sprintf("witness.user_ids[%d]", i), "not signed by the user %x: %v", uid, err))
+			}
+		}
+		return violations
+	})
+}
+
+// findAssetGroup returns the asset_group_id of the asset in the transaction
+func findAssetGroup(txobj *BBcTransaction, assetID []byte) ([]byte, bool) {
+	for _, evt := range txobj.Events {
+		if evt.Asset != nil && bytes.Equal(evt.Asset.AssetID, assetID) {
+			return evt.AssetGroupID, true
+		}
+	}
+	for _, rtn := range txobj.Relations {
+		if rtn.Asset != nil && bytes.Equal(rtn.Asset.AssetID, assetID) {
+			return rtn.AssetGroupID, true
+		}
+		if rtn.AssetRaw != nil && bytes.Equal(rtn.AssetRaw.AssetID, assetID) {
+			return rtn.AssetGroupID, true
+		}
+		if rtn.AssetHash != nil && containsID(rtn.AssetHash.AssetIDs, assetID) {
+			return rtn.AssetGroupID, true
+		}
+	}
+	return nil, false
+}
+
+// anyContained returns true if any of ids is in the list
+func anyContained(list [][]byte, ids [][]byte) bool {
+	for _, id := range ids {
+		if containsID(list, id) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,272 @@
+/*
+Copyright (c) 2020 Zettant Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bbclib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRuleEngine(t *testing.T) {
+	group1 := GetIdentifier("validation_group1", defaultIDLength)
+	group2 := GetIdentifier("validation_group2", defaultIDLength)
+	keypair, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts := now.UnixNano() / int64(time.Microsecond)
+
+	prevTx, err := NewTransactionBuilder(nil).
+		SetTimestamp(ts-1000).
+		AddEvent(&group1, func(e *EventBuilder) {
+			e.AddMandatoryApprover(&txtest_u1).CreateAsset(&txtest_u1, nil, map[string]int{"amount": 10})
+		}).
+		AddWitness(&txtest_u1).
+		Sign(&txtest_u1, keypair, false).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := map[string]*BBcTransaction{string(prevTx.TransactionID): prevTx}
+	resolver := func(txid []byte) (*BBcTransaction, error) {
+		if txobj, ok := store[string(txid)]; ok {
+			return txobj, nil
+		}
+		return nil, errors.New("not found")
+	}
+	prevAsset := prevTx.Events[0].Asset.AssetID
+	unknown := GetIdentifier("unknown transaction", defaultIDLength)
+
+	makeTx := func(timestamp int64, ptrTxID, ptrAssetID []byte) *BBcTransaction {
+		txobj, err := NewTransactionBuilder(nil).
+			SetTimestamp(timestamp).
+			AddEvent(&group1, func(e *EventBuilder) {
+				e.AddReferenceIndex(0).AddMandatoryApprover(&txtest_u2).CreateAsset(&txtest_u2, nil, map[string]int{"amount": 10})
+			}).
+			CreateReference(&group1, prevTx, 0).
+			AddRelation(&group2, func(r *RelationBuilder) {
+				r.CreatePointer(&ptrTxID, &ptrAssetID).CreateAsset(&txtest_u2, nil, "memo")
+			}).
+			Sign(&txtest_u1, keypair, false).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return txobj
+	}
+
+	t.Run("valid transaction", func(t *testing.T) {
+		engine := NewRuleEngine()
+		_ = engine.RegisterGlobal(SignatureRule(nil))
+		_ = engine.RegisterGlobal(TimestampWindowRule(time.Hour, time.Minute, func() time.Time { return now }))
+		_ = engine.Register(group1, ReferenceRule(nil))
+		_ = engine.Register(group1, CausalOrderRule())
+		_ = engine.Register(group1, BodySchemaRule(func() interface{} { return &map[string]int{} }, nil))
+		_ = engine.Register(group2, PointerTargetRule(group1))
+		_ = engine.Register(group2, BodyTypeRule(AssetBodyTypeRaw, AssetBodyTypeMsgpack))
+		if err := engine.Validate(makeTx(ts, prevTx.TransactionID, prevAsset), resolver); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("rules run for the asset groups in the transaction", func(t *testing.T) {
+		engine := NewRuleEngine()
+		var ran []string
+		record := func(name string) ValidationRule {
+			return NewRule(name, func(ctx *ValidationContext) []Violation {
+				ran = append(ran, fmt.Sprintf("%s:%d:%d", name, len(ctx.Events()), len(ctx.Relations())))
+				return nil
+			})
+		}
+		_ = engine.RegisterGlobal(record("global"))
+		_ = engine.Register(group1, record("group1"))
+		_ = engine.Register(group2, record("group2"))
+		_ = engine.Register(GetIdentifier("validation_group3", defaultIDLength), record("group3"))
+		if err := engine.Validate(makeTx(ts, prevTx.TransactionID, prevAsset), nil); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(ran, ",") != "global:1:1,group1:1:0,group2:0:1" {
+			t.Fatalf("unexpected rules ran: %v", ran)
+		}
+	})
+
+	t.Run("violations", func(t *testing.T) {
+		engine := NewRuleEngine()
+		_ = engine.RegisterGlobal(TimestampWindowRule(time.Hour, time.Minute, func() time.Time { return now }))
+		_ = engine.Register(group1, BodyTypeRule(AssetBodyTypeJSON))
+		_ = engine.Register(group2, PointerTargetRule(group2))
+		err := engine.Validate(makeTx(ts+int64(time.Hour/time.Microsecond), prevTx.TransactionID, prevAsset), resolver)
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("ValidationError must be returned: %v", err)
+		}
+		expected := []struct {
+			rule, path string
+			group      []byte
+		}{
+			{RuleTimestampWindow, "timestamp", nil},
+			{RuleBodyType, "events[0].asset.asset_body_type", group1},
+			{RulePointerTarget, "relations[0].pointers[0]", group2},
+		}
+		if len(verr.Violations) != len(expected) {
+			t.Fatalf("unexpected violations: %v", err)
+		}
+		for i, e := range expected {
+			v := verr.Violations[i]
+			if v.Rule != e.rule || v.Path != e.path || !bytes.Equal(v.AssetGroupID, e.group) {
+				t.Fatalf("unexpected violation %d: %v", i, v)
+			}
+		}
+		t.Log(err)
+	})
+
+	t.Run("unresolvable targets", func(t *testing.T) {
+		engine := NewRuleEngine()
+		_ = engine.Register(group2, PointerTargetRule())
+		_ = engine.Register(group2, CausalOrderRule())
+		err := engine.Validate(makeTx(ts, unknown, prevAsset), resolver)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || len(verr.Violations) != 1 || verr.Violations[0].Path != "relations[0].pointers[0].transaction_id" {
+			t.Fatalf("unresolvable pointer must be reported: %v", err)
+		}
+
+		err = engine.Validate(makeTx(ts, prevTx.TransactionID, unknown), resolver)
+		if !errors.As(err, &verr) || len(verr.Violations) != 1 || verr.Violations[0].Path != "relations[0].pointers[0].asset_id" {
+			t.Fatalf("unknown asset must be reported: %v", err)
+		}
+
+		engine = NewRuleEngine()
+		_ = engine.Register(group1, ReferenceRule(nil))
+		err = engine.Validate(makeTx(ts, prevTx.TransactionID, prevAsset), nil)
+		if !errors.As(err, &verr) || !strings.Contains(verr.Violations[0].Message, ErrNoResolver.Error()) {
+			t.Fatalf("missing resolver must be reported: %v", err)
+		}
+	})
+
+	t.Run("causal order", func(t *testing.T) {
+		engine := NewRuleEngine()
+		_ = engine.Register(group1, CausalOrderRule())
+		err := engine.Validate(makeTx(ts-2000, prevTx.TransactionID, prevAsset), resolver)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || len(verr.Violations) != 1 || verr.Violations[0].Path != "references[0]" {
+			t.Fatalf("older transaction referring a newer one must be reported: %v", err)
+		}
+	})
+
+	t.Run("signatures", func(t *testing.T) {
+		engine := NewRuleEngine()
+		_ = engine.RegisterGlobal(SignatureRule(nil))
+		txobj := makeTx(ts, prevTx.TransactionID, prevAsset)
+		txobj.Timestamp++
+		err := engine.Validate(txobj, nil)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Violations[0].Path != "signatures[0]" {
+			t.Fatalf("invalid signature must be reported: %v", err)
+		}
+	})
+
+	t.Run("approvals and witnesses with public keys", func(t *testing.T) {
+		mallory, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+		keypair3, _ := GenerateKeypair(KeyTypeEcdsaP256v1, DefaultCompressionMode)
+		publicKeys := make(PublicKeyMap)
+		publicKeys.Add(txtest_u1, keypair.Pubkey)
+		publicKeys.Add(txtest_u3, keypair3.Pubkey)
+		engine := NewRuleEngine()
+		_ = engine.RegisterGlobal(SignatureRule(publicKeys.Resolve))
+		_ = engine.Register(group1, ReferenceRule(publicKeys.Resolve))
+		structural := NewRuleEngine()
+		_ = structural.RegisterGlobal(SignatureRule(nil))
+		_ = structural.Register(group1, ReferenceRule(nil))
+		if err := engine.Validate(prevTx, resolver); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Validate(makeTx(ts, prevTx.TransactionID, prevAsset), resolver); err != nil {
+			t.Fatal(err)
+		}
+
+		// mallory signs in the name of u1
+		spend := func(ref *BBcTransaction, signer []byte, key *KeyPair) *BBcTransaction {
+			txobj, err := NewTransactionBuilder(nil).
+				SetTimestamp(ts).
+				AddEvent(&group1, func(e *EventBuilder) {
+					e.AddReferenceIndex(0).AddMandatoryApprover(&txtest_u2).CreateAsset(&txtest_u2, nil, map[string]int{"amount": 10})
+				}).
+				CreateReference(&group1, ref, 0).
+				Sign(&signer, key, false).
+				BuildDraft()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return txobj
+		}
+		forged := spend(prevTx, txtest_u1, mallory)
+		if err := structural.Validate(forged, resolver); err != nil {
+			t.Fatalf("signatures must be valid by themselves: %v", err)
+		}
+		err := engine.Validate(forged, resolver)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || len(verr.Violations) != 1 || verr.Violations[0].Path != "references[0].sig_indices[0]" {
+			t.Fatalf("approval with a wrong key must be reported: %v", err)
+		}
+
+		unsigned := spend(prevTx, txtest_u2, keypair)
+		if err := structural.Validate(unsigned, resolver); !errors.As(err, &verr) || verr.Violations[len(verr.Violations)-1].Path != "references[0].sig_indices[0]" {
+			t.Fatalf("missing approval must be reported: %v", err)
+		}
+
+		witnessed, err := NewTransactionBuilder(nil).SetTimestamp(ts).AddRelation(&group2, nil).AddWitness(&txtest_u1).Sign(&txtest_u1, mallory, false).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := structural.Validate(witnessed, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Validate(witnessed, nil); !errors.As(err, &verr) || verr.Violations[0].Path != "witness.user_ids[0]" {
+			t.Fatalf("witness with a wrong key must be reported: %v", err)
+		}
+
+		// option approvers (1 of u1 and u3)
+		optionTx, err := NewTransactionBuilder(nil).
+			SetTimestamp(ts-1000).
+			AddEvent(&group1, func(e *EventBuilder) {
+				e.SetOptionParams(1, 2).AddOptionApprover(&txtest_u1).AddOptionApprover(&txtest_u3).CreateAsset(&txtest_u1, nil, map[string]int{"amount": 10})
+			}).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		store[string(optionTx.TransactionID)] = optionTx
+		if err := engine.Validate(spend(optionTx, txtest_u3, keypair3), resolver); err != nil {
+			t.Fatalf("approval by an option approver must be accepted: %v", err)
+		}
+		if err := engine.Validate(spend(optionTx, txtest_u3, mallory), resolver); !errors.As(err, &verr) || verr.Violations[0].Path != "references[0].sig_indices[0]" {
+			t.Fatalf("option approval with a wrong key must be reported: %v", err)
+		}
+	})
+
+	t.Run("registration errors", func(t *testing.T) {
+		engine := NewRuleEngine()
+		if engine.Register(nil, SignatureRule(nil)) == nil || engine.RegisterGlobal(nil) == nil {
+			t.Fatal("invalid registration must fail")
+		}
+		if engine.Validate(nil, nil) == nil {
+			t.Fatal("nil transaction must fail")
+		}
+	})
+}
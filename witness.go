@@ -98,10 +98,16 @@ func (p *BBcWitness) AddSignature(userID *[]byte, sig *BBcSignature) error {
 func (p *BBcWitness) Pack() ([]byte, error) {
 	buf := new(bytes.Buffer)
 
-	Put2byte(buf, uint16(len(p.UserIDs)))
+	if err := Put2byte(buf, uint16(len(p.UserIDs))); err != nil {
+		return nil, err
+	}
 	for i := 0; i < len(p.UserIDs); i++ {
-		PutBigInt(buf, &p.UserIDs[i], p.IdLengthConf.UserIdLength)
-		Put2byte(buf, uint16(p.SigIndices[i]))
+		if err := PutBigInt(buf, &p.UserIDs[i], p.IdLengthConf.UserIdLength); err != nil {
+			return nil, err
+		}
+		if err := Put2byte(buf, uint16(p.SigIndices[i])); err != nil {
+			return nil, err
+		}
 	}
 
 	return buf.Bytes(), nil
@@ -109,28 +115,72 @@ func (p *BBcWitness) Pack() ([]byte, error) {
 
 // Unpack the BBcWitness object to the binary data
 func (p *BBcWitness) Unpack(dat *[]byte) error {
+	if p.IdLengthConf == nil {
+		p.IdLengthConf = &BBcIdConfig{}
+	}
+
 	var err error
-	buf := bytes.NewBuffer(*dat)
+	d := newDecoder(*dat)
 
-	userNum, err := Get2byte(buf)
+	userNum, err := d.get2byte("user_ids")
 	if err != nil {
 		return err
 	}
 	for i := 0; i < int(userNum); i++ {
-		userID, ulen, err2 := GetBigInt(buf)
+		userID, ulen, err2 := d.getBigInt(fmt.Sprintf("user_ids[%d]", i))
 		if err2 != nil {
 			return err2
 		}
 		p.IdLengthConf.UserIdLength = ulen
 		p.UserIDs = append(p.UserIDs, userID)
 
-		idx, err2 := Get2byte(buf)
+		idx, err2 := d.get2byte(fmt.Sprintf("sig_indices[%d]", i))
 		if err2 != nil {
 			return err2
 		}
 		p.SigIndices = append(p.SigIndices, int(idx))
-		p.Transaction.SetSigIndex(userID, int(idx))
+		if p.Transaction != nil {
+			p.Transaction.SetSigIndex(userID, int(idx))
+		}
 	}
 
 	return nil
 }
+
+// Clone returns a deep copy of the BBcWitness object (the link to the parent transaction is kept as is)
+func (p *BBcWitness) Clone() *BBcWitness {
+	return p.clone(newCloneContext())
+}
+
+// clone returns a deep copy of the BBcWitness object, sharing the ID length configuration in the cloneContext
+func (p *BBcWitness) clone(c *cloneContext) *BBcWitness {
+	if p == nil {
+		return nil
+	}
+	obj := BBcWitness{
+		IdLengthConf: c.conf(p.IdLengthConf),
+		Version:      p.Version,
+		UserIDs:      cloneBytesList(p.UserIDs),
+		Transaction:  p.Transaction,
+	}
+	if p.SigIndices != nil {
+		obj.SigIndices = append([]int{}, p.SigIndices...)
+	}
+	return &obj
+}
+
+// Equal returns true if the BBcWitness objects have the same content to be packed
+func (p *BBcWitness) Equal(q *BBcWitness) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	if !equalBytesList(p.UserIDs, q.UserIDs) || len(p.SigIndices) != len(q.SigIndices) {
+		return false
+	}
+	for i := range p.SigIndices {
+		if p.SigIndices[i] != q.SigIndices[i] {
+			return false
+		}
+	}
+	return true
+}